@@ -0,0 +1,200 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+
+	// accessTokenPrefix tells personal access tokens apart from session
+	// tokens and makes them easy to find by secret scanners.
+	accessTokenPrefix = "todo_pat_"
+	// maxAccessTokens bounds the personal access tokens of one user.
+	maxAccessTokens = 50
+)
+
+var (
+	ErrInvalidScope         = errors.New("invalid scope")
+	ErrInsufficientScope    = errors.New("token lacks the required scope")
+	ErrEmptyTokenName       = errors.New("token name cannot be empty")
+	ErrAccessTokenNotFound  = errors.New("access token not found")
+	ErrTooManyAccessTokens  = errors.New("too many access tokens")
+	ErrAccessTokenExpiresAt = errors.New("access token expiry must be in the future")
+)
+
+var validScopes = map[string]bool{
+	ScopeTodosRead:  true,
+	ScopeTodosWrite: true,
+}
+
+// AccessToken describes a personal access token. The token itself is only
+// returned once, by CreateAccessToken. A zero ExpiresAt never expires and a
+// zero LastUsedAt means the token was never used.
+type AccessToken struct {
+	ID         string
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	ExpiresAt  time.Time
+	LastUsedAt time.Time
+}
+
+// Credentials describe how a request was authenticated: with a session
+// token, a personal access token (AccessTokenID) or an OAuth access token
+// (ClientID). Scopes are nil for session tokens, which may do anything their
+// user can.
+type Credentials struct {
+	UserID        string
+	AccessTokenID string
+	ClientID      string
+	Scopes        []string
+}
+
+// HasScope reports whether the credentials allow scope.
+func (c Credentials) HasScope(scope string) bool {
+	if c.Scopes == nil {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type accessToken struct {
+	AccessToken
+	userID string
+	hash   string
+}
+
+// CreateAccessToken issues a personal access token limited to scopes. Only
+// its hash is kept, so the returned token cannot be retrieved again.
+func (s *authService) CreateAccessToken(ctx context.Context, userID, name string, scopes []string, expiresAt time.Time) (string, AccessToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", AccessToken{}, ErrEmptyTokenName
+	}
+	if len(scopes) == 0 {
+		return "", AccessToken{}, ErrInvalidScope
+	}
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		if !validScopes[scope] {
+			return "", AccessToken{}, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		seen[scope] = true
+	}
+	now := time.Now()
+	if !expiresAt.IsZero() && !expiresAt.After(now) {
+		return "", AccessToken{}, ErrAccessTokenExpiresAt
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return "", AccessToken{}, err
+	}
+	token := accessTokenPrefix + secret
+
+	unique := make([]string, 0, len(seen))
+	for scope := range seen {
+		unique = append(unique, scope)
+	}
+	sort.Strings(unique)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.emailsByID[userID]; !exists {
+		return "", AccessToken{}, ErrUserNotFound
+	}
+	if len(s.accessTokensByUser[userID]) >= maxAccessTokens {
+		return "", AccessToken{}, ErrTooManyAccessTokens
+	}
+
+	s.accessTokenCounter++
+	t := &accessToken{
+		AccessToken: AccessToken{
+			ID:        fmt.Sprintf("pat_%d", s.accessTokenCounter),
+			Name:      name,
+			Scopes:    unique,
+			CreatedAt: now,
+			ExpiresAt: expiresAt,
+		},
+		userID: userID,
+		hash:   hashToken(token),
+	}
+	s.accessTokens[t.hash] = t
+	s.accessTokensByUser[userID] = append(s.accessTokensByUser[userID], t)
+
+	return token, t.AccessToken, nil
+}
+
+// ListAccessTokens returns the personal access tokens of the user, oldest
+// first, including expired ones.
+func (s *authService) ListAccessTokens(ctx context.Context, userID string) ([]AccessToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]AccessToken, 0, len(s.accessTokensByUser[userID]))
+	for _, t := range s.accessTokensByUser[userID] {
+		tokens = append(tokens, t.AccessToken)
+	}
+	return tokens, nil
+}
+
+// RevokeAccessToken deletes a personal access token of the user.
+func (s *authService) RevokeAccessToken(ctx context.Context, userID, tokenID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := s.accessTokensByUser[userID]
+	for i, t := range tokens {
+		if t.ID == tokenID {
+			delete(s.accessTokens, t.hash)
+			s.accessTokensByUser[userID] = append(tokens[:i:i], tokens[i+1:]...)
+			return nil
+		}
+	}
+	return ErrAccessTokenNotFound
+}
+
+// Authenticate resolves a session token, personal access token or OAuth
+// access token to the credentials of its user, recording when personal access
+// tokens are used.
+func (s *authService) Authenticate(ctx context.Context, token string) (Credentials, error) {
+	if strings.HasPrefix(token, oauthAccessTokenPrefix) {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		return s.authenticateOAuth(token)
+	}
+	if !strings.HasPrefix(token, accessTokenPrefix) {
+		s.mu.RLock()
+		userID, exists := s.tokens[hashToken(token)]
+		s.mu.RUnlock()
+
+		if !exists {
+			return Credentials{}, ErrInvalidToken
+		}
+		return Credentials{UserID: userID}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, exists := s.accessTokens[hashToken(token)]
+	now := time.Now()
+	if !exists || (!t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)) {
+		return Credentials{}, ErrInvalidToken
+	}
+	t.LastUsedAt = now
+	return Credentials{UserID: t.userID, AccessTokenID: t.ID, Scopes: t.Scopes}, nil
+}
@@ -0,0 +1,126 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost))
+	userID, _ := authSvc.Signup(ctx, "test@example.com", "password123")
+
+	if _, _, err := authSvc.CreateAccessToken(ctx, userID, "ci", []string{"admin"}, time.Time{}); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Expected ErrInvalidScope, got %v", err)
+	}
+	if _, _, err := authSvc.CreateAccessToken(ctx, userID, "ci", []string{ScopeTodosRead}, time.Now().Add(-time.Hour)); err != ErrAccessTokenExpiresAt {
+		t.Errorf("Expected ErrAccessTokenExpiresAt, got %v", err)
+	}
+
+	token, info, err := authSvc.CreateAccessToken(ctx, userID, "ci", []string{ScopeTodosWrite, ScopeTodosRead, ScopeTodosRead}, time.Time{})
+	if err != nil {
+		t.Fatalf("CreateAccessToken failed: %v", err)
+	}
+	if !strings.HasPrefix(token, accessTokenPrefix) || len(info.Scopes) != 2 {
+		t.Errorf("Unexpected token %q with scopes %v", token, info.Scopes)
+	}
+	if _, stored := authSvc.(*authService).accessTokens[hashToken(token)]; !stored {
+		t.Error("Expected the token to be stored by its hash")
+	}
+
+	credentials, err := authSvc.Authenticate(ctx, token)
+	if err != nil || credentials.UserID != userID || credentials.AccessTokenID != info.ID {
+		t.Fatalf("Authenticate: got %+v, %v", credentials, err)
+	}
+	if id, _ := authSvc.ValidateToken(ctx, token); id != userID {
+		t.Errorf("Expected ValidateToken to accept access tokens, got %q", id)
+	}
+	tokens, _ := authSvc.ListAccessTokens(ctx, userID)
+	if len(tokens) != 1 || tokens[0].LastUsedAt.IsZero() {
+		t.Errorf("Expected one used token, got %+v", tokens)
+	}
+
+	expiring, _, _ := authSvc.CreateAccessToken(ctx, userID, "short", []string{ScopeTodosRead}, time.Now().Add(time.Hour))
+	authSvc.(*authService).accessTokens[hashToken(expiring)].ExpiresAt = time.Now().Add(-time.Second)
+	if _, err := authSvc.Authenticate(ctx, expiring); err != ErrInvalidToken {
+		t.Errorf("Expected an expired token to be rejected, got %v", err)
+	}
+
+	if err := authSvc.RevokeAccessToken(ctx, "user_2", info.ID); err != ErrAccessTokenNotFound {
+		t.Errorf("Expected other users not to revoke the token, got %v", err)
+	}
+	if err := authSvc.RevokeAccessToken(ctx, userID, info.ID); err != nil {
+		t.Fatalf("RevokeAccessToken failed: %v", err)
+	}
+	if _, err := authSvc.Authenticate(ctx, token); err != ErrInvalidToken {
+		t.Errorf("Expected a revoked token to be rejected, got %v", err)
+	}
+}
+
+func TestAccessTokenScopes(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost))
+	userID, _ := authSvc.Signup(ctx, "test@example.com", "password123")
+	session, _ := authSvc.Login(ctx, "test@example.com", "password123")
+	readOnly, _, _ := authSvc.CreateAccessToken(ctx, userID, "reporting", []string{ScopeTodosRead}, time.Time{})
+
+	todoSvc := NewTodoService()
+	todoSvc.CreateTodo(ctx, userID, TodoInput{Text: "Existing"})
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(authSvc, todoSvc, NewEventBroker(16), nil)))
+	defer server.Close()
+
+	do := func(method, path, token, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, tc := range []struct {
+		method, path, token, body string
+		status                    int
+	}{
+		{"GET", "/v1/todos", readOnly, "", http.StatusOK},
+		{"GET", "/v1/lists", readOnly, "", http.StatusOK},
+		{"POST", "/v1/todos", readOnly, `{"text":"Nope"}`, http.StatusForbidden},
+		{"POST", "/v1/todos", session, `{"text":"Yes"}`, http.StatusOK},
+		{"GET", "/v1/todos?user_id=user_2", readOnly, "", http.StatusUnauthorized},
+		{"GET", "/v1/todos", "invalid", "", http.StatusUnauthorized},
+		{"GET", "/v1/todos?user_id=" + userID, "", "", http.StatusUnauthorized},
+		{"POST", "/v1/todos", "", `{"user_id":"` + userID + `","text":"Nope"}`, http.StatusUnauthorized},
+		{"DELETE", "/v1/todos/todo_1?user_id=" + userID, "", "", http.StatusUnauthorized},
+		{"GET", "/v1/lists?user_id=" + userID, "", "", http.StatusUnauthorized},
+		{"POST", "/v1/todos", session, `{"user_id":"user_2","text":"Nope"}`, http.StatusUnauthorized},
+		{"POST", "/graphql", readOnly, `{"query":"{ todos { total } }"}`, http.StatusOK},
+		{"GET", "/v1/tokens", readOnly, "", http.StatusForbidden},
+		{"POST", "/v1/tokens", readOnly, `{"name":"escalate","scopes":["todos:write"]}`, http.StatusForbidden},
+		{"POST", "/v1/mfa/enroll", readOnly, "", http.StatusForbidden},
+		{"GET", "/v1/tokens", session, "", http.StatusOK},
+	} {
+		if status := do(tc.method, tc.path, tc.token, tc.body); status != tc.status {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.status, status)
+		}
+	}
+
+	resp := makeGraphQLEndpoint(newGraphQLSchema(authSvc, todoSvc))
+	credentials, _ := authSvc.Authenticate(ctx, readOnly)
+	gqlCtx := context.WithValue(context.WithValue(ctx, userIDContextKey, userID), credentialsContextKey, credentials)
+	result, _ := resp(gqlCtx, graphqlRequest{Query: `mutation { createTodo(input: {text: "Nope"}) { id } }`})
+	if errs := result.(graphqlResponse).Errors; len(errs) != 1 || !errors.Is(errs[0], ErrInsufficientScope) {
+		t.Errorf("Expected GraphQL mutations to require todos:write, got %v", errs)
+	}
+}
@@ -0,0 +1,305 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+const (
+	PermissionViewUsers   = "users:view"
+	PermissionManageUsers = "users:manage"
+	PermissionManageRoles = "roles:manage"
+	PermissionViewTodos   = "todos:view_any"
+	PermissionViewAudit   = "audit:view"
+)
+
+// maxAdminActions bounds the audit trail; the oldest entries are dropped.
+const maxAdminActions = 10000
+
+var (
+	ErrInvalidRole     = errors.New("invalid role")
+	ErrForbidden       = errors.New("forbidden")
+	ErrAccountDisabled = errors.New("account disabled")
+	ErrAdminSelf       = errors.New("admins cannot disable or demote themselves")
+)
+
+// rolePermissions lists what each role may do beyond managing its own todos
+// and account.
+var rolePermissions = map[string]map[string]bool{
+	RoleUser: {},
+	RoleSupport: {
+		PermissionViewUsers: true,
+		PermissionViewTodos: true,
+	},
+	RoleAdmin: {
+		PermissionViewUsers:   true,
+		PermissionManageUsers: true,
+		PermissionManageRoles: true,
+		PermissionViewTodos:   true,
+		PermissionViewAudit:   true,
+	},
+}
+
+// HasPermission reports whether the role of the user grants permission.
+// Disabled users have no permissions.
+func (u User) HasPermission(permission string) bool {
+	return !u.Disabled && rolePermissions[u.Role][permission]
+}
+
+// UserQuery narrows ListUsers. Zero-valued fields match every user; Search
+// matches part of the email address, ignoring case.
+type UserQuery struct {
+	Search   string
+	Role     string
+	Disabled *bool
+}
+
+// AdminAction is an entry of the audit trail of administrative actions.
+type AdminAction struct {
+	ID       string
+	ActorID  string
+	Action   string
+	TargetID string
+	Detail   string
+	At       time.Time
+}
+
+// WithAdminEmails makes the accounts with these email addresses admins once
+// their address is verified, unless they were given another role. It is
+// meant to bootstrap the first admin.
+func WithAdminEmails(emails ...string) AuthOption {
+	return func(s *authService) {
+		for _, email := range emails {
+			if email = strings.TrimSpace(email); email != "" {
+				s.adminEmails[email] = true
+			}
+		}
+	}
+}
+
+// roleOf must be called with s.mu held.
+func (s *authService) roleOf(u user) string {
+	if u.Role != "" {
+		return u.Role
+	}
+	if u.Verified && s.adminEmails[u.Email] {
+		return RoleAdmin
+	}
+	return RoleUser
+}
+
+// publicUser must be called with s.mu held.
+func (s *authService) publicUser(u user) User {
+	return User{
+		ID:            u.ID,
+		Email:         u.Email,
+		EmailVerified: u.Verified,
+		MFAEnabled:    s.mfaEnabled(u.ID),
+		Role:          s.roleOf(u),
+		Disabled:      u.Disabled,
+		CreatedAt:     u.CreatedAt,
+	}
+}
+
+// ListUsers returns the users matching query, oldest first, with the total
+// number of matches.
+func (s *authService) ListUsers(ctx context.Context, query UserQuery, limit, offset int) ([]User, int, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	search := strings.ToLower(query.Search)
+
+	s.mu.RLock()
+	var users []User
+	for _, u := range s.users {
+		pu := s.publicUser(u)
+		if search != "" && !strings.Contains(strings.ToLower(pu.Email), search) {
+			continue
+		}
+		if query.Role != "" && pu.Role != query.Role {
+			continue
+		}
+		if query.Disabled != nil && pu.Disabled != *query.Disabled {
+			continue
+		}
+		users = append(users, pu)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(users, func(i, j int) bool {
+		if !users[i].CreatedAt.Equal(users[j].CreatedAt) {
+			return users[i].CreatedAt.Before(users[j].CreatedAt)
+		}
+		return users[i].ID < users[j].ID
+	})
+
+	total := len(users)
+	if offset >= total {
+		return []User{}, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return users[offset:end], total, nil
+}
+
+// SetRole changes the role of the user.
+func (s *authService) SetRole(ctx context.Context, userID, role string) error {
+	if _, valid := rolePermissions[role]; !valid {
+		return fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email, exists := s.emailsByID[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+	u := s.users[email]
+	u.Role = role
+	s.users[email] = u
+	return nil
+}
+
+// SetUserDisabled disables or enables the account. Disabling it signs the
+// user out everywhere: sessions, personal access tokens, OAuth grants and
+// pending two-factor challenges are revoked, and it cannot sign in again
+// until enabled.
+func (s *authService) SetUserDisabled(ctx context.Context, userID string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email, exists := s.emailsByID[userID]
+	if !exists {
+		return ErrUserNotFound
+	}
+	u := s.users[email]
+	u.Disabled = disabled
+	s.users[email] = u
+	if disabled {
+		s.revokeCredentials(userID)
+	}
+	return nil
+}
+
+// revokeCredentials revokes the sessions, personal access tokens, OAuth
+// grants and pending two-factor challenge of a user. It must be called with
+// s.mu held.
+func (s *authService) revokeCredentials(userID string) {
+	for token, id := range s.tokens {
+		if id == userID {
+			delete(s.tokens, token)
+		}
+	}
+	for _, t := range s.accessTokensByUser[userID] {
+		delete(s.accessTokens, t.hash)
+	}
+	delete(s.accessTokensByUser, userID)
+	for hash, code := range s.oauthCodes {
+		if code.userID == userID {
+			delete(s.oauthCodes, hash)
+		}
+	}
+	for _, token := range s.oauthTokens {
+		if token.grant.userID == userID {
+			s.revokeGrant(token.grant)
+		}
+	}
+	if state := s.mfa[userID]; state != nil {
+		delete(s.challenges, state.challenge)
+		state.challenge = ""
+	}
+}
+
+// ResetMFA turns off two-factor authentication for a user who lost their
+// authenticator and recovery codes.
+func (s *authService) ResetMFA(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.emailsByID[userID]; !exists {
+		return ErrUserNotFound
+	}
+	state := s.mfa[userID]
+	if state == nil {
+		return ErrMFANotEnabled
+	}
+	delete(s.challenges, state.challenge)
+	delete(s.mfa, userID)
+	return nil
+}
+
+// RecordAdminAction appends an entry to the audit trail.
+func (s *authService) RecordAdminAction(ctx context.Context, action AdminAction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.adminActionCounter++
+	action.ID = fmt.Sprintf("action_%d", s.adminActionCounter)
+	if action.At.IsZero() {
+		action.At = time.Now()
+	}
+	s.adminActions = append(s.adminActions, action)
+	if len(s.adminActions) > maxAdminActions {
+		s.adminActions = append([]AdminAction(nil), s.adminActions[len(s.adminActions)-maxAdminActions:]...)
+	}
+	return nil
+}
+
+// ListAdminActions returns the audit trail, newest first, optionally only
+// the actions on targetID.
+func (s *authService) ListAdminActions(ctx context.Context, targetID string, limit, offset int) ([]AdminAction, int, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var actions []AdminAction
+	for i := len(s.adminActions) - 1; i >= 0; i-- {
+		if targetID == "" || s.adminActions[i].TargetID == targetID {
+			actions = append(actions, s.adminActions[i])
+		}
+	}
+
+	total := len(actions)
+	if offset >= total {
+		return []AdminAction{}, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return actions[offset:end], total, nil
+}
+
+// ListSecurityEvents is served by the auditing middleware, which owns the
+// security audit log.
+func (s *authService) ListSecurityEvents(ctx context.Context, query SecurityEventQuery, limit, offset int) ([]SecurityEvent, int, error) {
+	return nil, 0, ErrAuditLogNotConfigured
+}
@@ -0,0 +1,344 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+// recordAdminAction adds an action of the authenticated user to the audit
+// trail.
+func recordAdminAction(ctx context.Context, svc AuthService, action, targetID, detail string) error {
+	actorID, _ := UserIDFromContext(ctx)
+	return svc.RecordAdminAction(ctx, AdminAction{ActorID: actorID, Action: action, TargetID: targetID, Detail: detail})
+}
+
+type listUsersRequest struct {
+	Query  UserQuery `json:"-"`
+	Limit  int       `json:"limit"`
+	Offset int       `json:"offset"`
+}
+
+type listUsersResponse struct {
+	Users  []User `json:"users,omitempty"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Err    string `json:"error,omitempty"`
+}
+
+func makeAdminListUsersEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listUsersRequest)
+		users, total, err := svc.ListUsers(ctx, req.Query, req.Limit, req.Offset)
+		if err != nil {
+			return listUsersResponse{Err: err.Error()}, nil
+		}
+		if err := recordAdminAction(ctx, svc, "list_users", "", fmt.Sprintf("q=%q role=%q", req.Query.Search, req.Query.Role)); err != nil {
+			return nil, err
+		}
+		return listUsersResponse{Users: users, Total: total, Limit: req.Limit, Offset: req.Offset}, nil
+	}
+}
+
+// adminUserRequest names the user an admin endpoint acts on.
+type adminUserRequest struct {
+	UserID string `json:"-"`
+}
+
+type adminUserResponse struct {
+	User *User  `json:"user,omitempty"`
+	Err  string `json:"error,omitempty"`
+}
+
+// adminUserResult records action on userID and responds with the user, or
+// with err if the action failed.
+func adminUserResult(ctx context.Context, svc AuthService, action, userID, detail string, err error) (interface{}, error) {
+	if err != nil {
+		return adminUserResponse{Err: err.Error()}, nil
+	}
+	if err := recordAdminAction(ctx, svc, action, userID, detail); err != nil {
+		return nil, err
+	}
+	u, err := svc.GetUser(ctx, userID)
+	if err != nil {
+		return adminUserResponse{Err: err.Error()}, nil
+	}
+	return adminUserResponse{User: &u}, nil
+}
+
+func makeAdminGetUserEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(adminUserRequest)
+		_, err := svc.GetUser(ctx, req.UserID)
+		return adminUserResult(ctx, svc, "get_user", req.UserID, "", err)
+	}
+}
+
+type setRoleRequest struct {
+	UserID string `json:"-"`
+	Role   string `json:"role"`
+}
+
+func makeAdminSetRoleEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(setRoleRequest)
+		var err error
+		if actorID, _ := UserIDFromContext(ctx); actorID == req.UserID && req.Role != RoleAdmin {
+			err = ErrAdminSelf
+		} else {
+			err = svc.SetRole(ctx, req.UserID, req.Role)
+		}
+		return adminUserResult(ctx, svc, "set_role", req.UserID, "role="+req.Role, err)
+	}
+}
+
+func makeAdminSetUserDisabledEndpoint(svc AuthService, disabled bool) endpoint.Endpoint {
+	action := "enable_user"
+	if disabled {
+		action = "disable_user"
+	}
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(adminUserRequest)
+		var err error
+		if actorID, _ := UserIDFromContext(ctx); actorID == req.UserID && disabled {
+			err = ErrAdminSelf
+		} else {
+			err = svc.SetUserDisabled(ctx, req.UserID, disabled)
+		}
+		return adminUserResult(ctx, svc, action, req.UserID, "", err)
+	}
+}
+
+func makeAdminResetMFAEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(adminUserRequest)
+		err := svc.ResetMFA(ctx, req.UserID)
+		return adminUserResult(ctx, svc, "reset_mfa", req.UserID, "", err)
+	}
+}
+
+func makeAdminUnlockUserEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(adminUserRequest)
+		u, err := svc.GetUser(ctx, req.UserID)
+		if err == nil {
+			err = svc.UnlockAccount(ctx, u.Email)
+		}
+		return adminUserResult(ctx, svc, "unlock_user", req.UserID, "", err)
+	}
+}
+
+// makeAdminListTodosEndpoint lists the todos of any user. Every view is
+// recorded in the audit trail before the todos are returned.
+func makeAdminListTodosEndpoint(authSvc AuthService, todoSvc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listTodosRequest)
+		if _, err := authSvc.GetUser(ctx, req.UserID); err != nil {
+			return listTodosResponse{Err: err.Error()}, nil
+		}
+		if err := recordAdminAction(ctx, authSvc, "view_todos", req.UserID, ""); err != nil {
+			return nil, err
+		}
+		todos, total, err := todoSvc.ListTodos(ctx, req.UserID, req.Filter, req.Limit, req.Offset)
+		if err != nil {
+			return listTodosResponse{Err: err.Error()}, nil
+		}
+		return listTodosResponse{Todos: todos, Total: total, Limit: req.Limit, Offset: req.Offset}, nil
+	}
+}
+
+type listAdminActionsRequest struct {
+	TargetID string `json:"target_id"`
+	Limit    int    `json:"limit"`
+	Offset   int    `json:"offset"`
+}
+
+type listAdminActionsResponse struct {
+	Actions []AdminAction `json:"actions,omitempty"`
+	Total   int           `json:"total"`
+	Limit   int           `json:"limit"`
+	Offset  int           `json:"offset"`
+	Err     string        `json:"error,omitempty"`
+}
+
+func makeAdminAuditEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listAdminActionsRequest)
+		actions, total, err := svc.ListAdminActions(ctx, req.TargetID, req.Limit, req.Offset)
+		if err != nil {
+			return listAdminActionsResponse{Err: err.Error()}, nil
+		}
+		return listAdminActionsResponse{Actions: actions, Total: total, Limit: req.Limit, Offset: req.Offset}, nil
+	}
+}
+
+type listSecurityEventsRequest struct {
+	Query  SecurityEventQuery `json:"-"`
+	Limit  int                `json:"limit"`
+	Offset int                `json:"offset"`
+}
+
+type listSecurityEventsResponse struct {
+	Events []SecurityEvent `json:"events,omitempty"`
+	Total  int             `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+	Err    string          `json:"error,omitempty"`
+}
+
+func makeAdminSecurityLogEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listSecurityEventsRequest)
+		events, total, err := svc.ListSecurityEvents(ctx, req.Query, req.Limit, req.Offset)
+		if err != nil {
+			return listSecurityEventsResponse{Err: err.Error()}, nil
+		}
+		return listSecurityEventsResponse{Events: events, Total: total, Limit: req.Limit, Offset: req.Offset}, nil
+	}
+}
+
+// pageParams reads the limit and offset query parameters, defaulting to the
+// first 50 results.
+func pageParams(r *http.Request) (limit, offset int) {
+	limit = 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil {
+		offset = o
+	}
+	return limit, offset
+}
+
+func decodeAdminListUsersRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	req := listUsersRequest{Query: UserQuery{Search: q.Get("q"), Role: q.Get("role")}}
+	if d := q.Get("disabled"); d != "" {
+		if parsed, err := strconv.ParseBool(d); err == nil {
+			req.Query.Disabled = &parsed
+		}
+	}
+	req.Limit, req.Offset = pageParams(r)
+	return req, nil
+}
+
+func decodeAdminUserRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return adminUserRequest{UserID: mux.Vars(r)["id"]}, nil
+}
+
+func decodeAdminSetRoleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req setRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.UserID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func decodeAdminListTodosRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeListTodosRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	listReq := req.(listTodosRequest)
+	listReq.UserID = mux.Vars(r)["id"]
+	return listReq, nil
+}
+
+func decodeAdminAuditRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	req := listAdminActionsRequest{TargetID: r.URL.Query().Get("target_id")}
+	req.Limit, req.Offset = pageParams(r)
+	return req, nil
+}
+
+var ErrInvalidTimeRange = errors.New("since and until must be RFC 3339 times")
+
+// parseTimeRange reads the optional since and until query parameters.
+func parseTimeRange(q url.Values, since, until *time.Time) error {
+	for _, bound := range []struct {
+		param string
+		t     *time.Time
+	}{{"since", since}, {"until", until}} {
+		if v := q.Get(bound.param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return ErrInvalidTimeRange
+			}
+			*bound.t = t
+		}
+	}
+	return nil
+}
+
+func decodeAdminSecurityLogRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	req := listSecurityEventsRequest{Query: SecurityEventQuery{UserID: q.Get("user_id"), Type: q.Get("type")}}
+	if err := parseTimeRange(q, &req.Query.Since, &req.Query.Until); err != nil {
+		return nil, err
+	}
+	req.Limit, req.Offset = pageParams(r)
+	return req, nil
+}
+
+// makeAdminHandler serves an admin endpoint, which all take the session
+// token from the Authorization header.
+func makeAdminHandler(e endpoint.Endpoint, dec httptransport.DecodeRequestFunc) http.Handler {
+	return httptransport.NewServer(
+		e,
+		dec,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeAdminListUsersHandler(endpoints Endpoints) http.Handler {
+	return makeAdminHandler(endpoints.AdminListUsersEndpoint, decodeAdminListUsersRequest)
+}
+
+func MakeAdminGetUserHandler(endpoints Endpoints) http.Handler {
+	return makeAdminHandler(endpoints.AdminGetUserEndpoint, decodeAdminUserRequest)
+}
+
+func MakeAdminSetRoleHandler(endpoints Endpoints) http.Handler {
+	return makeAdminHandler(endpoints.AdminSetRoleEndpoint, decodeAdminSetRoleRequest)
+}
+
+func MakeAdminDisableUserHandler(endpoints Endpoints) http.Handler {
+	return makeAdminHandler(endpoints.AdminDisableUserEndpoint, decodeAdminUserRequest)
+}
+
+func MakeAdminEnableUserHandler(endpoints Endpoints) http.Handler {
+	return makeAdminHandler(endpoints.AdminEnableUserEndpoint, decodeAdminUserRequest)
+}
+
+func MakeAdminResetMFAHandler(endpoints Endpoints) http.Handler {
+	return makeAdminHandler(endpoints.AdminResetMFAEndpoint, decodeAdminUserRequest)
+}
+
+func MakeAdminUnlockUserHandler(endpoints Endpoints) http.Handler {
+	return makeAdminHandler(endpoints.AdminUnlockUserEndpoint, decodeAdminUserRequest)
+}
+
+func MakeAdminListTodosHandler(endpoints Endpoints) http.Handler {
+	return makeAdminHandler(endpoints.AdminListTodosEndpoint, decodeAdminListTodosRequest)
+}
+
+func MakeAdminAuditHandler(endpoints Endpoints) http.Handler {
+	return makeAdminHandler(endpoints.AdminAuditEndpoint, decodeAdminAuditRequest)
+}
+
+func MakeAdminSecurityLogHandler(endpoints Endpoints) http.Handler {
+	return makeAdminHandler(endpoints.AdminSecurityLogEndpoint, decodeAdminSecurityLogRequest)
+}
@@ -0,0 +1,162 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAdminUserManagement(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost), WithAdminEmails("root@example.com"))
+	rootID, _ := authSvc.Signup(ctx, "root@example.com", "password123")
+	userID, _ := authSvc.Signup(ctx, "test@example.com", "password123")
+	authSvc.Signup(ctx, "other@example.com", "password123")
+
+	if u, _ := authSvc.GetUser(ctx, rootID); u.Role != RoleUser {
+		t.Errorf("Expected admin emails to need verification first, got %q", u.Role)
+	}
+	svc := authSvc.(*authService)
+	root := svc.users["root@example.com"]
+	root.Verified = true
+	svc.users["root@example.com"] = root
+	if u, _ := authSvc.GetUser(ctx, rootID); u.Role != RoleAdmin || !u.HasPermission(PermissionManageRoles) {
+		t.Errorf("Expected a verified admin email to make an admin, got %+v", u)
+	}
+
+	if err := authSvc.SetRole(ctx, userID, "superuser"); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("Expected ErrInvalidRole, got %v", err)
+	}
+	if err := authSvc.SetRole(ctx, userID, RoleSupport); err != nil {
+		t.Fatalf("SetRole failed: %v", err)
+	}
+	users, total, _ := authSvc.ListUsers(ctx, UserQuery{Role: RoleSupport}, 10, 0)
+	if total != 1 || users[0].ID != userID || users[0].HasPermission(PermissionManageUsers) {
+		t.Errorf("Expected one support user, got %+v", users)
+	}
+	users, total, _ = authSvc.ListUsers(ctx, UserQuery{Search: "EXAMPLE"}, 2, 0)
+	if total != 3 || len(users) != 2 || users[0].ID != rootID {
+		t.Errorf("Expected the first 2 of 3 users, got %d %+v", total, users)
+	}
+
+	session, _ := authSvc.Login(ctx, "test@example.com", "password123")
+	pat, _, _ := authSvc.CreateAccessToken(ctx, userID, "ci", []string{ScopeTodosRead}, time.Time{})
+	if err := authSvc.SetUserDisabled(ctx, userID, true); err != nil {
+		t.Fatalf("SetUserDisabled failed: %v", err)
+	}
+	for _, token := range []string{session, pat} {
+		if _, err := authSvc.Authenticate(ctx, token); err != ErrInvalidToken {
+			t.Errorf("Expected disabling to revoke %q, got %v", token, err)
+		}
+	}
+	if _, err := authSvc.Login(ctx, "test@example.com", "password123"); err != ErrAccountDisabled {
+		t.Errorf("Expected ErrAccountDisabled, got %v", err)
+	}
+	if u, _ := authSvc.GetUser(ctx, userID); u.HasPermission(PermissionViewUsers) {
+		t.Error("Expected disabled users to have no permissions")
+	}
+	authSvc.SetUserDisabled(ctx, userID, false)
+	if _, err := authSvc.Login(ctx, "test@example.com", "password123"); err != nil {
+		t.Errorf("Expected an enabled user to log in, got %v", err)
+	}
+
+	if err := authSvc.ResetMFA(ctx, userID); err != ErrMFANotEnabled {
+		t.Errorf("Expected ErrMFANotEnabled, got %v", err)
+	}
+	enrollment, _ := authSvc.EnrollMFA(ctx, userID)
+	secret, _ := base32NoPadding.DecodeString(enrollment.Secret)
+	authSvc.ConfirmMFA(ctx, userID, totp(secret, time.Now().Unix()/totpPeriod))
+	if err := authSvc.ResetMFA(ctx, userID); err != nil {
+		t.Fatalf("ResetMFA failed: %v", err)
+	}
+	if _, err := authSvc.Login(ctx, "test@example.com", "password123"); err != nil {
+		t.Errorf("Expected no second factor after a reset, got %v", err)
+	}
+}
+
+func TestAdminEndpoints(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost))
+	adminID, _ := authSvc.Signup(ctx, "admin@example.com", "password123")
+	supportID, _ := authSvc.Signup(ctx, "support@example.com", "password123")
+	userID, _ := authSvc.Signup(ctx, "test@example.com", "password123")
+	authSvc.SetRole(ctx, adminID, RoleAdmin)
+	authSvc.SetRole(ctx, supportID, RoleSupport)
+	adminSession, _ := authSvc.Login(ctx, "admin@example.com", "password123")
+	supportSession, _ := authSvc.Login(ctx, "support@example.com", "password123")
+	userSession, _ := authSvc.Login(ctx, "test@example.com", "password123")
+	adminPAT, _, _ := authSvc.CreateAccessToken(ctx, adminID, "ci", []string{ScopeTodosRead, ScopeTodosWrite}, time.Time{})
+
+	todoSvc := NewTodoService()
+	todoSvc.CreateTodo(ctx, userID, TodoInput{Text: "Private"})
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(authSvc, todoSvc, NewEventBroker(16), nil)))
+	defer server.Close()
+
+	do := func(method, path, token, body string) (int, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		result := make(map[string]interface{})
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	for _, tc := range []struct {
+		method, path, token, body string
+		status                    int
+	}{
+		{"GET", "/v1/admin/users", "", "", http.StatusUnauthorized},
+		{"GET", "/v1/admin/users", userSession, "", http.StatusForbidden},
+		{"GET", "/v1/admin/users", adminPAT, "", http.StatusForbidden},
+		{"GET", "/v1/admin/users", supportSession, "", http.StatusOK},
+		{"GET", "/v1/admin/users/" + userID + "/todos", supportSession, "", http.StatusOK},
+		{"POST", "/v1/admin/users/" + userID + "/disable", supportSession, "", http.StatusForbidden},
+		{"PUT", "/v1/admin/users/" + supportID + "/role", supportSession, `{"role":"admin"}`, http.StatusForbidden},
+		{"GET", "/v1/admin/audit", supportSession, "", http.StatusForbidden},
+		{"GET", "/v1/admin/audit", adminSession, "", http.StatusOK},
+	} {
+		if status, _ := do(tc.method, tc.path, tc.token, tc.body); status != tc.status {
+			t.Errorf("%s %s: expected %d, got %d", tc.method, tc.path, tc.status, status)
+		}
+	}
+
+	if _, body := do("GET", "/v1/admin/users/"+userID+"/todos", adminSession, ""); body["total"] != float64(1) {
+		t.Errorf("Expected the admin to see the user's todo, got %v", body)
+	}
+	if _, body := do("POST", "/v1/admin/users/"+adminID+"/disable", adminSession, ""); body["error"] != ErrAdminSelf.Error() {
+		t.Errorf("Expected admins not to disable themselves, got %v", body)
+	}
+	_, body := do("POST", "/v1/admin/users/"+userID+"/disable", adminSession, "")
+	if user, _ := body["user"].(map[string]interface{}); user == nil || user["Disabled"] != true {
+		t.Errorf("Expected the disabled user, got %v", body)
+	}
+	if status, _ := do("GET", "/v1/todos", userSession, ""); status != http.StatusUnauthorized {
+		t.Errorf("Expected the disabled user's session to be revoked, got %d", status)
+	}
+	if _, body := do("PUT", "/v1/admin/users/"+supportID+"/role", adminSession, `{"role":"user"}`); body["error"] != nil {
+		t.Errorf("Expected the role to change, got %v", body)
+	}
+	if status, _ := do("GET", "/v1/admin/users", supportSession, ""); status != http.StatusForbidden {
+		t.Errorf("Expected a demoted user to lose access immediately, got %d", status)
+	}
+
+	actions, total, _ := authSvc.ListAdminActions(ctx, userID, 10, 0)
+	if total != 3 || actions[0].Action != "disable_user" || actions[0].ActorID != adminID ||
+		actions[1].Action != "view_todos" || actions[2].ActorID != supportID {
+		t.Errorf("Unexpected audit trail %+v", actions)
+	}
+}
@@ -0,0 +1,52 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrInvalidAssignee = errors.New("assignee cannot edit the todo")
+
+// AssignTodo assigns a todo to assigneeID, or unassigns it if assigneeID is
+// empty. Editors of a todo may assign it to anyone else who can edit it;
+// the assignee may also unassign themselves.
+func (s *todoService) AssignTodo(ctx context.Context, userID, todoID, assigneeID string) (Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return Todo{}, ErrTodoNotFound
+	}
+
+	selfUnassign := assigneeID == "" && todo.AssigneeID == userID
+	if !selfUnassign && !canEdit(s.todoRole(todo, userID)) {
+		return Todo{}, ErrUnauthorized
+	}
+	if assigneeID != "" && !canEdit(s.todoRole(todo, assigneeID)) {
+		return Todo{}, ErrInvalidAssignee
+	}
+
+	todo.AssigneeID = assigneeID
+	s.storeTodo(todo)
+	if assigneeID == "" {
+		s.record(todo, userID, TodoUnassigned)
+	} else {
+		s.record(todo, userID, TodoAssigned)
+	}
+
+	return todo, nil
+}
+
+// unassignLostAccess unassigns the todos in listID whose assignee can no
+// longer edit them after a membership change by userID. It must be called
+// with s.mu held.
+func (s *todoService) unassignLostAccess(userID, listID string) {
+	for _, todo := range s.todosById {
+		if todo.ListID == listID && todo.AssigneeID != "" && !canEdit(s.todoRole(todo, todo.AssigneeID)) {
+			todo.AssigneeID = ""
+			s.storeTodo(todo)
+			s.record(todo, userID, TodoUnassigned)
+		}
+	}
+}
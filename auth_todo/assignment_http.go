@@ -0,0 +1,88 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+type assignTodoRequest struct {
+	TodoID     string `json:"-"`
+	AssigneeID string `json:"assignee_id"`
+}
+
+func makeAssignTodoEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(assignTodoRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		if req.AssigneeID == "" {
+			return updateTodoResponse{Err: ErrInvalidAssignee.Error()}, nil
+		}
+		todo, err := svc.AssignTodo(ctx, userID, req.TodoID, req.AssigneeID)
+		if err != nil {
+			return updateTodoResponse{Err: err.Error()}, nil
+		}
+		return updateTodoResponse{Todo: &todo}, nil
+	}
+}
+
+type unassignTodoRequest struct {
+	TodoID string `json:"-"`
+}
+
+func makeUnassignTodoEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(unassignTodoRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		todo, err := svc.AssignTodo(ctx, userID, req.TodoID, "")
+		if err != nil {
+			return updateTodoResponse{Err: err.Error()}, nil
+		}
+		return updateTodoResponse{Todo: &todo}, nil
+	}
+}
+
+func decodeAssignTodoRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req assignTodoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.TodoID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func decodeUnassignTodoRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return unassignTodoRequest{TodoID: mux.Vars(r)["id"]}, nil
+}
+
+func MakeAssignTodoHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.AssignTodoEndpoint,
+		decodeAssignTodoRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeUnassignTodoHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.UnassignTodoEndpoint,
+		decodeUnassignTodoRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
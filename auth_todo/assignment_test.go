@@ -0,0 +1,71 @@
+package auth_todo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAssignTodo(t *testing.T) {
+	ctx := context.Background()
+	broker := NewEventBroker(16)
+	svc := NewEventingTodoMiddleware(broker, NewCachedTodoService(time.Minute, NewTodoService()))
+	listID, _ := svc.CreateList(ctx, "owner", "Chores")
+	todoID, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "Vacuum", ListID: listID})
+	for email, role := range map[string]string{"editor@example.com": ListRoleEditor, "viewer@example.com": ListRoleViewer} {
+		inv, _ := svc.ShareList(ctx, "owner", listID, email, role)
+		svc.RespondToInvitation(ctx, email[:len(email)-len("@example.com")], email, inv.ID, true)
+	}
+
+	if _, err := svc.AssignTodo(ctx, "owner", todoID, "viewer"); err != ErrInvalidAssignee {
+		t.Errorf("Expected viewers not to be assignable, got %v", err)
+	}
+	if _, err := svc.AssignTodo(ctx, "viewer", todoID, "editor"); err != ErrUnauthorized {
+		t.Errorf("Expected viewers not to assign, got %v", err)
+	}
+
+	// Prime the editor's cached listing before the assignment.
+	if _, total, _ := svc.ListTodos(ctx, "editor", TodoFilter{AssignedToMe: true}, 10, 0); total != 0 {
+		t.Errorf("Expected nothing assigned yet, got %d", total)
+	}
+	editorSub, _, _ := broker.Subscribe("editor", 0)
+	defer editorSub.Close()
+	ownerSub, _, _ := broker.Subscribe("owner", 0)
+	defer ownerSub.Close()
+
+	todo, err := svc.AssignTodo(ctx, "owner", todoID, "editor")
+	if err != nil || todo.AssigneeID != "editor" {
+		t.Fatalf("AssignTodo failed: %+v %v", todo, err)
+	}
+	if event := <-editorSub.C; event.Type != TodoAssigned || event.Todo.AssigneeID != "editor" {
+		t.Errorf("Expected the assignee to be notified, got %+v", event)
+	}
+	if event := <-ownerSub.C; event.Type != TodoUpdated {
+		t.Errorf("Expected others to see an update, got %+v", event)
+	}
+	todos, total, _ := svc.ListTodos(ctx, "editor", TodoFilter{AssignedToMe: true}, 10, 0)
+	if total != 1 || todos[0].ID != todoID {
+		t.Errorf("Expected the assigned todo, got %+v", todos)
+	}
+	if _, total, _ := svc.ListTodos(ctx, "owner", TodoFilter{AssignedToMe: true}, 10, 0); total != 0 {
+		t.Errorf("Expected nothing assigned to the owner, got %d", total)
+	}
+
+	svc.SetMemberRole(ctx, "owner", listID, "editor", ListRoleViewer)
+	if todo, _ := svc.GetTodo(ctx, "owner", todoID); todo.AssigneeID != "" {
+		t.Errorf("Expected demoting the assignee to unassign the todo, got %q", todo.AssigneeID)
+	}
+	if _, total, _ := svc.ListTodos(ctx, "editor", TodoFilter{AssignedToMe: true}, 10, 0); total != 0 {
+		t.Errorf("Expected the demoted member's listing to be refreshed, got %d", total)
+	}
+
+	svc.SetMemberRole(ctx, "owner", listID, "editor", ListRoleEditor)
+	svc.AssignTodo(ctx, "owner", todoID, "editor")
+	<-editorSub.C
+	if _, err := svc.AssignTodo(ctx, "editor", todoID, ""); err != nil {
+		t.Errorf("Expected the assignee to unassign themselves, got %v", err)
+	}
+	if event := <-editorSub.C; event.Type != TodoUnassigned {
+		t.Errorf("Expected the previous assignee to be notified, got %+v", event)
+	}
+}
@@ -0,0 +1,262 @@
+package auth_todo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// maxAttachmentSize bounds single attachments, in bytes.
+	maxAttachmentSize = 10 << 20
+	// defaultAttachmentQuota bounds the total size of the attachments each
+	// user uploads, in bytes.
+	defaultAttachmentQuota = 100 << 20
+	// maxAttachmentNameLength bounds attachment file names, in bytes.
+	maxAttachmentNameLength = 255
+)
+
+var (
+	ErrAttachmentsNotConfigured = errors.New("attachments are not configured")
+	ErrAttachmentNotFound       = errors.New("attachment not found")
+	ErrAttachmentTooLarge       = fmt.Errorf("attachment cannot be larger than %d bytes", maxAttachmentSize)
+	ErrEmptyAttachment          = errors.New("attachment cannot be empty")
+	ErrAttachmentQuotaExceeded  = errors.New("attachment quota exceeded")
+)
+
+// Attachment is a file attached to a todo. UserID is the uploader, whose
+// quota it counts against, and ContentType is sniffed from its contents.
+type Attachment struct {
+	ID          string
+	TodoID      string
+	UserID      string
+	Name        string
+	ContentType string
+	Size        int64
+	CreatedAt   time.Time
+	blobKey     string
+}
+
+// WithAttachments stores the contents of attachments in store and limits
+// the total size of each user's uploads to quota bytes, or to 100 MB if
+// quota is not positive. Without it attachments are disabled.
+func WithAttachments(store BlobStore, quota int64) TodoOption {
+	return func(s *todoService) {
+		if quota <= 0 {
+			quota = defaultAttachmentQuota
+		}
+		s.blobs = store
+		s.attachmentQuota = quota
+	}
+}
+
+// attachmentName keeps the base name of an uploaded file, so that names
+// from clients that send a full path cannot point elsewhere on download.
+func attachmentName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "." || name == "/" || name == "" {
+		return "attachment"
+	}
+	if len(name) > maxAttachmentNameLength {
+		name = name[:maxAttachmentNameLength]
+	}
+	return name
+}
+
+// AddAttachment attaches the contents of r to a todo. Editors of a todo may
+// attach files to it.
+func (s *todoService) AddAttachment(ctx context.Context, userID, todoID, name string, r io.Reader) (Attachment, error) {
+	if s.blobs == nil {
+		return Attachment{}, ErrAttachmentsNotConfigured
+	}
+
+	s.mu.RLock()
+	todo, exists := s.todosById[todoID]
+	role := s.todoRole(todo, userID)
+	s.mu.RUnlock()
+	if !exists {
+		return Attachment{}, ErrTodoNotFound
+	}
+	if !canEdit(role) {
+		return Attachment{}, ErrUnauthorized
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, maxAttachmentSize+1))
+	if err != nil {
+		return Attachment{}, err
+	}
+	if len(data) == 0 {
+		return Attachment{}, ErrEmptyAttachment
+	}
+	if len(data) > maxAttachmentSize {
+		return Attachment{}, ErrAttachmentTooLarge
+	}
+	key, err := newSecret()
+	if err != nil {
+		return Attachment{}, err
+	}
+	attachment := Attachment{
+		TodoID:      todoID,
+		UserID:      userID,
+		Name:        attachmentName(name),
+		ContentType: http.DetectContentType(data),
+		Size:        int64(len(data)),
+		CreatedAt:   time.Now(),
+		blobKey:     key,
+	}
+
+	// Reserve the quota before uploading so that concurrent uploads cannot
+	// exceed it together.
+	s.mu.Lock()
+	if s.attachmentUsage[userID]+attachment.Size > s.attachmentQuota {
+		s.mu.Unlock()
+		return Attachment{}, ErrAttachmentQuotaExceeded
+	}
+	s.attachmentUsage[userID] += attachment.Size
+	s.mu.Unlock()
+
+	if err := s.blobs.Put(ctx, key, bytes.NewReader(data), attachment.Size, attachment.ContentType); err != nil {
+		s.mu.Lock()
+		s.attachmentUsage[userID] -= attachment.Size
+		s.mu.Unlock()
+		return Attachment{}, err
+	}
+
+	s.mu.Lock()
+	todo, exists = s.todosById[todoID]
+	if !exists || !canEdit(s.todoRole(todo, userID)) {
+		s.attachmentUsage[userID] -= attachment.Size
+		s.mu.Unlock()
+		s.blobs.Delete(ctx, key)
+		if !exists {
+			return Attachment{}, ErrTodoNotFound
+		}
+		return Attachment{}, ErrUnauthorized
+	}
+	s.attachmentCounter++
+	attachment.ID = fmt.Sprintf("attachment_%d", s.attachmentCounter)
+	s.attachments[todoID] = append(s.attachments[todoID], attachment)
+	s.mu.Unlock()
+	return attachment, nil
+}
+
+// ListAttachments returns the attachments of a todo, oldest first.
+func (s *todoService) ListAttachments(ctx context.Context, userID, todoID string) ([]Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return nil, ErrTodoNotFound
+	}
+	if s.todoRole(todo, userID) == "" {
+		return nil, ErrUnauthorized
+	}
+	return append([]Attachment{}, s.attachments[todoID]...), nil
+}
+
+// OpenAttachment returns an attachment with its contents, which the caller
+// must close.
+func (s *todoService) OpenAttachment(ctx context.Context, userID, todoID, attachmentID string) (Attachment, io.ReadCloser, error) {
+	if s.blobs == nil {
+		return Attachment{}, nil, ErrAttachmentsNotConfigured
+	}
+
+	s.mu.RLock()
+	attachment, err := s.findAttachment(userID, todoID, attachmentID)
+	s.mu.RUnlock()
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+
+	body, err := s.blobs.Get(ctx, attachment.blobKey)
+	if err == ErrBlobNotFound {
+		return Attachment{}, nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return Attachment{}, nil, err
+	}
+	return attachment, body, nil
+}
+
+// DeleteAttachment deletes an attachment. Its uploader and the editors of
+// the todo may delete it.
+func (s *todoService) DeleteAttachment(ctx context.Context, userID, todoID, attachmentID string) error {
+	s.mu.Lock()
+	attachment, err := s.findAttachment(userID, todoID, attachmentID)
+	if err == nil && attachment.UserID != userID && !canEdit(s.todoRole(s.todosById[todoID], userID)) {
+		err = ErrUnauthorized
+	}
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	attachments := s.attachments[todoID]
+	for i, a := range attachments {
+		if a.ID == attachmentID {
+			s.attachments[todoID] = append(attachments[:i:i], attachments[i+1:]...)
+			break
+		}
+	}
+	s.attachmentUsage[attachment.UserID] -= attachment.Size
+	s.mu.Unlock()
+
+	return s.blobs.Delete(ctx, attachment.blobKey)
+}
+
+// AttachmentUsage returns the total size of the attachments userID uploaded
+// and their quota, in bytes.
+func (s *todoService) AttachmentUsage(ctx context.Context, userID string) (used, quota int64, err error) {
+	if s.blobs == nil {
+		return 0, 0, ErrAttachmentsNotConfigured
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.attachmentUsage[userID], s.attachmentQuota, nil
+}
+
+// findAttachment returns an attachment of a todo userID can read. It must
+// be called with s.mu held.
+func (s *todoService) findAttachment(userID, todoID, attachmentID string) (Attachment, error) {
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return Attachment{}, ErrTodoNotFound
+	}
+	if s.todoRole(todo, userID) == "" {
+		return Attachment{}, ErrUnauthorized
+	}
+	for _, a := range s.attachments[todoID] {
+		if a.ID == attachmentID {
+			return a, nil
+		}
+	}
+	return Attachment{}, ErrAttachmentNotFound
+}
+
+// dropAttachments forgets the attachments of a deleted todo and returns the
+// keys of their blobs. It must be called with s.mu held.
+func (s *todoService) dropAttachments(todoID string) []string {
+	var keys []string
+	for _, a := range s.attachments[todoID] {
+		s.attachmentUsage[a.UserID] -= a.Size
+		keys = append(keys, a.blobKey)
+	}
+	delete(s.attachments, todoID)
+	return keys
+}
+
+// deleteBlobs deletes the blobs of the attachments of deleted todos. The
+// todos are gone already, so a failure only leaves an unreachable blob
+// behind and is not reported.
+func (s *todoService) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		s.blobs.Delete(ctx, key)
+	}
+}
@@ -0,0 +1,211 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+var ErrMissingAttachmentFile = errors.New(`multipart request must have a "file" part`)
+
+// addAttachmentRequest carries the file part of the multipart upload. The
+// part is read by the endpoint, while the request body is still open.
+type addAttachmentRequest struct {
+	TodoID string    `json:"-"`
+	Name   string    `json:"-"`
+	File   io.Reader `json:"-"`
+}
+
+type attachmentResponse struct {
+	Attachment *Attachment `json:"attachment,omitempty"`
+	Err        string      `json:"error,omitempty"`
+}
+
+func makeAddAttachmentEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(addAttachmentRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		attachment, err := svc.AddAttachment(ctx, userID, req.TodoID, req.Name, req.File)
+		if err != nil {
+			return attachmentResponse{Err: err.Error()}, nil
+		}
+		return attachmentResponse{Attachment: &attachment}, nil
+	}
+}
+
+type attachmentRequest struct {
+	TodoID       string `json:"-"`
+	AttachmentID string `json:"-"`
+}
+
+type listAttachmentsResponse struct {
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Err         string       `json:"error,omitempty"`
+}
+
+func makeListAttachmentsEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(attachmentRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		attachments, err := svc.ListAttachments(ctx, userID, req.TodoID)
+		if err != nil {
+			return listAttachmentsResponse{Err: err.Error()}, nil
+		}
+		return listAttachmentsResponse{Attachments: attachments}, nil
+	}
+}
+
+// downloadAttachmentResponse holds the open contents of an attachment,
+// which encodeDownloadAttachmentResponse streams and closes.
+type downloadAttachmentResponse struct {
+	Attachment Attachment    `json:"-"`
+	Body       io.ReadCloser `json:"-"`
+	Err        string        `json:"error,omitempty"`
+}
+
+func makeDownloadAttachmentEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(attachmentRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		attachment, body, err := svc.OpenAttachment(ctx, userID, req.TodoID, req.AttachmentID)
+		if err != nil {
+			return downloadAttachmentResponse{Err: err.Error()}, nil
+		}
+		return downloadAttachmentResponse{Attachment: attachment, Body: body}, nil
+	}
+}
+
+type deleteAttachmentResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeDeleteAttachmentEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(attachmentRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		if err := svc.DeleteAttachment(ctx, userID, req.TodoID, req.AttachmentID); err != nil {
+			return deleteAttachmentResponse{Err: err.Error()}, nil
+		}
+		return deleteAttachmentResponse{}, nil
+	}
+}
+
+type attachmentUsageResponse struct {
+	Used  int64  `json:"used"`
+	Quota int64  `json:"quota"`
+	Err   string `json:"error,omitempty"`
+}
+
+func makeAttachmentUsageEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		used, quota, err := svc.AttachmentUsage(ctx, userID)
+		if err != nil {
+			return attachmentUsageResponse{Err: err.Error()}, nil
+		}
+		return attachmentUsageResponse{Used: used, Quota: quota}, nil
+	}
+}
+
+// decodeAddAttachmentRequest finds the "file" part of a multipart upload
+// without buffering the request, skipping any parts before it.
+func decodeAddAttachmentRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, ErrMissingAttachmentFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "file" {
+			return addAttachmentRequest{TodoID: mux.Vars(r)["id"], Name: part.FileName(), File: part}, nil
+		}
+	}
+}
+
+func decodeAttachmentRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	return attachmentRequest{TodoID: vars["id"], AttachmentID: vars["attachment_id"]}, nil
+}
+
+// encodeDownloadAttachmentResponse streams the attachment as a download.
+// The sniffed content type is served with nosniff so that browsers never
+// render an upload as a page of this origin; failures are reported as JSON
+// like every other endpoint.
+func encodeDownloadAttachmentResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(downloadAttachmentResponse)
+	if resp.Err != "" {
+		return encodeResponse(ctx, w, resp)
+	}
+	defer resp.Body.Close()
+
+	w.Header().Set("Content-Type", resp.Attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(resp.Attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": resp.Attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("streaming attachment %s: %w", resp.Attachment.ID, err)
+	}
+	return nil
+}
+
+// makeAttachmentHandler serves an attachment endpoint, which all take the
+// token from the Authorization header.
+func makeAttachmentHandler(e endpoint.Endpoint, dec httptransport.DecodeRequestFunc, enc httptransport.EncodeResponseFunc) http.Handler {
+	return httptransport.NewServer(
+		e,
+		dec,
+		enc,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeAddAttachmentHandler(endpoints Endpoints) http.Handler {
+	return makeAttachmentHandler(endpoints.AddAttachmentEndpoint, decodeAddAttachmentRequest, encodeResponse)
+}
+
+func MakeListAttachmentsHandler(endpoints Endpoints) http.Handler {
+	return makeAttachmentHandler(endpoints.ListAttachmentsEndpoint, decodeAttachmentRequest, encodeResponse)
+}
+
+func MakeDownloadAttachmentHandler(endpoints Endpoints) http.Handler {
+	return makeAttachmentHandler(endpoints.DownloadAttachmentEndpoint, decodeAttachmentRequest, encodeDownloadAttachmentResponse)
+}
+
+func MakeDeleteAttachmentHandler(endpoints Endpoints) http.Handler {
+	return makeAttachmentHandler(endpoints.DeleteAttachmentEndpoint, decodeAttachmentRequest, encodeResponse)
+}
+
+func MakeAttachmentUsageHandler(endpoints Endpoints) http.Handler {
+	return makeAttachmentHandler(endpoints.AttachmentUsageEndpoint, decodeAttachmentRequest, encodeResponse)
+}
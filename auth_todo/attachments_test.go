@@ -0,0 +1,160 @@
+package auth_todo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAttachments(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewTodoService().AddAttachment(ctx, "owner", "todo_1", "a.txt", strings.NewReader("x")); err != ErrAttachmentsNotConfigured {
+		t.Errorf("Expected ErrAttachmentsNotConfigured, got %v", err)
+	}
+
+	store, _ := NewLocalBlobStore(t.TempDir())
+	svc := NewTodoService(WithAttachments(store, 64))
+	listID, _ := svc.CreateList(ctx, "owner", "Launch")
+	todoID, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "Write post", ListID: listID})
+	inv, _ := svc.ShareList(ctx, "owner", listID, "viewer@example.com", ListRoleViewer)
+	svc.RespondToInvitation(ctx, "viewer", "viewer@example.com", inv.ID, true)
+
+	if _, err := svc.AddAttachment(ctx, "viewer", todoID, "a.txt", strings.NewReader("x")); err != ErrUnauthorized {
+		t.Errorf("Expected viewers not to upload, got %v", err)
+	}
+	if _, err := svc.AddAttachment(ctx, "owner", todoID, "a.txt", strings.NewReader("")); err != ErrEmptyAttachment {
+		t.Errorf("Expected ErrEmptyAttachment, got %v", err)
+	}
+	if _, err := svc.AddAttachment(ctx, "owner", todoID, "a.bin", bytes.NewReader(make([]byte, maxAttachmentSize+1))); err != ErrAttachmentTooLarge {
+		t.Errorf("Expected ErrAttachmentTooLarge, got %v", err)
+	}
+
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 24)
+	image, err := svc.AddAttachment(ctx, "owner", todoID, `C:\Users\me\shot.txt`, strings.NewReader(png))
+	if err != nil {
+		t.Fatalf("AddAttachment failed: %v", err)
+	}
+	if image.Name != "shot.txt" || image.ContentType != "image/png" || image.Size != 32 {
+		t.Errorf("Expected a sniffed PNG named shot.txt, got %+v", image)
+	}
+	if _, err := svc.AddAttachment(ctx, "owner", todoID, "big.txt", strings.NewReader(strings.Repeat("a", 33))); err != ErrAttachmentQuotaExceeded {
+		t.Errorf("Expected ErrAttachmentQuotaExceeded, got %v", err)
+	}
+	notes, _ := svc.AddAttachment(ctx, "owner", todoID, "notes.txt", strings.NewReader("remember the milk"))
+	if used, quota, _ := svc.AttachmentUsage(ctx, "owner"); used != 49 || quota != 64 {
+		t.Errorf("Expected 49 of 64 bytes used, got %d of %d", used, quota)
+	}
+
+	attachment, body, err := svc.OpenAttachment(ctx, "viewer", todoID, notes.ID)
+	if err != nil {
+		t.Fatalf("Expected viewers to download, got %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "remember the milk" || attachment.ContentType != "text/plain; charset=utf-8" {
+		t.Errorf("Unexpected download %+v %q", attachment, data)
+	}
+	if _, _, err := svc.OpenAttachment(ctx, "stranger", todoID, notes.ID); err != ErrUnauthorized {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	if err := svc.DeleteAttachment(ctx, "viewer", todoID, notes.ID); err != ErrUnauthorized {
+		t.Errorf("Expected viewers not to delete, got %v", err)
+	}
+	if err := svc.DeleteAttachment(ctx, "owner", todoID, notes.ID); err != nil {
+		t.Errorf("DeleteAttachment failed: %v", err)
+	}
+	if attachments, _ := svc.ListAttachments(ctx, "viewer", todoID); len(attachments) != 1 || attachments[0].ID != image.ID {
+		t.Errorf("Expected only the image to remain, got %+v", attachments)
+	}
+
+	svc.DeleteTodo(ctx, "owner", todoID)
+	if used, _, _ := svc.AttachmentUsage(ctx, "owner"); used != 0 {
+		t.Errorf("Expected deleting the todo to release the quota, got %d", used)
+	}
+	if _, err := store.Get(ctx, image.blobKey); err != ErrBlobNotFound {
+		t.Errorf("Expected deleting the todo to delete its blobs, got %v", err)
+	}
+}
+
+func TestAttachmentEndpoints(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost))
+	authSvc.Signup(ctx, "owner@example.com", "password123")
+	session, _ := authSvc.Login(ctx, "owner@example.com", "password123")
+
+	store, _ := NewLocalBlobStore(t.TempDir())
+	broker := NewEventBroker(16)
+	todoSvc := NewEventingTodoMiddleware(broker, NewCachedTodoService(time.Minute, NewTodoService(WithAttachments(store, 0))))
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(authSvc, todoSvc, broker, nil)))
+	defer server.Close()
+
+	do := func(method, path, contentType string, body io.Reader) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, body)
+		req.Header.Set("Authorization", "Bearer "+session)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		return resp
+	}
+	decode := func(resp *http.Response) map[string]interface{} {
+		defer resp.Body.Close()
+		result := make(map[string]interface{})
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result
+	}
+
+	todoID := decode(do("POST", "/v1/todos", "", strings.NewReader(`{"text":"Publish"}`)))["todo_id"].(string)
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	mw.WriteField("comment", "skipped")
+	part, _ := mw.CreateFormFile("file", "page.html")
+	part.Write([]byte("<html><script>alert(1)</script></html>"))
+	mw.Close()
+	body := decode(do("POST", "/v1/todos/"+todoID+"/attachments", mw.FormDataContentType(), &form))
+	attachment, _ := body["attachment"].(map[string]interface{})
+	if attachment == nil || attachment["ContentType"] != "text/html; charset=utf-8" {
+		t.Fatalf("Expected a sniffed HTML attachment, got %v", body)
+	}
+	if _, leaked := attachment["blobKey"]; leaked {
+		t.Errorf("Expected the blob key to stay internal, got %v", attachment)
+	}
+	path := "/v1/todos/" + todoID + "/attachments/" + attachment["ID"].(string)
+
+	resp := do("GET", path, "", nil)
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "<html><script>alert(1)</script></html>" {
+		t.Errorf("Unexpected download %q", data)
+	}
+	if resp.Header.Get("X-Content-Type-Options") != "nosniff" || resp.Header.Get("Content-Disposition") != `attachment; filename=page.html` {
+		t.Errorf("Expected a nosniff download, got %v", resp.Header)
+	}
+
+	if body := decode(do("GET", "/v1/attachments/usage", "", nil)); body["used"] != float64(len(data)) || body["quota"] != float64(defaultAttachmentQuota) {
+		t.Errorf("Unexpected usage %v", body)
+	}
+	if body := decode(do("POST", "/v1/todos/"+todoID+"/attachments", "text/plain", strings.NewReader("x"))); body["error"] == nil {
+		t.Errorf("Expected non-multipart uploads to fail, got %v", body)
+	}
+	if body := decode(do("DELETE", path, "", nil)); body["error"] != nil {
+		t.Errorf("DELETE failed: %v", body)
+	}
+	if body := decode(do("GET", path, "", nil)); body["error"] != ErrAttachmentNotFound.Error() {
+		t.Errorf("Expected a JSON error for a deleted attachment, got %v", body)
+	}
+}
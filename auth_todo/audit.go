@@ -0,0 +1,587 @@
+package auth_todo
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+// Types of security events.
+const (
+	AuditSignup                 = "signup"
+	AuditLoginSucceeded         = "login_succeeded"
+	AuditLoginFailed            = "login_failed"
+	AuditLoginMFARequired       = "login_mfa_required"
+	AuditCredentialsVerified    = "credentials_verified"
+	AuditCredentialsRejected    = "credentials_rejected"
+	AuditTokenRejected          = "token_rejected"
+	AuditPasswordResetRequested = "password_reset_requested"
+	AuditPasswordResetFailed    = "password_reset_failed"
+	AuditPasswordChanged        = "password_changed"
+	AuditMFAEnabled             = "mfa_enabled"
+	AuditMFADisabled            = "mfa_disabled"
+	AuditAdminAction            = "admin_action"
+)
+
+const (
+	// defaultAuditLogSize is the size at which audit log files are rotated.
+	defaultAuditLogSize = 10 << 20
+	// defaultAuditLogBackups is the number of rotated files kept.
+	defaultAuditLogBackups = 5
+)
+
+var (
+	ErrAuditLogNotConfigured = errors.New("security audit log is not configured")
+	ErrAuditLogTampered      = errors.New("security audit log hash chain is broken")
+)
+
+// SecurityEvent is an entry of the security audit log. Seq numbers the
+// entries and Hash chains each to the one before: it is the SHA-256 of
+// PrevHash and the entry with an empty Hash, so altering, removing or
+// reordering entries breaks the chain.
+type SecurityEvent struct {
+	Seq      int64
+	Type     string
+	UserID   string `json:",omitempty"`
+	Email    string `json:",omitempty"`
+	IP       string `json:",omitempty"`
+	Detail   string `json:",omitempty"`
+	At       time.Time
+	PrevHash string
+	Hash     string
+}
+
+// SecurityEventQuery narrows ListSecurityEvents. Zero-valued fields match
+// every event; Since is inclusive and Until exclusive.
+type SecurityEventQuery struct {
+	UserID string
+	Type   string
+	Since  time.Time
+	Until  time.Time
+}
+
+func (q SecurityEventQuery) matches(e SecurityEvent) bool {
+	return (q.UserID == "" || e.UserID == q.UserID) &&
+		(q.Type == "" || e.Type == q.Type) &&
+		(q.Since.IsZero() || !e.At.Before(q.Since)) &&
+		(q.Until.IsZero() || e.At.Before(q.Until))
+}
+
+// AuditLogger is a tamper-evident sink for security events.
+type AuditLogger interface {
+	// Log fills in the sequence number, time and hashes of event and
+	// appends it.
+	Log(ctx context.Context, event SecurityEvent) error
+	// Query returns the events matching query, newest first, with their
+	// total number.
+	Query(ctx context.Context, query SecurityEventQuery, limit, offset int) (events []SecurityEvent, total int, err error)
+	// Verify checks the hash chain of the retained events.
+	Verify(ctx context.Context) error
+}
+
+// hashEvent returns the hash chaining event to the entry before it.
+func hashEvent(event SecurityEvent) (string, error) {
+	event.Hash = ""
+	data, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(append([]byte(event.PrevHash+"\n"), data...))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type fileAuditLogger struct {
+	mu sync.Mutex
+	// rotation is held for reading while the files are read and for
+	// writing while they are rotated, so that readers need not block Log.
+	rotation   sync.RWMutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	seq        int64
+	lastHash   string
+}
+
+// NewFileAuditLogger appends security events to path as JSON lines,
+// continuing the hash chain of the events already there. Once the file
+// would grow beyond maxSize bytes it is rotated to path.1, shifting older
+// files up to path.<maxBackups>; the oldest is deleted. The chain runs on
+// across files, so the first retained event anchors it after a deletion.
+// An unterminated last line, left by a crash while it was written, is cut
+// off. Non-positive sizes default to 10 MB and negative backups to 5.
+func NewFileAuditLogger(path string, maxSize int64, maxBackups int) (AuditLogger, error) {
+	if maxSize <= 0 {
+		maxSize = defaultAuditLogSize
+	}
+	if maxBackups < 0 {
+		maxBackups = defaultAuditLogBackups
+	}
+	l := &fileAuditLogger{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := trimTornLine(path); err != nil {
+		return nil, err
+	}
+
+	// Pick up the chain from the newest file with an event in it.
+	for _, name := range l.files() {
+		events, err := readAuditFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(events) > 0 {
+			last := events[len(events)-1]
+			l.seq, l.lastHash = last.Seq, last.Hash
+		}
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *fileAuditLogger) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
+
+// files returns the log files, oldest first.
+func (l *fileAuditLogger) files() []string {
+	var names []string
+	for i := l.maxBackups; i >= 1; i-- {
+		names = append(names, l.path+"."+strconv.Itoa(i))
+	}
+	return append(names, l.path)
+}
+
+// rotate must be called with l.mu held.
+func (l *fileAuditLogger) rotate() error {
+	l.rotation.Lock()
+	defer l.rotation.Unlock()
+
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	if l.maxBackups == 0 {
+		if err := os.Remove(l.path); err != nil {
+			return err
+		}
+		return l.open()
+	}
+	os.Remove(l.path + "." + strconv.Itoa(l.maxBackups))
+	for i := l.maxBackups - 1; i >= 1; i-- {
+		err := os.Rename(l.path+"."+strconv.Itoa(i), l.path+"."+strconv.Itoa(i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+func (l *fileAuditLogger) Log(ctx context.Context, event SecurityEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event.Seq = l.seq + 1
+	event.At = time.Now().UTC()
+	event.PrevHash = l.lastHash
+	hash, err := hashEvent(event)
+	if err != nil {
+		return err
+	}
+	event.Hash = hash
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return fmt.Errorf("rotating audit log: %w", err)
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err == nil {
+		err = l.file.Sync()
+	}
+	if err != nil {
+		return err
+	}
+	l.seq, l.lastHash = event.Seq, event.Hash
+	return nil
+}
+
+// readAll returns the retained events, oldest first. It holds off rotation
+// but not Log, whose event is left out while it is still being written.
+func (l *fileAuditLogger) readAll() ([]SecurityEvent, error) {
+	l.rotation.RLock()
+	defer l.rotation.RUnlock()
+
+	var all []SecurityEvent
+	for _, name := range l.files() {
+		events, err := readAuditFile(name)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, events...)
+	}
+	return all, nil
+}
+
+func (l *fileAuditLogger) Query(ctx context.Context, query SecurityEventQuery, limit, offset int) ([]SecurityEvent, int, error) {
+	all, err := l.readAll()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var events []SecurityEvent
+	for i := len(all) - 1; i >= 0; i-- {
+		if query.matches(all[i]) {
+			events = append(events, all[i])
+		}
+	}
+	start, end := page(len(events), limit, offset)
+	return events[start:end], len(events), nil
+}
+
+func (l *fileAuditLogger) Verify(ctx context.Context) error {
+	all, err := l.readAll()
+	if err != nil {
+		return err
+	}
+	return verifyAuditChain(all)
+}
+
+// verifyAuditChain checks that every event hashes to its Hash and links to
+// the event before it. The first event's PrevHash is trusted, as the files
+// before it may have been rotated away.
+func verifyAuditChain(events []SecurityEvent) error {
+	for i, e := range events {
+		hash, err := hashEvent(e)
+		if err != nil {
+			return err
+		}
+		if hash != e.Hash {
+			return fmt.Errorf("%w: event %d was altered", ErrAuditLogTampered, e.Seq)
+		}
+		if i > 0 && (e.PrevHash != events[i-1].Hash || e.Seq != events[i-1].Seq+1) {
+			return fmt.Errorf("%w: event %d does not follow event %d", ErrAuditLogTampered, e.Seq, events[i-1].Seq)
+		}
+	}
+	return nil
+}
+
+// trimTornLine truncates the file name after its last complete line.
+func trimTornLine(name string) error {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+		return os.Truncate(name, int64(end))
+	}
+	return nil
+}
+
+// readAuditFile returns the events of the complete lines of the file name.
+// A line without its newline is still being written, or was torn by a crash,
+// and is skipped; a complete line that is not an event fails the read.
+func readAuditFile(name string) ([]SecurityEvent, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+	var events []SecurityEvent
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e SecurityEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%w: unreadable entry in %s", ErrAuditLogTampered, name)
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+type auditSubjectContextKey struct{}
+
+// withAuditSubject returns a context through which the AuthService names
+// the user an operation turned out to be about, such as the owner of a
+// reset token, for the event the auditing middleware logs.
+func withAuditSubject(ctx context.Context) (context.Context, *string) {
+	subject := new(string)
+	return context.WithValue(ctx, auditSubjectContextKey{}, subject), subject
+}
+
+// setAuditSubject reports the user the current operation is about. It does
+// nothing outside the auditing middleware.
+func setAuditSubject(ctx context.Context, userID string) {
+	if subject, ok := ctx.Value(auditSubjectContextKey{}).(*string); ok {
+		*subject = userID
+	}
+}
+
+type auditingAuthMiddleware struct {
+	audit  AuditLogger
+	logger log.Logger
+	next   AuthService
+}
+
+// NewAuditingAuthMiddleware logs signups, logins, rejected tokens, password
+// resets, second factor changes and admin actions to audit, and serves
+// ListSecurityEvents from it. Failures to log are reported to logger; only
+// admin actions fail when they cannot be logged.
+func NewAuditingAuthMiddleware(audit AuditLogger, logger log.Logger, svc AuthService) AuthService {
+	return &auditingAuthMiddleware{audit: audit, logger: logger, next: svc}
+}
+
+func (mw *auditingAuthMiddleware) log(ctx context.Context, event SecurityEvent) error {
+	event.IP = ClientIPFromContext(ctx)
+	err := mw.audit.Log(ctx, event)
+	if err != nil {
+		mw.logger.Log("msg", "cannot write security audit log", "event", event.Type, "err", err)
+	}
+	return err
+}
+
+// logLogin logs the outcome of a login step that returns a session token.
+func (mw *auditingAuthMiddleware) logLogin(ctx context.Context, userID, email string, err error) {
+	event := SecurityEvent{Type: AuditLoginSucceeded, UserID: userID, Email: email}
+	switch {
+	case errors.Is(err, ErrMFARequired):
+		event.Type = AuditLoginMFARequired
+	case err != nil:
+		event.Type = AuditLoginFailed
+		event.Detail = err.Error()
+	}
+	mw.log(ctx, event)
+}
+
+func (mw *auditingAuthMiddleware) Signup(ctx context.Context, email, password string) (string, error) {
+	userID, err := mw.next.Signup(ctx, email, password)
+	if err == nil {
+		mw.log(ctx, SecurityEvent{Type: AuditSignup, UserID: userID, Email: email})
+	}
+	return userID, err
+}
+
+func (mw *auditingAuthMiddleware) Login(ctx context.Context, email, password string) (string, error) {
+	ctx, subject := withAuditSubject(ctx)
+	token, err := mw.next.Login(ctx, email, password)
+	mw.logLogin(ctx, *subject, email, err)
+	return token, err
+}
+
+// VerifyCredentials logs credential checks apart from logins, as they start
+// no session.
+func (mw *auditingAuthMiddleware) VerifyCredentials(ctx context.Context, email, password, code string) (string, error) {
+	ctx, subject := withAuditSubject(ctx)
+	userID, err := mw.next.VerifyCredentials(ctx, email, password, code)
+	event := SecurityEvent{Type: AuditCredentialsVerified, UserID: *subject, Email: email}
+	if err != nil {
+		event.Type, event.Detail = AuditCredentialsRejected, err.Error()
+	}
+	mw.log(ctx, event)
+	return userID, err
+}
+
+func (mw *auditingAuthMiddleware) ValidateToken(ctx context.Context, token string) (string, error) {
+	userID, err := mw.next.ValidateToken(ctx, token)
+	if err != nil {
+		mw.log(ctx, SecurityEvent{Type: AuditTokenRejected, Detail: err.Error()})
+	}
+	return userID, err
+}
+
+func (mw *auditingAuthMiddleware) GetUser(ctx context.Context, userID string) (User, error) {
+	return mw.next.GetUser(ctx, userID)
+}
+
+func (mw *auditingAuthMiddleware) UnlockAccount(ctx context.Context, email string) error {
+	return mw.next.UnlockAccount(ctx, email)
+}
+
+func (mw *auditingAuthMiddleware) RequestPasswordReset(ctx context.Context, email string) error {
+	err := mw.next.RequestPasswordReset(ctx, email)
+	if err == nil {
+		mw.log(ctx, SecurityEvent{Type: AuditPasswordResetRequested, Email: email})
+	}
+	return err
+}
+
+func (mw *auditingAuthMiddleware) ResetPassword(ctx context.Context, token, newPassword string) error {
+	ctx, subject := withAuditSubject(ctx)
+	err := mw.next.ResetPassword(ctx, token, newPassword)
+	event := SecurityEvent{Type: AuditPasswordChanged, UserID: *subject}
+	if err != nil {
+		event.Type, event.Detail = AuditPasswordResetFailed, err.Error()
+	}
+	mw.log(ctx, event)
+	return err
+}
+
+func (mw *auditingAuthMiddleware) VerifyEmail(ctx context.Context, token string) error {
+	return mw.next.VerifyEmail(ctx, token)
+}
+
+func (mw *auditingAuthMiddleware) ResendVerification(ctx context.Context, email string) error {
+	return mw.next.ResendVerification(ctx, email)
+}
+
+func (mw *auditingAuthMiddleware) EnrollMFA(ctx context.Context, userID string) (MFAEnrollment, error) {
+	return mw.next.EnrollMFA(ctx, userID)
+}
+
+func (mw *auditingAuthMiddleware) ConfirmMFA(ctx context.Context, userID, code string) ([]string, error) {
+	recoveryCodes, err := mw.next.ConfirmMFA(ctx, userID, code)
+	if err == nil {
+		mw.log(ctx, SecurityEvent{Type: AuditMFAEnabled, UserID: userID})
+	}
+	return recoveryCodes, err
+}
+
+func (mw *auditingAuthMiddleware) CompleteMFALogin(ctx context.Context, challengeToken, code string) (string, error) {
+	ctx, subject := withAuditSubject(ctx)
+	token, err := mw.next.CompleteMFALogin(ctx, challengeToken, code)
+	mw.logLogin(ctx, *subject, "", err)
+	return token, err
+}
+
+func (mw *auditingAuthMiddleware) DisableMFA(ctx context.Context, userID, password string) error {
+	err := mw.next.DisableMFA(ctx, userID, password)
+	if err == nil {
+		mw.log(ctx, SecurityEvent{Type: AuditMFADisabled, UserID: userID})
+	}
+	return err
+}
+
+func (mw *auditingAuthMiddleware) Authenticate(ctx context.Context, token string) (Credentials, error) {
+	credentials, err := mw.next.Authenticate(ctx, token)
+	if err != nil {
+		mw.log(ctx, SecurityEvent{Type: AuditTokenRejected, Detail: err.Error()})
+	}
+	return credentials, err
+}
+
+func (mw *auditingAuthMiddleware) CreateAccessToken(ctx context.Context, userID, name string, scopes []string, expiresAt time.Time) (string, AccessToken, error) {
+	return mw.next.CreateAccessToken(ctx, userID, name, scopes, expiresAt)
+}
+
+func (mw *auditingAuthMiddleware) ListAccessTokens(ctx context.Context, userID string) ([]AccessToken, error) {
+	return mw.next.ListAccessTokens(ctx, userID)
+}
+
+func (mw *auditingAuthMiddleware) RevokeAccessToken(ctx context.Context, userID, tokenID string) error {
+	return mw.next.RevokeAccessToken(ctx, userID, tokenID)
+}
+
+func (mw *auditingAuthMiddleware) RegisterOAuthClient(ctx context.Context, ownerID, name string, redirectURIs []string, confidential bool) (OAuthClient, string, error) {
+	return mw.next.RegisterOAuthClient(ctx, ownerID, name, redirectURIs, confidential)
+}
+
+func (mw *auditingAuthMiddleware) ValidateOAuthAuthorization(ctx context.Context, req OAuthAuthorizationRequest) (OAuthClient, error) {
+	return mw.next.ValidateOAuthAuthorization(ctx, req)
+}
+
+func (mw *auditingAuthMiddleware) AuthorizeOAuth(ctx context.Context, userID string, req OAuthAuthorizationRequest) (string, error) {
+	return mw.next.AuthorizeOAuth(ctx, userID, req)
+}
+
+func (mw *auditingAuthMiddleware) ExchangeOAuthToken(ctx context.Context, req OAuthTokenRequest) (OAuthToken, error) {
+	return mw.next.ExchangeOAuthToken(ctx, req)
+}
+
+func (mw *auditingAuthMiddleware) IntrospectOAuthToken(ctx context.Context, clientID, clientSecret, token string) (OAuthIntrospection, error) {
+	return mw.next.IntrospectOAuthToken(ctx, clientID, clientSecret, token)
+}
+
+func (mw *auditingAuthMiddleware) RevokeOAuthToken(ctx context.Context, clientID, clientSecret, token string) error {
+	return mw.next.RevokeOAuthToken(ctx, clientID, clientSecret, token)
+}
+
+func (mw *auditingAuthMiddleware) BeginOIDCLogin(ctx context.Context) (OIDCAuthorization, error) {
+	return mw.next.BeginOIDCLogin(ctx)
+}
+
+func (mw *auditingAuthMiddleware) CompleteOIDCLogin(ctx context.Context, state, code string) (string, error) {
+	ctx, subject := withAuditSubject(ctx)
+	token, err := mw.next.CompleteOIDCLogin(ctx, state, code)
+	mw.logLogin(ctx, *subject, "", err)
+	return token, err
+}
+
+func (mw *auditingAuthMiddleware) ListUsers(ctx context.Context, query UserQuery, limit, offset int) ([]User, int, error) {
+	return mw.next.ListUsers(ctx, query, limit, offset)
+}
+
+func (mw *auditingAuthMiddleware) SetRole(ctx context.Context, userID, role string) error {
+	return mw.next.SetRole(ctx, userID, role)
+}
+
+func (mw *auditingAuthMiddleware) SetUserDisabled(ctx context.Context, userID string, disabled bool) error {
+	return mw.next.SetUserDisabled(ctx, userID, disabled)
+}
+
+func (mw *auditingAuthMiddleware) ResetMFA(ctx context.Context, userID string) error {
+	return mw.next.ResetMFA(ctx, userID)
+}
+
+// RecordAdminAction logs the action before recording it, so that admin
+// actions the security log misses are refused.
+func (mw *auditingAuthMiddleware) RecordAdminAction(ctx context.Context, action AdminAction) error {
+	detail := action.Action
+	if action.TargetID != "" {
+		detail += " " + action.TargetID
+	}
+	if action.Detail != "" {
+		detail += ": " + action.Detail
+	}
+	if err := mw.log(ctx, SecurityEvent{Type: AuditAdminAction, UserID: action.ActorID, Detail: detail}); err != nil {
+		return err
+	}
+	return mw.next.RecordAdminAction(ctx, action)
+}
+
+func (mw *auditingAuthMiddleware) ListAdminActions(ctx context.Context, targetID string, limit, offset int) ([]AdminAction, int, error) {
+	return mw.next.ListAdminActions(ctx, targetID, limit, offset)
+}
+
+func (mw *auditingAuthMiddleware) ListSecurityEvents(ctx context.Context, query SecurityEventQuery, limit, offset int) ([]SecurityEvent, int, error) {
+	return mw.audit.Query(ctx, query, limit, offset)
+}
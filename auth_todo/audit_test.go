@@ -0,0 +1,183 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestFileAuditLogger(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := NewFileAuditLogger(path, 600, 2)
+	if err != nil {
+		t.Fatalf("NewFileAuditLogger failed: %v", err)
+	}
+	for i := 0; i < 4; i++ {
+		audit.Log(ctx, SecurityEvent{Type: AuditLoginFailed, Email: "test@example.com", Detail: "invalid credentials"})
+	}
+
+	// Reopening continues the chain.
+	audit, _ = NewFileAuditLogger(path, 600, 2)
+	audit.Log(ctx, SecurityEvent{Type: AuditLoginSucceeded, UserID: "user_1"})
+	if err := audit.Verify(ctx); err != nil {
+		t.Fatalf("Expected a valid chain, got %v", err)
+	}
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Errorf("Expected the log to be rotated, got %v", err)
+	}
+
+	events, total, _ := audit.Query(ctx, SecurityEventQuery{}, 100, 0)
+	if total < 3 || events[0].Seq != 5 || events[0].Type != AuditLoginSucceeded {
+		t.Fatalf("Expected the retained events newest first, got %d %+v", total, events)
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i-1].PrevHash != events[i].Hash {
+			t.Errorf("Expected event %d to chain to event %d", events[i-1].Seq, events[i].Seq)
+		}
+	}
+	if _, total, _ := audit.Query(ctx, SecurityEventQuery{UserID: "user_1"}, 10, 0); total != 1 {
+		t.Errorf("Expected one event for user_1, got %d", total)
+	}
+	if _, total, _ := audit.Query(ctx, SecurityEventQuery{Type: AuditLoginFailed, Until: events[0].At}, 10, 0); total != len(events)-1 {
+		t.Errorf("Expected the failures before the success, got %d", total)
+	}
+	if _, total, _ := audit.Query(ctx, SecurityEventQuery{Since: time.Now().Add(time.Minute)}, 10, 0); total != 0 {
+		t.Errorf("Expected no events in the future, got %d", total)
+	}
+
+	data, _ := os.ReadFile(path)
+	tampered := strings.Replace(string(data), `"UserID":"user_1"`, `"UserID":"user_2"`, 1)
+	os.WriteFile(path, []byte(tampered), 0o600)
+	if err := audit.Verify(ctx); !errors.Is(err, ErrAuditLogTampered) {
+		t.Errorf("Expected an altered event to be detected, got %v", err)
+	}
+
+	os.WriteFile(path, data, 0o600)
+	oldest := path + ".2"
+	if _, err := os.Stat(oldest); err != nil {
+		oldest = path + ".1"
+	}
+	backup, _ := os.ReadFile(oldest)
+	lines := strings.SplitAfter(strings.TrimSuffix(string(backup), "\n"), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("Expected at least two events in %s", oldest)
+	}
+	os.WriteFile(oldest, []byte(strings.Join(lines[1:], "")+"\n"), 0o600)
+	if err := audit.Verify(ctx); err != nil {
+		t.Errorf("Expected the oldest retained event to anchor the chain, got %v", err)
+	}
+	os.WriteFile(oldest, backup, 0o600)
+	os.WriteFile(oldest, []byte(strings.Join(lines[:len(lines)-1], "")), 0o600)
+	if err := audit.Verify(ctx); !errors.Is(err, ErrAuditLogTampered) {
+		t.Errorf("Expected a removed event to be detected, got %v", err)
+	}
+}
+
+func TestFileAuditLoggerTornLine(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	audit, _ := NewFileAuditLogger(path, 0, 0)
+	audit.Log(ctx, SecurityEvent{Type: AuditLoginSucceeded, UserID: "user_1"})
+	audit.Log(ctx, SecurityEvent{Type: AuditLoginFailed, Email: "test@example.com"})
+
+	// A crash in the middle of a write leaves half a line behind.
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	f.WriteString(`{"Seq":3,"Type":"login_fa`)
+	f.Close()
+	audit, err := NewFileAuditLogger(path, 0, 0)
+	if err != nil {
+		t.Fatalf("Expected a torn last line to be dropped, got %v", err)
+	}
+	audit.Log(ctx, SecurityEvent{Type: AuditLoginSucceeded, UserID: "user_1"})
+	if err := audit.Verify(ctx); err != nil {
+		t.Fatalf("Expected a valid chain, got %v", err)
+	}
+	if events, total, _ := audit.Query(ctx, SecurityEventQuery{}, 10, 0); total != 3 || events[0].Seq != 3 {
+		t.Errorf("Expected three events, got %d %+v", total, events)
+	}
+
+	f, _ = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	f.WriteString("{\"Seq\":4,\"Type\":\"login_fa\n")
+	f.Close()
+	if _, err := NewFileAuditLogger(path, 0, 0); !errors.Is(err, ErrAuditLogTampered) {
+		t.Errorf("Expected a corrupt complete line to be rejected, got %v", err)
+	}
+}
+
+func TestAuditingAuthMiddleware(t *testing.T) {
+	ctx := context.Background()
+	audit, _ := NewFileAuditLogger(filepath.Join(t.TempDir(), "audit.log"), 0, 0)
+	outbox := make(channelMailer, 4)
+	base := NewAuthService(WithPasswordCost(bcrypt.MinCost), WithMailer(outbox, "https://todo.example.com"))
+	authSvc := NewAuditingAuthMiddleware(audit, log.NewNopLogger(), base)
+
+	if _, _, err := base.ListSecurityEvents(ctx, SecurityEventQuery{}, 10, 0); err != ErrAuditLogNotConfigured {
+		t.Errorf("Expected ErrAuditLogNotConfigured, got %v", err)
+	}
+
+	userID, _ := authSvc.Signup(ctx, "test@example.com", "password123")
+	receiveToken(t, outbox, "Verify your email address")
+	authSvc.Login(ctx, "test@example.com", "wrong")
+	authSvc.Login(ctx, "nobody@example.com", "wrong")
+	session, _ := authSvc.Login(ctx, "test@example.com", "password123")
+	authSvc.Authenticate(ctx, "forged")
+	authSvc.RequestPasswordReset(ctx, "test@example.com")
+	authSvc.ResetPassword(ctx, receiveToken(t, outbox, "Reset your password"), "newpassword")
+	authSvc.SetRole(ctx, userID, RoleAdmin)
+	authSvc.RecordAdminAction(ctx, AdminAction{ActorID: userID, Action: "set_role", TargetID: "user_9", Detail: "support"})
+
+	events, _, err := authSvc.ListSecurityEvents(ctx, SecurityEventQuery{}, 100, 0)
+	if err != nil {
+		t.Fatalf("ListSecurityEvents failed: %v", err)
+	}
+	var got []string
+	for i := len(events) - 1; i >= 0; i-- {
+		got = append(got, events[i].Type+" "+events[i].UserID)
+	}
+	want := []string{
+		AuditSignup + " " + userID,
+		AuditLoginFailed + " " + userID,
+		AuditLoginFailed + " ",
+		AuditLoginSucceeded + " " + userID,
+		AuditTokenRejected + " ",
+		AuditPasswordResetRequested + " ",
+		AuditPasswordChanged + " " + userID,
+		AuditAdminAction + " " + userID,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Unexpected events:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if events[0].Detail != "set_role user_9: support" || strings.Contains(events[3].Detail, "forged") {
+		t.Errorf("Unexpected details %q and %q", events[0].Detail, events[3].Detail)
+	}
+	if session == "" {
+		t.Fatal("Login failed")
+	}
+
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(authSvc, NewTodoService(), NewEventBroker(16), nil)))
+	defer server.Close()
+	adminSession, _ := authSvc.Login(ctx, "test@example.com", "newpassword")
+	req, _ := http.NewRequest("GET", server.URL+"/v1/admin/security-events?type=login_failed&user_id="+userID, nil)
+	req.Header.Set("Authorization", "Bearer "+adminSession)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var body listSecurityEventsResponse
+	json.NewDecoder(resp.Body).Decode(&body)
+	if body.Total != 1 || body.Events[0].Email != "test@example.com" {
+		t.Errorf("Expected the failed login of the admin, got %+v", body)
+	}
+}
@@ -0,0 +1,256 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// maxBlockers bounds how many todos a todo may be blocked by.
+const maxBlockers = 50
+
+var (
+	ErrDependencyCycle    = errors.New("dependency would create a cycle")
+	ErrDependencyNotFound = errors.New("todo is not blocked by that todo")
+	ErrTooManyBlockers    = errors.New("todo cannot be blocked by more than 50 todos")
+	ErrTodoBlocked        = errors.New("todo is blocked by open todos")
+)
+
+// WithBlockedCompletion lets todos be completed while todos blocking them
+// are still open. By default completing them fails with ErrTodoBlocked.
+func WithBlockedCompletion() TodoOption {
+	return func(s *todoService) {
+		s.blockedCompletion = true
+	}
+}
+
+// canComplete reports whether todo may be completed. It must be called with
+// s.mu held.
+func (s *todoService) canComplete(todo Todo) bool {
+	return s.blockedCompletion || !todo.Blocked
+}
+
+// hasOpenBlockers must be called with s.mu held.
+func (s *todoService) hasOpenBlockers(todo Todo) bool {
+	for _, id := range todo.BlockedBy {
+		if !s.todosById[id].Completed {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshBlocked updates whether a todo has open blockers after one of them
+// changed. It must be called with s.mu held.
+func (s *todoService) refreshBlocked(todoID string) {
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return
+	}
+	if blocked := s.hasOpenBlockers(todo); blocked != todo.Blocked {
+		todo.Blocked = blocked
+		s.storeTodo(todo)
+	}
+}
+
+// dependsOn reports whether todoID is blocked by targetID, directly or
+// through other todos. It must be called with s.mu held.
+func (s *todoService) dependsOn(todoID, targetID string) bool {
+	seen := map[string]bool{}
+	stack := []string{todoID}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == targetID {
+			return true
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		stack = append(stack, s.todosById[id].BlockedBy...)
+	}
+	return false
+}
+
+// without returns a copy of values without value, leaving values untouched
+// for the history entries that share it.
+func without(values []string, value string) []string {
+	out := []string{}
+	for _, v := range values {
+		if v != value {
+			out = append(out, v)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// AddBlocker records that a todo cannot be done before blockerID. Editors
+// of a todo may block it by any todo they can read, unless the blocker
+// already depends on it.
+func (s *todoService) AddBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error) {
+	if todoID == blockerID {
+		return Todo{}, ErrDependencyCycle
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return Todo{}, ErrTodoNotFound
+	}
+	if !canEdit(s.todoRole(todo, userID)) {
+		return Todo{}, ErrUnauthorized
+	}
+	blocker, exists := s.todosById[blockerID]
+	if !exists {
+		return Todo{}, ErrTodoNotFound
+	}
+	if s.todoRole(blocker, userID) == "" {
+		return Todo{}, ErrUnauthorized
+	}
+	if containsString(todo.BlockedBy, blockerID) {
+		return todo, nil
+	}
+	if len(todo.BlockedBy) >= maxBlockers {
+		return Todo{}, ErrTooManyBlockers
+	}
+	if s.dependsOn(blockerID, todoID) {
+		return Todo{}, ErrDependencyCycle
+	}
+
+	blocker.Blocking = append(append([]string(nil), blocker.Blocking...), todoID)
+	s.storeTodo(blocker)
+	todo.BlockedBy = append(append([]string(nil), todo.BlockedBy...), blockerID)
+	todo.Blocked = s.hasOpenBlockers(todo)
+	s.storeTodo(todo)
+	s.record(todo, userID, TodoUpdated)
+
+	return todo, nil
+}
+
+// RemoveBlocker removes a dependency added with AddBlocker. Editors of the
+// blocked todo may remove it.
+func (s *todoService) RemoveBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return Todo{}, ErrTodoNotFound
+	}
+	if !canEdit(s.todoRole(todo, userID)) {
+		return Todo{}, ErrUnauthorized
+	}
+	if !containsString(todo.BlockedBy, blockerID) {
+		return Todo{}, ErrDependencyNotFound
+	}
+
+	if blocker, exists := s.todosById[blockerID]; exists {
+		blocker.Blocking = without(blocker.Blocking, todoID)
+		s.storeTodo(blocker)
+	}
+	todo.BlockedBy = without(todo.BlockedBy, blockerID)
+	todo.Blocked = s.hasOpenBlockers(todo)
+	s.storeTodo(todo)
+	s.record(todo, userID, TodoUpdated)
+
+	return todo, nil
+}
+
+// dropDependencies removes a deleted todo from the todos it blocked and was
+// blocked by. It must be called with s.mu held.
+func (s *todoService) dropDependencies(todo Todo) {
+	for _, id := range todo.BlockedBy {
+		if blocker, exists := s.todosById[id]; exists {
+			blocker.Blocking = without(blocker.Blocking, todo.ID)
+			s.storeTodo(blocker)
+		}
+	}
+	for _, id := range todo.Blocking {
+		if dependent, exists := s.todosById[id]; exists {
+			dependent.BlockedBy = without(dependent.BlockedBy, todo.ID)
+			dependent.Blocked = s.hasOpenBlockers(dependent)
+			s.storeTodo(dependent)
+		}
+	}
+}
+
+// ListNextTodos returns the open todos userID can read in an order they can
+// be done in: every todo comes after the todos blocking it, and otherwise
+// in manual order. Todos that wait on open todos the user cannot read are
+// listed last, in manual order.
+func (s *todoService) ListNextTodos(ctx context.Context, userID string, limit, offset int) ([]Todo, int, error) {
+	s.mu.RLock()
+	readable := map[string]Todo{}
+	for _, t := range s.todosById {
+		if !t.Completed && s.todoRole(t, userID) != "" {
+			readable[t.ID] = t
+		}
+	}
+	// Kahn's algorithm over the readable open todos, taking the todo with
+	// the lowest rank among those whose blockers are all done. waiting
+	// counts the open readable blockers of each todo; hidden marks the todos
+	// with open blockers the user cannot read, which never become ready.
+	waiting := map[string]int{}
+	hidden := map[string]bool{}
+	for _, t := range readable {
+		for _, id := range t.BlockedBy {
+			if _, open := readable[id]; open {
+				waiting[t.ID]++
+			} else if !s.todosById[id].Completed {
+				hidden[t.ID] = true
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	var ready []Todo
+	for _, t := range readable {
+		if waiting[t.ID] == 0 && !hidden[t.ID] {
+			ready = append(ready, t)
+		}
+	}
+	sortByRank(ready)
+
+	ordered := make([]Todo, 0, len(readable))
+	for len(ready) > 0 {
+		next := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, next)
+		for _, id := range next.Blocking {
+			dependent, open := readable[id]
+			if !open {
+				continue
+			}
+			waiting[id]--
+			if waiting[id] == 0 && !hidden[id] {
+				i := sort.Search(len(ready), func(i int) bool {
+					return ready[i].Rank > dependent.Rank
+				})
+				ready = append(ready[:i], append([]Todo{dependent}, ready[i:]...)...)
+			}
+		}
+	}
+	if len(ordered) < len(readable) {
+		seen := make(map[string]bool, len(ordered))
+		for _, t := range ordered {
+			seen[t.ID] = true
+		}
+		var rest []Todo
+		for _, t := range readable {
+			if !seen[t.ID] {
+				rest = append(rest, t)
+			}
+		}
+		sortByRank(rest)
+		ordered = append(ordered, rest...)
+	}
+
+	start, end := page(len(ordered), limit, offset)
+	return ordered[start:end], len(ordered), nil
+}
@@ -0,0 +1,119 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+type blockerRequest struct {
+	TodoID    string `json:"-"`
+	BlockerID string `json:"blocker_id"`
+}
+
+func makeAddBlockerEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(blockerRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		todo, err := svc.AddBlocker(ctx, userID, req.TodoID, req.BlockerID)
+		if err != nil {
+			return updateTodoResponse{Err: err.Error()}, nil
+		}
+		return updateTodoResponse{Todo: &todo}, nil
+	}
+}
+
+func makeRemoveBlockerEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(blockerRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		todo, err := svc.RemoveBlocker(ctx, userID, req.TodoID, req.BlockerID)
+		if err != nil {
+			return updateTodoResponse{Err: err.Error()}, nil
+		}
+		return updateTodoResponse{Todo: &todo}, nil
+	}
+}
+
+type listNextTodosRequest struct {
+	Limit  int
+	Offset int
+}
+
+func makeListNextTodosEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listNextTodosRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		todos, total, err := svc.ListNextTodos(ctx, userID, req.Limit, req.Offset)
+		if err != nil {
+			return listTodosResponse{Err: err.Error()}, nil
+		}
+		return listTodosResponse{Todos: todos, Total: total, Limit: req.Limit, Offset: req.Offset}, nil
+	}
+}
+
+func decodeAddBlockerRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req blockerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.TodoID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func decodeRemoveBlockerRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	return blockerRequest{TodoID: vars["id"], BlockerID: vars["blocker_id"]}, nil
+}
+
+func decodeListNextTodosRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req listNextTodosRequest
+	req.Limit, req.Offset = pageParams(r)
+	return req, nil
+}
+
+func MakeAddBlockerHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.AddBlockerEndpoint,
+		decodeAddBlockerRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeRemoveBlockerHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.RemoveBlockerEndpoint,
+		decodeRemoveBlockerRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeListNextTodosHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.ListNextTodosEndpoint,
+		decodeListNextTodosRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
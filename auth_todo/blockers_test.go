@@ -0,0 +1,125 @@
+package auth_todo
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDependencies(t *testing.T) {
+	ctx := context.Background()
+	svc := NewCachedTodoService(time.Minute, NewTodoService())
+	listID, _ := svc.CreateList(ctx, "owner", "Release")
+	ids := map[string]string{}
+	for _, text := range []string{"design", "build", "test", "ship", "docs"} {
+		ids[text], _ = svc.CreateTodo(ctx, "owner", TodoInput{Text: text, ListID: listID})
+	}
+	private, _ := svc.CreateTodo(ctx, "stranger", TodoInput{Text: "secret"})
+
+	if _, err := svc.AddBlocker(ctx, "owner", ids["build"], private); err != ErrUnauthorized {
+		t.Errorf("Expected blockers to be readable, got %v", err)
+	}
+	if _, err := svc.AddBlocker(ctx, "owner", ids["build"], ids["build"]); err != ErrDependencyCycle {
+		t.Errorf("Expected a todo not to block itself, got %v", err)
+	}
+	svc.AddBlocker(ctx, "owner", ids["build"], ids["design"])
+	svc.AddBlocker(ctx, "owner", ids["test"], ids["build"])
+	svc.AddBlocker(ctx, "owner", ids["ship"], ids["test"])
+	todo, err := svc.AddBlocker(ctx, "owner", ids["ship"], ids["docs"])
+	if err != nil || !todo.Blocked || !reflect.DeepEqual(todo.BlockedBy, []string{ids["test"], ids["docs"]}) {
+		t.Fatalf("AddBlocker failed: %+v %v", todo, err)
+	}
+	if _, err := svc.AddBlocker(ctx, "owner", ids["design"], ids["ship"]); err != ErrDependencyCycle {
+		t.Errorf("Expected a cycle through four todos to be rejected, got %v", err)
+	}
+	if design, _ := svc.GetTodo(ctx, "owner", ids["design"]); design.Blocked || !reflect.DeepEqual(design.Blocking, []string{ids["build"]}) {
+		t.Errorf("Expected design to block build, got %+v", design)
+	}
+
+	next := func() string {
+		t.Helper()
+		todos, _, err := svc.ListNextTodos(ctx, "owner", 10, 0)
+		if err != nil {
+			t.Fatalf("ListNextTodos failed: %v", err)
+		}
+		var texts []string
+		for _, todo := range todos {
+			texts = append(texts, todo.Text)
+		}
+		return strings.Join(texts, " ")
+	}
+	if got := next(); got != "design build test docs ship" {
+		t.Errorf("Expected blockers before the todos they block, got %q", got)
+	}
+
+	if err := svc.CompleteTodo(ctx, "owner", ids["build"]); err != ErrTodoBlocked {
+		t.Errorf("Expected blocked todos not to be completed, got %v", err)
+	}
+	if _, err := svc.TransitionTodo(ctx, "owner", ids["build"], "done"); err != ErrTodoBlocked {
+		t.Errorf("Expected blocked todos not to reach the terminal status, got %v", err)
+	}
+	// Prime the cached listing before the blocker is completed.
+	svc.ListTodos(ctx, "owner", TodoFilter{}, 10, 0)
+	svc.CompleteTodo(ctx, "owner", ids["design"])
+	if todos, _, _ := svc.ListTodos(ctx, "owner", TodoFilter{}, 10, 0); todos[3].Text != "build" || todos[3].Blocked {
+		t.Errorf("Expected build to be unblocked in the listing, got %+v", todos[3])
+	}
+	if got := next(); got != "build test docs ship" {
+		t.Errorf("Expected completed todos to be left out, got %q", got)
+	}
+
+	todo, err = svc.RemoveBlocker(ctx, "owner", ids["ship"], ids["docs"])
+	if err != nil || !reflect.DeepEqual(todo.BlockedBy, []string{ids["test"]}) {
+		t.Errorf("RemoveBlocker failed: %+v %v", todo, err)
+	}
+	if _, err := svc.RemoveBlocker(ctx, "owner", ids["ship"], ids["docs"]); err != ErrDependencyNotFound {
+		t.Errorf("Expected ErrDependencyNotFound, got %v", err)
+	}
+	svc.DeleteTodo(ctx, "owner", ids["test"])
+	if ship, _ := svc.GetTodo(ctx, "owner", ids["ship"]); ship.Blocked || len(ship.BlockedBy) != 0 {
+		t.Errorf("Expected deleting the blocker to unblock ship, got %+v", ship)
+	}
+	if build, _ := svc.GetTodo(ctx, "owner", ids["build"]); len(build.Blocking) != 0 {
+		t.Errorf("Expected the deleted todo to be dropped from build, got %+v", build)
+	}
+}
+
+func TestBlockedCompletion(t *testing.T) {
+	ctx := context.Background()
+	svc := NewTodoService(WithBlockedCompletion())
+	blocker, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "first"})
+	blocked, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "second"})
+	svc.AddBlocker(ctx, "owner", blocked, blocker)
+
+	if err := svc.CompleteTodo(ctx, "owner", blocked); err != nil {
+		t.Errorf("Expected blocked todos to be completed, got %v", err)
+	}
+	svc.CompleteTodo(ctx, "owner", blocker)
+	svc.TransitionTodo(ctx, "owner", blocker, "todo")
+	if todo, _ := svc.GetTodo(ctx, "owner", blocked); !todo.Blocked || !todo.Completed {
+		t.Errorf("Expected reopening the blocker to block the todo again, got %+v", todo)
+	}
+}
+
+func TestRevertBlockedTodo(t *testing.T) {
+	ctx := context.Background()
+	svc := NewTodoService()
+	todoID, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "ship"})
+	blocker, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "test"})
+	svc.CompleteTodo(ctx, "owner", todoID)
+	svc.RevertTodo(ctx, "owner", todoID, 1)
+	svc.AddBlocker(ctx, "owner", todoID, blocker)
+
+	// Reverting to the completed version must not bypass the blocker.
+	if _, err := svc.RevertTodo(ctx, "owner", todoID, 2); err != ErrTodoBlocked {
+		t.Errorf("Expected ErrTodoBlocked, got %v", err)
+	}
+	if todo, _ := svc.GetTodo(ctx, "owner", todoID); todo.Completed {
+		t.Errorf("Expected the todo to stay open, got %+v", todo)
+	}
+	if _, err := svc.RevertTodo(ctx, "owner", todoID, 1); err != nil {
+		t.Errorf("Expected open versions to be restored, got %v", err)
+	}
+}
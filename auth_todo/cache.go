@@ -3,6 +3,8 @@ package auth_todo
 import (
 	"context"
 	"fmt"
+	"io"
+	"strings"
 	"sync"
 	"time"
 )
@@ -48,25 +50,56 @@ func (s *cachedTodoService) cleanupExpired() {
 	}
 }
 
-func (s *cachedTodoService) CreateTodo(ctx context.Context, userID, text string) (string, error) {
-	todoID, err := s.next.CreateTodo(ctx, userID, text)
-	if err != nil {
-		return "", err
-	}
-
+// invalidate drops every cached listing of the users.
+func (s *cachedTodoService) invalidate(userIDs ...string) {
 	s.mu.Lock()
-	for key := range s.cache {
-		if len(key) > len(userID) && key[:len(userID)] == userID {
-			delete(s.cache, key)
+	for _, userID := range userIDs {
+		prefix := userID + ":"
+		for key := range s.cache {
+			if strings.HasPrefix(key, prefix) {
+				delete(s.cache, key)
+			}
 		}
 	}
 	s.mu.Unlock()
+}
+
+// invalidateTodos drops the cached listings of everyone who sees the todos.
+func (s *cachedTodoService) invalidateTodos(ctx context.Context, userID string, todos ...Todo) {
+	s.invalidate(todoAudience(ctx, s.next, userID, todos...)...)
+}
+
+// withDependents adds the todos blocked by todos that userID can read,
+// which are unblocked or blocked again when todos are completed, reopened
+// or deleted.
+func (s *cachedTodoService) withDependents(ctx context.Context, userID string, todos ...Todo) []Todo {
+	for _, todo := range todos {
+		for _, id := range todo.Blocking {
+			if dependent, err := s.next.GetTodo(ctx, userID, id); err == nil {
+				todos = append(todos, dependent)
+			}
+		}
+	}
+	return todos
+}
+
+func (s *cachedTodoService) CreateTodo(ctx context.Context, userID string, input TodoInput) (string, error) {
+	todoID, err := s.next.CreateTodo(ctx, userID, input)
+	if err != nil {
+		return "", err
+	}
+
+	s.invalidateTodos(ctx, userID, Todo{UserID: userID, ListID: input.ListID})
 
 	return todoID, nil
 }
 
-func (s *cachedTodoService) ListTodos(ctx context.Context, userID string, limit, offset int) ([]Todo, int, error) {
-	cacheKey := fmt.Sprintf("%s:%d:%d", userID, limit, offset)
+func (s *cachedTodoService) GetTodo(ctx context.Context, userID, todoID string) (Todo, error) {
+	return s.next.GetTodo(ctx, userID, todoID)
+}
+
+func (s *cachedTodoService) ListTodos(ctx context.Context, userID string, filter TodoFilter, limit, offset int) ([]Todo, int, error) {
+	cacheKey := fmt.Sprintf("%s:%d:%d:%s", userID, limit, offset, filter.key())
 
 	s.mu.RLock()
 	entry, exists := s.cache[cacheKey]
@@ -76,7 +109,7 @@ func (s *cachedTodoService) ListTodos(ctx context.Context, userID string, limit,
 		return entry.todos, entry.total, nil
 	}
 
-	todos, total, err := s.next.ListTodos(ctx, userID, limit, offset)
+	todos, total, err := s.next.ListTodos(ctx, userID, filter, limit, offset)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -98,13 +131,254 @@ func (s *cachedTodoService) CompleteTodo(ctx context.Context, userID, todoID str
 		return err
 	}
 
-	s.mu.Lock()
-	for key := range s.cache {
-		if len(key) > len(userID) && key[:len(userID)] == userID {
-			delete(s.cache, key)
-		}
+	todo, _ := s.next.GetTodo(ctx, userID, todoID)
+	s.invalidateTodos(ctx, userID, s.withDependents(ctx, userID, todo)...)
+
+	return nil
+}
+
+func (s *cachedTodoService) UpdateTodo(ctx context.Context, userID, todoID string, patch TodoPatch) (Todo, error) {
+	before, _ := s.next.GetTodo(ctx, userID, todoID)
+	todo, err := s.next.UpdateTodo(ctx, userID, todoID, patch)
+	if err != nil {
+		return Todo{}, err
 	}
-	s.mu.Unlock()
+
+	s.invalidateTodos(ctx, userID, before, todo)
+
+	return todo, nil
+}
+
+func (s *cachedTodoService) DeleteTodo(ctx context.Context, userID, todoID string) error {
+	todo, _ := s.next.GetTodo(ctx, userID, todoID)
+	dependents := s.withDependents(ctx, userID, todo)
+	err := s.next.DeleteTodo(ctx, userID, todoID)
+	if err != nil {
+		return err
+	}
+
+	s.invalidateTodos(ctx, userID, dependents...)
 
 	return nil
 }
+
+func (s *cachedTodoService) CreateList(ctx context.Context, userID, name string) (string, error) {
+	return s.next.CreateList(ctx, userID, name)
+}
+
+func (s *cachedTodoService) ListLists(ctx context.Context, userID string) ([]List, error) {
+	return s.next.ListLists(ctx, userID)
+}
+
+func (s *cachedTodoService) ListTags(ctx context.Context, userID string) ([]Tag, error) {
+	return s.next.ListTags(ctx, userID)
+}
+
+func (s *cachedTodoService) ShareList(ctx context.Context, userID, listID, email, role string) (Invitation, error) {
+	return s.next.ShareList(ctx, userID, listID, email, role)
+}
+
+func (s *cachedTodoService) ListInvitations(ctx context.Context, email string) ([]Invitation, error) {
+	return s.next.ListInvitations(ctx, email)
+}
+
+func (s *cachedTodoService) RespondToInvitation(ctx context.Context, userID, email, invitationID string, accept bool) error {
+	if err := s.next.RespondToInvitation(ctx, userID, email, invitationID, accept); err != nil {
+		return err
+	}
+
+	s.invalidate(userID)
+
+	return nil
+}
+
+func (s *cachedTodoService) ListMembers(ctx context.Context, userID, listID string) ([]ListMember, error) {
+	return s.next.ListMembers(ctx, userID, listID)
+}
+
+func (s *cachedTodoService) SetMemberRole(ctx context.Context, userID, listID, memberID, role string) error {
+	audience := listAudience(ctx, s.next, userID, listID)
+	if err := s.next.SetMemberRole(ctx, userID, listID, memberID, role); err != nil {
+		return err
+	}
+
+	s.invalidate(append(audience, memberID)...)
+
+	return nil
+}
+
+func (s *cachedTodoService) RemoveMember(ctx context.Context, userID, listID, memberID string) error {
+	audience := listAudience(ctx, s.next, userID, listID)
+	if err := s.next.RemoveMember(ctx, userID, listID, memberID); err != nil {
+		return err
+	}
+
+	s.invalidate(append(audience, memberID)...)
+
+	return nil
+}
+
+func (s *cachedTodoService) AssignTodo(ctx context.Context, userID, todoID, assigneeID string) (Todo, error) {
+	before, _ := s.next.GetTodo(ctx, userID, todoID)
+	todo, err := s.next.AssignTodo(ctx, userID, todoID, assigneeID)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	s.invalidateTodos(ctx, userID, before, todo)
+
+	return todo, nil
+}
+
+func (s *cachedTodoService) AddComment(ctx context.Context, userID, todoID, text string) (Comment, error) {
+	return s.next.AddComment(ctx, userID, todoID, text)
+}
+
+func (s *cachedTodoService) EditComment(ctx context.Context, userID, todoID, commentID, text string) (Comment, error) {
+	return s.next.EditComment(ctx, userID, todoID, commentID, text)
+}
+
+func (s *cachedTodoService) DeleteComment(ctx context.Context, userID, todoID, commentID string) error {
+	return s.next.DeleteComment(ctx, userID, todoID, commentID)
+}
+
+func (s *cachedTodoService) ListComments(ctx context.Context, userID, todoID string, limit, offset int) ([]Comment, int, error) {
+	return s.next.ListComments(ctx, userID, todoID, limit, offset)
+}
+
+func (s *cachedTodoService) TodoActivity(ctx context.Context, userID, todoID string, limit, offset int) ([]Activity, int, error) {
+	return s.next.TodoActivity(ctx, userID, todoID, limit, offset)
+}
+
+func (s *cachedTodoService) TodoHistory(ctx context.Context, userID, todoID string, limit, offset int) ([]TodoChange, int, error) {
+	return s.next.TodoHistory(ctx, userID, todoID, limit, offset)
+}
+
+func (s *cachedTodoService) RevertTodo(ctx context.Context, userID, todoID string, version int) (Todo, error) {
+	before, _ := s.next.GetTodo(ctx, userID, todoID)
+	todo, err := s.next.RevertTodo(ctx, userID, todoID, version)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	s.invalidateTodos(ctx, userID, s.withDependents(ctx, userID, before, todo)...)
+
+	return todo, nil
+}
+
+func (s *cachedTodoService) MoveTodo(ctx context.Context, userID, todoID string, move TodoMove) (Todo, error) {
+	todo, err := s.next.MoveTodo(ctx, userID, todoID, move)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	s.invalidateTodos(ctx, userID, todo)
+
+	return todo, nil
+}
+
+func (s *cachedTodoService) GetWorkflow(ctx context.Context, userID, listID string) (Workflow, error) {
+	return s.next.GetWorkflow(ctx, userID, listID)
+}
+
+func (s *cachedTodoService) SetWorkflow(ctx context.Context, userID, listID string, workflow Workflow) (Workflow, error) {
+	workflow, err := s.next.SetWorkflow(ctx, userID, listID, workflow)
+	if err != nil {
+		return Workflow{}, err
+	}
+
+	s.invalidateTodos(ctx, userID, Todo{ListID: listID})
+
+	return workflow, nil
+}
+
+func (s *cachedTodoService) TransitionTodo(ctx context.Context, userID, todoID, status string) (Todo, error) {
+	todo, err := s.next.TransitionTodo(ctx, userID, todoID, status)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	s.invalidateTodos(ctx, userID, s.withDependents(ctx, userID, todo)...)
+
+	return todo, nil
+}
+
+func (s *cachedTodoService) ListBoard(ctx context.Context, userID, listID string) (Board, error) {
+	return s.next.ListBoard(ctx, userID, listID)
+}
+
+func (s *cachedTodoService) AddBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error) {
+	todo, err := s.next.AddBlocker(ctx, userID, todoID, blockerID)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	blocker, _ := s.next.GetTodo(ctx, userID, blockerID)
+	s.invalidateTodos(ctx, userID, todo, blocker)
+
+	return todo, nil
+}
+
+func (s *cachedTodoService) RemoveBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error) {
+	todo, err := s.next.RemoveBlocker(ctx, userID, todoID, blockerID)
+	if err != nil {
+		return Todo{}, err
+	}
+
+	blocker, _ := s.next.GetTodo(ctx, userID, blockerID)
+	s.invalidateTodos(ctx, userID, todo, blocker)
+
+	return todo, nil
+}
+
+func (s *cachedTodoService) ListNextTodos(ctx context.Context, userID string, limit, offset int) ([]Todo, int, error) {
+	return s.next.ListNextTodos(ctx, userID, limit, offset)
+}
+
+func (s *cachedTodoService) AddAttachment(ctx context.Context, userID, todoID, name string, r io.Reader) (Attachment, error) {
+	return s.next.AddAttachment(ctx, userID, todoID, name, r)
+}
+
+func (s *cachedTodoService) ListAttachments(ctx context.Context, userID, todoID string) ([]Attachment, error) {
+	return s.next.ListAttachments(ctx, userID, todoID)
+}
+
+func (s *cachedTodoService) OpenAttachment(ctx context.Context, userID, todoID, attachmentID string) (Attachment, io.ReadCloser, error) {
+	return s.next.OpenAttachment(ctx, userID, todoID, attachmentID)
+}
+
+func (s *cachedTodoService) DeleteAttachment(ctx context.Context, userID, todoID, attachmentID string) error {
+	return s.next.DeleteAttachment(ctx, userID, todoID, attachmentID)
+}
+
+func (s *cachedTodoService) AttachmentUsage(ctx context.Context, userID string) (int64, int64, error) {
+	return s.next.AttachmentUsage(ctx, userID)
+}
+
+func (s *cachedTodoService) StartTimer(ctx context.Context, userID, todoID, note string) (TimeEntry, error) {
+	return s.next.StartTimer(ctx, userID, todoID, note)
+}
+
+func (s *cachedTodoService) StopTimer(ctx context.Context, userID string) (TimeEntry, error) {
+	return s.next.StopTimer(ctx, userID)
+}
+
+func (s *cachedTodoService) AddTimeEntry(ctx context.Context, userID, todoID string, input TimeEntryInput) (TimeEntry, error) {
+	return s.next.AddTimeEntry(ctx, userID, todoID, input)
+}
+
+func (s *cachedTodoService) ListTimeEntries(ctx context.Context, userID, todoID string, limit, offset int) ([]TimeEntry, int, error) {
+	return s.next.ListTimeEntries(ctx, userID, todoID, limit, offset)
+}
+
+func (s *cachedTodoService) DeleteTimeEntry(ctx context.Context, userID, todoID, entryID string) error {
+	return s.next.DeleteTimeEntry(ctx, userID, todoID, entryID)
+}
+
+func (s *cachedTodoService) TimeReport(ctx context.Context, userID string, query TimeQuery) (TimeReport, error) {
+	return s.next.TimeReport(ctx, userID, query)
+}
+
+func (s *cachedTodoService) Timesheet(ctx context.Context, userID string, query TimeQuery) ([]TimesheetEntry, error) {
+	return s.next.Timesheet(ctx, userID, query)
+}
@@ -0,0 +1,265 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ActivityComment is the type of the activity entries for comments; the
+// other entries use the todo event types.
+const ActivityComment = "comment"
+
+// maxCommentLength bounds comments, in bytes.
+const maxCommentLength = 5000
+
+var (
+	ErrEmptyComment    = errors.New("comment cannot be empty")
+	ErrCommentTooLong  = fmt.Errorf("comment cannot be longer than %d bytes", maxCommentLength)
+	ErrCommentNotFound = errors.New("comment not found")
+)
+
+// mentionPattern matches @mentions of user IDs. It requires a non-word
+// character before the @ so that email addresses are not mentions.
+var mentionPattern = regexp.MustCompile(`\B@([A-Za-z0-9_-]+)`)
+
+// Comment is a comment on a todo. Mentions holds the IDs of the users with
+// access to the todo it mentions as @user_id.
+type Comment struct {
+	ID        string
+	TodoID    string
+	UserID    string
+	Text      string
+	Mentions  []string
+	CreatedAt time.Time
+	EditedAt  time.Time
+}
+
+// Activity is an entry of the activity feed of a todo: a comment or a
+// change such as its completion.
+type Activity struct {
+	Type       string
+	TodoID     string
+	UserID     string
+	AssigneeID string   `json:",omitempty"`
+	Comment    *Comment `json:",omitempty"`
+	At         time.Time
+}
+
+// parseMentions returns the users mentioned in text, in order and without
+// duplicates.
+func parseMentions(text string) []string {
+	var mentions []string
+	seen := make(map[string]bool)
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		if id := m[1]; !seen[id] {
+			seen[id] = true
+			mentions = append(mentions, id)
+		}
+	}
+	return mentions
+}
+
+func validateComment(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", ErrEmptyComment
+	}
+	if len(text) > maxCommentLength {
+		return "", ErrCommentTooLong
+	}
+	return text, nil
+}
+
+// mentionsIn returns the users mentioned in text who can read todo, other
+// than its author. It must be called with s.mu held.
+func (s *todoService) mentionsIn(todo Todo, authorID, text string) []string {
+	mentions := []string{}
+	for _, id := range parseMentions(text) {
+		if id != authorID && s.todoRole(todo, id) != "" {
+			mentions = append(mentions, id)
+		}
+	}
+	return mentions
+}
+
+// record appends a change to the activity feed and the history of a todo.
+// It must be called with s.mu held, after every mutation of a todo.
+func (s *todoService) record(todo Todo, userID, activityType string) {
+	s.appendHistory(todo, userID, activityType)
+	s.activity[todo.ID] = append(s.activity[todo.ID], Activity{
+		Type:       activityType,
+		TodoID:     todo.ID,
+		UserID:     userID,
+		AssigneeID: todo.AssigneeID,
+		At:         time.Now(),
+	})
+}
+
+// AddComment comments on a todo. Anyone who can read a todo may comment on
+// it.
+func (s *todoService) AddComment(ctx context.Context, userID, todoID, text string) (Comment, error) {
+	text, err := validateComment(text)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return Comment{}, ErrTodoNotFound
+	}
+	if s.todoRole(todo, userID) == "" {
+		return Comment{}, ErrUnauthorized
+	}
+
+	s.commentCounter++
+	comment := Comment{
+		ID:        fmt.Sprintf("comment_%d", s.commentCounter),
+		TodoID:    todoID,
+		UserID:    userID,
+		Text:      text,
+		Mentions:  s.mentionsIn(todo, userID, text),
+		CreatedAt: time.Now(),
+	}
+	s.comments[todoID] = append(s.comments[todoID], comment)
+	return comment, nil
+}
+
+// EditComment changes the text of a comment. Only its author may edit it.
+func (s *todoService) EditComment(ctx context.Context, userID, todoID, commentID, text string) (Comment, error) {
+	text, err := validateComment(text)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return Comment{}, ErrTodoNotFound
+	}
+	if s.todoRole(todo, userID) == "" {
+		return Comment{}, ErrUnauthorized
+	}
+	for i, c := range s.comments[todoID] {
+		if c.ID != commentID {
+			continue
+		}
+		if c.UserID != userID {
+			return Comment{}, ErrUnauthorized
+		}
+		c.Text = text
+		c.Mentions = s.mentionsIn(todo, userID, text)
+		c.EditedAt = time.Now()
+		s.comments[todoID][i] = c
+		return c, nil
+	}
+	return Comment{}, ErrCommentNotFound
+}
+
+// DeleteComment deletes a comment. Its author and the owners of the todo
+// may delete it.
+func (s *todoService) DeleteComment(ctx context.Context, userID, todoID, commentID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return ErrTodoNotFound
+	}
+	role := s.todoRole(todo, userID)
+	if role == "" {
+		return ErrUnauthorized
+	}
+	comments := s.comments[todoID]
+	for i, c := range comments {
+		if c.ID != commentID {
+			continue
+		}
+		if c.UserID != userID && role != ListRoleOwner {
+			return ErrUnauthorized
+		}
+		s.comments[todoID] = append(comments[:i:i], comments[i+1:]...)
+		return nil
+	}
+	return ErrCommentNotFound
+}
+
+// ListComments returns the comments on a todo, oldest first, with their
+// total number.
+func (s *todoService) ListComments(ctx context.Context, userID, todoID string, limit, offset int) ([]Comment, int, error) {
+	s.mu.RLock()
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		s.mu.RUnlock()
+		return nil, 0, ErrTodoNotFound
+	}
+	if s.todoRole(todo, userID) == "" {
+		s.mu.RUnlock()
+		return nil, 0, ErrUnauthorized
+	}
+	comments := append([]Comment{}, s.comments[todoID]...)
+	s.mu.RUnlock()
+
+	start, end := page(len(comments), limit, offset)
+	return comments[start:end], len(comments), nil
+}
+
+// TodoActivity returns the activity feed of a todo, oldest first: its
+// comments merged with changes such as its creation, completion and
+// assignment.
+func (s *todoService) TodoActivity(ctx context.Context, userID, todoID string, limit, offset int) ([]Activity, int, error) {
+	s.mu.RLock()
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		s.mu.RUnlock()
+		return nil, 0, ErrTodoNotFound
+	}
+	if s.todoRole(todo, userID) == "" {
+		s.mu.RUnlock()
+		return nil, 0, ErrUnauthorized
+	}
+	feed := append([]Activity{}, s.activity[todoID]...)
+	for _, c := range s.comments[todoID] {
+		c := c
+		feed = append(feed, Activity{Type: ActivityComment, TodoID: todoID, UserID: c.UserID, Comment: &c, At: c.CreatedAt})
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(feed, func(i, j int) bool {
+		return feed[i].At.Before(feed[j].At)
+	})
+
+	start, end := page(len(feed), limit, offset)
+	return feed[start:end], len(feed), nil
+}
+
+// page clamps limit and offset like ListTodos and returns the bounds of the
+// page within total results.
+func page(total, limit, offset int) (start, end int) {
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= total {
+		return total, total
+	}
+	end = offset + limit
+	if end > total {
+		end = total
+	}
+	return offset, end
+}
@@ -0,0 +1,173 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+type commentRequest struct {
+	TodoID    string `json:"-"`
+	CommentID string `json:"-"`
+	Text      string `json:"text"`
+}
+
+type commentResponse struct {
+	Comment *Comment `json:"comment,omitempty"`
+	Err     string   `json:"error,omitempty"`
+}
+
+func makeAddCommentEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(commentRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		comment, err := svc.AddComment(ctx, userID, req.TodoID, req.Text)
+		if err != nil {
+			return commentResponse{Err: err.Error()}, nil
+		}
+		return commentResponse{Comment: &comment}, nil
+	}
+}
+
+func makeEditCommentEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(commentRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		comment, err := svc.EditComment(ctx, userID, req.TodoID, req.CommentID, req.Text)
+		if err != nil {
+			return commentResponse{Err: err.Error()}, nil
+		}
+		return commentResponse{Comment: &comment}, nil
+	}
+}
+
+type deleteCommentResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeDeleteCommentEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(commentRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		if err := svc.DeleteComment(ctx, userID, req.TodoID, req.CommentID); err != nil {
+			return deleteCommentResponse{Err: err.Error()}, nil
+		}
+		return deleteCommentResponse{}, nil
+	}
+}
+
+type todoPageRequest struct {
+	TodoID string `json:"-"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+type listCommentsResponse struct {
+	Comments []Comment `json:"comments,omitempty"`
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+	Err      string    `json:"error,omitempty"`
+}
+
+func makeListCommentsEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(todoPageRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		comments, total, err := svc.ListComments(ctx, userID, req.TodoID, req.Limit, req.Offset)
+		if err != nil {
+			return listCommentsResponse{Err: err.Error()}, nil
+		}
+		return listCommentsResponse{Comments: comments, Total: total, Limit: req.Limit, Offset: req.Offset}, nil
+	}
+}
+
+type todoActivityResponse struct {
+	Activity []Activity `json:"activity,omitempty"`
+	Total    int        `json:"total"`
+	Limit    int        `json:"limit"`
+	Offset   int        `json:"offset"`
+	Err      string     `json:"error,omitempty"`
+}
+
+func makeTodoActivityEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(todoPageRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		activity, total, err := svc.TodoActivity(ctx, userID, req.TodoID, req.Limit, req.Offset)
+		if err != nil {
+			return todoActivityResponse{Err: err.Error()}, nil
+		}
+		return todoActivityResponse{Activity: activity, Total: total, Limit: req.Limit, Offset: req.Offset}, nil
+	}
+}
+
+func decodeCommentRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req commentRequest
+	if r.Method != http.MethodDelete {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+	}
+	vars := mux.Vars(r)
+	req.TodoID, req.CommentID = vars["id"], vars["comment_id"]
+	return req, nil
+}
+
+func decodeTodoPageRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	req := todoPageRequest{TodoID: mux.Vars(r)["id"]}
+	req.Limit, req.Offset = pageParams(r)
+	return req, nil
+}
+
+// makeCommentHandler serves a comment endpoint, which all take the token
+// from the Authorization header.
+func makeCommentHandler(e endpoint.Endpoint, dec httptransport.DecodeRequestFunc) http.Handler {
+	return httptransport.NewServer(
+		e,
+		dec,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeAddCommentHandler(endpoints Endpoints) http.Handler {
+	return makeCommentHandler(endpoints.AddCommentEndpoint, decodeCommentRequest)
+}
+
+func MakeListCommentsHandler(endpoints Endpoints) http.Handler {
+	return makeCommentHandler(endpoints.ListCommentsEndpoint, decodeTodoPageRequest)
+}
+
+func MakeEditCommentHandler(endpoints Endpoints) http.Handler {
+	return makeCommentHandler(endpoints.EditCommentEndpoint, decodeCommentRequest)
+}
+
+func MakeDeleteCommentHandler(endpoints Endpoints) http.Handler {
+	return makeCommentHandler(endpoints.DeleteCommentEndpoint, decodeCommentRequest)
+}
+
+func MakeTodoActivityHandler(endpoints Endpoints) http.Handler {
+	return makeCommentHandler(endpoints.TodoActivityEndpoint, decodeTodoPageRequest)
+}
@@ -0,0 +1,97 @@
+package auth_todo
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	for text, want := range map[string][]string{
+		"no mentions":                      nil,
+		"@user_1 please look":              {"user_1"},
+		"cc @user_2, @user_3 and @user_2.": {"user_2", "user_3"},
+		"mail me at me@example.com":        nil,
+		"(@user_4) done":                   {"user_4"},
+		"@@user_5 and trailing @":          {"user_5"},
+	} {
+		if got := parseMentions(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("parseMentions(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	ctx := context.Background()
+	broker := NewEventBroker(16)
+	svc := NewEventingTodoMiddleware(broker, NewTodoService())
+	listID, _ := svc.CreateList(ctx, "owner", "Launch")
+	todoID, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "Write post", ListID: listID})
+	inv, _ := svc.ShareList(ctx, "owner", listID, "viewer@example.com", ListRoleViewer)
+	svc.RespondToInvitation(ctx, "viewer", "viewer@example.com", inv.ID, true)
+
+	if _, err := svc.AddComment(ctx, "stranger", todoID, "Hi"); err != ErrUnauthorized {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	if _, err := svc.AddComment(ctx, "owner", todoID, "  "); err != ErrEmptyComment {
+		t.Errorf("Expected ErrEmptyComment, got %v", err)
+	}
+	if _, err := svc.AddComment(ctx, "owner", todoID, strings.Repeat("a", maxCommentLength+1)); err != ErrCommentTooLong {
+		t.Errorf("Expected ErrCommentTooLong, got %v", err)
+	}
+
+	viewerSub, _, _ := broker.Subscribe("viewer", 0)
+	defer viewerSub.Close()
+	first, err := svc.AddComment(ctx, "owner", todoID, "@viewer can you review? cc @stranger @owner")
+	if err != nil {
+		t.Fatalf("AddComment failed: %v", err)
+	}
+	if !reflect.DeepEqual(first.Mentions, []string{"viewer"}) {
+		t.Errorf("Expected only readers other than the author to be mentioned, got %v", first.Mentions)
+	}
+	if event := <-viewerSub.C; event.Type != TodoMentioned || event.TodoID != todoID {
+		t.Errorf("Expected a mention event, got %+v", event)
+	}
+	second, _ := svc.AddComment(ctx, "viewer", todoID, "Looks good")
+	svc.CompleteTodo(ctx, "owner", todoID)
+
+	if _, err := svc.EditComment(ctx, "owner", todoID, second.ID, "Hijacked"); err != ErrUnauthorized {
+		t.Errorf("Expected only authors to edit, got %v", err)
+	}
+	edited, err := svc.EditComment(ctx, "viewer", todoID, second.ID, "Looks great")
+	if err != nil || edited.Text != "Looks great" || edited.EditedAt.IsZero() {
+		t.Errorf("Unexpected edit %+v %v", edited, err)
+	}
+	if err := svc.DeleteComment(ctx, "viewer", todoID, first.ID); err != ErrUnauthorized {
+		t.Errorf("Expected viewers not to delete others' comments, got %v", err)
+	}
+
+	activity, total, _ := svc.TodoActivity(ctx, "viewer", todoID, 10, 0)
+	var types []string
+	for _, a := range activity {
+		types = append(types, a.Type)
+	}
+	if want := []string{TodoCreated, ActivityComment, ActivityComment, TodoCompleted}; total != 4 || !reflect.DeepEqual(types, want) {
+		t.Errorf("Expected activity %v, got %v", want, types)
+	}
+	if activity[2].Comment.Text != "Looks great" {
+		t.Errorf("Expected the feed to show the edited comment, got %+v", activity[2].Comment)
+	}
+
+	if err := svc.DeleteComment(ctx, "owner", todoID, second.ID); err != nil {
+		t.Errorf("Expected owners to delete any comment, got %v", err)
+	}
+	comments, total, _ := svc.ListComments(ctx, "viewer", todoID, 1, 0)
+	if total != 1 || len(comments) != 1 || comments[0].ID != first.ID {
+		t.Errorf("Expected the remaining comment, got %d %+v", total, comments)
+	}
+	if comments, _, _ := svc.ListComments(ctx, "viewer", todoID, 10, 5); len(comments) != 0 {
+		t.Errorf("Expected an empty page past the end, got %+v", comments)
+	}
+
+	svc.DeleteTodo(ctx, "owner", todoID)
+	if _, _, err := svc.TodoActivity(ctx, "owner", todoID, 10, 0); err != ErrTodoNotFound {
+		t.Errorf("Expected the feed to go with the todo, got %v", err)
+	}
+}
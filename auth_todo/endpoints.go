@@ -2,8 +2,11 @@ package auth_todo
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 type signupRequest struct {
@@ -32,15 +35,46 @@ type loginRequest struct {
 	Password string `json:"password"`
 }
 
+// loginResponse carries either a session token or, for accounts with
+// two-factor authentication, a challenge token to pass to /login/mfa with a
+// code.
 type loginResponse struct {
-	Token string `json:"token,omitempty"`
-	Err   string `json:"error,omitempty"`
+	Token          string `json:"token,omitempty"`
+	MFARequired    bool   `json:"mfa_required,omitempty"`
+	ChallengeToken string `json:"challenge_token,omitempty"`
+	Err            string `json:"error,omitempty"`
 }
 
 func makeLoginEndpoint(svc AuthService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(loginRequest)
 		token, err := svc.Login(ctx, req.Email, req.Password)
+		var mfaErr *MFARequiredError
+		if errors.As(err, &mfaErr) {
+			return loginResponse{MFARequired: true, ChallengeToken: mfaErr.ChallengeToken}, nil
+		}
+		if errors.Is(err, ErrTooManyLoginAttempts) {
+			return nil, err
+		}
+		if err != nil {
+			return loginResponse{Err: err.Error()}, nil
+		}
+		return loginResponse{Token: token}, nil
+	}
+}
+
+type loginMFARequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+func makeLoginMFAEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(loginMFARequest)
+		token, err := svc.CompleteMFALogin(ctx, req.ChallengeToken, req.Code)
+		if errors.Is(err, ErrTooManyLoginAttempts) {
+			return nil, err
+		}
 		if err != nil {
 			return loginResponse{Err: err.Error()}, nil
 		}
@@ -48,6 +82,72 @@ func makeLoginEndpoint(svc AuthService) endpoint.Endpoint {
 	}
 }
 
+type enrollMFAResponse struct {
+	Secret     string `json:"secret,omitempty"`
+	OTPAuthURI string `json:"otpauth_uri,omitempty"`
+	Err        string `json:"error,omitempty"`
+}
+
+func makeEnrollMFAEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		enrollment, err := svc.EnrollMFA(ctx, userID)
+		if err != nil {
+			return enrollMFAResponse{Err: err.Error()}, nil
+		}
+		return enrollMFAResponse{Secret: enrollment.Secret, OTPAuthURI: enrollment.URI}, nil
+	}
+}
+
+type confirmMFARequest struct {
+	Code string `json:"code"`
+}
+
+type confirmMFAResponse struct {
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	Err           string   `json:"error,omitempty"`
+}
+
+func makeConfirmMFAEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(confirmMFARequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		codes, err := svc.ConfirmMFA(ctx, userID, req.Code)
+		if err != nil {
+			return confirmMFAResponse{Err: err.Error()}, nil
+		}
+		return confirmMFAResponse{RecoveryCodes: codes}, nil
+	}
+}
+
+type disableMFARequest struct {
+	Password string `json:"password"`
+}
+
+type disableMFAResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeDisableMFAEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(disableMFARequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		if err := svc.DisableMFA(ctx, userID, req.Password); err != nil {
+			return disableMFAResponse{Err: err.Error()}, nil
+		}
+		return disableMFAResponse{}, nil
+	}
+}
+
 type validateTokenRequest struct {
 	Token string `json:"token"`
 }
@@ -68,9 +168,84 @@ func makeValidateTokenEndpoint(svc AuthService) endpoint.Endpoint {
 	}
 }
 
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type forgotPasswordResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeForgotPasswordEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(forgotPasswordRequest)
+		if err := svc.RequestPasswordReset(ctx, req.Email); err != nil {
+			return forgotPasswordResponse{Err: err.Error()}, nil
+		}
+		return forgotPasswordResponse{}, nil
+	}
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type resetPasswordResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeResetPasswordEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(resetPasswordRequest)
+		if err := svc.ResetPassword(ctx, req.Token, req.Password); err != nil {
+			return resetPasswordResponse{Err: err.Error()}, nil
+		}
+		return resetPasswordResponse{}, nil
+	}
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type verifyEmailResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeVerifyEmailEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(verifyEmailRequest)
+		if err := svc.VerifyEmail(ctx, req.Token); err != nil {
+			return verifyEmailResponse{Err: err.Error()}, nil
+		}
+		return verifyEmailResponse{}, nil
+	}
+}
+
+type resendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type resendVerificationResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeResendVerificationEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(resendVerificationRequest)
+		if err := svc.ResendVerification(ctx, req.Email); err != nil {
+			return resendVerificationResponse{Err: err.Error()}, nil
+		}
+		return resendVerificationResponse{}, nil
+	}
+}
+
 type createTodoRequest struct {
-	UserID string `json:"user_id"`
-	Text   string `json:"text"`
+	UserID string   `json:"user_id"`
+	Text   string   `json:"text"`
+	ListID string   `json:"list_id,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
 }
 
 type createTodoResponse struct {
@@ -81,7 +256,15 @@ type createTodoResponse struct {
 func makeCreateTodoEndpoint(svc TodoService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(createTodoRequest)
-		todoID, err := svc.CreateTodo(ctx, req.UserID, req.Text)
+		userID, err := requestUserID(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		todoID, err := svc.CreateTodo(ctx, userID, TodoInput{
+			Text:   req.Text,
+			ListID: req.ListID,
+			Tags:   req.Tags,
+		})
 		if err != nil {
 			return createTodoResponse{Err: err.Error()}, nil
 		}
@@ -90,9 +273,10 @@ func makeCreateTodoEndpoint(svc TodoService) endpoint.Endpoint {
 }
 
 type listTodosRequest struct {
-	UserID string `json:"user_id"`
-	Limit  int    `json:"limit"`
-	Offset int    `json:"offset"`
+	UserID string     `json:"user_id"`
+	Filter TodoFilter `json:"-"`
+	Limit  int        `json:"limit"`
+	Offset int        `json:"offset"`
 }
 
 type listTodosResponse struct {
@@ -106,7 +290,11 @@ type listTodosResponse struct {
 func makeListTodosEndpoint(svc TodoService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(listTodosRequest)
-		todos, total, err := svc.ListTodos(ctx, req.UserID, req.Limit, req.Offset)
+		userID, err := requestUserID(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		todos, total, err := svc.ListTodos(ctx, userID, req.Filter, req.Limit, req.Offset)
 		if err != nil {
 			return listTodosResponse{Err: err.Error()}, nil
 		}
@@ -131,7 +319,11 @@ type completeTodoResponse struct {
 func makeCompleteTodoEndpoint(svc TodoService) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(completeTodoRequest)
-		err := svc.CompleteTodo(ctx, req.UserID, req.TodoID)
+		userID, err := requestUserID(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		err = svc.CompleteTodo(ctx, userID, req.TodoID)
 		if err != nil {
 			return completeTodoResponse{Err: err.Error()}, nil
 		}
@@ -139,22 +331,415 @@ func makeCompleteTodoEndpoint(svc TodoService) endpoint.Endpoint {
 	}
 }
 
+type updateTodoRequest struct {
+	UserID string    `json:"user_id"`
+	TodoID string    `json:"-"`
+	Text   *string   `json:"text,omitempty"`
+	ListID *string   `json:"list_id,omitempty"`
+	Tags   *[]string `json:"tags,omitempty"`
+}
+
+type updateTodoResponse struct {
+	Todo *Todo  `json:"todo,omitempty"`
+	Err  string `json:"error,omitempty"`
+}
+
+func makeUpdateTodoEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(updateTodoRequest)
+		userID, err := requestUserID(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		todo, err := svc.UpdateTodo(ctx, userID, req.TodoID, TodoPatch{
+			Text:   req.Text,
+			ListID: req.ListID,
+			Tags:   req.Tags,
+		})
+		if err != nil {
+			return updateTodoResponse{Err: err.Error()}, nil
+		}
+		return updateTodoResponse{Todo: &todo}, nil
+	}
+}
+
+type deleteTodoRequest struct {
+	UserID string `json:"user_id"`
+	TodoID string `json:"todo_id"`
+}
+
+type deleteTodoResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeDeleteTodoEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteTodoRequest)
+		userID, err := requestUserID(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		err = svc.DeleteTodo(ctx, userID, req.TodoID)
+		if err != nil {
+			return deleteTodoResponse{Err: err.Error()}, nil
+		}
+		return deleteTodoResponse{}, nil
+	}
+}
+
+type todoEventsRequest struct {
+	LastEventID uint64
+}
+
+// todoEventsResponse is streamed by encodeEventStream, which closes the
+// subscription once the client goes away.
+type todoEventsResponse struct {
+	sub      *EventSubscription
+	replay   []TodoEvent
+	complete bool
+}
+
+func makeTodoEventsEndpoint(broker *EventBroker) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(todoEventsRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		sub, replay, complete := broker.Subscribe(userID, req.LastEventID)
+		return todoEventsResponse{sub: sub, replay: replay, complete: complete}, nil
+	}
+}
+
+type createListRequest struct {
+	UserID string `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+type createListResponse struct {
+	ListID string `json:"list_id,omitempty"`
+	Err    string `json:"error,omitempty"`
+}
+
+func makeCreateListEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createListRequest)
+		userID, err := requestUserID(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		listID, err := svc.CreateList(ctx, userID, req.Name)
+		if err != nil {
+			return createListResponse{Err: err.Error()}, nil
+		}
+		return createListResponse{ListID: listID}, nil
+	}
+}
+
+type listListsRequest struct {
+	UserID string `json:"user_id"`
+	Shared bool   `json:"shared"`
+}
+
+type listListsResponse struct {
+	Lists []List `json:"lists"`
+	Err   string `json:"error,omitempty"`
+}
+
+func makeListListsEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listListsRequest)
+		userID, err := requestUserID(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		lists, err := svc.ListLists(ctx, userID)
+		if err != nil {
+			return listListsResponse{Err: err.Error()}, nil
+		}
+		if req.Shared {
+			shared := []List{}
+			for _, l := range lists {
+				if l.UserID != userID {
+					shared = append(shared, l)
+				}
+			}
+			lists = shared
+		}
+		return listListsResponse{Lists: lists}, nil
+	}
+}
+
+type createAccessTokenRequest struct {
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+type createAccessTokenResponse struct {
+	Token       string       `json:"token,omitempty"`
+	AccessToken *AccessToken `json:"access_token,omitempty"`
+	Err         string       `json:"error,omitempty"`
+}
+
+func makeCreateAccessTokenEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createAccessTokenRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		token, info, err := svc.CreateAccessToken(ctx, userID, req.Name, req.Scopes, req.ExpiresAt)
+		if err != nil {
+			return createAccessTokenResponse{Err: err.Error()}, nil
+		}
+		return createAccessTokenResponse{Token: token, AccessToken: &info}, nil
+	}
+}
+
+type listAccessTokensResponse struct {
+	AccessTokens []AccessToken `json:"access_tokens"`
+	Err          string        `json:"error,omitempty"`
+}
+
+func makeListAccessTokensEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		tokens, err := svc.ListAccessTokens(ctx, userID)
+		if err != nil {
+			return listAccessTokensResponse{Err: err.Error()}, nil
+		}
+		return listAccessTokensResponse{AccessTokens: tokens}, nil
+	}
+}
+
+type revokeAccessTokenRequest struct {
+	TokenID string `json:"-"`
+}
+
+type revokeAccessTokenResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeRevokeAccessTokenEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(revokeAccessTokenRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		if err := svc.RevokeAccessToken(ctx, userID, req.TokenID); err != nil {
+			return revokeAccessTokenResponse{Err: err.Error()}, nil
+		}
+		return revokeAccessTokenResponse{}, nil
+	}
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type graphqlResponse struct {
+	Data   interface{}   `json:"data"`
+	Errors gqlerror.List `json:"errors,omitempty"`
+}
+
+func makeGraphQLEndpoint(schema *graphqlSchema) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(graphqlRequest)
+		return schema.execute(ctx, req), nil
+	}
+}
+
 type Endpoints struct {
-	SignupEndpoint        endpoint.Endpoint
-	LoginEndpoint         endpoint.Endpoint
-	ValidateTokenEndpoint endpoint.Endpoint
-	CreateTodoEndpoint    endpoint.Endpoint
-	ListTodosEndpoint     endpoint.Endpoint
-	CompleteTodoEndpoint  endpoint.Endpoint
-}
-
-func MakeEndpoints(authSvc AuthService, todoSvc TodoService) Endpoints {
-	return Endpoints{
-		SignupEndpoint:        makeSignupEndpoint(authSvc),
-		LoginEndpoint:         makeLoginEndpoint(authSvc),
-		ValidateTokenEndpoint: makeValidateTokenEndpoint(authSvc),
-		CreateTodoEndpoint:    makeCreateTodoEndpoint(todoSvc),
-		ListTodosEndpoint:     makeListTodosEndpoint(todoSvc),
-		CompleteTodoEndpoint:  makeCompleteTodoEndpoint(todoSvc),
+	SignupEndpoint             endpoint.Endpoint
+	LoginEndpoint              endpoint.Endpoint
+	LoginMFAEndpoint           endpoint.Endpoint
+	EnrollMFAEndpoint          endpoint.Endpoint
+	ConfirmMFAEndpoint         endpoint.Endpoint
+	DisableMFAEndpoint         endpoint.Endpoint
+	CreateAccessTokenEndpoint  endpoint.Endpoint
+	ListAccessTokensEndpoint   endpoint.Endpoint
+	RevokeAccessTokenEndpoint  endpoint.Endpoint
+	CreateOAuthClientEndpoint  endpoint.Endpoint
+	OAuthAuthorizeEndpoint     endpoint.Endpoint
+	OAuthConsentEndpoint       endpoint.Endpoint
+	OAuthTokenEndpoint         endpoint.Endpoint
+	OAuthIntrospectEndpoint    endpoint.Endpoint
+	OAuthRevokeEndpoint        endpoint.Endpoint
+	OIDCLoginEndpoint          endpoint.Endpoint
+	OIDCCallbackEndpoint       endpoint.Endpoint
+	AdminListUsersEndpoint     endpoint.Endpoint
+	AdminGetUserEndpoint       endpoint.Endpoint
+	AdminSetRoleEndpoint       endpoint.Endpoint
+	AdminDisableUserEndpoint   endpoint.Endpoint
+	AdminEnableUserEndpoint    endpoint.Endpoint
+	AdminResetMFAEndpoint      endpoint.Endpoint
+	AdminUnlockUserEndpoint    endpoint.Endpoint
+	AdminListTodosEndpoint     endpoint.Endpoint
+	AdminAuditEndpoint         endpoint.Endpoint
+	AdminSecurityLogEndpoint   endpoint.Endpoint
+	ValidateTokenEndpoint      endpoint.Endpoint
+	ForgotPasswordEndpoint     endpoint.Endpoint
+	ResetPasswordEndpoint      endpoint.Endpoint
+	VerifyEmailEndpoint        endpoint.Endpoint
+	ResendVerificationEndpoint endpoint.Endpoint
+	CreateTodoEndpoint         endpoint.Endpoint
+	ListTodosEndpoint          endpoint.Endpoint
+	CompleteTodoEndpoint       endpoint.Endpoint
+	UpdateTodoEndpoint         endpoint.Endpoint
+	DeleteTodoEndpoint         endpoint.Endpoint
+	AssignTodoEndpoint         endpoint.Endpoint
+	UnassignTodoEndpoint       endpoint.Endpoint
+	AddCommentEndpoint         endpoint.Endpoint
+	ListCommentsEndpoint       endpoint.Endpoint
+	EditCommentEndpoint        endpoint.Endpoint
+	DeleteCommentEndpoint      endpoint.Endpoint
+	TodoActivityEndpoint       endpoint.Endpoint
+	TodoHistoryEndpoint        endpoint.Endpoint
+	RevertTodoEndpoint         endpoint.Endpoint
+	MoveTodoEndpoint           endpoint.Endpoint
+	TransitionTodoEndpoint     endpoint.Endpoint
+	AddBlockerEndpoint         endpoint.Endpoint
+	RemoveBlockerEndpoint      endpoint.Endpoint
+	ListNextTodosEndpoint      endpoint.Endpoint
+	AddAttachmentEndpoint      endpoint.Endpoint
+	ListAttachmentsEndpoint    endpoint.Endpoint
+	DownloadAttachmentEndpoint endpoint.Endpoint
+	DeleteAttachmentEndpoint   endpoint.Endpoint
+	AttachmentUsageEndpoint    endpoint.Endpoint
+	StartTimerEndpoint         endpoint.Endpoint
+	StopTimerEndpoint          endpoint.Endpoint
+	AddTimeEntryEndpoint       endpoint.Endpoint
+	ListTimeEntriesEndpoint    endpoint.Endpoint
+	DeleteTimeEntryEndpoint    endpoint.Endpoint
+	TimeReportEndpoint         endpoint.Endpoint
+	TimesheetEndpoint          endpoint.Endpoint
+	TodoEventsEndpoint         endpoint.Endpoint
+	CreateListEndpoint         endpoint.Endpoint
+	ListListsEndpoint          endpoint.Endpoint
+	ShareListEndpoint          endpoint.Endpoint
+	ListMembersEndpoint        endpoint.Endpoint
+	GetWorkflowEndpoint        endpoint.Endpoint
+	SetWorkflowEndpoint        endpoint.Endpoint
+	ListBoardEndpoint          endpoint.Endpoint
+	SetMemberRoleEndpoint      endpoint.Endpoint
+	RemoveMemberEndpoint       endpoint.Endpoint
+	ListInvitationsEndpoint    endpoint.Endpoint
+	AcceptInvitationEndpoint   endpoint.Endpoint
+	DeclineInvitationEndpoint  endpoint.Endpoint
+	GraphQLEndpoint            endpoint.Endpoint
+
+	// clientIPs resolves the client IP of requests behind the trusted proxies
+	// of the rate limits.
+	clientIPs clientIPResolver
+}
+
+// MakeEndpoints wires the services into endpoints. limits may be nil to
+// disable rate limiting; their trusted proxies are then not honoured either.
+//
+// The REST todo and list endpoints require a token and enforce its scopes;
+// a user_id in the request must name the authenticated user. Account
+// settings only accept session tokens. OAuth access tokens
+// are accepted like personal access tokens, limited to the scopes the user
+// granted.
+func MakeEndpoints(authSvc AuthService, todoSvc TodoService, broker *EventBroker, limits *RateLimits) Endpoints {
+	authenticate := NewAuthenticationMiddleware(authSvc)
+	read := RequireScope(ScopeTodosRead)
+	write := RequireScope(ScopeTodosWrite)
+	limit := limits.Middleware
+	// admin guards the admin endpoints, which only accept session tokens of
+	// users whose role grants permission.
+	admin := func(permission string) endpoint.Middleware {
+		return endpoint.Chain(authenticate, requireSession, RequirePermission(authSvc, permission))
+	}
+
+	endpoints := Endpoints{
+		SignupEndpoint:             limit("signup")(makeSignupEndpoint(authSvc)),
+		LoginEndpoint:              limit("login")(makeLoginEndpoint(authSvc)),
+		LoginMFAEndpoint:           limit("login_mfa")(makeLoginMFAEndpoint(authSvc)),
+		EnrollMFAEndpoint:          authenticate(requireSession(limit("enroll_mfa")(makeEnrollMFAEndpoint(authSvc)))),
+		ConfirmMFAEndpoint:         authenticate(requireSession(limit("confirm_mfa")(makeConfirmMFAEndpoint(authSvc)))),
+		DisableMFAEndpoint:         authenticate(requireSession(limit("disable_mfa")(makeDisableMFAEndpoint(authSvc)))),
+		CreateAccessTokenEndpoint:  authenticate(requireSession(limit("create_access_token")(makeCreateAccessTokenEndpoint(authSvc)))),
+		ListAccessTokensEndpoint:   authenticate(requireSession(limit("list_access_tokens")(makeListAccessTokensEndpoint(authSvc)))),
+		RevokeAccessTokenEndpoint:  authenticate(requireSession(limit("revoke_access_token")(makeRevokeAccessTokenEndpoint(authSvc)))),
+		CreateOAuthClientEndpoint:  authenticate(requireSession(limit("create_oauth_client")(makeCreateOAuthClientEndpoint(authSvc)))),
+		OAuthAuthorizeEndpoint:     limit("oauth_authorize")(makeOAuthAuthorizeEndpoint(authSvc)),
+		OAuthConsentEndpoint:       limit("oauth_consent")(makeOAuthConsentEndpoint(authSvc)),
+		OAuthTokenEndpoint:         limit("oauth_token")(makeOAuthTokenEndpoint(authSvc)),
+		OAuthIntrospectEndpoint:    limit("oauth_introspect")(makeOAuthIntrospectEndpoint(authSvc)),
+		OAuthRevokeEndpoint:        limit("oauth_revoke")(makeOAuthRevokeEndpoint(authSvc)),
+		OIDCLoginEndpoint:          limit("oidc_login")(makeOIDCLoginEndpoint(authSvc)),
+		OIDCCallbackEndpoint:       limit("oidc_callback")(makeOIDCCallbackEndpoint(authSvc)),
+		AdminListUsersEndpoint:     admin(PermissionViewUsers)(limit("admin_list_users")(makeAdminListUsersEndpoint(authSvc))),
+		AdminGetUserEndpoint:       admin(PermissionViewUsers)(limit("admin_get_user")(makeAdminGetUserEndpoint(authSvc))),
+		AdminSetRoleEndpoint:       admin(PermissionManageRoles)(limit("admin_set_role")(makeAdminSetRoleEndpoint(authSvc))),
+		AdminDisableUserEndpoint:   admin(PermissionManageUsers)(limit("admin_disable_user")(makeAdminSetUserDisabledEndpoint(authSvc, true))),
+		AdminEnableUserEndpoint:    admin(PermissionManageUsers)(limit("admin_enable_user")(makeAdminSetUserDisabledEndpoint(authSvc, false))),
+		AdminResetMFAEndpoint:      admin(PermissionManageUsers)(limit("admin_reset_mfa")(makeAdminResetMFAEndpoint(authSvc))),
+		AdminUnlockUserEndpoint:    admin(PermissionManageUsers)(limit("admin_unlock_user")(makeAdminUnlockUserEndpoint(authSvc))),
+		AdminListTodosEndpoint:     admin(PermissionViewTodos)(limit("admin_list_todos")(makeAdminListTodosEndpoint(authSvc, todoSvc))),
+		AdminAuditEndpoint:         admin(PermissionViewAudit)(limit("admin_audit")(makeAdminAuditEndpoint(authSvc))),
+		AdminSecurityLogEndpoint:   admin(PermissionViewAudit)(limit("admin_security_log")(makeAdminSecurityLogEndpoint(authSvc))),
+		ValidateTokenEndpoint:      limit("validate")(makeValidateTokenEndpoint(authSvc)),
+		ForgotPasswordEndpoint:     limit("forgot_password")(makeForgotPasswordEndpoint(authSvc)),
+		ResetPasswordEndpoint:      limit("reset_password")(makeResetPasswordEndpoint(authSvc)),
+		VerifyEmailEndpoint:        limit("verify_email")(makeVerifyEmailEndpoint(authSvc)),
+		ResendVerificationEndpoint: limit("resend_verification")(makeResendVerificationEndpoint(authSvc)),
+		CreateTodoEndpoint:         authenticate(write(limit("create_todo")(makeCreateTodoEndpoint(todoSvc)))),
+		ListTodosEndpoint:          authenticate(read(limit("list_todos")(makeListTodosEndpoint(todoSvc)))),
+		CompleteTodoEndpoint:       authenticate(write(limit("complete_todo")(makeCompleteTodoEndpoint(todoSvc)))),
+		UpdateTodoEndpoint:         authenticate(write(limit("update_todo")(makeUpdateTodoEndpoint(todoSvc)))),
+		DeleteTodoEndpoint:         authenticate(write(limit("delete_todo")(makeDeleteTodoEndpoint(todoSvc)))),
+		AssignTodoEndpoint:         authenticate(write(limit("assign_todo")(makeAssignTodoEndpoint(todoSvc)))),
+		UnassignTodoEndpoint:       authenticate(write(limit("unassign_todo")(makeUnassignTodoEndpoint(todoSvc)))),
+		AddCommentEndpoint:         authenticate(write(limit("add_comment")(makeAddCommentEndpoint(todoSvc)))),
+		ListCommentsEndpoint:       authenticate(read(limit("list_comments")(makeListCommentsEndpoint(todoSvc)))),
+		EditCommentEndpoint:        authenticate(write(limit("edit_comment")(makeEditCommentEndpoint(todoSvc)))),
+		DeleteCommentEndpoint:      authenticate(write(limit("delete_comment")(makeDeleteCommentEndpoint(todoSvc)))),
+		TodoActivityEndpoint:       authenticate(read(limit("todo_activity")(makeTodoActivityEndpoint(todoSvc)))),
+		TodoHistoryEndpoint:        authenticate(read(limit("todo_history")(makeTodoHistoryEndpoint(todoSvc)))),
+		RevertTodoEndpoint:         authenticate(write(limit("revert_todo")(makeRevertTodoEndpoint(todoSvc)))),
+		MoveTodoEndpoint:           authenticate(write(limit("move_todo")(makeMoveTodoEndpoint(todoSvc)))),
+		TransitionTodoEndpoint:     authenticate(write(limit("transition_todo")(makeTransitionTodoEndpoint(todoSvc)))),
+		AddBlockerEndpoint:         authenticate(write(limit("add_blocker")(makeAddBlockerEndpoint(todoSvc)))),
+		RemoveBlockerEndpoint:      authenticate(write(limit("remove_blocker")(makeRemoveBlockerEndpoint(todoSvc)))),
+		ListNextTodosEndpoint:      authenticate(read(limit("list_next_todos")(makeListNextTodosEndpoint(todoSvc)))),
+		AddAttachmentEndpoint:      authenticate(write(limit("add_attachment")(makeAddAttachmentEndpoint(todoSvc)))),
+		ListAttachmentsEndpoint:    authenticate(read(limit("list_attachments")(makeListAttachmentsEndpoint(todoSvc)))),
+		DownloadAttachmentEndpoint: authenticate(read(limit("download_attachment")(makeDownloadAttachmentEndpoint(todoSvc)))),
+		DeleteAttachmentEndpoint:   authenticate(write(limit("delete_attachment")(makeDeleteAttachmentEndpoint(todoSvc)))),
+		AttachmentUsageEndpoint:    authenticate(read(limit("attachment_usage")(makeAttachmentUsageEndpoint(todoSvc)))),
+		StartTimerEndpoint:         authenticate(write(limit("start_timer")(makeStartTimerEndpoint(todoSvc)))),
+		StopTimerEndpoint:          authenticate(write(limit("stop_timer")(makeStopTimerEndpoint(todoSvc)))),
+		AddTimeEntryEndpoint:       authenticate(write(limit("add_time_entry")(makeAddTimeEntryEndpoint(todoSvc)))),
+		ListTimeEntriesEndpoint:    authenticate(read(limit("list_time_entries")(makeListTimeEntriesEndpoint(todoSvc)))),
+		DeleteTimeEntryEndpoint:    authenticate(write(limit("delete_time_entry")(makeDeleteTimeEntryEndpoint(todoSvc)))),
+		TimeReportEndpoint:         authenticate(read(limit("time_report")(makeTimeReportEndpoint(todoSvc)))),
+		TimesheetEndpoint:          authenticate(read(limit("timesheet")(makeTimesheetEndpoint(todoSvc)))),
+		TodoEventsEndpoint:         authenticate(read(limit("todo_events")(makeTodoEventsEndpoint(broker)))),
+		CreateListEndpoint:         authenticate(write(limit("create_list")(makeCreateListEndpoint(todoSvc)))),
+		ListListsEndpoint:          authenticate(read(limit("list_lists")(makeListListsEndpoint(todoSvc)))),
+		ShareListEndpoint:          authenticate(write(limit("share_list")(makeShareListEndpoint(todoSvc)))),
+		ListMembersEndpoint:        authenticate(read(limit("list_members")(makeListMembersEndpoint(authSvc, todoSvc)))),
+		GetWorkflowEndpoint:        authenticate(read(limit("get_workflow")(makeGetWorkflowEndpoint(todoSvc)))),
+		SetWorkflowEndpoint:        authenticate(write(limit("set_workflow")(makeSetWorkflowEndpoint(todoSvc)))),
+		ListBoardEndpoint:          authenticate(read(limit("list_board")(makeListBoardEndpoint(todoSvc)))),
+		SetMemberRoleEndpoint:      authenticate(write(limit("set_member_role")(makeSetMemberRoleEndpoint(todoSvc)))),
+		RemoveMemberEndpoint:       authenticate(write(limit("remove_member")(makeRemoveMemberEndpoint(todoSvc)))),
+		ListInvitationsEndpoint:    authenticate(read(limit("list_invitations")(makeListInvitationsEndpoint(authSvc, todoSvc)))),
+		AcceptInvitationEndpoint:   authenticate(write(limit("accept_invitation")(makeRespondToInvitationEndpoint(authSvc, todoSvc, true)))),
+		DeclineInvitationEndpoint:  authenticate(write(limit("decline_invitation")(makeRespondToInvitationEndpoint(authSvc, todoSvc, false)))),
+		GraphQLEndpoint:            authenticate(read(limit("graphql")(makeGraphQLEndpoint(newGraphQLSchema(authSvc, todoSvc))))),
+	}
+	if limits != nil {
+		endpoints.clientIPs = limits.clientIPs
 	}
+	return endpoints
 }
@@ -0,0 +1,519 @@
+package auth_todo
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	TodoCreated   = "created"
+	TodoUpdated   = "updated"
+	TodoCompleted = "completed"
+	TodoDeleted   = "deleted"
+	// TodoAssigned and TodoUnassigned replace TodoUpdated for the new and
+	// the previous assignee of a todo.
+	TodoAssigned   = "assigned"
+	TodoUnassigned = "unassigned"
+	// TodoCommented is sent for new comments, except to the users they
+	// mention, who get TodoMentioned.
+	TodoCommented = "commented"
+	TodoMentioned = "mentioned"
+)
+
+type TodoEvent struct {
+	ID         uint64    `json:"id"`
+	Type       string    `json:"type"`
+	UserID     string    `json:"user_id"`
+	TodoID     string    `json:"todo_id"`
+	Todo       *Todo     `json:"todo,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is dropped. Dropped subscribers reconnect and resume from the replay buffer.
+const subscriberBuffer = 64
+
+// EventSubscription receives the events of one user until Close is called or
+// the subscriber falls too far behind, in which case C is closed and Dropped
+// reports true.
+type EventSubscription struct {
+	C <-chan TodoEvent
+
+	ch      chan TodoEvent
+	userID  string
+	broker  *EventBroker
+	dropped bool
+}
+
+func (sub *EventSubscription) Close() {
+	sub.broker.unsubscribe(sub)
+}
+
+func (sub *EventSubscription) Dropped() bool {
+	sub.broker.mu.Lock()
+	defer sub.broker.mu.Unlock()
+	return sub.dropped
+}
+
+// EventBroker fans todo events out to every subscription of their user and
+// keeps the last replaySize events per user so reconnecting clients can
+// resume where they left off. Event IDs continue from the microseconds since
+// the Unix epoch at which the broker was created, so IDs issued before a
+// restart are older than every ID of the new process and are recognised as
+// unknown.
+type EventBroker struct {
+	mu          sync.Mutex
+	epoch       uint64
+	lastID      uint64
+	replaySize  int
+	history     map[string][]TodoEvent
+	evicted     map[string]uint64
+	subscribers map[string]map[*EventSubscription]struct{}
+}
+
+func NewEventBroker(replaySize int) *EventBroker {
+	epoch := uint64(time.Now().UnixMicro())
+	return &EventBroker{
+		epoch:       epoch,
+		lastID:      epoch,
+		replaySize:  replaySize,
+		history:     make(map[string][]TodoEvent),
+		evicted:     make(map[string]uint64),
+		subscribers: make(map[string]map[*EventSubscription]struct{}),
+	}
+}
+
+func (b *EventBroker) Publish(userID, eventType string, todoID string, todo *Todo) TodoEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := TodoEvent{
+		ID:         b.lastID,
+		Type:       eventType,
+		UserID:     userID,
+		TodoID:     todoID,
+		Todo:       todo,
+		OccurredAt: time.Now(),
+	}
+
+	history := append(b.history[userID], event)
+	if len(history) > b.replaySize {
+		overflow := len(history) - b.replaySize
+		b.evicted[userID] = history[overflow-1].ID
+		history = append([]TodoEvent(nil), history[overflow:]...)
+	}
+	b.history[userID] = history
+
+	for sub := range b.subscribers[userID] {
+		select {
+		case sub.ch <- event:
+		default:
+			b.drop(sub)
+		}
+	}
+
+	return event
+}
+
+// Subscribe registers a subscription for userID. When lastEventID is
+// non-zero, the buffered events after it are returned for replay; complete
+// is false if some of those events have already been evicted, or lastEventID
+// was not issued by this broker, and the client should refetch its state
+// instead.
+func (b *EventBroker) Subscribe(userID string, lastEventID uint64) (sub *EventSubscription, replay []TodoEvent, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan TodoEvent, subscriberBuffer)
+	sub = &EventSubscription{C: ch, ch: ch, userID: userID, broker: b}
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[*EventSubscription]struct{})
+	}
+	b.subscribers[userID][sub] = struct{}{}
+
+	if lastEventID == 0 {
+		return sub, nil, true
+	}
+	if lastEventID < b.epoch || lastEventID > b.lastID {
+		return sub, nil, false
+	}
+
+	for _, event := range b.history[userID] {
+		if event.ID > lastEventID {
+			replay = append(replay, event)
+		}
+	}
+
+	return sub, replay, lastEventID >= b.evicted[userID]
+}
+
+func (b *EventBroker) unsubscribe(sub *EventSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub.userID][sub]; ok {
+		delete(b.subscribers[sub.userID], sub)
+		if len(b.subscribers[sub.userID]) == 0 {
+			delete(b.subscribers, sub.userID)
+		}
+		close(sub.ch)
+	}
+}
+
+// drop must be called with b.mu held.
+func (b *EventBroker) drop(sub *EventSubscription) {
+	sub.dropped = true
+	delete(b.subscribers[sub.userID], sub)
+	close(sub.ch)
+}
+
+type eventingTodoMiddleware struct {
+	broker *EventBroker
+	next   TodoService
+}
+
+// NewEventingTodoMiddleware publishes an event to broker after every
+// successful mutation. It belongs outside the cache so that clients reacting
+// to an event never read a stale listing.
+func NewEventingTodoMiddleware(broker *EventBroker, svc TodoService) TodoService {
+	return &eventingTodoMiddleware{
+		broker: broker,
+		next:   svc,
+	}
+}
+
+func (mw *eventingTodoMiddleware) CreateTodo(ctx context.Context, userID string, input TodoInput) (string, error) {
+	ctx, respaced := withRespacedTodos(ctx)
+	todoID, err := mw.next.CreateTodo(ctx, userID, input)
+	if err != nil {
+		return "", err
+	}
+	mw.publish(ctx, userID, TodoCreated, todoID)
+	mw.publishRespaced(ctx, userID, todoID, *respaced)
+	return todoID, nil
+}
+
+func (mw *eventingTodoMiddleware) GetTodo(ctx context.Context, userID, todoID string) (Todo, error) {
+	return mw.next.GetTodo(ctx, userID, todoID)
+}
+
+func (mw *eventingTodoMiddleware) ListTodos(ctx context.Context, userID string, filter TodoFilter, limit, offset int) ([]Todo, int, error) {
+	return mw.next.ListTodos(ctx, userID, filter, limit, offset)
+}
+
+func (mw *eventingTodoMiddleware) CompleteTodo(ctx context.Context, userID, todoID string) error {
+	if err := mw.next.CompleteTodo(ctx, userID, todoID); err != nil {
+		return err
+	}
+	mw.publish(ctx, userID, TodoCompleted, todoID)
+	return nil
+}
+
+func (mw *eventingTodoMiddleware) UpdateTodo(ctx context.Context, userID, todoID string, patch TodoPatch) (Todo, error) {
+	ctx, respaced := withRespacedTodos(ctx)
+	before, _ := mw.next.GetTodo(ctx, userID, todoID)
+	todo, err := mw.next.UpdateTodo(ctx, userID, todoID, patch)
+	if err != nil {
+		return Todo{}, err
+	}
+	mw.publishChange(ctx, userID, before, todo, func(string) string { return TodoUpdated })
+	mw.publishRespaced(ctx, userID, todoID, *respaced)
+	return todo, nil
+}
+
+// publishChange sends todo to everyone who sees it after a change made by
+// userID. Users who could only see it before, e.g. because it left a shared
+// list, get a TodoDeleted event without its contents instead.
+func (mw *eventingTodoMiddleware) publishChange(ctx context.Context, userID string, before, todo Todo, eventType func(id string) string) {
+	after := todoAudience(ctx, mw.next, userID, todo)
+	for _, id := range after {
+		mw.broker.Publish(id, eventType(id), todo.ID, &todo)
+	}
+	for _, id := range todoAudience(ctx, mw.next, userID, before) {
+		if !containsString(after, id) {
+			mw.broker.Publish(id, TodoDeleted, todo.ID, nil)
+		}
+	}
+}
+
+func (mw *eventingTodoMiddleware) DeleteTodo(ctx context.Context, userID, todoID string) error {
+	todo, err := mw.next.GetTodo(ctx, userID, todoID)
+	if err != nil {
+		return err
+	}
+	audience := todoAudience(ctx, mw.next, userID, todo)
+	if err := mw.next.DeleteTodo(ctx, userID, todoID); err != nil {
+		return err
+	}
+	for _, id := range audience {
+		mw.broker.Publish(id, TodoDeleted, todoID, &todo)
+	}
+	return nil
+}
+
+func (mw *eventingTodoMiddleware) CreateList(ctx context.Context, userID, name string) (string, error) {
+	return mw.next.CreateList(ctx, userID, name)
+}
+
+func (mw *eventingTodoMiddleware) ListLists(ctx context.Context, userID string) ([]List, error) {
+	return mw.next.ListLists(ctx, userID)
+}
+
+func (mw *eventingTodoMiddleware) ListTags(ctx context.Context, userID string) ([]Tag, error) {
+	return mw.next.ListTags(ctx, userID)
+}
+
+func (mw *eventingTodoMiddleware) ShareList(ctx context.Context, userID, listID, email, role string) (Invitation, error) {
+	return mw.next.ShareList(ctx, userID, listID, email, role)
+}
+
+func (mw *eventingTodoMiddleware) ListInvitations(ctx context.Context, email string) ([]Invitation, error) {
+	return mw.next.ListInvitations(ctx, email)
+}
+
+func (mw *eventingTodoMiddleware) RespondToInvitation(ctx context.Context, userID, email, invitationID string, accept bool) error {
+	return mw.next.RespondToInvitation(ctx, userID, email, invitationID, accept)
+}
+
+func (mw *eventingTodoMiddleware) ListMembers(ctx context.Context, userID, listID string) ([]ListMember, error) {
+	return mw.next.ListMembers(ctx, userID, listID)
+}
+
+func (mw *eventingTodoMiddleware) SetMemberRole(ctx context.Context, userID, listID, memberID, role string) error {
+	return mw.next.SetMemberRole(ctx, userID, listID, memberID, role)
+}
+
+func (mw *eventingTodoMiddleware) RemoveMember(ctx context.Context, userID, listID, memberID string) error {
+	return mw.next.RemoveMember(ctx, userID, listID, memberID)
+}
+
+// AssignTodo notifies the new assignee with a TodoAssigned event and the
+// previous one with TodoUnassigned; everyone else sees an update.
+func (mw *eventingTodoMiddleware) AssignTodo(ctx context.Context, userID, todoID, assigneeID string) (Todo, error) {
+	before, _ := mw.next.GetTodo(ctx, userID, todoID)
+	todo, err := mw.next.AssignTodo(ctx, userID, todoID, assigneeID)
+	if err != nil {
+		return Todo{}, err
+	}
+	mw.publishChange(ctx, userID, before, todo, func(id string) string {
+		switch {
+		case id == todo.AssigneeID && id != before.AssigneeID:
+			return TodoAssigned
+		case id == before.AssigneeID && id != todo.AssigneeID:
+			return TodoUnassigned
+		}
+		return TodoUpdated
+	})
+	return todo, nil
+}
+
+func (mw *eventingTodoMiddleware) AddComment(ctx context.Context, userID, todoID, text string) (Comment, error) {
+	comment, err := mw.next.AddComment(ctx, userID, todoID, text)
+	if err != nil {
+		return Comment{}, err
+	}
+	todo, err := mw.next.GetTodo(ctx, userID, todoID)
+	if err != nil {
+		return comment, nil
+	}
+	for _, id := range todoAudience(ctx, mw.next, userID, todo) {
+		eventType := TodoCommented
+		if containsString(comment.Mentions, id) {
+			eventType = TodoMentioned
+		}
+		mw.broker.Publish(id, eventType, todoID, &todo)
+	}
+	return comment, nil
+}
+
+func (mw *eventingTodoMiddleware) EditComment(ctx context.Context, userID, todoID, commentID, text string) (Comment, error) {
+	return mw.next.EditComment(ctx, userID, todoID, commentID, text)
+}
+
+func (mw *eventingTodoMiddleware) DeleteComment(ctx context.Context, userID, todoID, commentID string) error {
+	return mw.next.DeleteComment(ctx, userID, todoID, commentID)
+}
+
+func (mw *eventingTodoMiddleware) ListComments(ctx context.Context, userID, todoID string, limit, offset int) ([]Comment, int, error) {
+	return mw.next.ListComments(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *eventingTodoMiddleware) TodoActivity(ctx context.Context, userID, todoID string, limit, offset int) ([]Activity, int, error) {
+	return mw.next.TodoActivity(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *eventingTodoMiddleware) TodoHistory(ctx context.Context, userID, todoID string, limit, offset int) ([]TodoChange, int, error) {
+	return mw.next.TodoHistory(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *eventingTodoMiddleware) RevertTodo(ctx context.Context, userID, todoID string, version int) (Todo, error) {
+	ctx, respaced := withRespacedTodos(ctx)
+	before, _ := mw.next.GetTodo(ctx, userID, todoID)
+	todo, err := mw.next.RevertTodo(ctx, userID, todoID, version)
+	if err != nil {
+		return Todo{}, err
+	}
+	mw.publishChange(ctx, userID, before, todo, func(string) string { return TodoUpdated })
+	mw.publishRespaced(ctx, userID, todoID, *respaced)
+	return todo, nil
+}
+
+func (mw *eventingTodoMiddleware) MoveTodo(ctx context.Context, userID, todoID string, move TodoMove) (Todo, error) {
+	ctx, respaced := withRespacedTodos(ctx)
+	todo, err := mw.next.MoveTodo(ctx, userID, todoID, move)
+	if err != nil {
+		return Todo{}, err
+	}
+	for _, id := range todoAudience(ctx, mw.next, userID, todo) {
+		mw.broker.Publish(id, TodoUpdated, todoID, &todo)
+	}
+	mw.publishRespaced(ctx, userID, todoID, *respaced)
+	return todo, nil
+}
+
+// publishRespaced sends TodoUpdated for the todos whose ranks were respaced
+// while todoID was placed, other than todoID itself.
+func (mw *eventingTodoMiddleware) publishRespaced(ctx context.Context, userID, todoID string, respaced []Todo) {
+	for _, todo := range respaced {
+		if todo.ID == todoID {
+			continue
+		}
+		todo := todo
+		for _, id := range todoAudience(ctx, mw.next, userID, todo) {
+			mw.broker.Publish(id, TodoUpdated, todo.ID, &todo)
+		}
+	}
+}
+
+func (mw *eventingTodoMiddleware) GetWorkflow(ctx context.Context, userID, listID string) (Workflow, error) {
+	return mw.next.GetWorkflow(ctx, userID, listID)
+}
+
+func (mw *eventingTodoMiddleware) SetWorkflow(ctx context.Context, userID, listID string, workflow Workflow) (Workflow, error) {
+	return mw.next.SetWorkflow(ctx, userID, listID, workflow)
+}
+
+// TransitionTodo sends TodoCompleted when a todo reaches the terminal
+// status and TodoUpdated for other transitions.
+func (mw *eventingTodoMiddleware) TransitionTodo(ctx context.Context, userID, todoID, status string) (Todo, error) {
+	before, _ := mw.next.GetTodo(ctx, userID, todoID)
+	todo, err := mw.next.TransitionTodo(ctx, userID, todoID, status)
+	if err != nil {
+		return Todo{}, err
+	}
+	if todo.Status == before.Status {
+		return todo, nil
+	}
+	eventType := TodoUpdated
+	if todo.Completed && !before.Completed {
+		eventType = TodoCompleted
+	}
+	for _, id := range todoAudience(ctx, mw.next, userID, todo) {
+		mw.broker.Publish(id, eventType, todoID, &todo)
+	}
+	return todo, nil
+}
+
+func (mw *eventingTodoMiddleware) ListBoard(ctx context.Context, userID, listID string) (Board, error) {
+	return mw.next.ListBoard(ctx, userID, listID)
+}
+
+func (mw *eventingTodoMiddleware) AddBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error) {
+	todo, err := mw.next.AddBlocker(ctx, userID, todoID, blockerID)
+	if err != nil {
+		return Todo{}, err
+	}
+	for _, id := range todoAudience(ctx, mw.next, userID, todo) {
+		mw.broker.Publish(id, TodoUpdated, todoID, &todo)
+	}
+	return todo, nil
+}
+
+func (mw *eventingTodoMiddleware) RemoveBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error) {
+	todo, err := mw.next.RemoveBlocker(ctx, userID, todoID, blockerID)
+	if err != nil {
+		return Todo{}, err
+	}
+	for _, id := range todoAudience(ctx, mw.next, userID, todo) {
+		mw.broker.Publish(id, TodoUpdated, todoID, &todo)
+	}
+	return todo, nil
+}
+
+func (mw *eventingTodoMiddleware) ListNextTodos(ctx context.Context, userID string, limit, offset int) ([]Todo, int, error) {
+	return mw.next.ListNextTodos(ctx, userID, limit, offset)
+}
+
+func (mw *eventingTodoMiddleware) AddAttachment(ctx context.Context, userID, todoID, name string, r io.Reader) (Attachment, error) {
+	attachment, err := mw.next.AddAttachment(ctx, userID, todoID, name, r)
+	if err != nil {
+		return Attachment{}, err
+	}
+	mw.publish(ctx, userID, TodoUpdated, todoID)
+	return attachment, nil
+}
+
+func (mw *eventingTodoMiddleware) ListAttachments(ctx context.Context, userID, todoID string) ([]Attachment, error) {
+	return mw.next.ListAttachments(ctx, userID, todoID)
+}
+
+func (mw *eventingTodoMiddleware) OpenAttachment(ctx context.Context, userID, todoID, attachmentID string) (Attachment, io.ReadCloser, error) {
+	return mw.next.OpenAttachment(ctx, userID, todoID, attachmentID)
+}
+
+func (mw *eventingTodoMiddleware) DeleteAttachment(ctx context.Context, userID, todoID, attachmentID string) error {
+	if err := mw.next.DeleteAttachment(ctx, userID, todoID, attachmentID); err != nil {
+		return err
+	}
+	mw.publish(ctx, userID, TodoUpdated, todoID)
+	return nil
+}
+
+func (mw *eventingTodoMiddleware) AttachmentUsage(ctx context.Context, userID string) (int64, int64, error) {
+	return mw.next.AttachmentUsage(ctx, userID)
+}
+
+func (mw *eventingTodoMiddleware) StartTimer(ctx context.Context, userID, todoID, note string) (TimeEntry, error) {
+	return mw.next.StartTimer(ctx, userID, todoID, note)
+}
+
+func (mw *eventingTodoMiddleware) StopTimer(ctx context.Context, userID string) (TimeEntry, error) {
+	return mw.next.StopTimer(ctx, userID)
+}
+
+func (mw *eventingTodoMiddleware) AddTimeEntry(ctx context.Context, userID, todoID string, input TimeEntryInput) (TimeEntry, error) {
+	return mw.next.AddTimeEntry(ctx, userID, todoID, input)
+}
+
+func (mw *eventingTodoMiddleware) ListTimeEntries(ctx context.Context, userID, todoID string, limit, offset int) ([]TimeEntry, int, error) {
+	return mw.next.ListTimeEntries(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *eventingTodoMiddleware) DeleteTimeEntry(ctx context.Context, userID, todoID, entryID string) error {
+	return mw.next.DeleteTimeEntry(ctx, userID, todoID, entryID)
+}
+
+func (mw *eventingTodoMiddleware) TimeReport(ctx context.Context, userID string, query TimeQuery) (TimeReport, error) {
+	return mw.next.TimeReport(ctx, userID, query)
+}
+
+func (mw *eventingTodoMiddleware) Timesheet(ctx context.Context, userID string, query TimeQuery) ([]TimesheetEntry, error) {
+	return mw.next.Timesheet(ctx, userID, query)
+}
+
+// publish sends the event to everyone who sees the todo: its creator and
+// the members of its list.
+func (mw *eventingTodoMiddleware) publish(ctx context.Context, userID, eventType, todoID string) {
+	var todo *Todo
+	audience := []string{userID}
+	if t, err := mw.next.GetTodo(ctx, userID, todoID); err == nil {
+		todo = &t
+		audience = todoAudience(ctx, mw.next, userID, t)
+	}
+	for _, id := range audience {
+		mw.broker.Publish(id, eventType, todoID, todo)
+	}
+}
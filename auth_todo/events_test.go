@@ -0,0 +1,138 @@
+package auth_todo
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventBrokerReplay(t *testing.T) {
+	broker := NewEventBroker(2)
+
+	first := broker.Publish("user_1", TodoCreated, "todo_1", nil)
+	broker.Publish("user_2", TodoCreated, "todo_2", nil)
+	second := broker.Publish("user_1", TodoCompleted, "todo_1", nil)
+
+	sub, replay, complete := broker.Subscribe("user_1", first.ID)
+	defer sub.Close()
+	if !complete || len(replay) != 1 || replay[0].ID != second.ID {
+		t.Fatalf("Expected complete replay of event %d, got %v (complete=%v)", second.ID, replay, complete)
+	}
+
+	// Two more events evict both of the earlier ones from the buffer.
+	broker.Publish("user_1", TodoUpdated, "todo_1", nil)
+	broker.Publish("user_1", TodoDeleted, "todo_1", nil)
+
+	other, replay, complete := broker.Subscribe("user_1", first.ID)
+	defer other.Close()
+	if complete || len(replay) != 2 {
+		t.Fatalf("Expected incomplete replay of 2 events, got %v (complete=%v)", replay, complete)
+	}
+
+	fresh, replay, complete := broker.Subscribe("user_1", 0)
+	defer fresh.Close()
+	if !complete || replay != nil {
+		t.Fatal("Expected a fresh subscription without replay")
+	}
+}
+
+func TestEventBrokerUnknownIDs(t *testing.T) {
+	before := NewEventBroker(16)
+	old := before.Publish("user_1", TodoCreated, "todo_1", nil)
+
+	// A restarted broker issues IDs above those of the previous process and
+	// asks clients resuming from one of them to refetch.
+	time.Sleep(time.Millisecond)
+	broker := NewEventBroker(16)
+	event := broker.Publish("user_1", TodoUpdated, "todo_1", nil)
+	if event.ID <= old.ID {
+		t.Fatalf("Expected IDs to continue after %d, got %d", old.ID, event.ID)
+	}
+	for _, id := range []uint64{old.ID, event.ID + 1} {
+		sub, replay, complete := broker.Subscribe("user_1", id)
+		sub.Close()
+		if complete || replay != nil {
+			t.Errorf("Expected a reset for unknown ID %d, got %v (complete=%v)", id, replay, complete)
+		}
+	}
+}
+
+func TestEventBrokerDropsSlowSubscribers(t *testing.T) {
+	broker := NewEventBroker(subscriberBuffer * 2)
+	sub, _, _ := broker.Subscribe("user_1", 0)
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		broker.Publish("user_1", TodoCreated, "todo_1", nil)
+	}
+
+	if !sub.Dropped() {
+		t.Fatal("Expected slow subscriber to be dropped")
+	}
+	for range sub.C {
+	}
+	sub.Close()
+}
+
+func TestTodoEventsStream(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService()
+	authSvc.Signup(ctx, "test@example.com", "password123")
+	token, _ := authSvc.Login(ctx, "test@example.com", "password123")
+
+	broker := NewEventBroker(16)
+	todoSvc := NewEventingTodoMiddleware(broker, NewTodoService())
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(authSvc, todoSvc, broker, nil)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/v1/todos/events")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without a token, got %d", resp.StatusCode)
+	}
+
+	userID, _ := authSvc.ValidateToken(ctx, token)
+	earlier, _, _ := broker.Subscribe(userID, 0)
+	todoID, _ := todoSvc.CreateTodo(ctx, userID, TodoInput{Text: "Before connecting"})
+	created := <-earlier.C
+	earlier.Close()
+
+	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(reqCtx, http.MethodGet, server.URL+"/v1/todos/events?access_token="+token, nil)
+	req.Header.Set("Last-Event-ID", "0")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	todoSvc.CompleteTodo(ctx, userID, todoID)
+
+	scanner := bufio.NewScanner(resp.Body)
+	var events []string
+	for scanner.Scan() && len(events) < 1 {
+		if line := scanner.Text(); strings.HasPrefix(line, "event: ") {
+			events = append(events, strings.TrimPrefix(line, "event: "))
+		}
+	}
+	if len(events) != 1 || events[0] != TodoCompleted {
+		t.Fatalf("Expected a completed event, got %v", events)
+	}
+
+	// Resuming after the first event replays the completion.
+	sub, replay, complete := broker.Subscribe(userID, created.ID)
+	defer sub.Close()
+	if !complete || len(replay) != 1 || replay[0].Type != TodoCompleted {
+		t.Fatalf("Expected completed event in replay, got %v", replay)
+	}
+}
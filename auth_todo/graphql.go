@@ -0,0 +1,841 @@
+package auth_todo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/validator"
+)
+
+const graphqlSchemaSDL = `
+schema {
+  query: Query
+  mutation: Mutation
+}
+
+scalar Time
+
+type Query {
+  me: User!
+  todo(id: ID!): Todo
+  todos(filter: TodoFilter, limit: Int = 50, offset: Int = 0): TodoPage!
+  lists: [List!]!
+  tags: [Tag!]!
+}
+
+type Mutation {
+  createTodo(input: CreateTodoInput!): Todo!
+  completeTodo(id: ID!): Todo!
+  createList(name: String!): List!
+}
+
+type User {
+  id: ID!
+  email: String!
+  emailVerified: Boolean!
+  mfaEnabled: Boolean!
+  role: String!
+  createdAt: Time!
+}
+
+type Todo {
+  id: ID!
+  text: String!
+  completed: Boolean!
+  createdAt: Time!
+  tags: [String!]!
+  list: List
+}
+
+type List {
+  id: ID!
+  name: String!
+  role: String!
+  createdAt: Time!
+  todos(completed: Boolean, limit: Int = 50): [Todo!]!
+  todoCount: Int!
+}
+
+type Tag {
+  name: String!
+  count: Int!
+}
+
+type TodoPage {
+  todos: [Todo!]!
+  total: Int!
+  limit: Int!
+  offset: Int!
+  hasMore: Boolean!
+}
+
+input TodoFilter {
+  completed: Boolean
+  listId: ID
+  tag: String
+  search: String
+}
+
+input CreateTodoInput {
+  text: String!
+  listId: ID
+  tags: [String!]
+}
+`
+
+const (
+	// graphqlMaxDepth bounds how deeply selections may nest.
+	graphqlMaxDepth = 8
+	// graphqlMaxComplexity bounds the estimated number of fields resolved by
+	// one operation; see complexity.
+	graphqlMaxComplexity = 5000
+	// graphqlDefaultListSize is the assumed length of lists without a limit
+	// argument when estimating complexity.
+	graphqlDefaultListSize = 10
+	// graphqlPageSize is the page size used when the loader drains ListTodos.
+	graphqlPageSize = 100
+)
+
+var (
+	ErrQueryTooDeep    = errors.New("query exceeds maximum depth")
+	ErrQueryTooComplex = errors.New("query exceeds maximum complexity")
+)
+
+// graphqlResolver resolves one field for a batch of parent objects and
+// returns one value per parent, in order. A value that is an error is
+// reported for that parent only. Resolving a whole level of the result at
+// once lets list fields load their children with a single service call
+// instead of one call per parent.
+type graphqlResolver func(ctx context.Context, e *graphqlExecution, parents []interface{}, args map[string]interface{}) ([]interface{}, error)
+
+type graphqlSchema struct {
+	schema    *ast.Schema
+	authSvc   AuthService
+	todoSvc   TodoService
+	resolvers map[string]map[string]graphqlResolver
+}
+
+func newGraphQLSchema(authSvc AuthService, todoSvc TodoService) *graphqlSchema {
+	s := &graphqlSchema{
+		schema:  gqlparser.MustLoadSchema(&ast.Source{Name: "schema.graphql", Input: graphqlSchemaSDL}),
+		authSvc: authSvc,
+		todoSvc: todoSvc,
+	}
+	s.resolvers = s.makeResolvers()
+	return s
+}
+
+type graphqlExecution struct {
+	schema *graphqlSchema
+	userID string
+	vars   map[string]interface{}
+	loader *graphqlLoader
+	errors gqlerror.List
+}
+
+func (s *graphqlSchema) execute(ctx context.Context, req graphqlRequest) graphqlResponse {
+	userID, ok := UserIDFromContext(ctx)
+	if !ok {
+		return graphqlResponse{Errors: gqlerror.List{gqlerror.Wrap(ErrUnauthorized)}}
+	}
+
+	doc, errs := gqlparser.LoadQuery(s.schema, req.Query)
+	if len(errs) > 0 {
+		return graphqlResponse{Errors: errs}
+	}
+
+	op := doc.Operations.ForName(req.OperationName)
+	if op == nil {
+		return graphqlResponse{Errors: gqlerror.List{gqlerror.Errorf("operation %q not found", req.OperationName)}}
+	}
+
+	vars, err := validator.VariableValues(s.schema, op, req.Variables)
+	if err != nil {
+		return graphqlResponse{Errors: gqlerror.List{gqlerror.WrapIfUnwrapped(err)}}
+	}
+
+	if depth := selectionDepth(op.SelectionSet); depth > graphqlMaxDepth {
+		return graphqlResponse{Errors: gqlerror.List{gqlerror.Errorf("%s: %d > %d", ErrQueryTooDeep, depth, graphqlMaxDepth)}}
+	}
+	if cost := complexity(op.SelectionSet, vars, graphqlDefaultListSize); cost > graphqlMaxComplexity {
+		return graphqlResponse{Errors: gqlerror.List{gqlerror.Errorf("%s: %d > %d", ErrQueryTooComplex, cost, graphqlMaxComplexity)}}
+	}
+
+	rootType := "Query"
+	if op.Operation == ast.Mutation {
+		if !hasScope(ctx, ScopeTodosWrite) {
+			return graphqlResponse{Errors: gqlerror.List{gqlerror.Wrap(ErrInsufficientScope)}}
+		}
+		rootType = "Mutation"
+	}
+
+	e := &graphqlExecution{
+		schema: s,
+		userID: userID,
+		vars:   vars,
+		loader: newGraphQLLoader(s.todoSvc, userID),
+	}
+
+	var data interface{}
+	if result := e.executeSelectionSet(ctx, rootType, []interface{}{nil}, op.SelectionSet, []ast.Path{nil})[0]; result != (invalidNull{}) {
+		data = result
+	}
+
+	return graphqlResponse{Data: data, Errors: e.errors}
+}
+
+// invalidNull marks a null that reached a non-null position and must
+// propagate to the nearest nullable parent.
+type invalidNull struct{}
+
+type collectedField struct {
+	key    string
+	fields []*ast.Field
+}
+
+// collectFields flattens fragments and merges fields sharing a response key,
+// preserving the order in which keys first appear.
+func (e *graphqlExecution) collectFields(typeName string, sel ast.SelectionSet, out []*collectedField) []*collectedField {
+	for _, selection := range sel {
+		switch s := selection.(type) {
+		case *ast.Field:
+			if !e.included(s.Directives) {
+				continue
+			}
+			key := s.Alias
+			if key == "" {
+				key = s.Name
+			}
+			merged := false
+			for _, cf := range out {
+				if cf.key == key {
+					cf.fields = append(cf.fields, s)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				out = append(out, &collectedField{key: key, fields: []*ast.Field{s}})
+			}
+		case *ast.FragmentSpread:
+			if !e.included(s.Directives) || s.Definition.TypeCondition != typeName {
+				continue
+			}
+			out = e.collectFields(typeName, s.Definition.SelectionSet, out)
+		case *ast.InlineFragment:
+			if !e.included(s.Directives) || (s.TypeCondition != "" && s.TypeCondition != typeName) {
+				continue
+			}
+			out = e.collectFields(typeName, s.SelectionSet, out)
+		}
+	}
+	return out
+}
+
+func (e *graphqlExecution) included(directives ast.DirectiveList) bool {
+	if d := directives.ForName("skip"); d != nil && d.ArgumentMap(e.vars)["if"] == true {
+		return false
+	}
+	if d := directives.ForName("include"); d != nil && d.ArgumentMap(e.vars)["if"] == false {
+		return false
+	}
+	return true
+}
+
+func (e *graphqlExecution) executeSelectionSet(ctx context.Context, typeName string, objs []interface{}, sel ast.SelectionSet, paths []ast.Path) []interface{} {
+	objects := make([]*orderedObject, len(objs))
+	for i := range objects {
+		objects[i] = &orderedObject{values: make(map[string]interface{})}
+	}
+	invalid := make([]bool, len(objs))
+
+	for _, cf := range e.collectFields(typeName, sel, nil) {
+		field := cf.fields[0]
+		if field.Name == "__typename" {
+			for _, o := range objects {
+				o.set(cf.key, typeName)
+			}
+			continue
+		}
+
+		childPaths := make([]ast.Path, len(objs))
+		for i := range paths {
+			childPaths[i] = appendPath(paths[i], ast.PathName(cf.key))
+		}
+
+		var values []interface{}
+		var err error
+		if resolver, ok := e.schema.resolvers[typeName][field.Name]; ok {
+			values, err = resolver(ctx, e, objs, field.ArgumentMap(e.vars))
+		} else {
+			err = fmt.Errorf("field %s.%s is not supported", typeName, field.Name)
+		}
+		if err != nil {
+			values = make([]interface{}, len(objs))
+			for i := range values {
+				values[i] = err
+			}
+		}
+		for i, v := range values {
+			if fieldErr, ok := v.(error); ok {
+				e.addError(field, childPaths[i], fieldErr)
+				values[i] = nil
+			}
+		}
+
+		var children ast.SelectionSet
+		for _, f := range cf.fields {
+			children = append(children, f.SelectionSet...)
+		}
+
+		for i, v := range e.completeValues(ctx, field.Definition.Type, values, children, childPaths) {
+			if v == (invalidNull{}) {
+				invalid[i] = true
+				continue
+			}
+			objects[i].set(cf.key, v)
+		}
+	}
+
+	results := make([]interface{}, len(objs))
+	for i := range objs {
+		if invalid[i] {
+			results[i] = invalidNull{}
+		} else {
+			results[i] = objects[i]
+		}
+	}
+	return results
+}
+
+func (e *graphqlExecution) completeValues(ctx context.Context, typ *ast.Type, values []interface{}, sel ast.SelectionSet, paths []ast.Path) []interface{} {
+	out := make([]interface{}, len(values))
+	null := interface{}(nil)
+	if typ.NonNull {
+		null = invalidNull{}
+	}
+
+	if typ.Elem != nil {
+		var flat []interface{}
+		var flatPaths []ast.Path
+		var owners []int
+		for i, v := range values {
+			if v == nil {
+				continue
+			}
+			rv := reflect.ValueOf(v)
+			for j := 0; j < rv.Len(); j++ {
+				flat = append(flat, rv.Index(j).Interface())
+				flatPaths = append(flatPaths, appendPath(paths[i], ast.PathIndex(j)))
+				owners = append(owners, i)
+			}
+		}
+
+		lists := make([][]interface{}, len(values))
+		for i, v := range values {
+			if v != nil {
+				lists[i] = []interface{}{}
+			}
+		}
+		for k, item := range e.completeValues(ctx, typ.Elem, flat, sel, flatPaths) {
+			i := owners[k]
+			if lists[i] == nil {
+				continue
+			}
+			if item == (invalidNull{}) {
+				lists[i] = nil
+				continue
+			}
+			lists[i] = append(lists[i], item)
+		}
+
+		for i := range values {
+			if lists[i] == nil {
+				out[i] = null
+			} else {
+				out[i] = lists[i]
+			}
+		}
+		return out
+	}
+
+	def := e.schema.schema.Types[typ.NamedType]
+	if def.Kind != ast.Object {
+		for i, v := range values {
+			if v == nil {
+				out[i] = null
+			} else {
+				out[i] = serializeScalar(v)
+			}
+		}
+		return out
+	}
+
+	var objs []interface{}
+	var objPaths []ast.Path
+	var index []int
+	for i, v := range values {
+		if v == nil {
+			out[i] = null
+			continue
+		}
+		objs = append(objs, v)
+		objPaths = append(objPaths, paths[i])
+		index = append(index, i)
+	}
+	if len(objs) > 0 {
+		for k, result := range e.executeSelectionSet(ctx, typ.NamedType, objs, sel, objPaths) {
+			if result == (invalidNull{}) {
+				out[index[k]] = null
+			} else {
+				out[index[k]] = result
+			}
+		}
+	}
+	return out
+}
+
+func (e *graphqlExecution) addError(field *ast.Field, path ast.Path, err error) {
+	gqlErr := gqlerror.WrapPath(path, err)
+	if field.Position != nil {
+		gqlErr.Locations = []gqlerror.Location{{Line: field.Position.Line, Column: field.Position.Column}}
+	}
+	e.errors = append(e.errors, gqlErr)
+}
+
+func serializeScalar(v interface{}) interface{} {
+	if t, ok := v.(time.Time); ok {
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+func appendPath(path ast.Path, elem ast.PathElement) ast.Path {
+	out := make(ast.Path, len(path), len(path)+1)
+	copy(out, path)
+	return append(out, elem)
+}
+
+// selectionDepth returns the nesting depth of sel, looking through fragments.
+func selectionDepth(sel ast.SelectionSet) int {
+	max := 0
+	for _, selection := range sel {
+		depth := 0
+		switch s := selection.(type) {
+		case *ast.Field:
+			depth = 1 + selectionDepth(s.SelectionSet)
+		case *ast.FragmentSpread:
+			depth = selectionDepth(s.Definition.SelectionSet)
+		case *ast.InlineFragment:
+			depth = selectionDepth(s.SelectionSet)
+		}
+		if depth > max {
+			max = depth
+		}
+	}
+	return max
+}
+
+// complexity estimates how many fields sel resolves. Every field costs one,
+// and the children of a list field are multiplied by the list length: the
+// field's own limit argument, the limit of the enclosing page, or
+// graphqlDefaultListSize.
+func complexity(sel ast.SelectionSet, vars map[string]interface{}, pageSize int) int {
+	total := 0
+	for _, selection := range sel {
+		switch s := selection.(type) {
+		case *ast.Field:
+			if s.Definition == nil || strings.HasPrefix(s.Name, "__") {
+				total++
+				continue
+			}
+			childPageSize := graphqlDefaultListSize
+			multiplier := 1
+			if s.Definition.Type.Elem != nil {
+				multiplier = pageSize
+			}
+			if limit, ok := s.ArgumentMap(vars)["limit"]; ok && limit != nil {
+				childPageSize = clampLimit(toInt(limit))
+				if s.Definition.Type.Elem != nil {
+					multiplier = childPageSize
+				}
+			}
+			total += 1 + multiplier*complexity(s.SelectionSet, vars, childPageSize)
+		case *ast.FragmentSpread:
+			total += complexity(s.Definition.SelectionSet, vars, pageSize)
+		case *ast.InlineFragment:
+			total += complexity(s.SelectionSet, vars, pageSize)
+		}
+	}
+	return total
+}
+
+// clampLimit applies the same bounds as todoService.ListTodos.
+func clampLimit(limit int) int {
+	if limit <= 0 {
+		return 50
+	}
+	if limit > 100 {
+		return 100
+	}
+	return limit
+}
+
+func toInt(v interface{}) int {
+	switch n := v.(type) {
+	case int:
+		return n
+	case int32:
+		return int(n)
+	case int64:
+		return int(n)
+	case float64:
+		return int(n)
+	case json.Number:
+		i, _ := n.Int64()
+		return int(i)
+	}
+	return 0
+}
+
+func stringArg(args map[string]interface{}, name string) string {
+	s, _ := args[name].(string)
+	return s
+}
+
+func boolArg(args map[string]interface{}, name string) *bool {
+	b, ok := args[name].(bool)
+	if !ok {
+		return nil
+	}
+	return &b
+}
+
+func stringsArg(args map[string]interface{}, name string) []string {
+	values, _ := args[name].([]interface{})
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+type todoPage struct {
+	Todos  []Todo
+	Total  int
+	Limit  int
+	Offset int
+}
+
+func (s *graphqlSchema) makeResolvers() map[string]map[string]graphqlResolver {
+	return map[string]map[string]graphqlResolver{
+		"Query": {
+			"me": rootField(func(ctx context.Context, e *graphqlExecution, args map[string]interface{}) (interface{}, error) {
+				return s.authSvc.GetUser(ctx, e.userID)
+			}),
+			"todo": rootField(func(ctx context.Context, e *graphqlExecution, args map[string]interface{}) (interface{}, error) {
+				todo, err := s.todoSvc.GetTodo(ctx, e.userID, stringArg(args, "id"))
+				if err == ErrTodoNotFound {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				return todo, nil
+			}),
+			"todos": rootField(func(ctx context.Context, e *graphqlExecution, args map[string]interface{}) (interface{}, error) {
+				var filter TodoFilter
+				if in, ok := args["filter"].(map[string]interface{}); ok {
+					filter.Completed = boolArg(in, "completed")
+					if listID := stringArg(in, "listId"); listID != "" {
+						filter.ListIDs = []string{listID}
+					}
+					filter.Tag = stringArg(in, "tag")
+					filter.Search = stringArg(in, "search")
+				}
+				limit := clampLimit(toInt(args["limit"]))
+				offset := toInt(args["offset"])
+				todos, total, err := s.todoSvc.ListTodos(ctx, e.userID, filter, limit, offset)
+				if err != nil {
+					return nil, err
+				}
+				return todoPage{Todos: todos, Total: total, Limit: limit, Offset: offset}, nil
+			}),
+			"lists": rootField(func(ctx context.Context, e *graphqlExecution, args map[string]interface{}) (interface{}, error) {
+				lists, _, err := e.loader.lists(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return lists, nil
+			}),
+			"tags": rootField(func(ctx context.Context, e *graphqlExecution, args map[string]interface{}) (interface{}, error) {
+				tags, err := s.todoSvc.ListTags(ctx, e.userID)
+				if err != nil {
+					return nil, err
+				}
+				return tags, nil
+			}),
+		},
+		"Mutation": {
+			"createTodo": rootField(func(ctx context.Context, e *graphqlExecution, args map[string]interface{}) (interface{}, error) {
+				in, _ := args["input"].(map[string]interface{})
+				todoID, err := s.todoSvc.CreateTodo(ctx, e.userID, TodoInput{
+					Text:   stringArg(in, "text"),
+					ListID: stringArg(in, "listId"),
+					Tags:   stringsArg(in, "tags"),
+				})
+				if err != nil {
+					return nil, err
+				}
+				return s.todoSvc.GetTodo(ctx, e.userID, todoID)
+			}),
+			"completeTodo": rootField(func(ctx context.Context, e *graphqlExecution, args map[string]interface{}) (interface{}, error) {
+				todoID := stringArg(args, "id")
+				if err := s.todoSvc.CompleteTodo(ctx, e.userID, todoID); err != nil {
+					return nil, err
+				}
+				return s.todoSvc.GetTodo(ctx, e.userID, todoID)
+			}),
+			"createList": rootField(func(ctx context.Context, e *graphqlExecution, args map[string]interface{}) (interface{}, error) {
+				listID, err := s.todoSvc.CreateList(ctx, e.userID, stringArg(args, "name"))
+				if err != nil {
+					return nil, err
+				}
+				e.loader.reset()
+				_, byID, err := e.loader.lists(ctx)
+				if err != nil {
+					return nil, err
+				}
+				return byID[listID], nil
+			}),
+		},
+		"User": {
+			"id":            objectField(func(u User) interface{} { return u.ID }),
+			"email":         objectField(func(u User) interface{} { return u.Email }),
+			"emailVerified": objectField(func(u User) interface{} { return u.EmailVerified }),
+			"mfaEnabled":    objectField(func(u User) interface{} { return u.MFAEnabled }),
+			"role":          objectField(func(u User) interface{} { return u.Role }),
+			"createdAt":     objectField(func(u User) interface{} { return u.CreatedAt }),
+		},
+		"Todo": {
+			"id":        objectField(func(t Todo) interface{} { return t.ID }),
+			"text":      objectField(func(t Todo) interface{} { return t.Text }),
+			"completed": objectField(func(t Todo) interface{} { return t.Completed }),
+			"createdAt": objectField(func(t Todo) interface{} { return t.CreatedAt }),
+			"tags": objectField(func(t Todo) interface{} {
+				if t.Tags == nil {
+					return []string{}
+				}
+				return t.Tags
+			}),
+			"list": func(ctx context.Context, e *graphqlExecution, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+				_, byID, err := e.loader.lists(ctx)
+				if err != nil {
+					return nil, err
+				}
+				out := make([]interface{}, len(parents))
+				for i, p := range parents {
+					if list, ok := byID[p.(Todo).ListID]; ok {
+						out[i] = list
+					}
+				}
+				return out, nil
+			},
+		},
+		"List": {
+			"id":        objectField(func(l List) interface{} { return l.ID }),
+			"name":      objectField(func(l List) interface{} { return l.Name }),
+			"role":      objectField(func(l List) interface{} { return l.Role }),
+			"createdAt": objectField(func(l List) interface{} { return l.CreatedAt }),
+			"todos": func(ctx context.Context, e *graphqlExecution, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+				byList, err := e.loader.todosByList(ctx, listIDs(parents), boolArg(args, "completed"))
+				if err != nil {
+					return nil, err
+				}
+				limit := clampLimit(toInt(args["limit"]))
+				out := make([]interface{}, len(parents))
+				for i, p := range parents {
+					todos := append([]Todo{}, byList[p.(List).ID]...)
+					if len(todos) > limit {
+						todos = todos[:limit]
+					}
+					out[i] = todos
+				}
+				return out, nil
+			},
+			"todoCount": func(ctx context.Context, e *graphqlExecution, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+				byList, err := e.loader.todosByList(ctx, listIDs(parents), nil)
+				if err != nil {
+					return nil, err
+				}
+				out := make([]interface{}, len(parents))
+				for i, p := range parents {
+					out[i] = len(byList[p.(List).ID])
+				}
+				return out, nil
+			},
+		},
+		"Tag": {
+			"name":  objectField(func(t Tag) interface{} { return t.Name }),
+			"count": objectField(func(t Tag) interface{} { return t.Count }),
+		},
+		"TodoPage": {
+			"todos":   objectField(func(p todoPage) interface{} { return p.Todos }),
+			"total":   objectField(func(p todoPage) interface{} { return p.Total }),
+			"limit":   objectField(func(p todoPage) interface{} { return p.Limit }),
+			"offset":  objectField(func(p todoPage) interface{} { return p.Offset }),
+			"hasMore": objectField(func(p todoPage) interface{} { return p.Offset+len(p.Todos) < p.Total }),
+		},
+	}
+}
+
+// rootField adapts a resolver for a field of Query or Mutation, which always
+// has a single parent.
+func rootField(fn func(ctx context.Context, e *graphqlExecution, args map[string]interface{}) (interface{}, error)) graphqlResolver {
+	return func(ctx context.Context, e *graphqlExecution, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+		v, err := fn(ctx, e, args)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{v}, nil
+	}
+}
+
+// objectField adapts an accessor on an already loaded object.
+func objectField[T any](fn func(T) interface{}) graphqlResolver {
+	return func(ctx context.Context, e *graphqlExecution, parents []interface{}, args map[string]interface{}) ([]interface{}, error) {
+		out := make([]interface{}, len(parents))
+		for i, p := range parents {
+			out[i] = fn(p.(T))
+		}
+		return out, nil
+	}
+}
+
+func listIDs(parents []interface{}) []string {
+	ids := make([]string, len(parents))
+	for i, p := range parents {
+		ids[i] = p.(List).ID
+	}
+	return ids
+}
+
+// graphqlLoader memoizes service calls for the duration of one operation so
+// that sibling fields share results.
+type graphqlLoader struct {
+	todoSvc   TodoService
+	userID    string
+	listSlice []List
+	listByID  map[string]List
+	byList    map[string]map[string][]Todo
+}
+
+func newGraphQLLoader(todoSvc TodoService, userID string) *graphqlLoader {
+	return &graphqlLoader{
+		todoSvc: todoSvc,
+		userID:  userID,
+		byList:  make(map[string]map[string][]Todo),
+	}
+}
+
+func (l *graphqlLoader) reset() {
+	l.listSlice = nil
+	l.listByID = nil
+	l.byList = make(map[string]map[string][]Todo)
+}
+
+func (l *graphqlLoader) lists(ctx context.Context) ([]List, map[string]List, error) {
+	if l.listByID != nil {
+		return l.listSlice, l.listByID, nil
+	}
+
+	lists, err := l.todoSvc.ListLists(ctx, l.userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	l.listSlice = lists
+	l.listByID = make(map[string]List, len(lists))
+	for _, list := range lists {
+		l.listByID[list.ID] = list
+	}
+	return l.listSlice, l.listByID, nil
+}
+
+// todosByList loads the todos of every list in listIDs with one filtered
+// ListTodos query, paging through it, and groups them by list.
+func (l *graphqlLoader) todosByList(ctx context.Context, listIDs []string, completed *bool) (map[string][]Todo, error) {
+	ids := append([]string{}, listIDs...)
+	sort.Strings(ids)
+	filter := TodoFilter{ListIDs: ids, Completed: completed}
+	key := filter.key()
+
+	if byList, ok := l.byList[key]; ok {
+		return byList, nil
+	}
+
+	byList := make(map[string][]Todo)
+	for offset := 0; ; offset += graphqlPageSize {
+		todos, total, err := l.todoSvc.ListTodos(ctx, l.userID, filter, graphqlPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range todos {
+			byList[t.ListID] = append(byList[t.ListID], t)
+		}
+		if len(todos) == 0 || offset+len(todos) >= total {
+			break
+		}
+	}
+
+	l.byList[key] = byList
+	return byList, nil
+}
+
+// orderedObject is a JSON object that keeps the field order of the query.
+type orderedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *orderedObject) set(key string, value interface{}) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
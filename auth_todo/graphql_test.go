@@ -0,0 +1,145 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type countingTodoService struct {
+	TodoService
+	listTodosCalls int
+	listListsCalls int
+}
+
+func (s *countingTodoService) ListTodos(ctx context.Context, userID string, filter TodoFilter, limit, offset int) ([]Todo, int, error) {
+	s.listTodosCalls++
+	return s.TodoService.ListTodos(ctx, userID, filter, limit, offset)
+}
+
+func (s *countingTodoService) ListLists(ctx context.Context, userID string) ([]List, error) {
+	s.listListsCalls++
+	return s.TodoService.ListLists(ctx, userID)
+}
+
+func execGraphQL(t *testing.T, schema *graphqlSchema, userID, query string, vars map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	ctx := context.WithValue(context.Background(), userIDContextKey, userID)
+	resp := schema.execute(ctx, graphqlRequest{Query: query, Variables: vars})
+
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var out map[string]interface{}
+	json.Unmarshal(raw, &out)
+	return out
+}
+
+func TestGraphQLQueryAndBatching(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService()
+	userID, _ := authSvc.Signup(ctx, "test@example.com", "password123")
+
+	todoSvc := &countingTodoService{TodoService: NewTodoService()}
+	for i := 0; i < 5; i++ {
+		listID, _ := todoSvc.CreateList(ctx, userID, "List")
+		todoSvc.CreateTodo(ctx, userID, TodoInput{Text: "Todo", ListID: listID, Tags: []string{"work"}})
+	}
+	schema := newGraphQLSchema(authSvc, todoSvc)
+
+	out := execGraphQL(t, schema, userID, `
+		query Dashboard {
+			me { email }
+			lists { id name todoCount todos(limit: 10) { id text list { name } } }
+			tags { name count }
+			page: todos(filter: {tag: "work"}, limit: 2) { total hasMore todos { id } }
+		}`, nil)
+	if out["errors"] != nil {
+		t.Fatalf("Unexpected errors: %v", out["errors"])
+	}
+
+	data := out["data"].(map[string]interface{})
+	if email := data["me"].(map[string]interface{})["email"]; email != "test@example.com" {
+		t.Fatalf("Expected me.email test@example.com, got %v", email)
+	}
+	lists := data["lists"].([]interface{})
+	if len(lists) != 5 {
+		t.Fatalf("Expected 5 lists, got %d", len(lists))
+	}
+	for _, l := range lists {
+		todos := l.(map[string]interface{})["todos"].([]interface{})
+		if len(todos) != 1 {
+			t.Fatalf("Expected 1 todo per list, got %d", len(todos))
+		}
+	}
+	page := data["page"].(map[string]interface{})
+	if page["total"].(float64) != 5 || page["hasMore"] != true {
+		t.Fatalf("Unexpected page: %v", page)
+	}
+
+	// One ListTodos for lists.todos/todoCount plus one for the page, however
+	// many lists there are.
+	if todoSvc.listTodosCalls != 2 {
+		t.Fatalf("Expected 2 ListTodos calls, got %d", todoSvc.listTodosCalls)
+	}
+	if todoSvc.listListsCalls != 1 {
+		t.Fatalf("Expected 1 ListLists call, got %d", todoSvc.listListsCalls)
+	}
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	schema := newGraphQLSchema(NewAuthService(), NewTodoService())
+
+	out := execGraphQL(t, schema, "user_1", `
+		mutation Create($text: String!) {
+			createTodo(input: {text: $text, tags: ["Home"]}) { id completed tags }
+		}`, map[string]interface{}{"text": "Water plants"})
+	if out["errors"] != nil {
+		t.Fatalf("Unexpected errors: %v", out["errors"])
+	}
+	todo := out["data"].(map[string]interface{})["createTodo"].(map[string]interface{})
+	if todo["completed"] != false || todo["tags"].([]interface{})[0] != "home" {
+		t.Fatalf("Unexpected todo: %v", todo)
+	}
+
+	out = execGraphQL(t, schema, "user_1", `mutation($id: ID!) { completeTodo(id: $id) { completed } }`,
+		map[string]interface{}{"id": todo["id"]})
+	if out["data"].(map[string]interface{})["completeTodo"].(map[string]interface{})["completed"] != true {
+		t.Fatalf("Expected todo to be completed, got %v", out)
+	}
+
+	// Errors on a non-null root field null out data.
+	out = execGraphQL(t, schema, "different_user", `mutation($id: ID!) { completeTodo(id: $id) { completed } }`,
+		map[string]interface{}{"id": todo["id"]})
+	if out["data"] != nil || !strings.Contains(toJSON(out["errors"]), ErrUnauthorized.Error()) {
+		t.Fatalf("Expected unauthorized error, got %v", out)
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	schema := newGraphQLSchema(NewAuthService(), NewTodoService())
+
+	deep := `{ lists { todos { list { todos { list { todos { list { todos { id } } } } } } } } }`
+	out := execGraphQL(t, schema, "user_1", deep, nil)
+	if !strings.Contains(toJSON(out["errors"]), ErrQueryTooDeep.Error()) {
+		t.Fatalf("Expected depth error, got %v", out)
+	}
+
+	wide := `{ lists { todos(limit: 100) { list { todos(limit: 100) { id } } } } }`
+	out = execGraphQL(t, schema, "user_1", wide, nil)
+	if !strings.Contains(toJSON(out["errors"]), ErrQueryTooComplex.Error()) {
+		t.Fatalf("Expected complexity error, got %v", out)
+	}
+
+	out = execGraphQL(t, schema, "user_1", `{ nope }`, nil)
+	if out["errors"] == nil {
+		t.Fatal("Expected validation error for unknown field")
+	}
+}
+
+func toJSON(v interface{}) string {
+	raw, _ := json.Marshal(v)
+	return string(raw)
+}
@@ -0,0 +1,193 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// TodoReverted is the type of the history and activity entries of reverts.
+// Subscribers receive them as updated events.
+const TodoReverted = "reverted"
+
+var ErrVersionNotFound = errors.New("version not found")
+
+// TodoChange is an entry of the history of a todo: the state it was left in
+// by a mutation, with the state before it. Version counts the changes from
+// 1, its creation, which has no Before. Changed names the fields that
+// differ between the two.
+type TodoChange struct {
+	Version int
+	TodoID  string
+	UserID  string
+	Action  string
+	Changed []string `json:",omitempty"`
+	Before  *Todo    `json:",omitempty"`
+	After   Todo
+	At      time.Time
+}
+
+// changedFields names the fields of a todo a client can change that differ
+// between before and after.
+func changedFields(before, after Todo) []string {
+	var changed []string
+	if before.Text != after.Text {
+		changed = append(changed, "Text")
+	}
+	if before.ListID != after.ListID {
+		changed = append(changed, "ListID")
+	}
+	if before.AssigneeID != after.AssigneeID {
+		changed = append(changed, "AssigneeID")
+	}
+	if !equalStrings(before.Tags, after.Tags) {
+		changed = append(changed, "Tags")
+	}
+	if before.Completed != after.Completed {
+		changed = append(changed, "Completed")
+	}
+	if before.Status != after.Status {
+		changed = append(changed, "Status")
+	}
+	if !equalStrings(before.BlockedBy, after.BlockedBy) {
+		changed = append(changed, "BlockedBy")
+	}
+	if before.Rank != after.Rank {
+		changed = append(changed, "Rank")
+	}
+	return changed
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshot copies todo so that history entries do not share its tags.
+func snapshot(todo Todo) Todo {
+	todo.Tags = append([]string(nil), todo.Tags...)
+	return todo
+}
+
+// appendHistory appends the state a mutation by userID left todo in to its
+// history. It must be called with s.mu held.
+func (s *todoService) appendHistory(todo Todo, userID, action string) {
+	history := s.history[todo.ID]
+	change := TodoChange{
+		Version: len(history) + 1,
+		TodoID:  todo.ID,
+		UserID:  userID,
+		Action:  action,
+		After:   snapshot(todo),
+		At:      time.Now(),
+	}
+	if len(history) > 0 {
+		before := history[len(history)-1].After
+		change.Before = &before
+		change.Changed = changedFields(before, todo)
+	}
+	s.history[todo.ID] = append(history, change)
+}
+
+// TodoHistory returns the history of a todo, oldest first, with its total
+// number of entries. Anyone who can read a todo can read its history. The
+// history outlives the todo: it ends with a deleted entry, and stays
+// readable by those who could read the todo when it was deleted.
+func (s *todoService) TodoHistory(ctx context.Context, userID, todoID string, limit, offset int) ([]TodoChange, int, error) {
+	s.mu.RLock()
+	history := s.history[todoID]
+	if len(history) == 0 {
+		s.mu.RUnlock()
+		return nil, 0, ErrTodoNotFound
+	}
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		todo = history[len(history)-1].After
+	}
+	if s.todoRole(todo, userID) == "" {
+		s.mu.RUnlock()
+		return nil, 0, ErrUnauthorized
+	}
+	s.mu.RUnlock()
+
+	// Entries are never changed once appended, so the slice can be read
+	// without the lock.
+	start, end := page(len(history), limit, offset)
+	return history[start:end:end], len(history), nil
+}
+
+// RevertTodo restores the fields of a todo to the state after version of
+// its history, as a new change. Editors of a todo may revert it, unless that
+// moves it to another list while they are neither its creator nor an owner
+// of its list, moves it into a list they cannot edit, or completes it while
+// it is blocked. Restoring another status is subject to the same transition
+// rules and WIP limits as TransitionTodo. The todo is unassigned if the
+// assignee of that version can no longer edit it.
+func (s *todoService) RevertTodo(ctx context.Context, userID, todoID string, version int) (Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return Todo{}, ErrTodoNotFound
+	}
+	if !canEdit(s.todoRole(todo, userID)) {
+		return Todo{}, ErrUnauthorized
+	}
+	history := s.history[todoID]
+	if version < 1 || version > len(history) {
+		return Todo{}, ErrVersionNotFound
+	}
+
+	target := history[version-1].After
+	if target.ListID != todo.ListID && !s.canMove(todo, userID) {
+		return Todo{}, ErrUnauthorized
+	}
+	if target.ListID != todo.ListID && target.ListID != "" {
+		list, exists := s.lists[target.ListID]
+		if !exists {
+			return Todo{}, ErrListNotFound
+		}
+		if !canEdit(s.listRole(list, userID)) {
+			return Todo{}, ErrUnauthorized
+		}
+	}
+
+	current := todo
+	todo.Text = target.Text
+	todo.ListID = target.ListID
+	todo.Tags = append([]string(nil), target.Tags...)
+	todo.Completed = target.Completed
+	todo.Status = target.Status
+	s.fitStatus(&todo)
+	if todo.Status != current.Status {
+		w := s.workflow(todo.ListID)
+		if todo.ListID == current.ListID && !w.allows(current.Status, todo.Status) {
+			return Todo{}, ErrTransitionNotAllowed
+		}
+		if status, _ := w.status(todo.Status); status.WIPLimit > 0 && s.countStatus(todo.ListID, todo.Status, todo.ID) >= status.WIPLimit {
+			return Todo{}, ErrWIPLimitReached
+		}
+	}
+	if todo.Completed && !s.canComplete(todo) {
+		return Todo{}, ErrTodoBlocked
+	}
+	todo.AssigneeID = target.AssigneeID
+	if todo.AssigneeID != "" && !canEdit(s.todoRole(todo, todo.AssigneeID)) {
+		todo.AssigneeID = ""
+	}
+	if todo.ListID != current.ListID {
+		todo.Rank = s.nextRank(ctx, userID, rankScopeOf(todo))
+	}
+	s.storeTodo(todo)
+	s.record(todo, userID, TodoReverted)
+
+	return todo, nil
+}
@@ -0,0 +1,85 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+type todoHistoryResponse struct {
+	History []TodoChange `json:"history,omitempty"`
+	Total   int          `json:"total"`
+	Limit   int          `json:"limit"`
+	Offset  int          `json:"offset"`
+	Err     string       `json:"error,omitempty"`
+}
+
+func makeTodoHistoryEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(todoPageRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		history, total, err := svc.TodoHistory(ctx, userID, req.TodoID, req.Limit, req.Offset)
+		if err != nil {
+			return todoHistoryResponse{Err: err.Error()}, nil
+		}
+		return todoHistoryResponse{History: history, Total: total, Limit: req.Limit, Offset: req.Offset}, nil
+	}
+}
+
+type revertTodoRequest struct {
+	TodoID  string `json:"-"`
+	Version int    `json:"version"`
+}
+
+func makeRevertTodoEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(revertTodoRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		todo, err := svc.RevertTodo(ctx, userID, req.TodoID, req.Version)
+		if err != nil {
+			return updateTodoResponse{Err: err.Error()}, nil
+		}
+		return updateTodoResponse{Todo: &todo}, nil
+	}
+}
+
+func decodeRevertTodoRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req revertTodoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.TodoID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func MakeTodoHistoryHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.TodoHistoryEndpoint,
+		decodeTodoPageRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeRevertTodoHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.RevertTodoEndpoint,
+		decodeRevertTodoRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
@@ -0,0 +1,74 @@
+package auth_todo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTodoHistory(t *testing.T) {
+	ctx := context.Background()
+	broker := NewEventBroker(16)
+	svc := NewEventingTodoMiddleware(broker, NewTodoService())
+	listID, _ := svc.CreateList(ctx, "owner", "Launch")
+	todoID, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "Write post", Tags: []string{"blog"}})
+	inv, _ := svc.ShareList(ctx, "owner", listID, "viewer@example.com", ListRoleViewer)
+	svc.RespondToInvitation(ctx, "viewer", "viewer@example.com", inv.ID, true)
+
+	text := "Write launch post"
+	svc.UpdateTodo(ctx, "owner", todoID, TodoPatch{Text: &text, ListID: &listID})
+	svc.CompleteTodo(ctx, "owner", todoID)
+
+	if _, _, err := svc.TodoHistory(ctx, "stranger", todoID, 10, 0); err != ErrUnauthorized {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	history, total, err := svc.TodoHistory(ctx, "viewer", todoID, 10, 0)
+	if err != nil || total != 3 {
+		t.Fatalf("Expected three entries, got %d %v", total, err)
+	}
+	if history[0].Action != TodoCreated || history[0].Before != nil || history[0].Version != 1 {
+		t.Errorf("Unexpected creation entry %+v", history[0])
+	}
+	update := history[1]
+	if update.UserID != "owner" || update.Before.Text != "Write post" || update.After.Text != text ||
+		!reflect.DeepEqual(update.Changed, []string{"Text", "ListID"}) {
+		t.Errorf("Unexpected update entry %+v", update)
+	}
+	if !reflect.DeepEqual(history[2].Changed, []string{"Completed", "Status"}) {
+		t.Errorf("Expected the completion to change Completed and Status, got %v", history[2].Changed)
+	}
+
+	if _, err := svc.RevertTodo(ctx, "viewer", todoID, 1); err != ErrUnauthorized {
+		t.Errorf("Expected viewers not to revert, got %v", err)
+	}
+	if _, err := svc.RevertTodo(ctx, "owner", todoID, 4); err != ErrVersionNotFound {
+		t.Errorf("Expected ErrVersionNotFound, got %v", err)
+	}
+	sub, _, _ := broker.Subscribe("viewer", 0)
+	defer sub.Close()
+	reverted, err := svc.RevertTodo(ctx, "owner", todoID, 1)
+	if err != nil {
+		t.Fatalf("RevertTodo failed: %v", err)
+	}
+	if reverted.Text != "Write post" || reverted.ListID != "" || reverted.Completed || !reflect.DeepEqual(reverted.Tags, []string{"blog"}) {
+		t.Errorf("Expected the first version, got %+v", reverted)
+	}
+	if event := <-sub.C; event.Type != TodoDeleted || event.TodoID != todoID || event.Todo != nil {
+		t.Errorf("Expected the former list member to see only a deletion, got %+v", event)
+	}
+
+	svc.DeleteTodo(ctx, "owner", todoID)
+	history, total, err = svc.TodoHistory(ctx, "owner", todoID, 2, 3)
+	if err != nil || total != 5 || len(history) != 2 {
+		t.Fatalf("Expected the history to outlive the todo, got %d %v", total, err)
+	}
+	if history[0].Action != TodoReverted || history[1].Action != TodoDeleted || history[1].UserID != "owner" {
+		t.Errorf("Expected the revert and the deletion last, got %+v", history)
+	}
+	if _, _, err := svc.TodoHistory(ctx, "viewer", todoID, 10, 0); err != ErrUnauthorized {
+		t.Errorf("Expected the history to be readable only by those who could read the todo, got %v", err)
+	}
+	if _, err := svc.RevertTodo(ctx, "owner", todoID, 1); err != ErrTodoNotFound {
+		t.Errorf("Expected deleted todos not to be reverted, got %v", err)
+	}
+}
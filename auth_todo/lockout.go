@@ -0,0 +1,296 @@
+package auth_todo
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrTooManyLoginAttempts = errors.New("too many failed login attempts")
+
+// LoginThrottledError is returned by Login while an account or client IP is
+// backing off or locked out. It matches ErrTooManyLoginAttempts with
+// errors.Is.
+type LoginThrottledError struct {
+	Until  time.Time
+	Locked bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	return ErrTooManyLoginAttempts.Error()
+}
+
+func (e *LoginThrottledError) Is(target error) bool {
+	return target == ErrTooManyLoginAttempts
+}
+
+// LoginThrottlePolicy lets FreeAttempts failures through without delay.
+// Every further failure doubles the wait before the next attempt, starting
+// at BaseDelay and capped at MaxDelay, until LockoutAfter failures lock the
+// subject out for LockoutDuration. Failures are forgotten after Window
+// without a new one.
+type LoginThrottlePolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+// LoginThrottleConfig holds the policies applied per account and per client
+// IP. The IP policy should be looser, since many users may share an address.
+type LoginThrottleConfig struct {
+	Account LoginThrottlePolicy
+	IP      LoginThrottlePolicy
+}
+
+func DefaultLoginThrottleConfig() LoginThrottleConfig {
+	return LoginThrottleConfig{
+		Account: LoginThrottlePolicy{
+			FreeAttempts:    3,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockoutAfter:    10,
+			LockoutDuration: 15 * time.Minute,
+			Window:          time.Hour,
+		},
+		IP: LoginThrottlePolicy{
+			FreeAttempts:    20,
+			BaseDelay:       time.Second,
+			MaxDelay:        time.Minute,
+			LockoutAfter:    100,
+			LockoutDuration: time.Hour,
+			Window:          time.Hour,
+		},
+	}
+}
+
+const (
+	LoginFailed     = "login_failed"
+	AccountLocked   = "account_locked"
+	AccountUnlocked = "account_unlocked"
+	IPLocked        = "ip_locked"
+)
+
+// LoginEvent reports failed logins and lockouts to the hook installed with
+// WithLoginEventHook. Email is the address that was tried, which may not
+// belong to any account.
+type LoginEvent struct {
+	Type     string
+	Email    string
+	IP       string
+	Failures int
+	Until    time.Time
+}
+
+type loginFailures struct {
+	count       int
+	pending     int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// loginThrottle counts failed logins per account and per IP. Unknown emails
+// are tracked exactly like existing ones so that lockouts do not reveal
+// which accounts exist.
+type loginThrottle struct {
+	config LoginThrottleConfig
+	hook   func(LoginEvent)
+	now    func() time.Time
+
+	mu       sync.Mutex
+	accounts map[string]*loginFailures
+	ips      map[string]*loginFailures
+	sweptAt  time.Time
+}
+
+func newLoginThrottle(config LoginThrottleConfig) *loginThrottle {
+	return &loginThrottle{
+		config:   config,
+		now:      time.Now,
+		accounts: make(map[string]*loginFailures),
+		ips:      make(map[string]*loginFailures),
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// reserve returns an error if a login for email from ip must wait, and
+// otherwise counts the attempt as a failure until fail, succeed or release
+// settles it. Counting it up front keeps parallel guesses from all passing
+// before any of them is found wrong.
+func (t *loginThrottle) reserve(email, ip string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	email = normalizeEmail(email)
+	if err := t.wait(t.accounts[email], t.config.Account, now); err != nil {
+		return err
+	}
+	if ip != "" {
+		if err := t.wait(t.ips[ip], t.config.IP, now); err != nil {
+			return err
+		}
+	}
+
+	t.sweep(now)
+	t.count(t.accounts, email, t.config.Account, now)
+	if ip != "" {
+		t.count(t.ips, ip, t.config.IP, now)
+	}
+	return nil
+}
+
+func (t *loginThrottle) wait(f *loginFailures, policy LoginThrottlePolicy, now time.Time) error {
+	if f == nil {
+		return nil
+	}
+	if now.Before(f.lockedUntil) {
+		return &LoginThrottledError{Until: f.lockedUntil, Locked: true}
+	}
+	if f.count <= policy.FreeAttempts || now.Sub(f.last) > policy.Window {
+		return nil
+	}
+
+	delay := policy.BaseDelay
+	for i := policy.FreeAttempts + 1; i < f.count && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	if until := f.last.Add(delay); now.Before(until) {
+		return &LoginThrottledError{Until: until}
+	}
+	return nil
+}
+
+// count adds a pending failure for key. It must be called with t.mu held.
+func (t *loginThrottle) count(failures map[string]*loginFailures, key string, policy LoginThrottlePolicy, now time.Time) {
+	f := failures[key]
+	if f == nil || now.Sub(f.last) > policy.Window {
+		f = &loginFailures{}
+		failures[key] = f
+	}
+	f.count++
+	f.pending++
+	f.last = now
+}
+
+// fail settles a reserved login for email from ip as failed.
+func (t *loginThrottle) fail(email, ip string) {
+	t.mu.Lock()
+	now := t.now()
+	email = normalizeEmail(email)
+
+	account, locked := t.record(t.accounts, email, t.config.Account, now)
+	events := []LoginEvent{{Type: LoginFailed, Email: email, IP: ip, Failures: account.count}}
+	if locked {
+		events = append(events, LoginEvent{Type: AccountLocked, Email: email, IP: ip, Failures: account.count, Until: account.lockedUntil})
+	}
+	if ip != "" {
+		if addr, locked := t.record(t.ips, ip, t.config.IP, now); locked {
+			events = append(events, LoginEvent{Type: IPLocked, Email: email, IP: ip, Failures: addr.count, Until: addr.lockedUntil})
+		}
+	}
+	t.mu.Unlock()
+
+	t.notify(events...)
+}
+
+// record turns a pending failure of key into a failure and reports whether
+// it locked key out. Every failure from LockoutAfter on locks again, so the
+// lockout repeats for as long as the failures continue within the window.
+// It must be called with t.mu held.
+func (t *loginThrottle) record(failures map[string]*loginFailures, key string, policy LoginThrottlePolicy, now time.Time) (*loginFailures, bool) {
+	f := failures[key]
+	if f == nil || f.pending == 0 {
+		// The reservation was cleared, as by an unlock.
+		t.count(failures, key, policy, now)
+		f = failures[key]
+	}
+	f.pending--
+	if policy.LockoutAfter > 0 && f.count >= policy.LockoutAfter {
+		f.lockedUntil = now.Add(policy.LockoutDuration)
+		return f, true
+	}
+	return f, false
+}
+
+// loginSweepInterval is how often expired failures are swept.
+const loginSweepInterval = time.Minute
+
+// sweep forgets failures older than their policy window, bounding the memory
+// held for guessed emails and one-off addresses. It must be called with t.mu
+// held.
+func (t *loginThrottle) sweep(now time.Time) {
+	if now.Sub(t.sweptAt) < loginSweepInterval {
+		return
+	}
+	t.sweptAt = now
+	for _, tracked := range []struct {
+		failures map[string]*loginFailures
+		window   time.Duration
+	}{{t.accounts, t.config.Account.Window}, {t.ips, t.config.IP.Window}} {
+		for key, f := range tracked.failures {
+			if now.Sub(f.last) > tracked.window && !now.Before(f.lockedUntil) {
+				delete(tracked.failures, key)
+			}
+		}
+	}
+}
+
+// succeed settles a reserved login as successful and clears the failures of
+// the account. Failures of the IP are kept, so an attacker cannot reset its
+// counter by logging in to an account of its own.
+func (t *loginThrottle) succeed(email, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	email = normalizeEmail(email)
+	delete(t.accounts, email)
+	t.unreserve(t.ips, ip)
+}
+
+// release settles a reserved login that neither failed nor succeeded, such
+// as one waiting for its second factor.
+func (t *loginThrottle) release(email, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.unreserve(t.accounts, normalizeEmail(email))
+	t.unreserve(t.ips, ip)
+}
+
+// unreserve must be called with t.mu held.
+func (t *loginThrottle) unreserve(failures map[string]*loginFailures, key string) {
+	if f := failures[key]; f != nil && f.pending > 0 {
+		f.pending--
+		f.count--
+	}
+}
+
+// unlock clears the failures and lockout of the account.
+func (t *loginThrottle) unlock(email string) {
+	email = normalizeEmail(email)
+	t.mu.Lock()
+	_, tracked := t.accounts[email]
+	delete(t.accounts, email)
+	t.mu.Unlock()
+
+	if tracked {
+		t.notify(LoginEvent{Type: AccountUnlocked, Email: email})
+	}
+}
+
+func (t *loginThrottle) notify(events ...LoginEvent) {
+	if t.hook == nil {
+		return
+	}
+	for _, event := range events {
+		t.hook(event)
+	}
+}
@@ -0,0 +1,166 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLoginThrottle(t *testing.T) {
+	var events []LoginEvent
+	svc := NewAuthService(
+		WithPasswordCost(bcrypt.MinCost),
+		WithLoginThrottle(LoginThrottleConfig{
+			Account: LoginThrottlePolicy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: 4 * time.Second, LockoutAfter: 5, LockoutDuration: time.Hour, Window: 24 * time.Hour},
+			IP:      LoginThrottlePolicy{FreeAttempts: 100, LockoutAfter: 100, Window: time.Hour},
+		}),
+		WithLoginEventHook(func(event LoginEvent) { events = append(events, event) }),
+	)
+	throttle := svc.(*authService).throttle
+	now := time.Unix(1700000000, 0)
+	throttle.now = func() time.Time { return now }
+
+	ctx := context.WithValue(context.Background(), requestInfoContextKey, &requestInfo{remoteAddr: "198.51.100.1:1234"})
+	svc.Signup(ctx, "known@example.com", "password123")
+
+	for _, email := range []string{"known@example.com", "unknown@example.com"} {
+		for i := 0; i < 2; i++ {
+			if _, err := svc.Login(ctx, email, "wrong"); err != ErrInvalidCredentials {
+				t.Fatalf("%s attempt %d: expected invalid credentials, got %v", email, i, err)
+			}
+		}
+		// The third failure starts the backoff.
+		svc.Login(ctx, email, "wrong")
+		var throttled *LoginThrottledError
+		if _, err := svc.Login(ctx, email, "password123"); !errors.As(err, &throttled) || throttled.Until != now.Add(time.Second) {
+			t.Fatalf("%s: expected backoff of 1s, got %v", email, err)
+		}
+	}
+
+	// Failures 4 and 5 double the delay and then lock the account, even
+	// against the right password.
+	now = now.Add(time.Second)
+	svc.Login(ctx, "known@example.com", "wrong")
+	now = now.Add(2 * time.Second)
+	svc.Login(ctx, "known@example.com", "wrong")
+	now = now.Add(time.Minute)
+	var throttled *LoginThrottledError
+	if _, err := svc.Login(ctx, "known@example.com", "password123"); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Fatalf("Expected account to be locked, got %v", err)
+	}
+	if last := events[len(events)-1]; last.Type != AccountLocked || last.Email != "known@example.com" || last.IP != "198.51.100.1" {
+		t.Errorf("Expected account_locked event, got %+v", last)
+	}
+
+	if err := svc.UnlockAccount(ctx, "unknown@example.com"); err != ErrUserNotFound {
+		t.Errorf("Expected ErrUserNotFound unlocking an unknown account, got %v", err)
+	}
+	if err := svc.UnlockAccount(ctx, "known@example.com"); err != nil {
+		t.Fatalf("UnlockAccount failed: %v", err)
+	}
+	if _, err := svc.Login(ctx, "known@example.com", "password123"); err != nil {
+		t.Fatalf("Expected login after unlock, got %v", err)
+	}
+	if last := events[len(events)-1]; last.Type != AccountUnlocked {
+		t.Errorf("Expected account_unlocked event, got %+v", last)
+	}
+}
+
+func TestLoginThrottlePerIP(t *testing.T) {
+	svc := NewAuthService(
+		WithPasswordCost(bcrypt.MinCost),
+		WithLoginThrottle(LoginThrottleConfig{
+			Account: LoginThrottlePolicy{FreeAttempts: 100, LockoutAfter: 100, Window: time.Hour},
+			IP:      LoginThrottlePolicy{FreeAttempts: 100, LockoutAfter: 3, LockoutDuration: time.Hour, Window: time.Hour},
+		}),
+	)
+	attacker := context.WithValue(context.Background(), requestInfoContextKey, &requestInfo{remoteAddr: "198.51.100.1:1234"})
+	other := context.WithValue(context.Background(), requestInfoContextKey, &requestInfo{remoteAddr: "198.51.100.2:1234"})
+	svc.Signup(other, "victim@example.com", "password123")
+
+	// Spraying different accounts from one address locks out the address.
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		svc.Login(attacker, email, "guess")
+	}
+	if _, err := svc.Login(attacker, "victim@example.com", "password123"); !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Fatalf("Expected the address to be locked out, got %v", err)
+	}
+	if _, err := svc.Login(other, "victim@example.com", "password123"); err != nil {
+		t.Fatalf("Expected other addresses to log in, got %v", err)
+	}
+}
+
+func TestLoginThrottleRelocks(t *testing.T) {
+	svc := NewAuthService(
+		WithPasswordCost(bcrypt.MinCost),
+		WithLoginThrottle(LoginThrottleConfig{
+			Account: LoginThrottlePolicy{FreeAttempts: 100, LockoutAfter: 3, LockoutDuration: time.Minute, Window: time.Hour},
+			IP:      LoginThrottlePolicy{FreeAttempts: 100, LockoutAfter: 100, Window: time.Hour},
+		}),
+	)
+	throttle := svc.(*authService).throttle
+	now := time.Unix(1700000000, 0)
+	throttle.now = func() time.Time { return now }
+	ctx := context.Background()
+	svc.Signup(ctx, "known@example.com", "password123")
+
+	for i := 0; i < 3; i++ {
+		svc.Login(ctx, "known@example.com", "wrong")
+	}
+	// Each failure after the lockout expires locks the account again.
+	for i := 0; i < 3; i++ {
+		now = now.Add(2 * time.Minute)
+		if _, err := svc.Login(ctx, "known@example.com", "wrong"); err != ErrInvalidCredentials {
+			t.Fatalf("Expected the lockout to expire, got %v", err)
+		}
+		var throttled *LoginThrottledError
+		if _, err := svc.Login(ctx, "known@example.com", "password123"); !errors.As(err, &throttled) || !throttled.Locked {
+			t.Fatalf("Expected failure %d to lock the account again, got %v", 4+i, err)
+		}
+	}
+}
+
+func TestLoginThrottleParallelGuesses(t *testing.T) {
+	svc := NewAuthService(
+		WithPasswordCost(bcrypt.MinCost),
+		WithLoginThrottle(LoginThrottleConfig{
+			Account: LoginThrottlePolicy{FreeAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutAfter: 10, LockoutDuration: time.Hour, Window: time.Hour},
+			IP:      LoginThrottlePolicy{FreeAttempts: 100, LockoutAfter: 100, Window: time.Hour},
+		}),
+	)
+	now := time.Unix(1700000000, 0)
+	svc.(*authService).throttle.now = func() time.Time { return now }
+	ctx := context.Background()
+	svc.Signup(ctx, "known@example.com", "password123")
+
+	// Guesses made at the same time reserve their attempts before any of
+	// them is checked, so only the free attempts and the first delayed one
+	// reach the password.
+	results := make(chan error, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(results); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.Login(ctx, "known@example.com", "wrong")
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+	checked := 0
+	for err := range results {
+		if err == ErrInvalidCredentials {
+			checked++
+		} else if !errors.Is(err, ErrTooManyLoginAttempts) {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+	if checked != 3 {
+		t.Errorf("Expected 3 guesses to be checked, got %d", checked)
+	}
+}
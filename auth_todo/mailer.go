@@ -0,0 +1,126 @@
+package auth_todo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers mail to users.
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+// format renders mail as an RFC 5322 message.
+func (m Mail) format(from string, date time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPMailer sends mail through the SMTP server at addr (host:port),
+// upgrading to TLS when the server supports it. auth may be nil.
+func NewSMTPMailer(addr, from string, auth smtp.Auth) Mailer {
+	return &smtpMailer{addr: addr, from: from, auth: auth}
+}
+
+func (m *smtpMailer) Send(_ context.Context, mail Mail) error {
+	if strings.ContainsAny(mail.To, "\r\n") || strings.ContainsAny(mail.Subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{mail.To}, mail.format(m.from, time.Now()))
+}
+
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer writes every mail as an .eml file to the outbox directory
+// dir instead of sending it, for local development.
+func NewFileMailer(dir, from string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &fileMailer{dir: dir, from: from}, nil
+}
+
+func (m *fileMailer) Send(_ context.Context, mail Mail) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.dir, name), mail.format(m.from, now), 0o600)
+}
+
+type logMailer struct {
+	logger log.Logger
+}
+
+// NewLogMailer logs every mail instead of sending it, for local development.
+// Bodies contain secrets such as reset tokens; never use it in production.
+func NewLogMailer(logger log.Logger) Mailer {
+	return &logMailer{logger: logger}
+}
+
+func (m *logMailer) Send(_ context.Context, mail Mail) error {
+	return m.logger.Log("msg", "mail", "to", mail.To, "subject", mail.Subject, "body", mail.Body)
+}
+
+type loggingMailer struct {
+	logger log.Logger
+	next   Mailer
+}
+
+// NewLoggingMailer logs every delivery without the body, which may contain
+// secrets.
+func NewLoggingMailer(logger log.Logger, mailer Mailer) Mailer {
+	return &loggingMailer{logger: logger, next: mailer}
+}
+
+func (mw *loggingMailer) Send(ctx context.Context, mail Mail) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "Send",
+			"to", mail.To,
+			"subject", mail.Subject,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.Send(ctx, mail)
+}
+
+type discardMailer struct{}
+
+func (discardMailer) Send(context.Context, Mail) error {
+	return nil
+}
@@ -0,0 +1,329 @@
+package auth_todo
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrMFARequired         = errors.New("second factor required")
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication already enabled")
+	ErrMFANotEnabled       = errors.New("two-factor authentication not enabled")
+	ErrMFANotEnrolled      = errors.New("no pending two-factor enrollment")
+	ErrInvalidMFACode      = errors.New("invalid two-factor code")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired login challenge")
+)
+
+// MFARequiredError is returned by Login when the password was right but the
+// account has two-factor authentication enabled. The login is completed by
+// passing ChallengeToken and a code to CompleteMFALogin. It matches
+// ErrMFARequired with errors.Is.
+type MFARequiredError struct {
+	ChallengeToken string
+}
+
+func (e *MFARequiredError) Error() string {
+	return ErrMFARequired.Error()
+}
+
+func (e *MFARequiredError) Is(target error) bool {
+	return target == ErrMFARequired
+}
+
+// MFAEnrollment is the secret of a pending enrollment. URI is the otpauth://
+// URI that authenticator apps scan as a QR code; Secret is the same key for
+// manual entry.
+type MFAEnrollment struct {
+	Secret string
+	URI    string
+}
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is how many periods before and after the current one are
+	// accepted, to allow for clock drift.
+	totpSkew = 1
+
+	mfaChallengeTTL      = 5 * time.Minute
+	mfaChallengeAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type mfaState struct {
+	secret        []byte
+	pendingSecret []byte
+	recoveryCodes []string
+	// lastStep is the time step of the last accepted code, so that a code
+	// cannot be replayed within its validity window.
+	lastStep int64
+	// challenge is the hash of the outstanding login challenge.
+	challenge string
+}
+
+type mfaChallenge struct {
+	userID    string
+	expiresAt time.Time
+	attempts  int
+}
+
+// totp returns the RFC 6238 code of secret for a time step, using HMAC-SHA1
+// as authenticator apps expect.
+func totp(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, code%1000000)
+}
+
+// verifyTOTP returns the time step code is valid for at now, skipping steps
+// up to and including lastStep.
+func verifyTOTP(secret []byte, code string, now time.Time, lastStep int64) (int64, bool) {
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totp(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// newRecoveryCodes returns recoveryCodeCount codes of 80 random bits, grouped
+// for readability, and their hashes.
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32NoPadding.EncodeToString(b))
+		code := raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// EnrollMFA starts enrollment with a new secret, replacing any pending one.
+// Two-factor authentication is only enabled once ConfirmMFA proves that the
+// user's authenticator has the secret.
+func (s *authService) EnrollMFA(ctx context.Context, userID string) (MFAEnrollment, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return MFAEnrollment{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email, exists := s.emailsByID[userID]
+	if !exists {
+		return MFAEnrollment{}, ErrUserNotFound
+	}
+	state := s.mfa[userID]
+	if state == nil {
+		state = &mfaState{}
+		s.mfa[userID] = state
+	}
+	if state.secret != nil {
+		return MFAEnrollment{}, ErrMFAAlreadyEnabled
+	}
+	state.pendingSecret = secret
+
+	encoded := base32NoPadding.EncodeToString(secret)
+	params := url.Values{}
+	params.Set("secret", encoded)
+	params.Set("issuer", s.mfaIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	uri := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + s.mfaIssuer + ":" + email,
+		RawQuery: params.Encode(),
+	}
+
+	return MFAEnrollment{Secret: encoded, URI: uri.String()}, nil
+}
+
+// ConfirmMFA enables two-factor authentication if code is valid for the
+// pending secret, and returns the recovery codes. They are only stored
+// hashed, so this is the only time they can be shown.
+func (s *authService) ConfirmMFA(ctx context.Context, userID, code string) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.mfa[userID]
+	if state == nil || state.pendingSecret == nil {
+		return nil, ErrMFANotEnrolled
+	}
+	step, ok := verifyTOTP(state.pendingSecret, code, time.Now(), state.lastStep)
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	state.secret = state.pendingSecret
+	state.pendingSecret = nil
+	state.recoveryCodes = hashes
+	state.lastStep = step
+	return codes, nil
+}
+
+// DisableMFA turns two-factor authentication off after checking the user's
+// password again, so that a stolen session cannot remove the second factor.
+func (s *authService) DisableMFA(ctx context.Context, userID, password string) error {
+	s.mu.RLock()
+	email, exists := s.emailsByID[userID]
+	u := s.users[email]
+	state := s.mfa[userID]
+	s.mu.RUnlock()
+
+	if !exists {
+		return ErrUserNotFound
+	}
+	if bcrypt.CompareHashAndPassword(u.PasswordHash, []byte(password)) != nil {
+		return ErrInvalidCredentials
+	}
+	if state == nil || state.secret == nil {
+		return ErrMFANotEnabled
+	}
+
+	s.mu.Lock()
+	delete(s.challenges, state.challenge)
+	delete(s.mfa, userID)
+	s.mu.Unlock()
+	return nil
+}
+
+// mfaEnabled must be called with s.mu held.
+func (s *authService) mfaEnabled(userID string) bool {
+	state := s.mfa[userID]
+	return state != nil && state.secret != nil
+}
+
+// newMFAChallenge returns the error Login reports for an account with
+// two-factor authentication enabled. Each account has at most one
+// outstanding challenge; a new login replaces it. It must be called with s.mu
+// held.
+func (s *authService) newMFAChallenge(userID string) error {
+	token, err := newSecret()
+	if err != nil {
+		return err
+	}
+	hash := hashToken(token)
+
+	state := s.mfa[userID]
+	delete(s.challenges, state.challenge)
+	state.challenge = hash
+	s.challenges[hash] = &mfaChallenge{userID: userID, expiresAt: time.Now().Add(mfaChallengeTTL)}
+
+	return &MFARequiredError{ChallengeToken: token}
+}
+
+// CompleteMFALogin finishes a Login that returned an MFARequiredError. code
+// is either the current TOTP code or an unused recovery code, which is then
+// consumed. A challenge allows a few wrong codes before it is discarded, and
+// wrong codes count as failed logins of the account.
+func (s *authService) CompleteMFALogin(ctx context.Context, challengeToken, code string) (string, error) {
+	ip := ClientIPFromContext(ctx)
+	hash := hashToken(challengeToken)
+
+	s.mu.Lock()
+	challenge, ok := s.challenges[hash]
+	if ok && time.Now().After(challenge.expiresAt) {
+		delete(s.challenges, hash)
+		ok = false
+	}
+	if !ok {
+		s.mu.Unlock()
+		return "", ErrInvalidMFAChallenge
+	}
+	email := s.emailsByID[challenge.userID]
+	s.mu.Unlock()
+	setAuditSubject(ctx, challenge.userID)
+
+	if err := s.throttle.reserve(email, ip); err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	if !s.checkMFACode(challenge.userID, code) {
+		challenge.attempts++
+		if challenge.attempts >= mfaChallengeAttempts {
+			delete(s.challenges, hash)
+		}
+		s.mu.Unlock()
+		s.throttle.fail(email, ip)
+		return "", ErrInvalidMFACode
+	}
+	delete(s.challenges, hash)
+	token, err := s.newSession(challenge.userID)
+	s.mu.Unlock()
+	if err != nil {
+		s.throttle.release(email, ip)
+		return "", err
+	}
+
+	s.throttle.succeed(email, ip)
+	return token, nil
+}
+
+// checkMFACode reports whether code is the current TOTP code of the user or
+// one of their unused recovery codes, which is then consumed. Each TOTP code
+// is accepted once. It must be called with s.mu held.
+func (s *authService) checkMFACode(userID, code string) bool {
+	state := s.mfa[userID]
+	if state == nil || state.secret == nil {
+		return false
+	}
+	if step, ok := verifyTOTP(state.secret, code, time.Now(), state.lastStep); ok {
+		state.lastStep = step
+		return true
+	}
+	if i := indexOf(state.recoveryCodes, hashToken(normalizeRecoveryCode(code))); i >= 0 {
+		state.recoveryCodes = append(state.recoveryCodes[:i:i], state.recoveryCodes[i+1:]...)
+		return true
+	}
+	return false
+}
+
+func indexOf(values []string, value string) int {
+	for i, v := range values {
+		if subtle.ConstantTimeCompare([]byte(v), []byte(value)) == 1 {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,184 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, truncated to six digits.
+	secret := []byte("12345678901234567890")
+	for _, tc := range []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	} {
+		if code := totp(secret, tc.unix/totpPeriod); code != tc.code {
+			t.Errorf("totp at %d: expected %s, got %s", tc.unix, tc.code, code)
+		}
+	}
+
+	now := time.Unix(1234567890, 0)
+	step := now.Unix() / totpPeriod
+	if got, ok := verifyTOTP(secret, totp(secret, step-1), now, 0); !ok || got != step-1 {
+		t.Errorf("Expected the previous period to be accepted, got %d %v", got, ok)
+	}
+	if _, ok := verifyTOTP(secret, totp(secret, step-2), now, 0); ok {
+		t.Error("Expected a code two periods old to be rejected")
+	}
+	if _, ok := verifyTOTP(secret, totp(secret, step), now, step); ok {
+		t.Error("Expected a used code to be rejected")
+	}
+}
+
+func TestMFALogin(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost), WithMFAIssuer("Todo"))
+	userID, _ := authSvc.Signup(ctx, "test@example.com", "password123")
+
+	if _, err := authSvc.ConfirmMFA(ctx, userID, "abcdef"); err != ErrMFANotEnrolled {
+		t.Fatalf("Expected ErrMFANotEnrolled, got %v", err)
+	}
+
+	enrollment, err := authSvc.EnrollMFA(ctx, userID)
+	if err != nil {
+		t.Fatalf("EnrollMFA failed: %v", err)
+	}
+	uri, _ := url.Parse(enrollment.URI)
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Todo:test@example.com" || uri.Query().Get("secret") != enrollment.Secret {
+		t.Errorf("Unexpected otpauth URI %s", enrollment.URI)
+	}
+	secret, err := base32NoPadding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("Secret is not base32: %v", err)
+	}
+	step := time.Now().Unix() / totpPeriod
+
+	// Until confirmed, the password alone still logs in.
+	if _, err := authSvc.Login(ctx, "test@example.com", "password123"); err != nil {
+		t.Fatalf("Expected login without a second factor, got %v", err)
+	}
+	if _, err := authSvc.ConfirmMFA(ctx, userID, "abcdef"); err != ErrInvalidMFACode {
+		t.Fatalf("Expected ErrInvalidMFACode, got %v", err)
+	}
+	recoveryCodes, err := authSvc.ConfirmMFA(ctx, userID, totp(secret, step))
+	if err != nil {
+		t.Fatalf("ConfirmMFA failed: %v", err)
+	}
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, got %d", recoveryCodeCount, len(recoveryCodes))
+	}
+	if u, _ := authSvc.GetUser(ctx, userID); !u.MFAEnabled {
+		t.Error("Expected MFA to be enabled")
+	}
+	if _, err := authSvc.EnrollMFA(ctx, userID); err != ErrMFAAlreadyEnabled {
+		t.Errorf("Expected ErrMFAAlreadyEnabled, got %v", err)
+	}
+
+	login := func() string {
+		t.Helper()
+		_, err := authSvc.Login(ctx, "test@example.com", "password123")
+		var mfaErr *MFARequiredError
+		if !errors.As(err, &mfaErr) || mfaErr.ChallengeToken == "" {
+			t.Fatalf("Expected an MFA challenge, got %v", err)
+		}
+		return mfaErr.ChallengeToken
+	}
+
+	challenge := login()
+	if _, err := authSvc.CompleteMFALogin(ctx, challenge, totp(secret, step)); err != ErrInvalidMFACode {
+		t.Errorf("Expected the confirmation code not to be replayable, got %v", err)
+	}
+	token, err := authSvc.CompleteMFALogin(ctx, challenge, totp(secret, step+1))
+	if err != nil {
+		t.Fatalf("CompleteMFALogin failed: %v", err)
+	}
+	if id, _ := authSvc.ValidateToken(ctx, token); id != userID {
+		t.Errorf("Expected the session of %s, got %s", userID, id)
+	}
+	if _, err := authSvc.CompleteMFALogin(ctx, challenge, recoveryCodes[0]); err != ErrInvalidMFAChallenge {
+		t.Errorf("Expected the challenge to be single-use, got %v", err)
+	}
+
+	// Recovery codes are accepted once, with or without separators.
+	challenge = login()
+	stripped := recoveryCodes[0][0:4] + recoveryCodes[0][5:9] + recoveryCodes[0][10:14] + recoveryCodes[0][15:19]
+	if _, err := authSvc.CompleteMFALogin(ctx, challenge, stripped); err != nil {
+		t.Fatalf("Expected the recovery code to be accepted, got %v", err)
+	}
+	challenge = login()
+	if _, err := authSvc.CompleteMFALogin(ctx, challenge, recoveryCodes[0]); err != ErrInvalidMFACode {
+		t.Errorf("Expected a used recovery code to be rejected, got %v", err)
+	}
+
+	// A new login replaces the outstanding challenge.
+	superseded := challenge
+	challenge = login()
+	if _, err := authSvc.CompleteMFALogin(ctx, superseded, recoveryCodes[1]); err != ErrInvalidMFAChallenge {
+		t.Errorf("Expected the superseded challenge to be rejected, got %v", err)
+	}
+
+	if err := authSvc.DisableMFA(ctx, userID, "wrong"); err != ErrInvalidCredentials {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	if err := authSvc.DisableMFA(ctx, userID, "password123"); err != nil {
+		t.Fatalf("DisableMFA failed: %v", err)
+	}
+	if _, err := authSvc.CompleteMFALogin(ctx, challenge, recoveryCodes[1]); err != ErrInvalidMFAChallenge {
+		t.Errorf("Expected disabling to discard the challenge, got %v", err)
+	}
+	if _, err := authSvc.Login(ctx, "test@example.com", "password123"); err != nil {
+		t.Errorf("Expected login without a second factor, got %v", err)
+	}
+}
+
+func TestMFAChallengeLimits(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultLoginThrottleConfig()
+	config.Account.FreeAttempts = mfaChallengeAttempts
+	config.Account.LockoutAfter = mfaChallengeAttempts
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost), WithLoginThrottle(config))
+	userID, _ := authSvc.Signup(ctx, "test@example.com", "password123")
+
+	enrollment, _ := authSvc.EnrollMFA(ctx, userID)
+	secret, _ := base32NoPadding.DecodeString(enrollment.Secret)
+	step := time.Now().Unix() / totpPeriod
+	authSvc.ConfirmMFA(ctx, userID, totp(secret, step-1))
+
+	_, err := authSvc.Login(ctx, "test@example.com", "password123")
+	var mfaErr *MFARequiredError
+	errors.As(err, &mfaErr)
+
+	for i := 0; i < mfaChallengeAttempts; i++ {
+		if _, err := authSvc.CompleteMFALogin(ctx, mfaErr.ChallengeToken, "abcdef"); err != ErrInvalidMFACode {
+			t.Fatalf("Attempt %d: expected ErrInvalidMFACode, got %v", i, err)
+		}
+	}
+	if _, err := authSvc.CompleteMFALogin(ctx, mfaErr.ChallengeToken, totp(secret, step)); err != ErrInvalidMFAChallenge {
+		t.Errorf("Expected the challenge to be discarded after %d wrong codes, got %v", mfaChallengeAttempts, err)
+	}
+
+	// Wrong codes count as failed logins of the account.
+	var throttled *LoginThrottledError
+	if _, err := authSvc.Login(ctx, "test@example.com", "password123"); !errors.As(err, &throttled) || !throttled.Locked {
+		t.Errorf("Expected the account to be locked, got %v", err)
+	}
+	authSvc.UnlockAccount(ctx, "test@example.com")
+
+	svc := authSvc.(*authService)
+	svc.mu.Lock()
+	svc.challenges[hashToken("expired")] = &mfaChallenge{userID: userID, expiresAt: time.Now().Add(-time.Second)}
+	svc.mu.Unlock()
+	if _, err := authSvc.CompleteMFALogin(ctx, "expired", totp(secret, step)); err != ErrInvalidMFAChallenge {
+		t.Errorf("Expected an expired challenge to be rejected, got %v", err)
+	}
+}
@@ -2,6 +2,8 @@ package auth_todo
 
 import (
 	"context"
+	"io"
+	"strings"
 	"time"
 
 	"github.com/go-kit/kit/metrics"
@@ -46,108 +48,1284 @@ func (mw *loggingAuthMiddleware) Login(ctx context.Context, email, password stri
 	return mw.next.Login(ctx, email, password)
 }
 
+func (mw *loggingAuthMiddleware) VerifyCredentials(ctx context.Context, email, password, code string) (userID string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "VerifyCredentials",
+			"email", email,
+			"user_id", userID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.VerifyCredentials(ctx, email, password, code)
+}
+
 func (mw *loggingAuthMiddleware) ValidateToken(ctx context.Context, token string) (userID string, err error) {
 	defer func(begin time.Time) {
 		mw.logger.Log(
-			"method", "ValidateToken",
+			"method", "ValidateToken",
+			"user_id", userID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ValidateToken(ctx, token)
+}
+
+func (mw *loggingAuthMiddleware) GetUser(ctx context.Context, userID string) (u User, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetUser",
+			"user_id", userID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.GetUser(ctx, userID)
+}
+
+func (mw *loggingAuthMiddleware) UnlockAccount(ctx context.Context, email string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UnlockAccount",
+			"email", email,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.UnlockAccount(ctx, email)
+}
+
+func (mw *loggingAuthMiddleware) RequestPasswordReset(ctx context.Context, email string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RequestPasswordReset",
+			"email", email,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.RequestPasswordReset(ctx, email)
+}
+
+func (mw *loggingAuthMiddleware) ResetPassword(ctx context.Context, token, newPassword string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ResetPassword",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ResetPassword(ctx, token, newPassword)
+}
+
+func (mw *loggingAuthMiddleware) VerifyEmail(ctx context.Context, token string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "VerifyEmail",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.VerifyEmail(ctx, token)
+}
+
+func (mw *loggingAuthMiddleware) ResendVerification(ctx context.Context, email string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ResendVerification",
+			"email", email,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ResendVerification(ctx, email)
+}
+
+func (mw *loggingAuthMiddleware) EnrollMFA(ctx context.Context, userID string) (enrollment MFAEnrollment, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "EnrollMFA",
+			"user_id", userID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.EnrollMFA(ctx, userID)
+}
+
+func (mw *loggingAuthMiddleware) ConfirmMFA(ctx context.Context, userID, code string) (recoveryCodes []string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ConfirmMFA",
+			"user_id", userID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ConfirmMFA(ctx, userID, code)
+}
+
+func (mw *loggingAuthMiddleware) CompleteMFALogin(ctx context.Context, challengeToken, code string) (token string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "CompleteMFALogin",
+			"token_generated", token != "",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.CompleteMFALogin(ctx, challengeToken, code)
+}
+
+func (mw *loggingAuthMiddleware) DisableMFA(ctx context.Context, userID, password string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "DisableMFA",
+			"user_id", userID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.DisableMFA(ctx, userID, password)
+}
+
+func (mw *loggingAuthMiddleware) Authenticate(ctx context.Context, token string) (credentials Credentials, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "Authenticate",
+			"user_id", credentials.UserID,
+			"access_token_id", credentials.AccessTokenID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.Authenticate(ctx, token)
+}
+
+func (mw *loggingAuthMiddleware) CreateAccessToken(ctx context.Context, userID, name string, scopes []string, expiresAt time.Time) (token string, info AccessToken, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "CreateAccessToken",
+			"user_id", userID,
+			"access_token_id", info.ID,
+			"scopes", strings.Join(scopes, " "),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.CreateAccessToken(ctx, userID, name, scopes, expiresAt)
+}
+
+func (mw *loggingAuthMiddleware) ListAccessTokens(ctx context.Context, userID string) (tokens []AccessToken, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListAccessTokens",
+			"user_id", userID,
+			"count", len(tokens),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListAccessTokens(ctx, userID)
+}
+
+func (mw *loggingAuthMiddleware) RevokeAccessToken(ctx context.Context, userID, tokenID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RevokeAccessToken",
+			"user_id", userID,
+			"access_token_id", tokenID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.RevokeAccessToken(ctx, userID, tokenID)
+}
+
+func (mw *loggingAuthMiddleware) RegisterOAuthClient(ctx context.Context, ownerID, name string, redirectURIs []string, confidential bool) (client OAuthClient, secret string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RegisterOAuthClient",
+			"user_id", ownerID,
+			"client_id", client.ID,
+			"confidential", confidential,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.RegisterOAuthClient(ctx, ownerID, name, redirectURIs, confidential)
+}
+
+func (mw *loggingAuthMiddleware) ValidateOAuthAuthorization(ctx context.Context, req OAuthAuthorizationRequest) (client OAuthClient, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ValidateOAuthAuthorization",
+			"client_id", req.ClientID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ValidateOAuthAuthorization(ctx, req)
+}
+
+func (mw *loggingAuthMiddleware) AuthorizeOAuth(ctx context.Context, userID string, req OAuthAuthorizationRequest) (code string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "AuthorizeOAuth",
+			"user_id", userID,
+			"client_id", req.ClientID,
+			"scopes", strings.Join(req.Scopes, " "),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.AuthorizeOAuth(ctx, userID, req)
+}
+
+func (mw *loggingAuthMiddleware) ExchangeOAuthToken(ctx context.Context, req OAuthTokenRequest) (token OAuthToken, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ExchangeOAuthToken",
+			"client_id", req.ClientID,
+			"grant_type", req.GrantType,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ExchangeOAuthToken(ctx, req)
+}
+
+func (mw *loggingAuthMiddleware) IntrospectOAuthToken(ctx context.Context, clientID, clientSecret, token string) (introspection OAuthIntrospection, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "IntrospectOAuthToken",
+			"client_id", clientID,
+			"active", introspection.Active,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.IntrospectOAuthToken(ctx, clientID, clientSecret, token)
+}
+
+func (mw *loggingAuthMiddleware) RevokeOAuthToken(ctx context.Context, clientID, clientSecret, token string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RevokeOAuthToken",
+			"client_id", clientID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.RevokeOAuthToken(ctx, clientID, clientSecret, token)
+}
+
+func (mw *loggingAuthMiddleware) BeginOIDCLogin(ctx context.Context) (authorization OIDCAuthorization, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "BeginOIDCLogin",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.BeginOIDCLogin(ctx)
+}
+
+func (mw *loggingAuthMiddleware) CompleteOIDCLogin(ctx context.Context, state, code string) (token string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "CompleteOIDCLogin",
+			"token_generated", token != "",
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.CompleteOIDCLogin(ctx, state, code)
+}
+
+func (mw *loggingAuthMiddleware) ListUsers(ctx context.Context, query UserQuery, limit, offset int) (users []User, total int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListUsers",
+			"search", query.Search,
+			"total", total,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListUsers(ctx, query, limit, offset)
+}
+
+func (mw *loggingAuthMiddleware) SetRole(ctx context.Context, userID, role string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "SetRole",
+			"user_id", userID,
+			"role", role,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.SetRole(ctx, userID, role)
+}
+
+func (mw *loggingAuthMiddleware) SetUserDisabled(ctx context.Context, userID string, disabled bool) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "SetUserDisabled",
+			"user_id", userID,
+			"disabled", disabled,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.SetUserDisabled(ctx, userID, disabled)
+}
+
+func (mw *loggingAuthMiddleware) ResetMFA(ctx context.Context, userID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ResetMFA",
+			"user_id", userID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ResetMFA(ctx, userID)
+}
+
+func (mw *loggingAuthMiddleware) RecordAdminAction(ctx context.Context, action AdminAction) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RecordAdminAction",
+			"actor_id", action.ActorID,
+			"action", action.Action,
+			"target_id", action.TargetID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.RecordAdminAction(ctx, action)
+}
+
+func (mw *loggingAuthMiddleware) ListAdminActions(ctx context.Context, targetID string, limit, offset int) (actions []AdminAction, total int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListAdminActions",
+			"target_id", targetID,
+			"total", total,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListAdminActions(ctx, targetID, limit, offset)
+}
+
+func (mw *loggingAuthMiddleware) ListSecurityEvents(ctx context.Context, query SecurityEventQuery, limit, offset int) (events []SecurityEvent, total int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListSecurityEvents",
+			"user_id", query.UserID,
+			"type", query.Type,
+			"total", total,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListSecurityEvents(ctx, query, limit, offset)
+}
+
+type instrumentingAuthMiddleware struct {
+	requestCount   metrics.Counter
+	requestLatency metrics.Histogram
+	next           AuthService
+}
+
+func NewInstrumentingAuthMiddleware(counter metrics.Counter, latency metrics.Histogram, svc AuthService) AuthService {
+	return &instrumentingAuthMiddleware{
+		requestCount:   counter,
+		requestLatency: latency,
+		next:           svc,
+	}
+}
+
+func (mw *instrumentingAuthMiddleware) Signup(ctx context.Context, email, password string) (string, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "Signup").Add(1)
+		mw.requestLatency.With("method", "Signup").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.Signup(ctx, email, password)
+}
+
+func (mw *instrumentingAuthMiddleware) Login(ctx context.Context, email, password string) (string, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "Login").Add(1)
+		mw.requestLatency.With("method", "Login").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.Login(ctx, email, password)
+}
+
+func (mw *instrumentingAuthMiddleware) VerifyCredentials(ctx context.Context, email, password, code string) (string, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "VerifyCredentials").Add(1)
+		mw.requestLatency.With("method", "VerifyCredentials").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.VerifyCredentials(ctx, email, password, code)
+}
+
+func (mw *instrumentingAuthMiddleware) ValidateToken(ctx context.Context, token string) (string, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ValidateToken").Add(1)
+		mw.requestLatency.With("method", "ValidateToken").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ValidateToken(ctx, token)
+}
+
+func (mw *instrumentingAuthMiddleware) GetUser(ctx context.Context, userID string) (User, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "GetUser").Add(1)
+		mw.requestLatency.With("method", "GetUser").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.GetUser(ctx, userID)
+}
+
+func (mw *instrumentingAuthMiddleware) UnlockAccount(ctx context.Context, email string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "UnlockAccount").Add(1)
+		mw.requestLatency.With("method", "UnlockAccount").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.UnlockAccount(ctx, email)
+}
+
+func (mw *instrumentingAuthMiddleware) RequestPasswordReset(ctx context.Context, email string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "RequestPasswordReset").Add(1)
+		mw.requestLatency.With("method", "RequestPasswordReset").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.RequestPasswordReset(ctx, email)
+}
+
+func (mw *instrumentingAuthMiddleware) ResetPassword(ctx context.Context, token, newPassword string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ResetPassword").Add(1)
+		mw.requestLatency.With("method", "ResetPassword").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ResetPassword(ctx, token, newPassword)
+}
+
+func (mw *instrumentingAuthMiddleware) VerifyEmail(ctx context.Context, token string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "VerifyEmail").Add(1)
+		mw.requestLatency.With("method", "VerifyEmail").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.VerifyEmail(ctx, token)
+}
+
+func (mw *instrumentingAuthMiddleware) ResendVerification(ctx context.Context, email string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ResendVerification").Add(1)
+		mw.requestLatency.With("method", "ResendVerification").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ResendVerification(ctx, email)
+}
+
+func (mw *instrumentingAuthMiddleware) EnrollMFA(ctx context.Context, userID string) (MFAEnrollment, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "EnrollMFA").Add(1)
+		mw.requestLatency.With("method", "EnrollMFA").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.EnrollMFA(ctx, userID)
+}
+
+func (mw *instrumentingAuthMiddleware) ConfirmMFA(ctx context.Context, userID, code string) ([]string, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ConfirmMFA").Add(1)
+		mw.requestLatency.With("method", "ConfirmMFA").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ConfirmMFA(ctx, userID, code)
+}
+
+func (mw *instrumentingAuthMiddleware) CompleteMFALogin(ctx context.Context, challengeToken, code string) (string, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "CompleteMFALogin").Add(1)
+		mw.requestLatency.With("method", "CompleteMFALogin").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.CompleteMFALogin(ctx, challengeToken, code)
+}
+
+func (mw *instrumentingAuthMiddleware) DisableMFA(ctx context.Context, userID, password string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "DisableMFA").Add(1)
+		mw.requestLatency.With("method", "DisableMFA").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.DisableMFA(ctx, userID, password)
+}
+
+func (mw *instrumentingAuthMiddleware) Authenticate(ctx context.Context, token string) (Credentials, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "Authenticate").Add(1)
+		mw.requestLatency.With("method", "Authenticate").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.Authenticate(ctx, token)
+}
+
+func (mw *instrumentingAuthMiddleware) CreateAccessToken(ctx context.Context, userID, name string, scopes []string, expiresAt time.Time) (string, AccessToken, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "CreateAccessToken").Add(1)
+		mw.requestLatency.With("method", "CreateAccessToken").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.CreateAccessToken(ctx, userID, name, scopes, expiresAt)
+}
+
+func (mw *instrumentingAuthMiddleware) ListAccessTokens(ctx context.Context, userID string) ([]AccessToken, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListAccessTokens").Add(1)
+		mw.requestLatency.With("method", "ListAccessTokens").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListAccessTokens(ctx, userID)
+}
+
+func (mw *instrumentingAuthMiddleware) RevokeAccessToken(ctx context.Context, userID, tokenID string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "RevokeAccessToken").Add(1)
+		mw.requestLatency.With("method", "RevokeAccessToken").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.RevokeAccessToken(ctx, userID, tokenID)
+}
+
+func (mw *instrumentingAuthMiddleware) RegisterOAuthClient(ctx context.Context, ownerID, name string, redirectURIs []string, confidential bool) (OAuthClient, string, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "RegisterOAuthClient").Add(1)
+		mw.requestLatency.With("method", "RegisterOAuthClient").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.RegisterOAuthClient(ctx, ownerID, name, redirectURIs, confidential)
+}
+
+func (mw *instrumentingAuthMiddleware) ValidateOAuthAuthorization(ctx context.Context, req OAuthAuthorizationRequest) (OAuthClient, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ValidateOAuthAuthorization").Add(1)
+		mw.requestLatency.With("method", "ValidateOAuthAuthorization").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ValidateOAuthAuthorization(ctx, req)
+}
+
+func (mw *instrumentingAuthMiddleware) AuthorizeOAuth(ctx context.Context, userID string, req OAuthAuthorizationRequest) (string, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "AuthorizeOAuth").Add(1)
+		mw.requestLatency.With("method", "AuthorizeOAuth").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.AuthorizeOAuth(ctx, userID, req)
+}
+
+func (mw *instrumentingAuthMiddleware) ExchangeOAuthToken(ctx context.Context, req OAuthTokenRequest) (OAuthToken, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ExchangeOAuthToken").Add(1)
+		mw.requestLatency.With("method", "ExchangeOAuthToken").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ExchangeOAuthToken(ctx, req)
+}
+
+func (mw *instrumentingAuthMiddleware) IntrospectOAuthToken(ctx context.Context, clientID, clientSecret, token string) (OAuthIntrospection, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "IntrospectOAuthToken").Add(1)
+		mw.requestLatency.With("method", "IntrospectOAuthToken").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.IntrospectOAuthToken(ctx, clientID, clientSecret, token)
+}
+
+func (mw *instrumentingAuthMiddleware) RevokeOAuthToken(ctx context.Context, clientID, clientSecret, token string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "RevokeOAuthToken").Add(1)
+		mw.requestLatency.With("method", "RevokeOAuthToken").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.RevokeOAuthToken(ctx, clientID, clientSecret, token)
+}
+
+func (mw *instrumentingAuthMiddleware) BeginOIDCLogin(ctx context.Context) (OIDCAuthorization, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "BeginOIDCLogin").Add(1)
+		mw.requestLatency.With("method", "BeginOIDCLogin").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.BeginOIDCLogin(ctx)
+}
+
+func (mw *instrumentingAuthMiddleware) CompleteOIDCLogin(ctx context.Context, state, code string) (string, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "CompleteOIDCLogin").Add(1)
+		mw.requestLatency.With("method", "CompleteOIDCLogin").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.CompleteOIDCLogin(ctx, state, code)
+}
+
+func (mw *instrumentingAuthMiddleware) ListUsers(ctx context.Context, query UserQuery, limit, offset int) ([]User, int, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListUsers").Add(1)
+		mw.requestLatency.With("method", "ListUsers").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListUsers(ctx, query, limit, offset)
+}
+
+func (mw *instrumentingAuthMiddleware) SetRole(ctx context.Context, userID, role string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "SetRole").Add(1)
+		mw.requestLatency.With("method", "SetRole").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.SetRole(ctx, userID, role)
+}
+
+func (mw *instrumentingAuthMiddleware) SetUserDisabled(ctx context.Context, userID string, disabled bool) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "SetUserDisabled").Add(1)
+		mw.requestLatency.With("method", "SetUserDisabled").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.SetUserDisabled(ctx, userID, disabled)
+}
+
+func (mw *instrumentingAuthMiddleware) ResetMFA(ctx context.Context, userID string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ResetMFA").Add(1)
+		mw.requestLatency.With("method", "ResetMFA").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ResetMFA(ctx, userID)
+}
+
+func (mw *instrumentingAuthMiddleware) RecordAdminAction(ctx context.Context, action AdminAction) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "RecordAdminAction").Add(1)
+		mw.requestLatency.With("method", "RecordAdminAction").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.RecordAdminAction(ctx, action)
+}
+
+func (mw *instrumentingAuthMiddleware) ListAdminActions(ctx context.Context, targetID string, limit, offset int) ([]AdminAction, int, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListAdminActions").Add(1)
+		mw.requestLatency.With("method", "ListAdminActions").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListAdminActions(ctx, targetID, limit, offset)
+}
+
+func (mw *instrumentingAuthMiddleware) ListSecurityEvents(ctx context.Context, query SecurityEventQuery, limit, offset int) ([]SecurityEvent, int, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListSecurityEvents").Add(1)
+		mw.requestLatency.With("method", "ListSecurityEvents").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListSecurityEvents(ctx, query, limit, offset)
+}
+
+type loggingTodoMiddleware struct {
+	logger log.Logger
+	next   TodoService
+}
+
+func NewLoggingTodoMiddleware(logger log.Logger, svc TodoService) TodoService {
+	return &loggingTodoMiddleware{
+		logger: logger,
+		next:   svc,
+	}
+}
+
+func (mw *loggingTodoMiddleware) CreateTodo(ctx context.Context, userID string, input TodoInput) (todoID string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "CreateTodo",
+			"user_id", userID,
+			"list_id", input.ListID,
+			"todo_id", todoID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.CreateTodo(ctx, userID, input)
+}
+
+func (mw *loggingTodoMiddleware) GetTodo(ctx context.Context, userID, todoID string) (todo Todo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetTodo",
+			"user_id", userID,
+			"todo_id", todoID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.GetTodo(ctx, userID, todoID)
+}
+
+func (mw *loggingTodoMiddleware) ListTodos(ctx context.Context, userID string, filter TodoFilter, limit, offset int) (todos []Todo, total int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListTodos",
+			"user_id", userID,
+			"filter", filter.key(),
+			"limit", limit,
+			"offset", offset,
+			"count", len(todos),
+			"total", total,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListTodos(ctx, userID, filter, limit, offset)
+}
+
+func (mw *loggingTodoMiddleware) CompleteTodo(ctx context.Context, userID, todoID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "CompleteTodo",
+			"user_id", userID,
+			"todo_id", todoID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.CompleteTodo(ctx, userID, todoID)
+}
+
+func (mw *loggingTodoMiddleware) UpdateTodo(ctx context.Context, userID, todoID string, patch TodoPatch) (todo Todo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "UpdateTodo",
+			"user_id", userID,
+			"todo_id", todoID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.UpdateTodo(ctx, userID, todoID, patch)
+}
+
+func (mw *loggingTodoMiddleware) DeleteTodo(ctx context.Context, userID, todoID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "DeleteTodo",
+			"user_id", userID,
+			"todo_id", todoID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.DeleteTodo(ctx, userID, todoID)
+}
+
+func (mw *loggingTodoMiddleware) CreateList(ctx context.Context, userID, name string) (listID string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "CreateList",
+			"user_id", userID,
+			"list_id", listID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.CreateList(ctx, userID, name)
+}
+
+func (mw *loggingTodoMiddleware) ListLists(ctx context.Context, userID string) (lists []List, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListLists",
+			"user_id", userID,
+			"count", len(lists),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListLists(ctx, userID)
+}
+
+func (mw *loggingTodoMiddleware) ListTags(ctx context.Context, userID string) (tags []Tag, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListTags",
+			"user_id", userID,
+			"count", len(tags),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListTags(ctx, userID)
+}
+
+func (mw *loggingTodoMiddleware) ShareList(ctx context.Context, userID, listID, email, role string) (inv Invitation, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ShareList",
+			"user_id", userID,
+			"list_id", listID,
+			"role", role,
+			"invitation_id", inv.ID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ShareList(ctx, userID, listID, email, role)
+}
+
+func (mw *loggingTodoMiddleware) ListInvitations(ctx context.Context, email string) (invitations []Invitation, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListInvitations",
+			"count", len(invitations),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListInvitations(ctx, email)
+}
+
+func (mw *loggingTodoMiddleware) RespondToInvitation(ctx context.Context, userID, email, invitationID string, accept bool) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RespondToInvitation",
+			"user_id", userID,
+			"invitation_id", invitationID,
+			"accept", accept,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.RespondToInvitation(ctx, userID, email, invitationID, accept)
+}
+
+func (mw *loggingTodoMiddleware) ListMembers(ctx context.Context, userID, listID string) (members []ListMember, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListMembers",
+			"user_id", userID,
+			"list_id", listID,
+			"count", len(members),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListMembers(ctx, userID, listID)
+}
+
+func (mw *loggingTodoMiddleware) SetMemberRole(ctx context.Context, userID, listID, memberID, role string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "SetMemberRole",
+			"user_id", userID,
+			"list_id", listID,
+			"member_id", memberID,
+			"role", role,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.SetMemberRole(ctx, userID, listID, memberID, role)
+}
+
+func (mw *loggingTodoMiddleware) RemoveMember(ctx context.Context, userID, listID, memberID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RemoveMember",
+			"user_id", userID,
+			"list_id", listID,
+			"member_id", memberID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.RemoveMember(ctx, userID, listID, memberID)
+}
+
+func (mw *loggingTodoMiddleware) AssignTodo(ctx context.Context, userID, todoID, assigneeID string) (todo Todo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "AssignTodo",
+			"user_id", userID,
+			"todo_id", todoID,
+			"assignee_id", assigneeID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.AssignTodo(ctx, userID, todoID, assigneeID)
+}
+
+func (mw *loggingTodoMiddleware) AddComment(ctx context.Context, userID, todoID, text string) (comment Comment, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "AddComment",
+			"user_id", userID,
+			"todo_id", todoID,
+			"comment_id", comment.ID,
+			"mentions", len(comment.Mentions),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.AddComment(ctx, userID, todoID, text)
+}
+
+func (mw *loggingTodoMiddleware) EditComment(ctx context.Context, userID, todoID, commentID, text string) (comment Comment, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "EditComment",
+			"user_id", userID,
+			"todo_id", todoID,
+			"comment_id", commentID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.EditComment(ctx, userID, todoID, commentID, text)
+}
+
+func (mw *loggingTodoMiddleware) DeleteComment(ctx context.Context, userID, todoID, commentID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "DeleteComment",
+			"user_id", userID,
+			"todo_id", todoID,
+			"comment_id", commentID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.DeleteComment(ctx, userID, todoID, commentID)
+}
+
+func (mw *loggingTodoMiddleware) ListComments(ctx context.Context, userID, todoID string, limit, offset int) (comments []Comment, total int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListComments",
+			"user_id", userID,
+			"todo_id", todoID,
+			"count", len(comments),
+			"total", total,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListComments(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *loggingTodoMiddleware) TodoActivity(ctx context.Context, userID, todoID string, limit, offset int) (activity []Activity, total int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "TodoActivity",
+			"user_id", userID,
+			"todo_id", todoID,
+			"count", len(activity),
+			"total", total,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.TodoActivity(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *loggingTodoMiddleware) TodoHistory(ctx context.Context, userID, todoID string, limit, offset int) (history []TodoChange, total int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "TodoHistory",
+			"user_id", userID,
+			"todo_id", todoID,
+			"count", len(history),
+			"total", total,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.TodoHistory(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *loggingTodoMiddleware) RevertTodo(ctx context.Context, userID, todoID string, version int) (todo Todo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RevertTodo",
+			"user_id", userID,
+			"todo_id", todoID,
+			"version", version,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.RevertTodo(ctx, userID, todoID, version)
+}
+
+func (mw *loggingTodoMiddleware) MoveTodo(ctx context.Context, userID, todoID string, move TodoMove) (todo Todo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "MoveTodo",
+			"user_id", userID,
+			"todo_id", todoID,
+			"before", move.Before,
+			"after", move.After,
+			"rank", todo.Rank,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.MoveTodo(ctx, userID, todoID, move)
+}
+
+func (mw *loggingTodoMiddleware) GetWorkflow(ctx context.Context, userID, listID string) (workflow Workflow, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "GetWorkflow",
+			"user_id", userID,
+			"list_id", listID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.GetWorkflow(ctx, userID, listID)
+}
+
+func (mw *loggingTodoMiddleware) SetWorkflow(ctx context.Context, userID, listID string, workflow Workflow) (result Workflow, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "SetWorkflow",
+			"user_id", userID,
+			"list_id", listID,
+			"statuses", len(workflow.Statuses),
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.SetWorkflow(ctx, userID, listID, workflow)
+}
+
+func (mw *loggingTodoMiddleware) TransitionTodo(ctx context.Context, userID, todoID, status string) (todo Todo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "TransitionTodo",
+			"user_id", userID,
+			"todo_id", todoID,
+			"status", status,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.TransitionTodo(ctx, userID, todoID, status)
+}
+
+func (mw *loggingTodoMiddleware) ListBoard(ctx context.Context, userID, listID string) (board Board, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListBoard",
+			"user_id", userID,
+			"list_id", listID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListBoard(ctx, userID, listID)
+}
+
+func (mw *loggingTodoMiddleware) AddBlocker(ctx context.Context, userID, todoID, blockerID string) (todo Todo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "AddBlocker",
+			"user_id", userID,
+			"todo_id", todoID,
+			"blocker_id", blockerID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.AddBlocker(ctx, userID, todoID, blockerID)
+}
+
+func (mw *loggingTodoMiddleware) RemoveBlocker(ctx context.Context, userID, todoID, blockerID string) (todo Todo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "RemoveBlocker",
+			"user_id", userID,
+			"todo_id", todoID,
+			"blocker_id", blockerID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.RemoveBlocker(ctx, userID, todoID, blockerID)
+}
+
+func (mw *loggingTodoMiddleware) ListNextTodos(ctx context.Context, userID string, limit, offset int) (todos []Todo, total int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListNextTodos",
+			"user_id", userID,
+			"limit", limit,
+			"offset", offset,
+			"count", len(todos),
+			"total", total,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListNextTodos(ctx, userID, limit, offset)
+}
+
+func (mw *loggingTodoMiddleware) AddAttachment(ctx context.Context, userID, todoID, name string, r io.Reader) (attachment Attachment, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "AddAttachment",
+			"user_id", userID,
+			"todo_id", todoID,
+			"attachment_id", attachment.ID,
+			"size", attachment.Size,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.AddAttachment(ctx, userID, todoID, name, r)
+}
+
+func (mw *loggingTodoMiddleware) ListAttachments(ctx context.Context, userID, todoID string) (attachments []Attachment, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListAttachments",
 			"user_id", userID,
+			"todo_id", todoID,
+			"count", len(attachments),
 			"err", err,
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.ValidateToken(ctx, token)
+	return mw.next.ListAttachments(ctx, userID, todoID)
 }
 
-type instrumentingAuthMiddleware struct {
-	requestCount   metrics.Counter
-	requestLatency metrics.Histogram
-	next           AuthService
+func (mw *loggingTodoMiddleware) OpenAttachment(ctx context.Context, userID, todoID, attachmentID string) (attachment Attachment, body io.ReadCloser, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "OpenAttachment",
+			"user_id", userID,
+			"todo_id", todoID,
+			"attachment_id", attachmentID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.OpenAttachment(ctx, userID, todoID, attachmentID)
 }
 
-func NewInstrumentingAuthMiddleware(counter metrics.Counter, latency metrics.Histogram, svc AuthService) AuthService {
-	return &instrumentingAuthMiddleware{
-		requestCount:   counter,
-		requestLatency: latency,
-		next:           svc,
-	}
+func (mw *loggingTodoMiddleware) DeleteAttachment(ctx context.Context, userID, todoID, attachmentID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "DeleteAttachment",
+			"user_id", userID,
+			"todo_id", todoID,
+			"attachment_id", attachmentID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.DeleteAttachment(ctx, userID, todoID, attachmentID)
 }
 
-func (mw *instrumentingAuthMiddleware) Signup(ctx context.Context, email, password string) (string, error) {
+func (mw *loggingTodoMiddleware) AttachmentUsage(ctx context.Context, userID string) (used, quota int64, err error) {
 	defer func(begin time.Time) {
-		mw.requestCount.With("method", "Signup").Add(1)
-		mw.requestLatency.With("method", "Signup").Observe(time.Since(begin).Seconds())
+		mw.logger.Log(
+			"method", "AttachmentUsage",
+			"user_id", userID,
+			"used", used,
+			"err", err,
+			"took", time.Since(begin),
+		)
 	}(time.Now())
-	return mw.next.Signup(ctx, email, password)
+	return mw.next.AttachmentUsage(ctx, userID)
 }
 
-func (mw *instrumentingAuthMiddleware) Login(ctx context.Context, email, password string) (string, error) {
+func (mw *loggingTodoMiddleware) StartTimer(ctx context.Context, userID, todoID, note string) (entry TimeEntry, err error) {
 	defer func(begin time.Time) {
-		mw.requestCount.With("method", "Login").Add(1)
-		mw.requestLatency.With("method", "Login").Observe(time.Since(begin).Seconds())
+		mw.logger.Log(
+			"method", "StartTimer",
+			"user_id", userID,
+			"todo_id", todoID,
+			"entry_id", entry.ID,
+			"err", err,
+			"took", time.Since(begin),
+		)
 	}(time.Now())
-	return mw.next.Login(ctx, email, password)
+	return mw.next.StartTimer(ctx, userID, todoID, note)
 }
 
-func (mw *instrumentingAuthMiddleware) ValidateToken(ctx context.Context, token string) (string, error) {
+func (mw *loggingTodoMiddleware) StopTimer(ctx context.Context, userID string) (entry TimeEntry, err error) {
 	defer func(begin time.Time) {
-		mw.requestCount.With("method", "ValidateToken").Add(1)
-		mw.requestLatency.With("method", "ValidateToken").Observe(time.Since(begin).Seconds())
+		mw.logger.Log(
+			"method", "StopTimer",
+			"user_id", userID,
+			"entry_id", entry.ID,
+			"err", err,
+			"took", time.Since(begin),
+		)
 	}(time.Now())
-	return mw.next.ValidateToken(ctx, token)
+	return mw.next.StopTimer(ctx, userID)
 }
 
-type loggingTodoMiddleware struct {
-	logger log.Logger
-	next   TodoService
+func (mw *loggingTodoMiddleware) AddTimeEntry(ctx context.Context, userID, todoID string, input TimeEntryInput) (entry TimeEntry, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "AddTimeEntry",
+			"user_id", userID,
+			"todo_id", todoID,
+			"entry_id", entry.ID,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.AddTimeEntry(ctx, userID, todoID, input)
 }
 
-func NewLoggingTodoMiddleware(logger log.Logger, svc TodoService) TodoService {
-	return &loggingTodoMiddleware{
-		logger: logger,
-		next:   svc,
-	}
+func (mw *loggingTodoMiddleware) ListTimeEntries(ctx context.Context, userID, todoID string, limit, offset int) (entries []TimeEntry, total int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log(
+			"method", "ListTimeEntries",
+			"user_id", userID,
+			"todo_id", todoID,
+			"total", total,
+			"err", err,
+			"took", time.Since(begin),
+		)
+	}(time.Now())
+	return mw.next.ListTimeEntries(ctx, userID, todoID, limit, offset)
 }
 
-func (mw *loggingTodoMiddleware) CreateTodo(ctx context.Context, userID, text string) (todoID string, err error) {
+func (mw *loggingTodoMiddleware) DeleteTimeEntry(ctx context.Context, userID, todoID, entryID string) (err error) {
 	defer func(begin time.Time) {
 		mw.logger.Log(
-			"method", "CreateTodo",
+			"method", "DeleteTimeEntry",
 			"user_id", userID,
 			"todo_id", todoID,
+			"entry_id", entryID,
 			"err", err,
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.CreateTodo(ctx, userID, text)
+	return mw.next.DeleteTimeEntry(ctx, userID, todoID, entryID)
 }
 
-func (mw *loggingTodoMiddleware) ListTodos(ctx context.Context, userID string, limit, offset int) (todos []Todo, total int, err error) {
+func (mw *loggingTodoMiddleware) TimeReport(ctx context.Context, userID string, query TimeQuery) (report TimeReport, err error) {
 	defer func(begin time.Time) {
 		mw.logger.Log(
-			"method", "ListTodos",
+			"method", "TimeReport",
 			"user_id", userID,
-			"limit", limit,
-			"offset", offset,
-			"count", len(todos),
-			"total", total,
+			"seconds", report.Seconds,
 			"err", err,
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.ListTodos(ctx, userID, limit, offset)
+	return mw.next.TimeReport(ctx, userID, query)
 }
 
-func (mw *loggingTodoMiddleware) CompleteTodo(ctx context.Context, userID, todoID string) (err error) {
+func (mw *loggingTodoMiddleware) Timesheet(ctx context.Context, userID string, query TimeQuery) (entries []TimesheetEntry, err error) {
 	defer func(begin time.Time) {
 		mw.logger.Log(
-			"method", "CompleteTodo",
+			"method", "Timesheet",
 			"user_id", userID,
-			"todo_id", todoID,
+			"entries", len(entries),
 			"err", err,
 			"took", time.Since(begin),
 		)
 	}(time.Now())
-	return mw.next.CompleteTodo(ctx, userID, todoID)
+	return mw.next.Timesheet(ctx, userID, query)
 }
 
 type instrumentingTodoMiddleware struct {
@@ -164,20 +1342,28 @@ func NewInstrumentingTodoMiddleware(counter metrics.Counter, latency metrics.His
 	}
 }
 
-func (mw *instrumentingTodoMiddleware) CreateTodo(ctx context.Context, userID, text string) (string, error) {
+func (mw *instrumentingTodoMiddleware) CreateTodo(ctx context.Context, userID string, input TodoInput) (string, error) {
 	defer func(begin time.Time) {
 		mw.requestCount.With("method", "CreateTodo").Add(1)
 		mw.requestLatency.With("method", "CreateTodo").Observe(time.Since(begin).Seconds())
 	}(time.Now())
-	return mw.next.CreateTodo(ctx, userID, text)
+	return mw.next.CreateTodo(ctx, userID, input)
 }
 
-func (mw *instrumentingTodoMiddleware) ListTodos(ctx context.Context, userID string, limit, offset int) ([]Todo, int, error) {
+func (mw *instrumentingTodoMiddleware) GetTodo(ctx context.Context, userID, todoID string) (Todo, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "GetTodo").Add(1)
+		mw.requestLatency.With("method", "GetTodo").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.GetTodo(ctx, userID, todoID)
+}
+
+func (mw *instrumentingTodoMiddleware) ListTodos(ctx context.Context, userID string, filter TodoFilter, limit, offset int) ([]Todo, int, error) {
 	defer func(begin time.Time) {
 		mw.requestCount.With("method", "ListTodos").Add(1)
 		mw.requestLatency.With("method", "ListTodos").Observe(time.Since(begin).Seconds())
 	}(time.Now())
-	return mw.next.ListTodos(ctx, userID, limit, offset)
+	return mw.next.ListTodos(ctx, userID, filter, limit, offset)
 }
 
 func (mw *instrumentingTodoMiddleware) CompleteTodo(ctx context.Context, userID, todoID string) error {
@@ -187,3 +1373,315 @@ func (mw *instrumentingTodoMiddleware) CompleteTodo(ctx context.Context, userID,
 	}(time.Now())
 	return mw.next.CompleteTodo(ctx, userID, todoID)
 }
+
+func (mw *instrumentingTodoMiddleware) UpdateTodo(ctx context.Context, userID, todoID string, patch TodoPatch) (Todo, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "UpdateTodo").Add(1)
+		mw.requestLatency.With("method", "UpdateTodo").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.UpdateTodo(ctx, userID, todoID, patch)
+}
+
+func (mw *instrumentingTodoMiddleware) DeleteTodo(ctx context.Context, userID, todoID string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "DeleteTodo").Add(1)
+		mw.requestLatency.With("method", "DeleteTodo").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.DeleteTodo(ctx, userID, todoID)
+}
+
+func (mw *instrumentingTodoMiddleware) CreateList(ctx context.Context, userID, name string) (string, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "CreateList").Add(1)
+		mw.requestLatency.With("method", "CreateList").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.CreateList(ctx, userID, name)
+}
+
+func (mw *instrumentingTodoMiddleware) ListLists(ctx context.Context, userID string) ([]List, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListLists").Add(1)
+		mw.requestLatency.With("method", "ListLists").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListLists(ctx, userID)
+}
+
+func (mw *instrumentingTodoMiddleware) ListTags(ctx context.Context, userID string) ([]Tag, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListTags").Add(1)
+		mw.requestLatency.With("method", "ListTags").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListTags(ctx, userID)
+}
+
+func (mw *instrumentingTodoMiddleware) ShareList(ctx context.Context, userID, listID, email, role string) (Invitation, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ShareList").Add(1)
+		mw.requestLatency.With("method", "ShareList").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ShareList(ctx, userID, listID, email, role)
+}
+
+func (mw *instrumentingTodoMiddleware) ListInvitations(ctx context.Context, email string) ([]Invitation, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListInvitations").Add(1)
+		mw.requestLatency.With("method", "ListInvitations").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListInvitations(ctx, email)
+}
+
+func (mw *instrumentingTodoMiddleware) RespondToInvitation(ctx context.Context, userID, email, invitationID string, accept bool) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "RespondToInvitation").Add(1)
+		mw.requestLatency.With("method", "RespondToInvitation").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.RespondToInvitation(ctx, userID, email, invitationID, accept)
+}
+
+func (mw *instrumentingTodoMiddleware) ListMembers(ctx context.Context, userID, listID string) ([]ListMember, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListMembers").Add(1)
+		mw.requestLatency.With("method", "ListMembers").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListMembers(ctx, userID, listID)
+}
+
+func (mw *instrumentingTodoMiddleware) SetMemberRole(ctx context.Context, userID, listID, memberID, role string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "SetMemberRole").Add(1)
+		mw.requestLatency.With("method", "SetMemberRole").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.SetMemberRole(ctx, userID, listID, memberID, role)
+}
+
+func (mw *instrumentingTodoMiddleware) RemoveMember(ctx context.Context, userID, listID, memberID string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "RemoveMember").Add(1)
+		mw.requestLatency.With("method", "RemoveMember").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.RemoveMember(ctx, userID, listID, memberID)
+}
+
+func (mw *instrumentingTodoMiddleware) AssignTodo(ctx context.Context, userID, todoID, assigneeID string) (Todo, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "AssignTodo").Add(1)
+		mw.requestLatency.With("method", "AssignTodo").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.AssignTodo(ctx, userID, todoID, assigneeID)
+}
+
+func (mw *instrumentingTodoMiddleware) AddComment(ctx context.Context, userID, todoID, text string) (Comment, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "AddComment").Add(1)
+		mw.requestLatency.With("method", "AddComment").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.AddComment(ctx, userID, todoID, text)
+}
+
+func (mw *instrumentingTodoMiddleware) EditComment(ctx context.Context, userID, todoID, commentID, text string) (Comment, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "EditComment").Add(1)
+		mw.requestLatency.With("method", "EditComment").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.EditComment(ctx, userID, todoID, commentID, text)
+}
+
+func (mw *instrumentingTodoMiddleware) DeleteComment(ctx context.Context, userID, todoID, commentID string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "DeleteComment").Add(1)
+		mw.requestLatency.With("method", "DeleteComment").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.DeleteComment(ctx, userID, todoID, commentID)
+}
+
+func (mw *instrumentingTodoMiddleware) ListComments(ctx context.Context, userID, todoID string, limit, offset int) ([]Comment, int, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListComments").Add(1)
+		mw.requestLatency.With("method", "ListComments").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListComments(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *instrumentingTodoMiddleware) TodoActivity(ctx context.Context, userID, todoID string, limit, offset int) ([]Activity, int, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "TodoActivity").Add(1)
+		mw.requestLatency.With("method", "TodoActivity").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.TodoActivity(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *instrumentingTodoMiddleware) TodoHistory(ctx context.Context, userID, todoID string, limit, offset int) ([]TodoChange, int, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "TodoHistory").Add(1)
+		mw.requestLatency.With("method", "TodoHistory").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.TodoHistory(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *instrumentingTodoMiddleware) RevertTodo(ctx context.Context, userID, todoID string, version int) (Todo, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "RevertTodo").Add(1)
+		mw.requestLatency.With("method", "RevertTodo").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.RevertTodo(ctx, userID, todoID, version)
+}
+
+func (mw *instrumentingTodoMiddleware) MoveTodo(ctx context.Context, userID, todoID string, move TodoMove) (Todo, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "MoveTodo").Add(1)
+		mw.requestLatency.With("method", "MoveTodo").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.MoveTodo(ctx, userID, todoID, move)
+}
+
+func (mw *instrumentingTodoMiddleware) GetWorkflow(ctx context.Context, userID, listID string) (Workflow, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "GetWorkflow").Add(1)
+		mw.requestLatency.With("method", "GetWorkflow").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.GetWorkflow(ctx, userID, listID)
+}
+
+func (mw *instrumentingTodoMiddleware) SetWorkflow(ctx context.Context, userID, listID string, workflow Workflow) (Workflow, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "SetWorkflow").Add(1)
+		mw.requestLatency.With("method", "SetWorkflow").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.SetWorkflow(ctx, userID, listID, workflow)
+}
+
+func (mw *instrumentingTodoMiddleware) TransitionTodo(ctx context.Context, userID, todoID, status string) (Todo, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "TransitionTodo").Add(1)
+		mw.requestLatency.With("method", "TransitionTodo").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.TransitionTodo(ctx, userID, todoID, status)
+}
+
+func (mw *instrumentingTodoMiddleware) ListBoard(ctx context.Context, userID, listID string) (Board, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListBoard").Add(1)
+		mw.requestLatency.With("method", "ListBoard").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListBoard(ctx, userID, listID)
+}
+
+func (mw *instrumentingTodoMiddleware) AddBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "AddBlocker").Add(1)
+		mw.requestLatency.With("method", "AddBlocker").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.AddBlocker(ctx, userID, todoID, blockerID)
+}
+
+func (mw *instrumentingTodoMiddleware) RemoveBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "RemoveBlocker").Add(1)
+		mw.requestLatency.With("method", "RemoveBlocker").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.RemoveBlocker(ctx, userID, todoID, blockerID)
+}
+
+func (mw *instrumentingTodoMiddleware) ListNextTodos(ctx context.Context, userID string, limit, offset int) ([]Todo, int, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListNextTodos").Add(1)
+		mw.requestLatency.With("method", "ListNextTodos").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListNextTodos(ctx, userID, limit, offset)
+}
+
+func (mw *instrumentingTodoMiddleware) AddAttachment(ctx context.Context, userID, todoID, name string, r io.Reader) (Attachment, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "AddAttachment").Add(1)
+		mw.requestLatency.With("method", "AddAttachment").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.AddAttachment(ctx, userID, todoID, name, r)
+}
+
+func (mw *instrumentingTodoMiddleware) ListAttachments(ctx context.Context, userID, todoID string) ([]Attachment, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListAttachments").Add(1)
+		mw.requestLatency.With("method", "ListAttachments").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListAttachments(ctx, userID, todoID)
+}
+
+func (mw *instrumentingTodoMiddleware) OpenAttachment(ctx context.Context, userID, todoID, attachmentID string) (Attachment, io.ReadCloser, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "OpenAttachment").Add(1)
+		mw.requestLatency.With("method", "OpenAttachment").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.OpenAttachment(ctx, userID, todoID, attachmentID)
+}
+
+func (mw *instrumentingTodoMiddleware) DeleteAttachment(ctx context.Context, userID, todoID, attachmentID string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "DeleteAttachment").Add(1)
+		mw.requestLatency.With("method", "DeleteAttachment").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.DeleteAttachment(ctx, userID, todoID, attachmentID)
+}
+
+func (mw *instrumentingTodoMiddleware) AttachmentUsage(ctx context.Context, userID string) (int64, int64, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "AttachmentUsage").Add(1)
+		mw.requestLatency.With("method", "AttachmentUsage").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.AttachmentUsage(ctx, userID)
+}
+
+func (mw *instrumentingTodoMiddleware) StartTimer(ctx context.Context, userID, todoID, note string) (TimeEntry, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "StartTimer").Add(1)
+		mw.requestLatency.With("method", "StartTimer").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.StartTimer(ctx, userID, todoID, note)
+}
+
+func (mw *instrumentingTodoMiddleware) StopTimer(ctx context.Context, userID string) (TimeEntry, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "StopTimer").Add(1)
+		mw.requestLatency.With("method", "StopTimer").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.StopTimer(ctx, userID)
+}
+
+func (mw *instrumentingTodoMiddleware) AddTimeEntry(ctx context.Context, userID, todoID string, input TimeEntryInput) (TimeEntry, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "AddTimeEntry").Add(1)
+		mw.requestLatency.With("method", "AddTimeEntry").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.AddTimeEntry(ctx, userID, todoID, input)
+}
+
+func (mw *instrumentingTodoMiddleware) ListTimeEntries(ctx context.Context, userID, todoID string, limit, offset int) ([]TimeEntry, int, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "ListTimeEntries").Add(1)
+		mw.requestLatency.With("method", "ListTimeEntries").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.ListTimeEntries(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *instrumentingTodoMiddleware) DeleteTimeEntry(ctx context.Context, userID, todoID, entryID string) error {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "DeleteTimeEntry").Add(1)
+		mw.requestLatency.With("method", "DeleteTimeEntry").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.DeleteTimeEntry(ctx, userID, todoID, entryID)
+}
+
+func (mw *instrumentingTodoMiddleware) TimeReport(ctx context.Context, userID string, query TimeQuery) (TimeReport, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "TimeReport").Add(1)
+		mw.requestLatency.With("method", "TimeReport").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.TimeReport(ctx, userID, query)
+}
+
+func (mw *instrumentingTodoMiddleware) Timesheet(ctx context.Context, userID string, query TimeQuery) ([]TimesheetEntry, error) {
+	defer func(begin time.Time) {
+		mw.requestCount.With("method", "Timesheet").Add(1)
+		mw.requestLatency.With("method", "Timesheet").Observe(time.Since(begin).Seconds())
+	}(time.Now())
+	return mw.next.Timesheet(ctx, userID, query)
+}
@@ -0,0 +1,478 @@
+package auth_todo
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	oauthCodeTTL    = 10 * time.Minute
+	oauthAccessTTL  = time.Hour
+	oauthRefreshTTL = 30 * 24 * time.Hour
+
+	oauthAccessTokenPrefix  = "todo_oat_"
+	oauthRefreshTokenPrefix = "todo_ort_"
+
+	// oauthSweepInterval is how often expired codes and tokens are swept.
+	oauthSweepInterval = time.Minute
+)
+
+var (
+	ErrOAuthClientNotFound  = errors.New("unknown OAuth client")
+	ErrInvalidRedirectURI   = errors.New("invalid redirect URI")
+	ErrEmptyClientName      = errors.New("client name cannot be empty")
+	ErrNoRedirectURIs       = errors.New("at least one redirect URI is required")
+	ErrUnsupportedChallenge = errors.New("code_challenge_method must be S256")
+)
+
+// OAuthError is an error response defined by RFC 6749, such as
+// invalid_grant. Code is sent to the client as the error parameter.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) error {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// OAuthClient is a third-party application registered by a user. Public
+// clients, such as mobile and single-page apps, have no secret and rely on
+// PKCE alone.
+type OAuthClient struct {
+	ID           string
+	Name         string
+	OwnerID      string
+	RedirectURIs []string
+	Confidential bool
+	CreatedAt    time.Time
+}
+
+// OAuthAuthorizationRequest holds the parameters of an authorization request
+// that identify the client and what it asks for.
+type OAuthAuthorizationRequest struct {
+	ClientID            string
+	RedirectURI         string
+	Scopes              []string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// OAuthTokenRequest holds the parameters of a token request for either the
+// authorization_code or the refresh_token grant.
+type OAuthTokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+}
+
+type OAuthToken struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+	Scopes       []string
+}
+
+// OAuthIntrospection describes a token as defined by RFC 7662. Everything but
+// Active is empty for inactive tokens.
+type OAuthIntrospection struct {
+	Active    bool
+	TokenType string
+	Scopes    []string
+	ClientID  string
+	UserID    string
+	Username  string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+type oauthClient struct {
+	OAuthClient
+	secretHash string
+}
+
+// oauthGrant is the authorization a user gave a client, from which access and
+// refresh tokens are issued.
+type oauthGrant struct {
+	clientID     string
+	userID       string
+	scopes       []string
+	accessTokens map[string]bool
+	refreshToken string
+}
+
+type oauthCode struct {
+	clientID    string
+	userID      string
+	redirectURI string
+	scopes      []string
+	challenge   string
+	expiresAt   time.Time
+	// grant is set once the code is exchanged, so that a replayed code can
+	// revoke the tokens issued for it.
+	grant *oauthGrant
+}
+
+type oauthToken struct {
+	grant     *oauthGrant
+	refresh   bool
+	issuedAt  time.Time
+	expiresAt time.Time
+}
+
+// validateRedirectURI accepts absolute https URIs without a fragment, and
+// http only for loopback addresses as used by native apps.
+func validateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return ErrInvalidRedirectURI
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		if host := u.Hostname(); host == "localhost" || net.ParseIP(host).IsLoopback() {
+			return nil
+		}
+	}
+	return ErrInvalidRedirectURI
+}
+
+// RegisterOAuthClient registers an application owned by ownerID. The secret
+// of a confidential client is only returned here; public clients get none.
+func (s *authService) RegisterOAuthClient(ctx context.Context, ownerID, name string, redirectURIs []string, confidential bool) (OAuthClient, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return OAuthClient{}, "", ErrEmptyClientName
+	}
+	if len(redirectURIs) == 0 {
+		return OAuthClient{}, "", ErrNoRedirectURIs
+	}
+	for _, uri := range redirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return OAuthClient{}, "", fmt.Errorf("%w: %q", err, uri)
+		}
+	}
+
+	var secret, secretHash string
+	if confidential {
+		var err error
+		if secret, err = newSecret(); err != nil {
+			return OAuthClient{}, "", err
+		}
+		secretHash = hashToken(secret)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.emailsByID[ownerID]; !exists {
+		return OAuthClient{}, "", ErrUserNotFound
+	}
+	s.oauthClientCounter++
+	c := &oauthClient{
+		OAuthClient: OAuthClient{
+			ID:           fmt.Sprintf("client_%d", s.oauthClientCounter),
+			Name:         name,
+			OwnerID:      ownerID,
+			RedirectURIs: append([]string(nil), redirectURIs...),
+			Confidential: confidential,
+			CreatedAt:    time.Now(),
+		},
+		secretHash: secretHash,
+	}
+	s.oauthClients[c.ID] = c
+	return c.OAuthClient, secret, nil
+}
+
+// ValidateOAuthAuthorization checks an authorization request before the user
+// is asked for consent. ErrOAuthClientNotFound and ErrInvalidRedirectURI must
+// be shown to the user rather than sent to the redirect URI; other problems
+// are reported as an *OAuthError to be sent there.
+func (s *authService) ValidateOAuthAuthorization(ctx context.Context, req OAuthAuthorizationRequest) (OAuthClient, error) {
+	s.mu.RLock()
+	c, exists := s.oauthClients[req.ClientID]
+	s.mu.RUnlock()
+
+	if !exists {
+		return OAuthClient{}, ErrOAuthClientNotFound
+	}
+	if indexOf(c.RedirectURIs, req.RedirectURI) < 0 {
+		return OAuthClient{}, ErrInvalidRedirectURI
+	}
+	if len(req.Scopes) == 0 {
+		return OAuthClient{}, oauthError("invalid_scope", "scope is required")
+	}
+	for _, scope := range req.Scopes {
+		if !validScopes[scope] {
+			return OAuthClient{}, oauthError("invalid_scope", fmt.Sprintf("unknown scope %q", scope))
+		}
+	}
+	if req.CodeChallengeMethod != "S256" {
+		return OAuthClient{}, oauthError("invalid_request", ErrUnsupportedChallenge.Error())
+	}
+	if len(req.CodeChallenge) != base64.RawURLEncoding.EncodedLen(sha256.Size) {
+		return OAuthClient{}, oauthError("invalid_request", "invalid code_challenge")
+	}
+	return c.OAuthClient, nil
+}
+
+// AuthorizeOAuth records that userID consented to the request and returns
+// the authorization code to redirect the user back with.
+func (s *authService) AuthorizeOAuth(ctx context.Context, userID string, req OAuthAuthorizationRequest) (string, error) {
+	if _, err := s.ValidateOAuthAuthorization(ctx, req); err != nil {
+		return "", err
+	}
+	code, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweepOAuth(now)
+	s.oauthCodes[hashToken(code)] = &oauthCode{
+		clientID:    req.ClientID,
+		userID:      userID,
+		redirectURI: req.RedirectURI,
+		scopes:      normalizeScopes(req.Scopes),
+		challenge:   req.CodeChallenge,
+		expiresAt:   now.Add(oauthCodeTTL),
+	}
+	return code, nil
+}
+
+func normalizeScopes(scopes []string) []string {
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// authenticateClient must be called with s.mu held. Public clients are
+// identified by their ID alone.
+func (s *authService) authenticateClient(clientID, clientSecret string) (*oauthClient, error) {
+	c, exists := s.oauthClients[clientID]
+	if !exists {
+		return nil, oauthError("invalid_client", "")
+	}
+	if c.Confidential && subtle.ConstantTimeCompare([]byte(c.secretHash), []byte(hashToken(clientSecret))) != 1 {
+		return nil, oauthError("invalid_client", "")
+	}
+	return c, nil
+}
+
+// ExchangeOAuthToken implements the token endpoint for the
+// authorization_code and refresh_token grants. Refresh tokens are rotated on
+// every use.
+func (s *authService) ExchangeOAuthToken(ctx context.Context, req OAuthTokenRequest) (OAuthToken, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.authenticateClient(req.ClientID, req.ClientSecret)
+	if err != nil {
+		return OAuthToken{}, err
+	}
+
+	switch req.GrantType {
+	case "authorization_code":
+		hash := hashToken(req.Code)
+		code, exists := s.oauthCodes[hash]
+		if !exists || !now.Before(code.expiresAt) || code.clientID != c.ID {
+			return OAuthToken{}, oauthError("invalid_grant", "invalid or expired code")
+		}
+		if code.grant != nil {
+			// RFC 6749 section 4.1.2: a code used twice may have been stolen,
+			// so the tokens already issued for it are revoked.
+			s.revokeGrant(code.grant)
+			delete(s.oauthCodes, hash)
+			return OAuthToken{}, oauthError("invalid_grant", "code already used")
+		}
+		if req.RedirectURI != code.redirectURI {
+			return OAuthToken{}, oauthError("invalid_grant", "redirect_uri does not match")
+		}
+		if !verifyCodeChallenge(req.CodeVerifier, code.challenge) {
+			return OAuthToken{}, oauthError("invalid_grant", "invalid code_verifier")
+		}
+		code.grant = &oauthGrant{
+			clientID:     c.ID,
+			userID:       code.userID,
+			scopes:       code.scopes,
+			accessTokens: make(map[string]bool),
+		}
+		return s.issueOAuthTokens(code.grant, now)
+
+	case "refresh_token":
+		hash := hashToken(req.RefreshToken)
+		token, exists := s.oauthTokens[hash]
+		if !exists || !token.refresh || !now.Before(token.expiresAt) || token.grant.clientID != c.ID {
+			return OAuthToken{}, oauthError("invalid_grant", "invalid or expired refresh token")
+		}
+		delete(s.oauthTokens, hash)
+		return s.issueOAuthTokens(token.grant, now)
+	}
+
+	return OAuthToken{}, oauthError("unsupported_grant_type", "")
+}
+
+// verifyCodeChallenge checks a PKCE verifier against an S256 challenge
+// (RFC 7636).
+func verifyCodeChallenge(verifier, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(codeChallengeS256(verifier)), []byte(challenge)) == 1
+}
+
+// issueOAuthTokens must be called with s.mu held.
+func (s *authService) issueOAuthTokens(grant *oauthGrant, now time.Time) (OAuthToken, error) {
+	access, err := newSecret()
+	if err != nil {
+		return OAuthToken{}, err
+	}
+	refresh, err := newSecret()
+	if err != nil {
+		return OAuthToken{}, err
+	}
+	access = oauthAccessTokenPrefix + access
+	refresh = oauthRefreshTokenPrefix + refresh
+
+	s.sweepOAuth(now)
+
+	accessHash, refreshHash := hashToken(access), hashToken(refresh)
+	s.oauthTokens[accessHash] = &oauthToken{grant: grant, issuedAt: now, expiresAt: now.Add(oauthAccessTTL)}
+	s.oauthTokens[refreshHash] = &oauthToken{grant: grant, refresh: true, issuedAt: now, expiresAt: now.Add(oauthRefreshTTL)}
+	grant.accessTokens[accessHash] = true
+	grant.refreshToken = refreshHash
+
+	return OAuthToken{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    oauthAccessTTL,
+		Scopes:       grant.scopes,
+	}, nil
+}
+
+// revokeGrant must be called with s.mu held.
+func (s *authService) revokeGrant(grant *oauthGrant) {
+	for hash := range grant.accessTokens {
+		delete(s.oauthTokens, hash)
+	}
+	grant.accessTokens = make(map[string]bool)
+	delete(s.oauthTokens, grant.refreshToken)
+}
+
+// sweepOAuth forgets expired codes and tokens. It must be called with s.mu
+// held.
+func (s *authService) sweepOAuth(now time.Time) {
+	if now.Sub(s.oauthSweptAt) < oauthSweepInterval {
+		return
+	}
+	s.oauthSweptAt = now
+	for hash, code := range s.oauthCodes {
+		if !now.Before(code.expiresAt) {
+			delete(s.oauthCodes, hash)
+		}
+	}
+	for hash, token := range s.oauthTokens {
+		if !now.Before(token.expiresAt) {
+			delete(s.oauthTokens, hash)
+			delete(token.grant.accessTokens, hash)
+		}
+	}
+}
+
+// IntrospectOAuthToken implements RFC 7662 for the client the token was
+// issued to. Tokens of other clients are reported as inactive.
+func (s *authService) IntrospectOAuthToken(ctx context.Context, clientID, clientSecret, token string) (OAuthIntrospection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return OAuthIntrospection{}, err
+	}
+	t, exists := s.oauthTokens[hashToken(token)]
+	if !exists || !time.Now().Before(t.expiresAt) || t.grant.clientID != c.ID {
+		return OAuthIntrospection{}, nil
+	}
+
+	tokenType := "access_token"
+	if t.refresh {
+		tokenType = "refresh_token"
+	}
+	return OAuthIntrospection{
+		Active:    true,
+		TokenType: tokenType,
+		Scopes:    t.grant.scopes,
+		ClientID:  c.ID,
+		UserID:    t.grant.userID,
+		Username:  s.emailsByID[t.grant.userID],
+		IssuedAt:  t.issuedAt,
+		ExpiresAt: t.expiresAt,
+	}, nil
+}
+
+// RevokeOAuthToken implements RFC 7009. Revoking a refresh token revokes
+// every token of its grant. Unknown tokens are not an error.
+func (s *authService) RevokeOAuthToken(ctx context.Context, clientID, clientSecret, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.authenticateClient(clientID, clientSecret)
+	if err != nil {
+		return err
+	}
+	hash := hashToken(token)
+	t, exists := s.oauthTokens[hash]
+	if !exists || t.grant.clientID != c.ID {
+		return nil
+	}
+	if t.refresh {
+		s.revokeGrant(t.grant)
+		return nil
+	}
+	delete(s.oauthTokens, hash)
+	delete(t.grant.accessTokens, hash)
+	return nil
+}
+
+// authenticateOAuth resolves an OAuth access token. It must be called with
+// s.mu held.
+func (s *authService) authenticateOAuth(token string) (Credentials, error) {
+	t, exists := s.oauthTokens[hashToken(token)]
+	if !exists || t.refresh || !time.Now().Before(t.expiresAt) {
+		return Credentials{}, ErrInvalidToken
+	}
+	return Credentials{UserID: t.grant.userID, ClientID: t.grant.clientID, Scopes: t.grant.scopes}, nil
+}
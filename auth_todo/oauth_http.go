@@ -0,0 +1,491 @@
+package auth_todo
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+//go:embed oauth_consent.html
+var oauthConsentHTML string
+
+var oauthConsentTemplate = template.Must(template.New("consent").Parse(oauthConsentHTML))
+
+// scopeDescriptions are shown to users on the consent screen.
+var scopeDescriptions = map[string]string{
+	ScopeTodosRead:  "Read your todos and lists",
+	ScopeTodosWrite: "Create, change and delete your todos and lists",
+}
+
+type createOAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Confidential bool     `json:"confidential"`
+}
+
+type createOAuthClientResponse struct {
+	Client       *OAuthClient `json:"client,omitempty"`
+	ClientSecret string       `json:"client_secret,omitempty"`
+	Err          string       `json:"error,omitempty"`
+}
+
+func makeCreateOAuthClientEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createOAuthClientRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		client, secret, err := svc.RegisterOAuthClient(ctx, userID, req.Name, req.RedirectURIs, req.Confidential)
+		if err != nil {
+			return createOAuthClientResponse{Err: err.Error()}, nil
+		}
+		return createOAuthClientResponse{Client: &client, ClientSecret: secret}, nil
+	}
+}
+
+// oauthAuthorizeRequest holds the query parameters of an authorization
+// request, which the consent form posts back unchanged.
+type oauthAuthorizeRequest struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state,omitempty"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+}
+
+func (r oauthAuthorizeRequest) authorization() OAuthAuthorizationRequest {
+	return OAuthAuthorizationRequest{
+		ClientID:            r.ClientID,
+		RedirectURI:         r.RedirectURI,
+		Scopes:              strings.Fields(r.Scope),
+		CodeChallenge:       r.CodeChallenge,
+		CodeChallengeMethod: r.CodeChallengeMethod,
+	}
+}
+
+type oauthConsentRequest struct {
+	oauthAuthorizeRequest
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	Code     string `json:"code,omitempty"`
+	Decision string `json:"decision"`
+}
+
+// oauthAuthorizeResponse either redirects the user back to the client or
+// renders the consent screen, or an error page if the client cannot be
+// trusted with a redirect.
+type oauthAuthorizeResponse struct {
+	Redirect string
+	Client   *OAuthClient
+	Request  oauthAuthorizeRequest
+	Scopes   []string
+	Email    string
+	Err      string
+}
+
+// validateAuthorizeRequest checks the request, returning the response to
+// send instead of the consent screen if it is invalid.
+func validateAuthorizeRequest(ctx context.Context, svc AuthService, req oauthAuthorizeRequest) (OAuthClient, *oauthAuthorizeResponse) {
+	client, err := svc.ValidateOAuthAuthorization(ctx, req.authorization())
+	var oauthErr *OAuthError
+	if (err == nil || errors.As(err, &oauthErr)) && req.ResponseType != "code" {
+		err = oauthError("unsupported_response_type", "response_type must be code")
+	}
+	if err == nil {
+		return client, nil
+	}
+	if errors.As(err, &oauthErr) {
+		return client, &oauthAuthorizeResponse{Redirect: oauthRedirect(req, url.Values{
+			"error":             {oauthErr.Code},
+			"error_description": {oauthErr.Description},
+		})}
+	}
+	return client, &oauthAuthorizeResponse{Err: err.Error()}
+}
+
+// oauthRedirect returns the client's redirect URI with params and the state
+// of the request added to its query.
+func oauthRedirect(req oauthAuthorizeRequest, params url.Values) string {
+	u, _ := url.Parse(req.RedirectURI)
+	q := u.Query()
+	for key, values := range params {
+		if values[0] != "" {
+			q.Set(key, values[0])
+		}
+	}
+	if req.State != "" {
+		q.Set("state", req.State)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func consentPage(client OAuthClient, req oauthAuthorizeRequest, email string, err error) oauthAuthorizeResponse {
+	resp := oauthAuthorizeResponse{Client: &client, Request: req, Email: email}
+	for _, scope := range strings.Fields(req.Scope) {
+		resp.Scopes = append(resp.Scopes, scopeDescriptions[scope])
+	}
+	if err != nil {
+		resp.Err = err.Error()
+	}
+	return resp
+}
+
+func makeOAuthAuthorizeEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(oauthAuthorizeRequest)
+		client, invalid := validateAuthorizeRequest(ctx, svc, req)
+		if invalid != nil {
+			return *invalid, nil
+		}
+		return consentPage(client, req, "", nil), nil
+	}
+}
+
+// makeOAuthConsentEndpoint handles the consent form. The user signs in on the
+// form itself, with a two-factor code if enabled, so a third-party page
+// cannot submit it on their behalf.
+func makeOAuthConsentEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(oauthConsentRequest)
+		client, invalid := validateAuthorizeRequest(ctx, svc, req.oauthAuthorizeRequest)
+		if invalid != nil {
+			return *invalid, nil
+		}
+		if req.Decision != "approve" {
+			return oauthAuthorizeResponse{Redirect: oauthRedirect(req.oauthAuthorizeRequest, url.Values{
+				"error": {"access_denied"},
+			})}, nil
+		}
+
+		// The credentials are checked without starting a session, which
+		// the consent would have no use for.
+		userID, err := svc.VerifyCredentials(ctx, req.Email, req.Password, req.Code)
+		if err != nil {
+			return consentPage(client, req.oauthAuthorizeRequest, req.Email, err), nil
+		}
+
+		code, err := svc.AuthorizeOAuth(ctx, userID, req.authorization())
+		if err != nil {
+			return nil, err
+		}
+		return oauthAuthorizeResponse{Redirect: oauthRedirect(req.oauthAuthorizeRequest, url.Values{
+			"code": {code},
+		})}, nil
+	}
+}
+
+// oauthErrorResponse is the error body of RFC 6749 section 5.2, embedded in
+// the responses of the token, introspection and revocation endpoints.
+type oauthErrorResponse struct {
+	Error            string `json:"error,omitempty"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func (r oauthErrorResponse) status() int {
+	switch r.Error {
+	case "":
+		return http.StatusOK
+	case "invalid_client":
+		return http.StatusUnauthorized
+	}
+	return http.StatusBadRequest
+}
+
+// oauthErrorFrom converts an *OAuthError into a response body. Other errors
+// are returned to fail the request.
+func oauthErrorFrom(err error) (oauthErrorResponse, error) {
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) {
+		return oauthErrorResponse{}, err
+	}
+	return oauthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description}, nil
+}
+
+type oauthTokenRequest struct {
+	GrantType    string `json:"grant_type"`
+	Code         string `json:"code,omitempty"`
+	RedirectURI  string `json:"redirect_uri,omitempty"`
+	CodeVerifier string `json:"code_verifier,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token,omitempty"`
+	TokenType    string `json:"token_type,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	oauthErrorResponse
+}
+
+func makeOAuthTokenEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(oauthTokenRequest)
+		token, err := svc.ExchangeOAuthToken(ctx, OAuthTokenRequest{
+			GrantType:    req.GrantType,
+			ClientID:     req.ClientID,
+			ClientSecret: req.ClientSecret,
+			Code:         req.Code,
+			RedirectURI:  req.RedirectURI,
+			CodeVerifier: req.CodeVerifier,
+			RefreshToken: req.RefreshToken,
+		})
+		if err != nil {
+			errResp, err := oauthErrorFrom(err)
+			return oauthTokenResponse{oauthErrorResponse: errResp}, err
+		}
+		return oauthTokenResponse{
+			AccessToken:  token.AccessToken,
+			TokenType:    "Bearer",
+			ExpiresIn:    int(token.ExpiresIn.Seconds()),
+			RefreshToken: token.RefreshToken,
+			Scope:        strings.Join(token.Scopes, " "),
+		}, nil
+	}
+}
+
+// oauthTokenActionRequest is the body of introspection and revocation
+// requests.
+type oauthTokenActionRequest struct {
+	Token         string `json:"token"`
+	TokenTypeHint string `json:"token_type_hint,omitempty"`
+	ClientID      string `json:"client_id"`
+	ClientSecret  string `json:"client_secret,omitempty"`
+}
+
+type oauthIntrospectResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	oauthErrorResponse
+}
+
+func makeOAuthIntrospectEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(oauthTokenActionRequest)
+		introspection, err := svc.IntrospectOAuthToken(ctx, req.ClientID, req.ClientSecret, req.Token)
+		if err != nil {
+			errResp, err := oauthErrorFrom(err)
+			return oauthIntrospectResponse{oauthErrorResponse: errResp}, err
+		}
+		if !introspection.Active {
+			return oauthIntrospectResponse{}, nil
+		}
+		return oauthIntrospectResponse{
+			Active:    true,
+			Scope:     strings.Join(introspection.Scopes, " "),
+			ClientID:  introspection.ClientID,
+			Username:  introspection.Username,
+			Subject:   introspection.UserID,
+			TokenType: introspection.TokenType,
+			ExpiresAt: introspection.ExpiresAt.Unix(),
+			IssuedAt:  introspection.IssuedAt.Unix(),
+		}, nil
+	}
+}
+
+type oauthRevokeResponse struct {
+	oauthErrorResponse
+}
+
+func makeOAuthRevokeEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(oauthTokenActionRequest)
+		if err := svc.RevokeOAuthToken(ctx, req.ClientID, req.ClientSecret, req.Token); err != nil {
+			errResp, err := oauthErrorFrom(err)
+			return oauthRevokeResponse{errResp}, err
+		}
+		return oauthRevokeResponse{}, nil
+	}
+}
+
+func decodeCreateOAuthClientRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req createOAuthClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func authorizeRequestFrom(values url.Values) oauthAuthorizeRequest {
+	return oauthAuthorizeRequest{
+		ResponseType:        values.Get("response_type"),
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		Scope:               values.Get("scope"),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+	}
+}
+
+func decodeOAuthAuthorizeRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return authorizeRequestFrom(r.URL.Query()), nil
+}
+
+func decodeOAuthConsentRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	return oauthConsentRequest{
+		oauthAuthorizeRequest: authorizeRequestFrom(r.PostForm),
+		Email:                 r.PostForm.Get("email"),
+		Password:              r.PostForm.Get("password"),
+		Code:                  r.PostForm.Get("code"),
+		Decision:              r.PostForm.Get("decision"),
+	}, nil
+}
+
+// clientCredentials returns the client credentials of a form request, from
+// HTTP Basic authentication as RFC 6749 section 2.3.1 prefers, or from the
+// body.
+func clientCredentials(r *http.Request) (clientID, clientSecret string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+		return id, secret
+	}
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+func decodeOAuthTokenRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	clientID, clientSecret := clientCredentials(r)
+	return oauthTokenRequest{
+		GrantType:    r.PostForm.Get("grant_type"),
+		Code:         r.PostForm.Get("code"),
+		RedirectURI:  r.PostForm.Get("redirect_uri"),
+		CodeVerifier: r.PostForm.Get("code_verifier"),
+		RefreshToken: r.PostForm.Get("refresh_token"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+	}, nil
+}
+
+func decodeOAuthTokenActionRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	clientID, clientSecret := clientCredentials(r)
+	return oauthTokenActionRequest{
+		Token:         r.PostForm.Get("token"),
+		TokenTypeHint: r.PostForm.Get("token_type_hint"),
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+	}, nil
+}
+
+func encodeOAuthAuthorizeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(oauthAuthorizeResponse)
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Redirect != "" {
+		w.Header().Set("Location", resp.Redirect)
+		w.WriteHeader(http.StatusFound)
+		return nil
+	}
+
+	// The consent screen must not be framed, or another site could trick
+	// the user into approving.
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	if resp.Client == nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	return oauthConsentTemplate.Execute(w, resp)
+}
+
+// encodeOAuthResponse writes the JSON responses of the token, introspection
+// and revocation endpoints with the status of their error, if any.
+func encodeOAuthResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	status := http.StatusOK
+	if resp, ok := response.(interface{ status() int }); ok {
+		status = resp.status()
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(response)
+}
+
+func MakeCreateOAuthClientHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.CreateOAuthClientEndpoint,
+		decodeCreateOAuthClientRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeOAuthAuthorizeHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.OAuthAuthorizeEndpoint,
+		decodeOAuthAuthorizeRequest,
+		encodeOAuthAuthorizeResponse,
+		serverOptions()...,
+	)
+}
+
+func MakeOAuthConsentHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.OAuthConsentEndpoint,
+		decodeOAuthConsentRequest,
+		encodeOAuthAuthorizeResponse,
+		serverOptions()...,
+	)
+}
+
+func MakeOAuthTokenHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.OAuthTokenEndpoint,
+		decodeOAuthTokenRequest,
+		encodeOAuthResponse,
+		serverOptions()...,
+	)
+}
+
+func MakeOAuthIntrospectHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.OAuthIntrospectEndpoint,
+		decodeOAuthTokenActionRequest,
+		encodeOAuthResponse,
+		serverOptions()...,
+	)
+}
+
+func MakeOAuthRevokeHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.OAuthRevokeEndpoint,
+		decodeOAuthTokenActionRequest,
+		encodeOAuthResponse,
+		serverOptions()...,
+	)
+}
@@ -0,0 +1,222 @@
+package auth_todo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestOAuthAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost))
+	userID, _ := authSvc.Signup(ctx, "test@example.com", "password123")
+	otherID, _ := authSvc.Signup(ctx, "other@example.com", "password123")
+	const redirectURI = "http://127.0.0.1:9000/callback"
+
+	if _, _, err := authSvc.RegisterOAuthClient(ctx, userID, "Bad", []string{"http://example.com/cb"}, false); err == nil {
+		t.Error("Expected plain http redirect URIs to be rejected")
+	}
+	client, secret, err := authSvc.RegisterOAuthClient(ctx, userID, "Planner", []string{redirectURI}, true)
+	if err != nil || secret == "" {
+		t.Fatalf("RegisterOAuthClient failed: %v", err)
+	}
+	other, _, _ := authSvc.RegisterOAuthClient(ctx, otherID, "Other", []string{redirectURI}, false)
+
+	todoSvc := NewTodoService()
+	todoSvc.CreateTodo(ctx, userID, TodoInput{Text: "Existing"})
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(authSvc, todoSvc, NewEventBroker(16), nil)))
+	defer server.Close()
+	httpClient := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	authorize := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {ScopeTodosRead},
+		"state":                 {"xyz"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	resp, err := httpClient.Get(server.URL + "/oauth/authorize?" + authorize.Encode())
+	if err != nil {
+		t.Fatalf("GET /oauth/authorize failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Frame-Options") != "DENY" {
+		t.Errorf("Expected the consent screen, got %d", resp.StatusCode)
+	}
+	unknown := url.Values{"response_type": {"code"}, "client_id": {"client_99"}, "redirect_uri": {redirectURI}}
+	resp, _ = httpClient.Get(server.URL + "/oauth/authorize?" + unknown.Encode())
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected unknown clients not to be redirected to, got %d", resp.StatusCode)
+	}
+
+	consent := func(decision, password string) *url.URL {
+		t.Helper()
+		form := url.Values{"email": {"test@example.com"}, "password": {password}, "decision": {decision}}
+		for key, values := range authorize {
+			form[key] = values
+		}
+		resp, err := httpClient.PostForm(server.URL+"/oauth/authorize", form)
+		if err != nil {
+			t.Fatalf("POST /oauth/authorize failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			return nil
+		}
+		location, _ := url.Parse(resp.Header.Get("Location"))
+		return location
+	}
+	if location := consent("approve", "wrong"); location != nil {
+		t.Errorf("Expected a wrong password to show the consent screen again, got %v", location)
+	}
+	if location := consent("deny", ""); location == nil || location.Query().Get("error") != "access_denied" {
+		t.Errorf("Expected access_denied, got %v", location)
+	}
+	location := consent("approve", "password123")
+	if location == nil || location.Query().Get("state") != "xyz" || location.Query().Get("code") == "" {
+		t.Fatalf("Expected a redirect with a code, got %v", location)
+	}
+	if sessions := len(authSvc.(*authService).tokens); sessions != 0 {
+		t.Errorf("Expected consent not to start sessions, got %d", sessions)
+	}
+	code := location.Query().Get("code")
+
+	post := func(path string, form url.Values, clientID, clientSecret string) (int, map[string]interface{}) {
+		t.Helper()
+		req, _ := http.NewRequest("POST", server.URL+path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(clientID, clientSecret)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("POST %s failed: %v", path, err)
+		}
+		defer resp.Body.Close()
+		body := make(map[string]interface{})
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+	exchange := url.Values{"grant_type": {"authorization_code"}, "code": {code}, "redirect_uri": {redirectURI}}
+
+	if status, _ := post("/oauth/token", exchange, client.ID, "wrong"); status != http.StatusUnauthorized {
+		t.Errorf("Expected invalid_client to be 401, got %d", status)
+	}
+	exchange.Set("code_verifier", strings.Repeat("w", 43))
+	if _, body := post("/oauth/token", exchange, client.ID, secret); body["error"] != "invalid_grant" {
+		t.Errorf("Expected a wrong verifier to be rejected, got %v", body)
+	}
+	exchange.Set("code_verifier", verifier)
+	status, tokens := post("/oauth/token", exchange, client.ID, secret)
+	accessToken, _ := tokens["access_token"].(string)
+	refreshToken, _ := tokens["refresh_token"].(string)
+	if status != http.StatusOK || accessToken == "" || refreshToken == "" || tokens["scope"] != ScopeTodosRead {
+		t.Fatalf("Expected tokens, got %d %v", status, tokens)
+	}
+
+	do := func(method, path, token, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := do("GET", "/v1/todos", accessToken, ""); status != http.StatusOK {
+		t.Errorf("Expected the access token to read todos, got %d", status)
+	}
+	if status := do("POST", "/v1/todos", accessToken, `{"text":"Nope"}`); status != http.StatusForbidden {
+		t.Errorf("Expected todos:read not to allow writes, got %d", status)
+	}
+	if status := do("GET", "/v1/tokens", accessToken, ""); status != http.StatusForbidden {
+		t.Errorf("Expected OAuth tokens not to manage access tokens, got %d", status)
+	}
+
+	introspect := url.Values{"token": {accessToken}}
+	if _, body := post("/oauth/introspect", introspect, client.ID, secret); body["active"] != true || body["sub"] != userID {
+		t.Errorf("Expected an active token of the user, got %v", body)
+	}
+	if _, body := post("/oauth/introspect", introspect, other.ID, ""); body["active"] != false {
+		t.Errorf("Expected tokens of other clients to be inactive, got %v", body)
+	}
+
+	refresh := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}}
+	_, refreshed := post("/oauth/token", refresh, client.ID, secret)
+	if refreshed["refresh_token"] == refreshToken || refreshed["access_token"] == nil {
+		t.Fatalf("Expected the refresh token to rotate, got %v", refreshed)
+	}
+	if _, body := post("/oauth/token", refresh, client.ID, secret); body["error"] != "invalid_grant" {
+		t.Errorf("Expected the old refresh token to be rejected, got %v", body)
+	}
+
+	// Replaying the code revokes everything issued for it.
+	if _, body := post("/oauth/token", exchange, client.ID, secret); body["error"] != "invalid_grant" {
+		t.Errorf("Expected a reused code to be rejected, got %v", body)
+	}
+	if status := do("GET", "/v1/todos", refreshed["access_token"].(string), ""); status != http.StatusUnauthorized {
+		t.Errorf("Expected code reuse to revoke the grant, got %d", status)
+	}
+}
+
+func TestOAuthRevoke(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost))
+	userID, _ := authSvc.Signup(ctx, "test@example.com", "password123")
+	const redirectURI = "https://app.example.com/callback"
+	client, _, _ := authSvc.RegisterOAuthClient(ctx, userID, "Public", []string{redirectURI}, false)
+
+	verifier := strings.Repeat("a", 64)
+	sum := sha256.Sum256([]byte(verifier))
+	req := OAuthAuthorizationRequest{
+		ClientID:            client.ID,
+		RedirectURI:         redirectURI,
+		Scopes:              []string{ScopeTodosWrite, ScopeTodosRead},
+		CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+		CodeChallengeMethod: "S256",
+	}
+	code, err := authSvc.AuthorizeOAuth(ctx, userID, req)
+	if err != nil {
+		t.Fatalf("AuthorizeOAuth failed: %v", err)
+	}
+	token, err := authSvc.ExchangeOAuthToken(ctx, OAuthTokenRequest{
+		GrantType:    "authorization_code",
+		ClientID:     client.ID,
+		Code:         code,
+		RedirectURI:  redirectURI,
+		CodeVerifier: verifier,
+	})
+	if err != nil {
+		t.Fatalf("ExchangeOAuthToken failed: %v", err)
+	}
+
+	credentials, err := authSvc.Authenticate(ctx, token.AccessToken)
+	if err != nil || credentials.ClientID != client.ID || !credentials.HasScope(ScopeTodosWrite) {
+		t.Fatalf("Authenticate: got %+v, %v", credentials, err)
+	}
+	if err := authSvc.RevokeOAuthToken(ctx, client.ID, "", "unknown"); err != nil {
+		t.Errorf("Expected unknown tokens to be ignored, got %v", err)
+	}
+	if err := authSvc.RevokeOAuthToken(ctx, client.ID, "", token.RefreshToken); err != nil {
+		t.Fatalf("RevokeOAuthToken failed: %v", err)
+	}
+	if _, err := authSvc.Authenticate(ctx, token.AccessToken); err != ErrInvalidToken {
+		t.Errorf("Expected revoking the refresh token to revoke its access tokens, got %v", err)
+	}
+}
@@ -0,0 +1,516 @@
+package auth_todo
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// oidcLoginTTL bounds how long a user may take at the identity provider.
+	oidcLoginTTL = 10 * time.Minute
+	// oidcKeysRefreshInterval limits how often the provider's keys are
+	// fetched again when an ID token is signed with an unknown key.
+	oidcKeysRefreshInterval = time.Minute
+	// oidcClockSkew is allowed between our clock and the provider's.
+	oidcClockSkew = time.Minute
+	// oidcMaxResponseSize bounds the documents read from the provider.
+	oidcMaxResponseSize = 1 << 20
+)
+
+var (
+	ErrOIDCNotConfigured    = errors.New("single sign-on is not configured")
+	ErrInvalidOIDCState     = errors.New("invalid or expired single sign-on state")
+	ErrInvalidIDToken       = errors.New("invalid ID token")
+	ErrOIDCEmailNotVerified = errors.New("identity provider did not verify the email address")
+)
+
+// OIDCConfig configures login through an OpenID Connect provider. The
+// provider's endpoints and keys are discovered from Issuer. ClientSecret may
+// be empty for public clients, which rely on PKCE alone.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// Scopes are requested in addition to openid and email.
+	Scopes []string
+	// HTTPClient talks to the provider; it defaults to a client with a 10s
+	// timeout.
+	HTTPClient *http.Client
+}
+
+// OIDCAuthorization starts a login at the identity provider. The user is sent
+// to URL; State must be bound to their browser, e.g. in a cookie, and checked
+// when they return.
+type OIDCAuthorization struct {
+	URL   string
+	State string
+}
+
+type oidcLogin struct {
+	nonce     string
+	verifier  string
+	expiresAt time.Time
+}
+
+// oidcMetadata is the part of the provider's discovery document we use.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcProvider caches the discovery document and signing keys of the
+// provider. Its mutex is separate from authService.mu so that requests to
+// the provider do not block other logins.
+type oidcProvider struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	metadata      *oidcMetadata
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+func newOIDCProvider(config OIDCConfig) *oidcProvider {
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	return &oidcProvider{config: config, client: client}
+}
+
+// getJSON fetches a JSON document from the provider into v.
+func (p *oidcProvider) getJSON(ctx context.Context, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", rawURL, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseSize)).Decode(v)
+}
+
+// discover returns the provider metadata, fetching it on first use.
+func (p *oidcProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+	var metadata oidcMetadata
+	if err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if metadata.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", metadata.Issuer, p.config.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: incomplete provider metadata")
+	}
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// key returns the signing key kid, fetching the provider's keys again if it
+// is unknown, as it is after the provider rotates its keys.
+func (p *oidcProvider) key(ctx context.Context, metadata *oidcMetadata, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if p.keys != nil && time.Since(p.keysFetchedAt) < oidcKeysRefreshInterval {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc keys: %w", err)
+	}
+	p.keys = make(map[string]crypto.PublicKey)
+	p.keysFetchedAt = time.Now()
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys of unsupported types are skipped rather than failing the set.
+		if key, err := k.publicKey(); err == nil {
+			p.keys[k.Kid] = key
+		}
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+}
+
+// exchange redeems an authorization code for an ID token.
+func (p *oidcProvider) exchange(ctx context.Context, metadata *oidcMetadata, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {verifier},
+		"client_id":     {p.config.ClientID},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("oidc token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseSize)).Decode(&body); err != nil {
+		return "", fmt.Errorf("oidc token: %s: %w", resp.Status, err)
+	}
+	if body.Error != "" {
+		return "", fmt.Errorf("oidc token: %s %s", body.Error, body.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || body.IDToken == "" {
+		return "", fmt.Errorf("oidc token: %s without an ID token", resp.Status)
+	}
+	return body.IDToken, nil
+}
+
+// idTokenClaims are the claims of an ID token we check or use.
+type idTokenClaims struct {
+	Issuer          string     `json:"iss"`
+	Subject         string     `json:"sub"`
+	Audience        audience   `json:"aud"`
+	AuthorizedParty string     `json:"azp"`
+	ExpiresAt       int64      `json:"exp"`
+	IssuedAt        int64      `json:"iat"`
+	NotBefore       int64      `json:"nbf"`
+	Nonce           string     `json:"nonce"`
+	Email           string     `json:"email"`
+	EmailVerified   stringBool `json:"email_verified"`
+}
+
+// audience is the aud claim, which is a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// stringBool accepts true as well as "true", which some providers send for
+// email_verified.
+type stringBool bool
+
+func (b *stringBool) UnmarshalJSON(data []byte) error {
+	*b = stringBool(string(data) == "true" || string(data) == `"true"`)
+	return nil
+}
+
+// verify checks the signature and claims of an ID token (OpenID Connect Core
+// section 3.1.3.7) and returns its claims.
+func (p *oidcProvider) verify(ctx context.Context, metadata *oidcMetadata, rawIDToken, nonce string, now time.Time) (idTokenClaims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return idTokenClaims{}, fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return idTokenClaims{}, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return idTokenClaims{}, fmt.Errorf("%w: malformed signature", ErrInvalidIDToken)
+	}
+	key, err := p.key(ctx, metadata, header.Kid)
+	if err != nil {
+		return idTokenClaims{}, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return idTokenClaims{}, err
+	}
+
+	var claims idTokenClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return idTokenClaims{}, err
+	}
+	invalid := func(reason string) (idTokenClaims, error) {
+		return idTokenClaims{}, fmt.Errorf("%w: %s", ErrInvalidIDToken, reason)
+	}
+	switch {
+	case claims.Issuer != metadata.Issuer:
+		return invalid("wrong issuer")
+	case indexOf(claims.Audience, p.config.ClientID) < 0:
+		return invalid("wrong audience")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID:
+		return invalid("wrong authorized party")
+	case claims.Subject == "":
+		return invalid("missing subject")
+	case !now.Before(time.Unix(claims.ExpiresAt, 0).Add(oidcClockSkew)):
+		return invalid("expired")
+	case claims.IssuedAt != 0 && now.Add(oidcClockSkew).Before(time.Unix(claims.IssuedAt, 0)):
+		return invalid("issued in the future")
+	case claims.NotBefore != 0 && now.Add(oidcClockSkew).Before(time.Unix(claims.NotBefore, 0)):
+		return invalid("not yet valid")
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return invalid("wrong nonce")
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil || json.Unmarshal(data, v) != nil {
+		return fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+	return nil
+}
+
+// verifyJWTSignature checks an RS256 or ES256 signature. The algorithm must
+// match the type of the key, so a token cannot pick a weaker one.
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg == "RS256" && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if alg == "ES256" && len(signature) == 64 {
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if ecdsa.Verify(key, digest[:], r, s) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+}
+
+// jsonWebKey is an RSA or P-256 public key of a JWK set (RFC 7517).
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, errors.New("invalid key parameter")
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, errors.New("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// codeChallengeS256 derives a PKCE challenge from a verifier (RFC 7636).
+func codeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// BeginOIDCLogin starts a login at the identity provider with a new state,
+// nonce and PKCE verifier, which are kept until the user returns.
+func (s *authService) BeginOIDCLogin(ctx context.Context) (OIDCAuthorization, error) {
+	if s.oidc == nil {
+		return OIDCAuthorization{}, ErrOIDCNotConfigured
+	}
+	metadata, err := s.oidc.discover(ctx)
+	if err != nil {
+		return OIDCAuthorization{}, err
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		if secrets[i], err = newSecret(); err != nil {
+			return OIDCAuthorization{}, err
+		}
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return OIDCAuthorization{}, fmt.Errorf("oidc discovery: %w", err)
+	}
+	q := authURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", s.oidc.config.ClientID)
+	q.Set("redirect_uri", s.oidc.config.RedirectURL)
+	q.Set("scope", strings.Join(append([]string{"openid", "email"}, s.oidc.config.Scopes...), " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallengeS256(verifier))
+	q.Set("code_challenge_method", "S256")
+	authURL.RawQuery = q.Encode()
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, login := range s.oidcLogins {
+		if !now.Before(login.expiresAt) {
+			delete(s.oidcLogins, hash)
+		}
+	}
+	s.oidcLogins[hashToken(state)] = &oidcLogin{nonce: nonce, verifier: verifier, expiresAt: now.Add(oidcLoginTTL)}
+	return OIDCAuthorization{URL: authURL.String(), State: state}, nil
+}
+
+// CompleteOIDCLogin redeems the code the provider returned with state and
+// signs in the user of its ID token. Users are found by the provider's
+// subject, then linked by email address if the provider verified it, and
+// otherwise created without a password. Nobody proved they own the address
+// of an unverified account, so linking one removes its password and second
+// factor and revokes its credentials. Like Login, it returns an
+// *MFARequiredError if the account has two-factor authentication.
+func (s *authService) CompleteOIDCLogin(ctx context.Context, state, code string) (string, error) {
+	if s.oidc == nil {
+		return "", ErrOIDCNotConfigured
+	}
+
+	s.mu.Lock()
+	login, exists := s.oidcLogins[hashToken(state)]
+	delete(s.oidcLogins, hashToken(state))
+	s.mu.Unlock()
+
+	now := time.Now()
+	if !exists || !now.Before(login.expiresAt) {
+		return "", ErrInvalidOIDCState
+	}
+
+	metadata, err := s.oidc.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	rawIDToken, err := s.oidc.exchange(ctx, metadata, code, login.verifier)
+	if err != nil {
+		return "", err
+	}
+	claims, err := s.oidc.verify(ctx, metadata, rawIDToken, login.nonce, now)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identity := claims.Issuer + " " + claims.Subject
+	userID, linked := s.oidcIdentities[identity]
+	if _, exists := s.emailsByID[userID]; !linked || !exists {
+		if !claims.EmailVerified {
+			return "", ErrOIDCEmailNotVerified
+		}
+		if err := validateEmail(claims.Email); err != nil {
+			return "", err
+		}
+		u, exists := s.users[claims.Email]
+		if !exists {
+			s.counter++
+			u = user{
+				ID:        fmt.Sprintf("user_%d", s.counter),
+				Email:     claims.Email,
+				CreatedAt: now,
+			}
+			s.emailsByID[u.ID] = u.Email
+		} else if !u.Verified {
+			u.PasswordHash = nil
+			s.revokeCredentials(u.ID)
+			delete(s.mfa, u.ID)
+		}
+		u.Verified = true
+		s.users[u.Email] = u
+		s.oidcIdentities[identity] = u.ID
+		userID = u.ID
+	}
+	setAuditSubject(ctx, userID)
+
+	if s.users[s.emailsByID[userID]].Disabled {
+		return "", ErrAccountDisabled
+	}
+	if s.mfaEnabled(userID) {
+		return "", s.newMFAChallenge(userID)
+	}
+	return s.newSession(userID)
+}
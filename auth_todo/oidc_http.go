@@ -0,0 +1,129 @@
+package auth_todo
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+// oidcStateCookie binds a login to the browser that started it, so that a
+// callback URL cannot be used to sign someone else in (login CSRF).
+const oidcStateCookie = "oidc_state"
+
+type oidcLoginResponse struct {
+	Redirect string `json:"-"`
+	State    string `json:"-"`
+	Err      string `json:"error,omitempty"`
+}
+
+func makeOIDCLoginEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		authorization, err := svc.BeginOIDCLogin(ctx)
+		if err != nil {
+			return oidcLoginResponse{Err: err.Error()}, nil
+		}
+		return oidcLoginResponse{Redirect: authorization.URL, State: authorization.State}, nil
+	}
+}
+
+type oidcCallbackRequest struct {
+	Code        string `json:"code"`
+	State       string `json:"state"`
+	Error       string `json:"error,omitempty"`
+	CookieState string `json:"-"`
+}
+
+func makeOIDCCallbackEndpoint(svc AuthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(oidcCallbackRequest)
+		if req.Error != "" {
+			return loginResponse{Err: "identity provider: " + req.Error}, nil
+		}
+		if req.State == "" || subtle.ConstantTimeCompare([]byte(req.State), []byte(req.CookieState)) != 1 {
+			return loginResponse{Err: ErrInvalidOIDCState.Error()}, nil
+		}
+		token, err := svc.CompleteOIDCLogin(ctx, req.State, req.Code)
+		var mfaErr *MFARequiredError
+		if errors.As(err, &mfaErr) {
+			return loginResponse{MFARequired: true, ChallengeToken: mfaErr.ChallengeToken}, nil
+		}
+		if err != nil {
+			return loginResponse{Err: err.Error()}, nil
+		}
+		return loginResponse{Token: token}, nil
+	}
+}
+
+func decodeOIDCLoginRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return nil, nil
+}
+
+func decodeOIDCCallbackRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	req := oidcCallbackRequest{
+		Code:  q.Get("code"),
+		State: q.Get("state"),
+		Error: q.Get("error"),
+	}
+	if cookie, err := r.Cookie(oidcStateCookie); err == nil {
+		req.CookieState = cookie.Value
+	}
+	return req, nil
+}
+
+func encodeOIDCLoginResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(oidcLoginResponse)
+	if resp.Redirect == "" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return encodeResponse(ctx, w, resp)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    resp.State,
+		Path:     "/oidc",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		Secure:   true,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Location", resp.Redirect)
+	w.WriteHeader(http.StatusFound)
+	return nil
+}
+
+// encodeOIDCCallbackResponse clears the state cookie, which is only good for
+// one callback.
+func encodeOIDCCallbackResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/oidc",
+		MaxAge:   -1,
+		Secure:   true,
+		HttpOnly: true,
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	return encodeResponse(ctx, w, response)
+}
+
+func MakeOIDCLoginHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.OIDCLoginEndpoint,
+		decodeOIDCLoginRequest,
+		encodeOIDCLoginResponse,
+		serverOptions()...,
+	)
+}
+
+func MakeOIDCCallbackHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.OIDCCallbackEndpoint,
+		decodeOIDCCallbackRequest,
+		encodeOIDCCallbackResponse,
+		serverOptions()...,
+	)
+}
@@ -0,0 +1,423 @@
+package auth_todo
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// mockIdP is a minimal OpenID Connect provider. It signs in whoever is set
+// in subject and email, and tamper may change the ID tokens it issues.
+type mockIdP struct {
+	*httptest.Server
+	t *testing.T
+
+	mu            sync.Mutex
+	key           *rsa.PrivateKey
+	kid           string
+	forgeKey      *rsa.PrivateKey
+	subject       string
+	email         string
+	emailVerified bool
+	tamper        func(header, claims map[string]interface{})
+	codes         map[string]mockIdPCode
+}
+
+type mockIdPCode struct {
+	challenge, nonce, redirectURI string
+	claims                        map[string]interface{}
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	idp := &mockIdP{t: t, codes: make(map[string]mockIdPCode)}
+	idp.rotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "oct", "kid": "symmetric", "k": "c2VjcmV0"},
+			{
+				"kty": "RSA", "kid": idp.kid, "use": "sig", "alg": "RS256",
+				"n": base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			},
+		}})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		code := idp.authorize(r.URL.String())
+		redirect, _ := url.Parse(r.URL.Query().Get("redirect_uri"))
+		redirect.RawQuery = url.Values{"code": {code}, "state": {r.URL.Query().Get("state")}}.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+// set changes the provider while it may be serving requests.
+func (idp *mockIdP) set(change func()) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	change()
+}
+
+func (idp *mockIdP) rotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		idp.t.Fatalf("GenerateKey failed: %v", err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.key = key
+	idp.kid = fmt.Sprintf("key-%d", time.Now().UnixNano())
+}
+
+// authorize signs in the current user for an authorization URL and returns
+// the code.
+func (idp *mockIdP) authorize(rawURL string) string {
+	u, _ := url.Parse(rawURL)
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || !strings.Contains(q.Get("scope"), "openid") {
+		idp.t.Errorf("Unexpected authorization request %s", rawURL)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code := fmt.Sprintf("code-%d", len(idp.codes))
+	idp.codes[code] = mockIdPCode{
+		challenge:   q.Get("code_challenge"),
+		nonce:       q.Get("nonce"),
+		redirectURI: q.Get("redirect_uri"),
+		claims: map[string]interface{}{
+			"iss":            idp.URL,
+			"sub":            idp.subject,
+			"aud":            q.Get("client_id"),
+			"exp":            time.Now().Add(5 * time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          q.Get("nonce"),
+			"email":          idp.email,
+			"email_verified": idp.emailVerified,
+		},
+	}
+	return code
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	if id, secret, _ := r.BasicAuth(); id != "app" || secret != "app-secret" {
+		fail("invalid_client")
+		return
+	}
+	grant, exists := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	if !exists || r.PostFormValue("redirect_uri") != grant.redirectURI ||
+		codeChallengeS256(r.PostFormValue("code_verifier")) != grant.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	header := map[string]interface{}{"alg": "RS256", "typ": "JWT", "kid": idp.kid}
+	if idp.tamper != nil {
+		idp.tamper(header, grant.claims)
+	}
+	key := idp.key
+	if idp.forgeKey != nil {
+		key = idp.forgeKey
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "unused",
+		"token_type":   "Bearer",
+		"id_token":     signJWT(idp.t, key, header, grant.claims),
+	})
+}
+
+func signJWT(t *testing.T, key crypto.Signer, header, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := encode(header) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+	var signature []byte
+	if ecKey, ok := key.(*ecdsa.PrivateKey); ok {
+		// JWS uses the raw r || s encoding rather than ASN.1.
+		r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		if err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	} else {
+		var err error
+		if signature, err = key.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newOIDCAuthService(idp *mockIdP) AuthService {
+	return NewAuthService(WithPasswordCost(bcrypt.MinCost), WithOIDC(OIDCConfig{
+		Issuer:       idp.URL,
+		ClientID:     "app",
+		ClientSecret: "app-secret",
+		RedirectURL:  "https://app.example.com/oidc/callback",
+		Scopes:       []string{"profile"},
+	}))
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockIdP(t)
+	authSvc := newOIDCAuthService(idp)
+	linkedID, _ := authSvc.Signup(ctx, "linked@example.com", "password123")
+	squatterSession, _ := authSvc.Login(ctx, "linked@example.com", "password123")
+	squatterToken, _, _ := authSvc.CreateAccessToken(ctx, linkedID, "keep", []string{ScopeTodosRead}, time.Time{})
+	verifiedID, _ := authSvc.Signup(ctx, "verified@example.com", "password123")
+	verified := authSvc.(*authService).users["verified@example.com"]
+	verified.Verified = true
+	authSvc.(*authService).users["verified@example.com"] = verified
+	verifiedSession, _ := authSvc.Login(ctx, "verified@example.com", "password123")
+
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(authSvc, NewTodoService(), NewEventBroker(16), nil)))
+	defer server.Close()
+	httpClient := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	// login goes through the redirects of a browser and returns the
+	// response of the callback.
+	login := func(sendCookie bool) loginResponse {
+		t.Helper()
+		resp, err := httpClient.Get(server.URL + "/oidc/login")
+		if err != nil {
+			t.Fatalf("GET /oidc/login failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound || len(resp.Cookies()) != 1 {
+			t.Fatalf("Expected a redirect with a state cookie, got %d", resp.StatusCode)
+		}
+		cookie := resp.Cookies()[0]
+		if !cookie.HttpOnly || !cookie.Secure {
+			t.Errorf("Expected a secure state cookie, got %+v", cookie)
+		}
+
+		resp, err = httpClient.Get(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatalf("GET authorize failed: %v", err)
+		}
+		resp.Body.Close()
+		callback, _ := url.Parse(resp.Header.Get("Location"))
+
+		req, _ := http.NewRequest("GET", server.URL+"/oidc/callback?"+callback.RawQuery, nil)
+		if sendCookie {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+		resp, err = httpClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /oidc/callback failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body loginResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		return body
+	}
+	userOf := func(resp loginResponse) User {
+		t.Helper()
+		userID, err := authSvc.ValidateToken(ctx, resp.Token)
+		if err != nil {
+			t.Fatalf("Expected a session, got %+v", resp)
+		}
+		u, _ := authSvc.GetUser(ctx, userID)
+		return u
+	}
+
+	idp.set(func() { idp.subject, idp.email, idp.emailVerified = "sub-1", "new@example.com", true })
+	created := userOf(login(true))
+	if created.Email != "new@example.com" || !created.EmailVerified {
+		t.Errorf("Expected a verified user to be provisioned, got %+v", created)
+	}
+	if _, err := authSvc.Login(ctx, "new@example.com", "x"); err != ErrInvalidCredentials {
+		t.Errorf("Expected provisioned users to have no password, got %v", err)
+	}
+
+	// The subject identifies the user even after the email changes.
+	idp.set(func() { idp.email = "renamed@example.com" })
+	if u := userOf(login(true)); u.ID != created.ID {
+		t.Errorf("Expected the linked user %s, got %s", created.ID, u.ID)
+	}
+
+	idp.set(func() { idp.subject, idp.email = "sub-2", "linked@example.com" })
+	if u := userOf(login(true)); u.ID != linkedID || !u.EmailVerified {
+		t.Errorf("Expected the existing account to be linked, got %+v", u)
+	}
+	// Whoever signed up with the address first never proved they own it.
+	if _, err := authSvc.Login(ctx, "linked@example.com", "password123"); err != ErrInvalidCredentials {
+		t.Errorf("Expected linking an unverified account to remove its password, got %v", err)
+	}
+	for _, token := range []string{squatterSession, squatterToken} {
+		if _, err := authSvc.ValidateToken(ctx, token); err != ErrInvalidToken {
+			t.Errorf("Expected linking an unverified account to revoke its credentials, got %v", err)
+		}
+	}
+
+	idp.set(func() { idp.subject, idp.email = "sub-4", "verified@example.com" })
+	if u := userOf(login(true)); u.ID != verifiedID {
+		t.Errorf("Expected the verified account to be linked, got %+v", u)
+	}
+	if _, err := authSvc.ValidateToken(ctx, verifiedSession); err != nil {
+		t.Errorf("Expected verified accounts to keep their sessions, got %v", err)
+	}
+	if _, err := authSvc.Login(ctx, "verified@example.com", "password123"); err != nil {
+		t.Errorf("Expected verified accounts to keep their password, got %v", err)
+	}
+
+	idp.set(func() { idp.subject, idp.email, idp.emailVerified = "sub-3", "unverified@example.com", false })
+	if resp := login(true); resp.Err != ErrOIDCEmailNotVerified.Error() {
+		t.Errorf("Expected unverified emails to be rejected, got %+v", resp)
+	}
+
+	idp.set(func() { idp.emailVerified = true })
+	if resp := login(false); resp.Err != ErrInvalidOIDCState.Error() {
+		t.Errorf("Expected a callback without the state cookie to be rejected, got %+v", resp)
+	}
+	if len(authSvc.(*authService).oidcLogins) != 1 {
+		t.Errorf("Expected the rejected login to stay pending, got %d", len(authSvc.(*authService).oidcLogins))
+	}
+
+	resp, err := httpClient.Get(server.URL + "/oidc/callback?error=access_denied")
+	if err != nil {
+		t.Fatalf("GET /oidc/callback failed: %v", err)
+	}
+	var denied loginResponse
+	json.NewDecoder(resp.Body).Decode(&denied)
+	resp.Body.Close()
+	if denied.Err != "identity provider: access_denied" {
+		t.Errorf("Expected the provider's error, got %+v", denied)
+	}
+	if _, err := NewAuthService().BeginOIDCLogin(ctx); err != ErrOIDCNotConfigured {
+		t.Errorf("Expected ErrOIDCNotConfigured, got %v", err)
+	}
+}
+
+func TestOIDCIDTokenValidation(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockIdP(t)
+	idp.subject, idp.email, idp.emailVerified = "sub-1", "test@example.com", true
+	authSvc := newOIDCAuthService(idp)
+
+	login := func() error {
+		t.Helper()
+		authorization, err := authSvc.BeginOIDCLogin(ctx)
+		if err != nil {
+			t.Fatalf("BeginOIDCLogin failed: %v", err)
+		}
+		code := idp.authorize(authorization.URL)
+		_, err = authSvc.CompleteOIDCLogin(ctx, authorization.State, code)
+		return err
+	}
+	if err := login(); err != nil {
+		t.Fatalf("Expected a valid ID token, got %v", err)
+	}
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	for name, tamper := range map[string]func(header, claims map[string]interface{}){
+		"wrong issuer":   func(_, c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"wrong audience": func(_, c map[string]interface{}) { c["aud"] = "other" },
+		"azp":            func(_, c map[string]interface{}) { c["aud"] = []string{"app", "other"} },
+		"expired":        func(_, c map[string]interface{}) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() },
+		"future":         func(_, c map[string]interface{}) { c["iat"] = time.Now().Add(time.Hour).Unix() },
+		"nonce":          func(_, c map[string]interface{}) { c["nonce"] = "replayed" },
+		"no subject":     func(_, c map[string]interface{}) { delete(c, "sub") },
+		"alg none":       func(h, _ map[string]interface{}) { h["alg"] = "none" },
+		"HS256":          func(h, _ map[string]interface{}) { h["alg"], h["kid"] = "HS256", "symmetric" },
+	} {
+		idp.set(func() { idp.tamper = tamper })
+		if err := login(); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: expected ErrInvalidIDToken, got %v", name, err)
+		}
+	}
+	idp.set(func() {
+		idp.tamper = func(_, c map[string]interface{}) { c["aud"] = []string{"app", "other"}; c["azp"] = "app" }
+	})
+	if err := login(); err != nil {
+		t.Errorf("Expected an audience list with azp to be accepted, got %v", err)
+	}
+	idp.set(func() { idp.tamper, idp.forgeKey = nil, otherKey })
+	if err := login(); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Expected a forged signature to be rejected, got %v", err)
+	}
+	idp.set(func() { idp.forgeKey = nil })
+
+	// Keys are fetched again for an unknown key ID, but not more than once
+	// per oidcKeysRefreshInterval.
+	idp.rotateKey()
+	if err := login(); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Expected keys not to be fetched again yet, got %v", err)
+	}
+	authSvc.(*authService).oidc.keysFetchedAt = time.Now().Add(-oidcKeysRefreshInterval)
+	if err := login(); err != nil {
+		t.Errorf("Expected rotated keys to be fetched, got %v", err)
+	}
+
+	authorization, _ := authSvc.BeginOIDCLogin(ctx)
+	code := idp.authorize(authorization.URL)
+	if _, err := authSvc.CompleteOIDCLogin(ctx, authorization.State, code); err != nil {
+		t.Fatalf("CompleteOIDCLogin failed: %v", err)
+	}
+	if _, err := authSvc.CompleteOIDCLogin(ctx, authorization.State, code); err != ErrInvalidOIDCState {
+		t.Errorf("Expected the state to be single-use, got %v", err)
+	}
+
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwk := jsonWebKey{
+		Kty: "EC", Crv: "P-256",
+		X: base64.RawURLEncoding.EncodeToString(ecKey.X.Bytes()),
+		Y: base64.RawURLEncoding.EncodeToString(ecKey.Y.Bytes()),
+	}
+	publicKey, err := jwk.publicKey()
+	if err != nil {
+		t.Fatalf("publicKey failed: %v", err)
+	}
+	parts := strings.Split(signJWT(t, ecKey, map[string]interface{}{"alg": "ES256"}, map[string]interface{}{}), ".")
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if err := verifyJWTSignature("ES256", publicKey, parts[0]+"."+parts[1], signature); err != nil {
+		t.Errorf("Expected ES256 signatures to verify, got %v", err)
+	}
+	if err := verifyJWTSignature("RS256", publicKey, parts[0]+"."+parts[1], signature); err == nil {
+		t.Error("Expected the algorithm to have to match the key")
+	}
+}
@@ -0,0 +1,1310 @@
+package auth_todo
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//go:embed docs.html
+var docsHTML []byte
+
+type apiParam struct {
+	Name        string
+	In          string
+	Type        string
+	Required    bool
+	Description string
+}
+
+type apiOperation struct {
+	Method      string
+	Path        string
+	OperationID string
+	Summary     string
+	Tag         string
+	Params      []apiParam
+	Request     interface{}
+	Response    interface{}
+	ContentType string
+	// RequestContentType defaults to application/json.
+	RequestContentType string
+	Unversioned        bool
+}
+
+// todoTokenParam documents the token every todo and list endpoint requires;
+// they only act for the authenticated user.
+var todoTokenParam = apiParam{Name: "Authorization", In: "header", Type: "string", Required: true, Description: "Bearer session token or personal access token with the todos:read or todos:write scope"}
+
+// adminTokenParam documents the session token of the admin endpoints, whose
+// user must have permission.
+func adminTokenParam(permission string) apiParam {
+	return apiParam{Name: "Authorization", In: "header", Type: "string", Required: true, Description: "Bearer session token of a user with the " + permission + " permission"}
+}
+
+// apiOperations describes every route registered by MakeHTTPHandler. Paths
+// are relative to the /v1 prefix unless the operation is Unversioned; the
+// legacy root aliases are documented as deprecated. Request and Response hold
+// zero values of the structs exchanged with the endpoints; their schemas are
+// derived from the json tags by reflection.
+var apiOperations = []apiOperation{
+	{
+		Method:      "POST",
+		Path:        "/signup",
+		OperationID: "signup",
+		Summary:     "Create a user account",
+		Tag:         "auth",
+		Request:     signupRequest{},
+		Response:    signupResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/login",
+		OperationID: "login",
+		Summary:     "Exchange credentials for a session token",
+		Tag:         "auth",
+		Request:     loginRequest{},
+		Response:    loginResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/login/mfa",
+		OperationID: "loginMFA",
+		Summary:     "Complete a login with a TOTP or recovery code",
+		Tag:         "auth",
+		Request:     loginMFARequest{},
+		Response:    loginResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/mfa/enroll",
+		OperationID: "enrollMFA",
+		Summary:     "Start two-factor enrollment and get the TOTP secret and otpauth URI for a QR code",
+		Tag:         "auth",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Required: true, Description: "Bearer session token"},
+		},
+		Response: enrollMFAResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/mfa/confirm",
+		OperationID: "confirmMFA",
+		Summary:     "Enable two-factor authentication with a code and get the recovery codes",
+		Tag:         "auth",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Required: true, Description: "Bearer session token"},
+		},
+		Request:  confirmMFARequest{},
+		Response: confirmMFAResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/mfa/disable",
+		OperationID: "disableMFA",
+		Summary:     "Disable two-factor authentication after re-entering the password",
+		Tag:         "auth",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Required: true, Description: "Bearer session token"},
+		},
+		Request:  disableMFARequest{},
+		Response: disableMFAResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/tokens",
+		OperationID: "createAccessToken",
+		Summary:     "Create a personal access token; the token is only returned once",
+		Tag:         "auth",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Required: true, Description: "Bearer session token"},
+		},
+		Request:  createAccessTokenRequest{},
+		Response: createAccessTokenResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/tokens",
+		OperationID: "listAccessTokens",
+		Summary:     "List personal access tokens",
+		Tag:         "auth",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Required: true, Description: "Bearer session token"},
+		},
+		Response: listAccessTokensResponse{},
+	},
+	{
+		Method:      "DELETE",
+		Path:        "/tokens/{id}",
+		OperationID: "revokeAccessToken",
+		Summary:     "Revoke a personal access token",
+		Tag:         "auth",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Required: true, Description: "Bearer session token"},
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: revokeAccessTokenResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/oauth/clients",
+		OperationID: "createOAuthClient",
+		Summary:     "Register an OAuth client; the secret of a confidential client is only returned once",
+		Tag:         "oauth",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Required: true, Description: "Bearer session token"},
+		},
+		Request:  createOAuthClientRequest{},
+		Response: createOAuthClientResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/validate",
+		OperationID: "validateToken",
+		Summary:     "Resolve a session token to its user",
+		Tag:         "auth",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Description: "Token to validate; takes precedence over the body"},
+		},
+		Request:  validateTokenRequest{},
+		Response: validateTokenResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/validate",
+		OperationID: "validateTokenHeader",
+		Summary:     "Resolve the token in the Authorization header to its user",
+		Tag:         "auth",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Required: true, Description: "Token to validate"},
+		},
+		Response: validateTokenResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/password/forgot",
+		OperationID: "forgotPassword",
+		Summary:     "Mail a password reset token; succeeds whether or not the account exists",
+		Tag:         "auth",
+		Request:     forgotPasswordRequest{},
+		Response:    forgotPasswordResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/password/reset",
+		OperationID: "resetPassword",
+		Summary:     "Set a new password with a reset token and sign out every session",
+		Tag:         "auth",
+		Request:     resetPasswordRequest{},
+		Response:    resetPasswordResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/verify-email",
+		OperationID: "verifyEmail",
+		Summary:     "Verify an email address with the token mailed at signup",
+		Tag:         "auth",
+		Request:     verifyEmailRequest{},
+		Response:    verifyEmailResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/verify-email/resend",
+		OperationID: "resendVerification",
+		Summary:     "Mail a new verification token; succeeds whether or not the account exists",
+		Tag:         "auth",
+		Request:     resendVerificationRequest{},
+		Response:    resendVerificationResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/todos",
+		OperationID: "createTodo",
+		Summary:     "Create a todo",
+		Tag:         "todos",
+		Params:      []apiParam{todoTokenParam},
+		Request:     createTodoRequest{},
+		Response:    createTodoResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/todos",
+		OperationID: "listTodos",
+		Summary:     "List todos, newest first or in manual order",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "user_id", In: "query", Type: "string", Description: "Deprecated; must name the authenticated user"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Page size, 1-100 (default 50)"},
+			{Name: "offset", In: "query", Type: "integer", Description: "Number of todos to skip"},
+			{Name: "completed", In: "query", Type: "boolean", Description: "Only completed or only open todos"},
+			{Name: "list_id", In: "query", Type: "string", Description: "Only todos in this list; may be repeated"},
+			{Name: "tag", In: "query", Type: "string", Description: "Only todos with this tag"},
+			{Name: "q", In: "query", Type: "string", Description: "Case-insensitive text search"},
+			{Name: "shared", In: "query", Type: "boolean", Description: "Only todos in lists other users shared"},
+			{Name: "assigned_to_me", In: "query", Type: "boolean", Description: "Only todos assigned to the caller"},
+			{Name: "sort", In: "query", Type: "string", Description: "manual to order by rank instead of newest first"},
+		},
+		Response: listTodosResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/todos/{id}/complete",
+		OperationID: "completeTodo",
+		Summary:     "Mark a todo as completed",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request: struct {
+			UserID string `json:"user_id"`
+		}{},
+		Response: completeTodoResponse{},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/todos/{id}/assignee",
+		OperationID: "assignTodo",
+		Summary:     "Assign a todo to a user who can edit it",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  assignTodoRequest{},
+		Response: updateTodoResponse{},
+	},
+	{
+		Method:      "DELETE",
+		Path:        "/todos/{id}/assignee",
+		OperationID: "unassignTodo",
+		Summary:     "Unassign a todo",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: updateTodoResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/todos/{id}/comments",
+		OperationID: "addComment",
+		Summary:     "Comment on a todo, mentioning users as @user_id",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  commentRequest{},
+		Response: commentResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/todos/{id}/comments",
+		OperationID: "listComments",
+		Summary:     "List the comments on a todo, oldest first",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "limit", In: "query", Type: "integer", Description: "Page size, 1-100 (default 50)"},
+			{Name: "offset", In: "query", Type: "integer", Description: "Number of comments to skip"},
+		},
+		Response: listCommentsResponse{},
+	},
+	{
+		Method:      "PATCH",
+		Path:        "/todos/{id}/comments/{comment_id}",
+		OperationID: "editComment",
+		Summary:     "Edit one of your comments",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "comment_id", In: "path", Type: "string", Required: true},
+		},
+		Request:  commentRequest{},
+		Response: commentResponse{},
+	},
+	{
+		Method:      "DELETE",
+		Path:        "/todos/{id}/comments/{comment_id}",
+		OperationID: "deleteComment",
+		Summary:     "Delete a comment as its author or an owner of the todo",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "comment_id", In: "path", Type: "string", Required: true},
+		},
+		Response: deleteCommentResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/todos/{id}/activity",
+		OperationID: "todoActivity",
+		Summary:     "List the comments and changes of a todo, oldest first",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "limit", In: "query", Type: "integer", Description: "Page size, 1-100 (default 50)"},
+			{Name: "offset", In: "query", Type: "integer", Description: "Number of entries to skip"},
+		},
+		Response: todoActivityResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/todos/{id}/history",
+		OperationID: "todoHistory",
+		Summary:     "List the changes of a todo with their actor and the fields before and after, oldest first",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "limit", In: "query", Type: "integer", Description: "Page size, 1-100 (default 50)"},
+			{Name: "offset", In: "query", Type: "integer", Description: "Number of entries to skip"},
+		},
+		Response: todoHistoryResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/todos/{id}/revert",
+		OperationID: "revertTodo",
+		Summary:     "Restore a todo to a version of its history",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  revertTodoRequest{},
+		Response: updateTodoResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/todos/{id}/move",
+		OperationID: "moveTodo",
+		Summary:     "Move a todo directly before or after another todo in the manual order",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  moveTodoRequest{},
+		Response: updateTodoResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/todos/{id}/transition",
+		OperationID: "transitionTodo",
+		Summary:     "Move a todo to another status its list's workflow allows",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  transitionTodoRequest{},
+		Response: updateTodoResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/todos/{id}/blockers",
+		OperationID: "addBlocker",
+		Summary:     "Block a todo by another todo; rejected if it would create a cycle",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  blockerRequest{},
+		Response: updateTodoResponse{},
+	},
+	{
+		Method:      "DELETE",
+		Path:        "/todos/{id}/blockers/{blocker_id}",
+		OperationID: "removeBlocker",
+		Summary:     "Remove a blocker of a todo",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "blocker_id", In: "path", Type: "string", Required: true},
+		},
+		Response: updateTodoResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/todos/next",
+		OperationID: "listNextTodos",
+		Summary:     "List open todos in an order they can be done in, each after its blockers",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "limit", In: "query", Type: "integer", Description: "Page size, 1-100 (default 50)"},
+			{Name: "offset", In: "query", Type: "integer", Description: "Number of todos to skip"},
+		},
+		Response: listTodosResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/todos/{id}/attachments",
+		OperationID: "addAttachment",
+		Summary:     "Attach a file of up to 10 MB to a todo",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request: struct {
+			File string `json:"file"`
+		}{},
+		RequestContentType: "multipart/form-data",
+		Response:           attachmentResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/todos/{id}/attachments",
+		OperationID: "listAttachments",
+		Summary:     "List the attachments of a todo, oldest first",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: listAttachmentsResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/todos/{id}/attachments/{attachment_id}",
+		OperationID: "downloadAttachment",
+		Summary:     "Download an attachment; failures are reported as JSON",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "attachment_id", In: "path", Type: "string", Required: true},
+		},
+		ContentType: "application/octet-stream",
+	},
+	{
+		Method:      "DELETE",
+		Path:        "/todos/{id}/attachments/{attachment_id}",
+		OperationID: "deleteAttachment",
+		Summary:     "Delete an attachment as its uploader or an editor of the todo",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "attachment_id", In: "path", Type: "string", Required: true},
+		},
+		Response: deleteAttachmentResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/attachments/usage",
+		OperationID: "attachmentUsage",
+		Summary:     "Show the bytes your attachments use and your quota",
+		Tag:         "todos",
+		Params:      []apiParam{todoTokenParam},
+		Response:    attachmentUsageResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/todos/{id}/timer",
+		OperationID: "startTimer",
+		Summary:     "Start a timer on a todo; each user may run one timer at a time",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  startTimerRequest{},
+		Response: timeEntryResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/timer/stop",
+		OperationID: "stopTimer",
+		Summary:     "Stop your running timer",
+		Tag:         "todos",
+		Params:      []apiParam{todoTokenParam},
+		Response:    timeEntryResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/todos/{id}/time-entries",
+		OperationID: "addTimeEntry",
+		Summary:     "Record time spent on a todo by hand",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  addTimeEntryRequest{},
+		Response: timeEntryResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/todos/{id}/time-entries",
+		OperationID: "listTimeEntries",
+		Summary:     "List the time entries of a todo",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "limit", In: "query", Type: "integer", Description: "Page size, 1-100 (default 50)"},
+			{Name: "offset", In: "query", Type: "integer", Description: "Number of entries to skip"},
+		},
+		Response: listTimeEntriesResponse{},
+	},
+	{
+		Method:      "DELETE",
+		Path:        "/todos/{id}/time-entries/{entry_id}",
+		OperationID: "deleteTimeEntry",
+		Summary:     "Delete a time entry; your own, or any as a list owner",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "entry_id", In: "path", Type: "string", Required: true},
+		},
+		Response: deleteTimeEntryResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/time/report",
+		OperationID: "timeReport",
+		Summary:     "Total the time tracked on your todos per todo, list, tag and day",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "todo_id", In: "query", Type: "string", Description: "Only time on this todo"},
+			{Name: "list_id", In: "query", Type: "string", Description: "Only time on todos in this list"},
+			{Name: "tag", In: "query", Type: "string", Description: "Only time on todos with this tag"},
+			{Name: "user_id", In: "query", Type: "string", Description: "Only time tracked by this user"},
+			{Name: "since", In: "query", Type: "string", Description: "Start of the range, RFC 3339"},
+			{Name: "until", In: "query", Type: "string", Description: "End of the range, RFC 3339 (default now)"},
+		},
+		Response: timeReportResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/time/timesheet",
+		OperationID: "exportTimesheet",
+		Summary:     "Export the time tracked on your todos as a CSV timesheet; failures are reported as JSON",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "todo_id", In: "query", Type: "string", Description: "Only time on this todo"},
+			{Name: "list_id", In: "query", Type: "string", Description: "Only time on todos in this list"},
+			{Name: "tag", In: "query", Type: "string", Description: "Only time on todos with this tag"},
+			{Name: "user_id", In: "query", Type: "string", Description: "Only time tracked by this user"},
+			{Name: "since", In: "query", Type: "string", Description: "Start of the range, RFC 3339"},
+			{Name: "until", In: "query", Type: "string", Description: "End of the range, RFC 3339 (default now)"},
+		},
+		ContentType: "text/csv",
+	},
+	{
+		Method:      "PATCH",
+		Path:        "/todos/{id}",
+		OperationID: "updateTodo",
+		Summary:     "Change a todo's text, list or tags",
+		Tag:         "todos",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  updateTodoRequest{},
+		Response: updateTodoResponse{},
+	},
+	{
+		Method:      "DELETE",
+		Path:        "/todos/{id}",
+		OperationID: "deleteTodo",
+		Summary:     "Delete a todo",
+		Tag:         "todos",
+		Params: []apiParam{
+			{Name: "id", In: "path", Type: "string", Required: true},
+			todoTokenParam,
+			{Name: "user_id", In: "query", Type: "string", Description: "Deprecated; must name the authenticated user"},
+		},
+		Response: deleteTodoResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/todos/events",
+		OperationID: "streamTodoEvents",
+		Summary:     "Server-Sent Events stream of the authenticated user's todo changes",
+		Tag:         "todos",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Description: "Bearer session token"},
+			{Name: "access_token", In: "query", Type: "string", Description: "Session token, for clients that cannot set headers"},
+			{Name: "Last-Event-ID", In: "header", Type: "integer", Description: "Resume after this event"},
+			{Name: "last_event_id", In: "query", Type: "integer", Description: "Resume after this event"},
+		},
+		Response:    TodoEvent{},
+		ContentType: "text/event-stream",
+	},
+	{
+		Method:      "GET",
+		Path:        "/sync",
+		OperationID: "sync",
+		Summary:     "Upgrade to the WebSocket sync channel for list subscriptions and mutations",
+		Tag:         "todos",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Description: "Bearer session token"},
+			{Name: "access_token", In: "query", Type: "string", Description: "Session token, for clients that cannot set headers"},
+		},
+		Request:     syncMessage{},
+		Response:    syncReply{},
+		ContentType: "application/websocket+json",
+	},
+	{
+		Method:      "POST",
+		Path:        "/lists",
+		OperationID: "createList",
+		Summary:     "Create a todo list",
+		Tag:         "lists",
+		Params:      []apiParam{todoTokenParam},
+		Request:     createListRequest{},
+		Response:    createListResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/lists",
+		OperationID: "listLists",
+		Summary:     "List own and shared todo lists, oldest first",
+		Tag:         "lists",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "user_id", In: "query", Type: "string", Description: "Deprecated; must name the authenticated user"},
+			{Name: "shared", In: "query", Type: "boolean", Description: "Only lists other users shared"},
+		},
+		Response: listListsResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/lists/{id}/members",
+		OperationID: "shareList",
+		Summary:     "Invite a user by email to a list as viewer, editor or owner",
+		Tag:         "lists",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  shareListRequest{},
+		Response: shareListResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/lists/{id}/members",
+		OperationID: "listMembers",
+		Summary:     "List the members of a list",
+		Tag:         "lists",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: listMembersResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/lists/{id}/workflow",
+		OperationID: "getWorkflow",
+		Summary:     "Get the workflow statuses and transitions of a list",
+		Tag:         "lists",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: workflowResponse{},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/lists/{id}/workflow",
+		OperationID: "setWorkflow",
+		Summary:     "Replace the workflow of a list; owners only",
+		Tag:         "lists",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  setWorkflowRequest{},
+		Response: workflowResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/lists/{id}/board",
+		OperationID: "listBoard",
+		Summary:     "List the todos of a list grouped by status, with WIP limits",
+		Tag:         "lists",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: listBoardResponse{},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/lists/{id}/members/{user_id}",
+		OperationID: "setMemberRole",
+		Summary:     "Change the role of a list member",
+		Tag:         "lists",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "user_id", In: "path", Type: "string", Required: true},
+		},
+		Request:  setMemberRoleRequest{},
+		Response: memberResponse{},
+	},
+	{
+		Method:      "DELETE",
+		Path:        "/lists/{id}/members/{user_id}",
+		OperationID: "removeMember",
+		Summary:     "Remove a member from a list, or leave it",
+		Tag:         "lists",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "user_id", In: "path", Type: "string", Required: true},
+		},
+		Response: memberResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/invitations",
+		OperationID: "listInvitations",
+		Summary:     "List pending invitations to the caller's verified email address",
+		Tag:         "lists",
+		Params:      []apiParam{todoTokenParam},
+		Response:    listInvitationsResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/invitations/{id}/accept",
+		OperationID: "acceptInvitation",
+		Summary:     "Accept an invitation and join the list",
+		Tag:         "lists",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: respondToInvitationResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/invitations/{id}/decline",
+		OperationID: "declineInvitation",
+		Summary:     "Decline an invitation",
+		Tag:         "lists",
+		Params: []apiParam{
+			todoTokenParam,
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: respondToInvitationResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/admin/users",
+		OperationID: "adminListUsers",
+		Summary:     "List users, oldest first",
+		Tag:         "admin",
+		Params: []apiParam{
+			adminTokenParam("users:view"),
+			{Name: "q", In: "query", Type: "string", Description: "Case-insensitive email search"},
+			{Name: "role", In: "query", Type: "string", Description: "Only users with this role"},
+			{Name: "disabled", In: "query", Type: "boolean", Description: "Only disabled or only enabled users"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Page size, 1-100 (default 50)"},
+			{Name: "offset", In: "query", Type: "integer", Description: "Number of results to skip"},
+		},
+		Response: listUsersResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/admin/users/{id}",
+		OperationID: "adminGetUser",
+		Summary:     "Get a user",
+		Tag:         "admin",
+		Params: []apiParam{
+			adminTokenParam("users:view"),
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: adminUserResponse{},
+	},
+	{
+		Method:      "PUT",
+		Path:        "/admin/users/{id}/role",
+		OperationID: "adminSetRole",
+		Summary:     "Change the role of a user: user, support or admin",
+		Tag:         "admin",
+		Params: []apiParam{
+			adminTokenParam("roles:manage"),
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Request:  setRoleRequest{},
+		Response: adminUserResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/admin/users/{id}/disable",
+		OperationID: "adminDisableUser",
+		Summary:     "Disable an account and revoke its sessions and tokens",
+		Tag:         "admin",
+		Params: []apiParam{
+			adminTokenParam("users:manage"),
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: adminUserResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/admin/users/{id}/enable",
+		OperationID: "adminEnableUser",
+		Summary:     "Enable a disabled account",
+		Tag:         "admin",
+		Params: []apiParam{
+			adminTokenParam("users:manage"),
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: adminUserResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/admin/users/{id}/mfa/reset",
+		OperationID: "adminResetMFA",
+		Summary:     "Turn off two-factor authentication for a user",
+		Tag:         "admin",
+		Params: []apiParam{
+			adminTokenParam("users:manage"),
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: adminUserResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/admin/users/{id}/unlock",
+		OperationID: "adminUnlockUser",
+		Summary:     "Clear the failed logins and lockout of an account",
+		Tag:         "admin",
+		Params: []apiParam{
+			adminTokenParam("users:manage"),
+			{Name: "id", In: "path", Type: "string", Required: true},
+		},
+		Response: adminUserResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/admin/users/{id}/todos",
+		OperationID: "adminListTodos",
+		Summary:     "List the todos of any user; recorded in the audit trail",
+		Tag:         "admin",
+		Params: []apiParam{
+			adminTokenParam("todos:view_any"),
+			{Name: "id", In: "path", Type: "string", Required: true},
+			{Name: "limit", In: "query", Type: "integer", Description: "Page size, 1-100 (default 50)"},
+			{Name: "offset", In: "query", Type: "integer", Description: "Number of results to skip"},
+			{Name: "completed", In: "query", Type: "boolean", Description: "Only completed or only open todos"},
+			{Name: "list_id", In: "query", Type: "string", Description: "Only todos in this list; may be repeated"},
+			{Name: "tag", In: "query", Type: "string", Description: "Only todos with this tag"},
+			{Name: "q", In: "query", Type: "string", Description: "Case-insensitive text search"},
+			{Name: "shared", In: "query", Type: "boolean", Description: "Only todos in lists other users shared"},
+			{Name: "assigned_to_me", In: "query", Type: "boolean", Description: "Only todos assigned to the caller"},
+			{Name: "sort", In: "query", Type: "string", Description: "manual to order by rank instead of newest first"},
+		},
+		Response: listTodosResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/admin/audit",
+		OperationID: "adminAudit",
+		Summary:     "List administrative actions, newest first",
+		Tag:         "admin",
+		Params: []apiParam{
+			adminTokenParam("audit:view"),
+			{Name: "target_id", In: "query", Type: "string", Description: "Only actions on this user"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Page size, 1-100 (default 50)"},
+			{Name: "offset", In: "query", Type: "integer", Description: "Number of results to skip"},
+		},
+		Response: listAdminActionsResponse{},
+	},
+	{
+		Method:      "GET",
+		Path:        "/admin/security-events",
+		OperationID: "adminSecurityEvents",
+		Summary:     "Query the hash-chained security audit log, newest first",
+		Tag:         "admin",
+		Params: []apiParam{
+			adminTokenParam("audit:view"),
+			{Name: "user_id", In: "query", Type: "string", Description: "Only events about this user"},
+			{Name: "type", In: "query", Type: "string", Description: "Only events of this type, e.g. login_failed"},
+			{Name: "since", In: "query", Type: "string", Description: "Only events at or after this RFC 3339 time"},
+			{Name: "until", In: "query", Type: "string", Description: "Only events before this RFC 3339 time"},
+			{Name: "limit", In: "query", Type: "integer", Description: "Page size, 1-100 (default 50)"},
+			{Name: "offset", In: "query", Type: "integer", Description: "Number of results to skip"},
+		},
+		Response: listSecurityEventsResponse{},
+	},
+	{
+		Method:      "POST",
+		Path:        "/graphql",
+		OperationID: "graphql",
+		Summary:     "Execute a GraphQL operation for the authenticated user",
+		Tag:         "graphql",
+		Params: []apiParam{
+			{Name: "Authorization", In: "header", Type: "string", Required: true, Description: "Bearer session token"},
+		},
+		Request:     graphqlRequest{},
+		Response:    graphqlResponse{},
+		Unversioned: true,
+	},
+	{
+		Method:      "GET",
+		Path:        "/oauth/authorize",
+		OperationID: "oauthAuthorize",
+		Summary:     "OAuth 2.0 consent screen for an authorization code request with PKCE (S256)",
+		Tag:         "oauth",
+		Params: []apiParam{
+			{Name: "response_type", In: "query", Type: "string", Required: true, Description: "Must be code"},
+			{Name: "client_id", In: "query", Type: "string", Required: true},
+			{Name: "redirect_uri", In: "query", Type: "string", Required: true, Description: "One of the client's registered redirect URIs"},
+			{Name: "scope", In: "query", Type: "string", Required: true, Description: "Space-separated todos:read and todos:write"},
+			{Name: "state", In: "query", Type: "string"},
+			{Name: "code_challenge", In: "query", Type: "string", Required: true},
+			{Name: "code_challenge_method", In: "query", Type: "string", Required: true, Description: "Must be S256"},
+		},
+		ContentType: "text/html",
+		Unversioned: true,
+	},
+	{
+		Method:             "POST",
+		Path:               "/oauth/authorize",
+		OperationID:        "oauthConsent",
+		Summary:            "Submit the consent form; redirects to the client with a code or an error",
+		Tag:                "oauth",
+		Request:            oauthConsentRequest{},
+		RequestContentType: "application/x-www-form-urlencoded",
+		ContentType:        "text/html",
+		Unversioned:        true,
+	},
+	{
+		Method:             "POST",
+		Path:               "/oauth/token",
+		OperationID:        "oauthToken",
+		Summary:            "Exchange an authorization code or refresh token for tokens (RFC 6749)",
+		Tag:                "oauth",
+		Request:            oauthTokenRequest{},
+		RequestContentType: "application/x-www-form-urlencoded",
+		Response:           oauthTokenResponse{},
+		Unversioned:        true,
+	},
+	{
+		Method:             "POST",
+		Path:               "/oauth/introspect",
+		OperationID:        "oauthIntrospect",
+		Summary:            "Describe a token issued to the calling client (RFC 7662)",
+		Tag:                "oauth",
+		Request:            oauthTokenActionRequest{},
+		RequestContentType: "application/x-www-form-urlencoded",
+		Response:           oauthIntrospectResponse{},
+		Unversioned:        true,
+	},
+	{
+		Method:             "POST",
+		Path:               "/oauth/revoke",
+		OperationID:        "oauthRevoke",
+		Summary:            "Revoke a token issued to the calling client (RFC 7009)",
+		Tag:                "oauth",
+		Request:            oauthTokenActionRequest{},
+		RequestContentType: "application/x-www-form-urlencoded",
+		Response:           oauthRevokeResponse{},
+		Unversioned:        true,
+	},
+	{
+		Method:      "GET",
+		Path:        "/oidc/login",
+		OperationID: "oidcLogin",
+		Summary:     "Redirect to the OpenID Connect identity provider to sign in",
+		Tag:         "auth",
+		ContentType: "text/html",
+		Unversioned: true,
+	},
+	{
+		Method:      "GET",
+		Path:        "/oidc/callback",
+		OperationID: "oidcCallback",
+		Summary:     "Return from the identity provider; signs in, linking or creating the account by verified email",
+		Tag:         "auth",
+		Params: []apiParam{
+			{Name: "code", In: "query", Type: "string"},
+			{Name: "state", In: "query", Type: "string", Required: true},
+			{Name: "error", In: "query", Type: "string", Description: "Set by the provider if the login failed"},
+		},
+		Response:    loginResponse{},
+		Unversioned: true,
+	},
+	{
+		Method:      "GET",
+		Path:        "/openapi.json",
+		OperationID: "getOpenAPISpec",
+		Summary:     "This document",
+		Tag:         "meta",
+		Unversioned: true,
+		ContentType: "application/json",
+	},
+	{
+		Method:      "GET",
+		Path:        "/docs",
+		OperationID: "getDocs",
+		Summary:     "Interactive API viewer",
+		Tag:         "meta",
+		Unversioned: true,
+		ContentType: "text/html",
+	},
+	{
+		Method:      "GET",
+		Path:        "/metrics",
+		OperationID: "getMetrics",
+		Summary:     "Prometheus metrics",
+		Tag:         "meta",
+		Unversioned: true,
+		ContentType: "text/plain",
+	},
+}
+
+// OpenAPISpec builds the OpenAPI 3.1 document for the HTTP API.
+func OpenAPISpec() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]interface{})
+
+	addOperation := func(path string, operation map[string]interface{}, method string) {
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(method)] = operation
+	}
+
+	for _, op := range apiOperations {
+		if op.Unversioned {
+			addOperation(op.Path, buildOperation(op, schemas), op.Method)
+			continue
+		}
+
+		addOperation(legacyVersion+op.Path, buildOperation(op, schemas), op.Method)
+
+		legacy := buildOperation(op, schemas)
+		legacy["operationId"] = op.OperationID + "Legacy"
+		legacy["deprecated"] = true
+		legacy["description"] = fmt.Sprintf("Deprecated alias of %s%s, removed after %s.",
+			legacyVersion, op.Path, legacySunset.Format("2006-01-02"))
+		addOperation(op.Path, legacy, op.Method)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":   "Auth + Todo Microservice",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+		},
+	}
+}
+
+func buildOperation(op apiOperation, schemas map[string]interface{}) map[string]interface{} {
+	operation := map[string]interface{}{
+		"operationId": op.OperationID,
+		"summary":     op.Summary,
+		"tags":        []string{op.Tag},
+	}
+
+	if len(op.Params) > 0 {
+		params := make([]interface{}, 0, len(op.Params))
+		for _, p := range op.Params {
+			param := map[string]interface{}{
+				"name":     p.Name,
+				"in":       p.In,
+				"required": p.Required,
+				"schema":   map[string]interface{}{"type": p.Type},
+			}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			params = append(params, param)
+		}
+		operation["parameters"] = params
+	}
+
+	if op.Request != nil {
+		requestType := "application/json"
+		if op.RequestContentType != "" {
+			requestType = op.RequestContentType
+		}
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				requestType: map[string]interface{}{
+					"schema": schemaFor(reflect.TypeOf(op.Request), schemas),
+				},
+			},
+		}
+	}
+
+	response := map[string]interface{}{"description": "OK"}
+	if op.Response != nil {
+		mediaType := "application/json"
+		if op.ContentType != "" {
+			mediaType = op.ContentType
+		}
+		response["content"] = map[string]interface{}{
+			mediaType: map[string]interface{}{
+				"schema": schemaFor(reflect.TypeOf(op.Response), schemas),
+			},
+		}
+	} else if op.ContentType != "" {
+		response["content"] = map[string]interface{}{
+			op.ContentType: map[string]interface{}{},
+		}
+	}
+	operation["responses"] = map[string]interface{}{
+		"200": response,
+		"429": map[string]interface{}{
+			"description": "Rate limit exceeded",
+			"headers": map[string]interface{}{
+				"Retry-After": map[string]interface{}{
+					"description": "Seconds to wait before retrying",
+					"schema":      map[string]interface{}{"type": "integer"},
+				},
+			},
+		},
+	}
+
+	return operation
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaFor returns the JSON schema of t. Named structs are registered in
+// schemas and referenced; anonymous structs are inlined.
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	if t.Kind() == reflect.Ptr {
+		return schemaFor(t.Elem(), schemas)
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	case t.Kind() == reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		name := schemaName(t)
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = nil // guards against recursive types
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	required := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, tagged := field.Tag.Lookup("json"); field.Anonymous && !tagged && field.Type.Kind() == reflect.Struct {
+			// encoding/json promotes the fields of untagged embedded structs.
+			embedded := structSchema(field.Type, schemas)
+			for name, property := range embedded["properties"].(map[string]interface{}) {
+				properties[name] = property
+			}
+			if fields, ok := embedded["required"].([]string); ok {
+				required = append(required, fields...)
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		omitempty := false
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				if opt == "omitempty" {
+					omitempty = true
+				}
+			}
+		}
+		properties[name] = schemaFor(field.Type, schemas)
+		if !omitempty {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func schemaName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+func MakeOpenAPIHandler() http.Handler {
+	spec, err := json.MarshalIndent(OpenAPISpec(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(spec)
+	})
+}
+
+func MakeDocsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(docsHTML)
+	})
+}
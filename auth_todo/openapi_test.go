@@ -0,0 +1,131 @@
+package auth_todo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestOpenAPISpecMatchesRouter(t *testing.T) {
+	router := MakeHTTPHandler(Endpoints{})
+
+	routes := make(map[string]bool)
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			t.Errorf("route %s has no method matcher", path)
+			return nil
+		}
+		for _, method := range methods {
+			routes[strings.ToLower(method)+" "+path] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+
+	paths := OpenAPISpec()["paths"].(map[string]interface{})
+	documented := make(map[string]bool)
+	for path, item := range paths {
+		for method := range item.(map[string]interface{}) {
+			documented[method+" "+path] = true
+		}
+	}
+
+	for route := range routes {
+		if !documented[route] {
+			t.Errorf("route %q is registered but missing from the OpenAPI spec", route)
+		}
+	}
+	for op := range documented {
+		if !routes[op] {
+			t.Errorf("operation %q is in the OpenAPI spec but not registered on the router", op)
+		}
+	}
+}
+
+func TestOpenAPISchemaRefsResolve(t *testing.T) {
+	spec := OpenAPISpec()
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	const prefix = `"#/components/schemas/`
+	for s := string(raw); strings.Contains(s, prefix); {
+		s = s[strings.Index(s, prefix)+len(prefix):]
+		name := s[:strings.Index(s, `"`)]
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("unresolved schema reference %q", name)
+		}
+	}
+
+	todo, ok := schemas["Todo"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected Todo schema to be registered")
+	}
+	props := todo["properties"].(map[string]interface{})
+	if props["CreatedAt"].(map[string]interface{})["format"] != "date-time" {
+		t.Fatalf("Expected CreatedAt to be a date-time, got %v", props["CreatedAt"])
+	}
+}
+
+func TestLegacyRoutesAreDeprecated(t *testing.T) {
+	router := MakeHTTPHandler(Endpoints{})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/todos/todo_1/complete", strings.NewReader("{")))
+	if rec.Header().Get("Deprecation") == "" || rec.Header().Get("Sunset") == "" {
+		t.Fatalf("Expected Deprecation and Sunset headers on legacy route, got %v", rec.Header())
+	}
+	if link := rec.Header().Get("Link"); link != `</v1/todos/todo_1/complete>; rel="successor-version"` {
+		t.Fatalf("Unexpected Link header: %q", link)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/todos/todo_1/complete", strings.NewReader("{")))
+	if rec.Header().Get("Deprecation") != "" {
+		t.Fatal("Expected no Deprecation header on /v1 route")
+	}
+
+	paths := OpenAPISpec()["paths"].(map[string]interface{})
+	legacy := paths["/todos"].(map[string]interface{})["get"].(map[string]interface{})
+	if legacy["deprecated"] != true {
+		t.Fatal("Expected legacy /todos to be documented as deprecated")
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	router := MakeHTTPHandler(Endpoints{})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	var doc map[string]interface{}
+	if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if doc["openapi"] != "3.1.0" {
+		t.Fatalf("Expected openapi 3.1.0, got %v", doc["openapi"])
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "openapi.json") {
+		t.Fatalf("Expected docs page referencing openapi.json, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,315 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// TodoMoved is the type of the history and activity entries of moves.
+const TodoMoved = "moved"
+
+// TodoSortManual orders ListTodos by rank, the order users arrange their
+// todos in, instead of newest first.
+const TodoSortManual = "manual"
+
+var (
+	ErrInvalidMove      = errors.New("exactly one other todo to move before or after is required")
+	ErrMoveAcrossScopes = errors.New("todos can only be moved next to todos of the same list")
+)
+
+// Ranks are strings of base-36 digits without trailing zeros, compared
+// lexicographically within a rankScope. New todos are appended rankStep
+// after the last rank of their scope, read as a number of the scope's width
+// in digits; moves take the midpoint of the ranks around the new position,
+// which grows by a digit every few moves into the same gap. Once a rank would
+// exceed maxRankLength, or the last rank cannot be stepped past in the
+// width, every rank of the scope is respaced.
+const (
+	rankDigits    = "0123456789abcdefghijklmnopqrstuvwxyz"
+	rankStep      = 36 * 36 * 36
+	minRankWidth  = 6
+	maxRankLength = 16
+	maxRankWidth  = 12
+)
+
+// TodoMove positions a todo directly before or directly after another one.
+// Exactly one of Before and After must be set.
+type TodoMove struct {
+	Before string
+	After  string
+}
+
+// rankBetween returns a rank that sorts after a and before b. An empty a
+// stands for the start of the order and an empty b for its end; a must sort
+// before b.
+func rankBetween(a, b string) string {
+	if b != "" {
+		n := 0
+		for n < len(b) && rankDigitAt(a, n) == b[n] {
+			n++
+		}
+		if n > 0 {
+			rest := ""
+			if n < len(a) {
+				rest = a[n:]
+			}
+			return b[:n] + rankBetween(rest, b[n:])
+		}
+	}
+	low := 0
+	if a != "" {
+		low = strings.IndexByte(rankDigits, a[0])
+	}
+	high := len(rankDigits)
+	if b != "" {
+		high = strings.IndexByte(rankDigits, b[0])
+	}
+	if high-low > 1 {
+		return string(rankDigits[(low+high)/2])
+	}
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(rankDigits[low]) + rankBetween(rest, "")
+}
+
+func rankDigitAt(rank string, i int) byte {
+	if i < len(rank) {
+		return rank[i]
+	}
+	return rankDigits[0]
+}
+
+// rankValue reads the first width digits of rank as a number, padding it
+// with zeros.
+func rankValue(rank string, width int) int64 {
+	var value int64
+	for i := 0; i < width; i++ {
+		value = value*int64(len(rankDigits)) + int64(strings.IndexByte(rankDigits, rankDigitAt(rank, i)))
+	}
+	return value
+}
+
+// formatRank writes value as a rank of width digits without trailing zeros.
+func formatRank(value int64, width int) string {
+	digits := make([]byte, width)
+	for i := width - 1; i >= 0; i-- {
+		digits[i] = rankDigits[value%int64(len(rankDigits))]
+		value /= int64(len(rankDigits))
+	}
+	return strings.TrimRight(string(digits), rankDigits[:1])
+}
+
+func rankLimit(width int) int64 {
+	limit := int64(1)
+	for i := 0; i < width; i++ {
+		limit *= int64(len(rankDigits))
+	}
+	return limit
+}
+
+// rankScope is the set of todos whose ranks order them against each other:
+// the todos of a list, or the todos of a user outside any list.
+type rankScope struct {
+	listID string
+	userID string
+}
+
+func rankScopeOf(todo Todo) rankScope {
+	if todo.ListID != "" {
+		return rankScope{listID: todo.ListID}
+	}
+	return rankScope{userID: todo.UserID}
+}
+
+// rankSpace is the width of the ranks of a scope and its last rank.
+type rankSpace struct {
+	width int
+	last  string
+}
+
+// rankSpace returns the rank space of scope. It must be called with s.mu
+// held.
+func (s *todoService) rankSpace(scope rankScope) *rankSpace {
+	space := s.rankSpaces[scope]
+	if space == nil {
+		space = &rankSpace{width: minRankWidth}
+		s.rankSpaces[scope] = space
+	}
+	return space
+}
+
+// nextRank returns a rank after every other one in scope for a todo that is
+// created in it or joins it. It must be called with s.mu held.
+func (s *todoService) nextRank(ctx context.Context, userID string, scope rankScope) string {
+	space := s.rankSpace(scope)
+	value := rankValue(space.last, space.width) + rankStep
+	if value >= rankLimit(space.width) {
+		s.rebalanceRanks(ctx, userID, scope, 1)
+		value = rankValue(space.last, space.width) + rankStep
+	}
+	space.last = formatRank(value, space.width)
+	return space.last
+}
+
+// rankedTodos returns the todos of scope in rank order. It must be called
+// with s.mu held.
+func (s *todoService) rankedTodos(scope rankScope) []Todo {
+	var todos []Todo
+	if scope.listID == "" {
+		for _, t := range s.todosByUser[scope.userID] {
+			if t.ListID == "" {
+				todos = append(todos, t)
+			}
+		}
+	} else {
+		for _, t := range s.todosById {
+			if t.ListID == scope.listID {
+				todos = append(todos, t)
+			}
+		}
+	}
+	sortByRank(todos)
+	return todos
+}
+
+func sortByRank(todos []Todo) {
+	sort.Slice(todos, func(i, j int) bool {
+		if todos[i].Rank != todos[j].Rank {
+			return todos[i].Rank < todos[j].Rank
+		}
+		return todos[i].ID < todos[j].ID
+	})
+}
+
+// rebalanceRanks respaces the ranks of the todos of scope rankStep apart,
+// keeping their order, with room for extra more todos after the last one.
+// Every todo whose rank changes gets a moved entry in its history by userID
+// and is reported through ctx, so that the eventing middleware can publish
+// it. Everyone who sees a scope sees all of its todos, so invalidating the
+// listings for the todo that caused the respacing covers them. It must be
+// called with s.mu held.
+func (s *todoService) rebalanceRanks(ctx context.Context, userID string, scope rankScope, extra int) {
+	todos := s.rankedTodos(scope)
+	width := minRankWidth
+	for int64(len(todos)+extra+1)*rankStep >= rankLimit(width) && width < maxRankWidth {
+		width++
+	}
+	space := s.rankSpace(scope)
+	space.width = width
+	space.last = ""
+	for i, todo := range todos {
+		rank := formatRank(int64(i+1)*rankStep, width)
+		space.last = rank
+		if rank == todo.Rank {
+			continue
+		}
+		todo.Rank = rank
+		s.storeTodo(todo)
+		s.appendHistory(todo, userID, TodoMoved)
+		addRespacedTodo(ctx, todo)
+	}
+}
+
+type respacedTodosContextKey struct{}
+
+// withRespacedTodos returns a context through which the TodoService reports
+// the todos whose ranks it respaced while placing another one.
+func withRespacedTodos(ctx context.Context) (context.Context, *[]Todo) {
+	respaced := new([]Todo)
+	return context.WithValue(ctx, respacedTodosContextKey{}, respaced), respaced
+}
+
+// addRespacedTodo reports a respaced todo. It does nothing outside the
+// eventing middleware.
+func addRespacedTodo(ctx context.Context, todo Todo) {
+	if respaced, ok := ctx.Value(respacedTodosContextKey{}).(*[]Todo); ok {
+		*respaced = append(*respaced, todo)
+	}
+}
+
+// MoveTodo positions a todo directly before or after another todo of the
+// same list, or of the same user's todos outside any list, in the manual
+// order. Editors of a todo may move it next to any such todo they can read.
+// The order is shared by everyone who sees the todos.
+func (s *todoService) MoveTodo(ctx context.Context, userID, todoID string, move TodoMove) (Todo, error) {
+	if (move.Before == "") == (move.After == "") {
+		return Todo{}, ErrInvalidMove
+	}
+	targetID := move.Before + move.After
+	if targetID == todoID {
+		return Todo{}, ErrInvalidMove
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return Todo{}, ErrTodoNotFound
+	}
+	if !canEdit(s.todoRole(todo, userID)) {
+		return Todo{}, ErrUnauthorized
+	}
+	target, exists := s.todosById[targetID]
+	if !exists {
+		return Todo{}, ErrTodoNotFound
+	}
+	if s.todoRole(target, userID) == "" {
+		return Todo{}, ErrUnauthorized
+	}
+	scope := rankScopeOf(todo)
+	if rankScopeOf(target) != scope {
+		return Todo{}, ErrMoveAcrossScopes
+	}
+
+	rank := s.rankNextTo(scope, todoID, targetID, move.Before != "")
+	if len(rank) > maxRankLength {
+		s.rebalanceRanks(ctx, userID, scope, 0)
+		rank = s.rankNextTo(scope, todoID, targetID, move.Before != "")
+	}
+	todo = s.todosById[todoID]
+	todo.Rank = rank
+	if space := s.rankSpace(scope); rank > space.last {
+		space.last = rank
+	}
+	s.storeTodo(todo)
+	s.record(todo, userID, TodoMoved)
+
+	return todo, nil
+}
+
+// rankNextTo returns the rank between the target and its neighbour in scope
+// before or after it, leaving out the todo being moved. It must be called
+// with s.mu held.
+func (s *todoService) rankNextTo(scope rankScope, todoID, targetID string, before bool) string {
+	todos := s.rankedTodos(scope)
+	i := 0
+	for todos[i].ID != targetID {
+		i++
+	}
+	if before {
+		low := ""
+		for j := i - 1; j >= 0; j-- {
+			if todos[j].ID != todoID {
+				low = todos[j].Rank
+				break
+			}
+		}
+		return rankBetween(low, todos[i].Rank)
+	}
+	high := ""
+	for j := i + 1; j < len(todos); j++ {
+		if todos[j].ID != todoID {
+			high = todos[j].Rank
+			break
+		}
+	}
+	return rankBetween(todos[i].Rank, high)
+}
@@ -0,0 +1,52 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+type moveTodoRequest struct {
+	TodoID string `json:"-"`
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+func makeMoveTodoEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(moveTodoRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		todo, err := svc.MoveTodo(ctx, userID, req.TodoID, TodoMove{Before: req.Before, After: req.After})
+		if err != nil {
+			return updateTodoResponse{Err: err.Error()}, nil
+		}
+		return updateTodoResponse{Todo: &todo}, nil
+	}
+}
+
+func decodeMoveTodoRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req moveTodoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.TodoID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func MakeMoveTodoHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.MoveTodoEndpoint,
+		decodeMoveTodoRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
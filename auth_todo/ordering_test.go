@@ -0,0 +1,157 @@
+package auth_todo
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRankBetween(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	ranks := []string{rankBetween("", "")}
+	for i := 0; i < 2000; i++ {
+		j := rng.Intn(len(ranks) + 1)
+		low, high := "", ""
+		if j > 0 {
+			low = ranks[j-1]
+		}
+		if j < len(ranks) {
+			high = ranks[j]
+		}
+		rank := rankBetween(low, high)
+		if rank <= low || (high != "" && rank >= high) || strings.HasSuffix(rank, "0") {
+			t.Fatalf("rankBetween(%q, %q) = %q", low, high, rank)
+		}
+		ranks = append(ranks[:j], append([]string{rank}, ranks[j:]...)...)
+	}
+	if rank := formatRank(rankValue("001z", 6)+rankStep, 6); rank != "002z" {
+		t.Errorf("Expected the next step after 001z to be 002z, got %q", rank)
+	}
+}
+
+func manualOrder(t *testing.T, svc TodoService, userID string) string {
+	t.Helper()
+	todos, _, err := svc.ListTodos(context.Background(), userID, TodoFilter{Sort: TodoSortManual}, 100, 0)
+	if err != nil {
+		t.Fatalf("ListTodos failed: %v", err)
+	}
+	var texts []string
+	for _, todo := range todos {
+		texts = append(texts, todo.Text)
+	}
+	return strings.Join(texts, " ")
+}
+
+func TestMoveTodo(t *testing.T) {
+	ctx := context.Background()
+	svc := NewCachedTodoService(time.Minute, NewTodoService())
+	listID, _ := svc.CreateList(ctx, "owner", "Errands")
+	ids := map[string]string{}
+	for _, text := range []string{"a", "b", "c", "d"} {
+		ids[text], _ = svc.CreateTodo(ctx, "owner", TodoInput{Text: text, ListID: listID})
+	}
+	inv, _ := svc.ShareList(ctx, "owner", listID, "viewer@example.com", ListRoleViewer)
+	svc.RespondToInvitation(ctx, "viewer", "viewer@example.com", inv.ID, true)
+	other, _ := svc.CreateTodo(ctx, "stranger", TodoInput{Text: "x"})
+
+	if got := manualOrder(t, svc, "viewer"); got != "a b c d" {
+		t.Fatalf("Expected new todos last, got %q", got)
+	}
+	for _, move := range []TodoMove{{}, {Before: ids["b"], After: ids["c"]}, {Before: ids["a"]}} {
+		if _, err := svc.MoveTodo(ctx, "owner", ids["a"], move); err != ErrInvalidMove {
+			t.Errorf("Expected ErrInvalidMove for %+v, got %v", move, err)
+		}
+	}
+	if _, err := svc.MoveTodo(ctx, "viewer", ids["a"], TodoMove{After: ids["d"]}); err != ErrUnauthorized {
+		t.Errorf("Expected viewers not to move todos, got %v", err)
+	}
+	if _, err := svc.MoveTodo(ctx, "owner", ids["a"], TodoMove{After: other}); err != ErrUnauthorized {
+		t.Errorf("Expected todos not to be moved next to unreadable ones, got %v", err)
+	}
+
+	svc.MoveTodo(ctx, "owner", ids["d"], TodoMove{Before: ids["a"]})
+	svc.MoveTodo(ctx, "owner", ids["a"], TodoMove{After: ids["c"]})
+	svc.MoveTodo(ctx, "owner", ids["b"], TodoMove{After: ids["a"]})
+	if got := manualOrder(t, svc, "viewer"); got != "d c a b" {
+		t.Errorf("Expected the moves in the viewer's listing, got %q", got)
+	}
+	if todos, _, _ := svc.ListTodos(ctx, "owner", TodoFilter{}, 100, 0); todos[0].Text != "d" || todos[3].Text != "a" {
+		t.Errorf("Expected listings newest first without sort=manual, got %+v", todos)
+	}
+	history, _, _ := svc.TodoHistory(ctx, "owner", ids["b"], 10, 0)
+	if last := history[len(history)-1]; last.Action != TodoMoved || !equalStrings(last.Changed, []string{"Rank"}) {
+		t.Errorf("Expected the move in the history, got %+v", last)
+	}
+
+	// Moving into the same gap over and over respaces the ranks.
+	for i := 0; i < 100; i++ {
+		mover, target := ids["d"], ids["c"]
+		if i%2 == 1 {
+			mover = ids["c"]
+			target = ids["d"]
+		}
+		todo, err := svc.MoveTodo(ctx, "owner", mover, TodoMove{Before: target})
+		if err != nil || len(todo.Rank) > maxRankLength {
+			t.Fatalf("MoveTodo failed: %+v %v", todo, err)
+		}
+	}
+	if got := manualOrder(t, svc, "owner"); got != "c d a b" {
+		t.Errorf("Expected respacing to keep the order, got %q", got)
+	}
+	svc.CreateTodo(ctx, "owner", TodoInput{Text: "e", ListID: listID})
+	if got := manualOrder(t, svc, "owner"); got != "c d a b e" {
+		t.Errorf("Expected the new todo last after respacing, got %q", got)
+	}
+}
+
+func TestRespacingIsScoped(t *testing.T) {
+	ctx := context.Background()
+	broker := NewEventBroker(1000)
+	svc := NewEventingTodoMiddleware(broker, NewCachedTodoService(time.Minute, NewTodoService()))
+	listID, _ := svc.CreateList(ctx, "owner", "Errands")
+	otherList, _ := svc.CreateList(ctx, "owner", "Work")
+	ids := map[string]string{}
+	for _, text := range []string{"a", "b", "c"} {
+		ids[text], _ = svc.CreateTodo(ctx, "owner", TodoInput{Text: text, ListID: listID})
+	}
+	other, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "x", ListID: otherList})
+	before, _ := svc.GetTodo(ctx, "owner", other)
+
+	if _, err := svc.MoveTodo(ctx, "owner", ids["a"], TodoMove{Before: other}); err != ErrMoveAcrossScopes {
+		t.Errorf("Expected ErrMoveAcrossScopes, got %v", err)
+	}
+
+	svc.MoveTodo(ctx, "owner", ids["c"], TodoMove{Before: ids["a"]})
+	start := broker.lastID
+	for i := 0; i < 100; i++ {
+		mover, target := ids["a"], ids["b"]
+		if i%2 == 1 {
+			mover, target = ids["b"], ids["a"]
+		}
+		svc.MoveTodo(ctx, "owner", mover, TodoMove{Before: target})
+	}
+
+	// Respacing rewrote c, which was never moved in the loop, with a history
+	// entry and an event, but left the other list alone.
+	history, _, _ := svc.TodoHistory(ctx, "owner", ids["c"], 10, 0)
+	if len(history) < 3 || history[len(history)-1].Action != TodoMoved {
+		t.Errorf("Expected respacing in c's history, got %+v", history)
+	}
+	sub, replay, _ := broker.Subscribe("owner", start)
+	sub.Close()
+	respaced := false
+	for _, event := range replay {
+		respaced = respaced || event.TodoID == ids["c"]
+	}
+	if !respaced {
+		t.Error("Expected an event for the respaced todo")
+	}
+	if after, _ := svc.GetTodo(ctx, "owner", other); after.Rank != before.Rank {
+		t.Errorf("Expected other lists to keep their ranks, got %q for %q", after.Rank, before.Rank)
+	}
+	if _, total, _ := svc.TodoHistory(ctx, "owner", other, 10, 0); total != 1 {
+		t.Errorf("Expected no history for the other list's todo, got %d entries", total)
+	}
+}
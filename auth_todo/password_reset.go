@@ -0,0 +1,81 @@
+package auth_todo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RequestPasswordReset mails a single-use reset token to email if it belongs
+// to an account, replacing any token sent before. It succeeds either way and
+// sends the mail in the background, so that neither the response nor its
+// timing reveals whether the account exists.
+func (s *authService) RequestPasswordReset(ctx context.Context, email string) error {
+	if email == "" {
+		return ErrEmptyEmail
+	}
+
+	token, err := newSecret()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	u, exists := s.users[email]
+	if exists {
+		s.resets.issue(u.ID, token, time.Now())
+	}
+	s.mu.Unlock()
+
+	if !exists {
+		return nil
+	}
+
+	mail := Mail{
+		To:      u.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your account.\n\n"+
+			"Use this link within %s to choose a new password:\n\n%s\n\n"+
+			"If it was not you, ignore this mail; your password has not been changed.\n",
+			s.resets.ttl, link(s.appURL, "reset-password", token)),
+	}
+	go s.mailer.Send(context.Background(), mail)
+
+	return nil
+}
+
+// ResetPassword sets a new password with a token from RequestPasswordReset.
+// The token is consumed even if it has expired. Every session, access token
+// and OAuth grant of the user is revoked and any login lockout is cleared.
+// Receiving the token also proves the address, so an unverified account
+// becomes verified.
+func (s *authService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if newPassword == "" {
+		return ErrEmptyPassword
+	}
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), s.passwordCost)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	userID, valid := s.resets.consume(token, time.Now())
+	email, exists := s.emailsByID[userID]
+	if !valid || !exists {
+		s.mu.Unlock()
+		return ErrInvalidResetToken
+	}
+	setAuditSubject(ctx, userID)
+
+	u := s.users[email]
+	u.PasswordHash = passwordHash
+	u.Verified = true
+	s.users[email] = u
+	s.revokeCredentials(u.ID)
+	s.mu.Unlock()
+
+	s.throttle.unlock(email)
+	return nil
+}
@@ -0,0 +1,178 @@
+package auth_todo
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type channelMailer chan Mail
+
+func (m channelMailer) Send(_ context.Context, mail Mail) error {
+	m <- mail
+	return nil
+}
+
+// receiveToken returns the token of the link in the next mail, which must
+// have the given subject.
+func receiveToken(t *testing.T, outbox channelMailer, subject string) string {
+	t.Helper()
+	select {
+	case mail := <-outbox:
+		if mail.Subject != subject {
+			t.Fatalf("Expected %q mail, got %q", subject, mail.Subject)
+		}
+		for _, line := range strings.Split(mail.Body, "\n") {
+			if u, err := url.Parse(line); err == nil && u.Query().Get("token") != "" {
+				return u.Query().Get("token")
+			}
+		}
+		t.Fatalf("No link in mail: %q", mail.Body)
+	case <-time.After(5 * time.Second):
+		t.Fatal("No mail sent")
+	}
+	return ""
+}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	outbox := make(channelMailer, 4)
+	svc := NewAuthService(WithPasswordCost(bcrypt.MinCost), WithMailer(outbox, "https://todo.example.com"))
+
+	svc.Signup(ctx, "test@example.com", "password123")
+	receiveToken(t, outbox, "Verify your email address")
+	session, _ := svc.Login(ctx, "test@example.com", "password123")
+	userID, _ := svc.ValidateToken(ctx, session)
+	pat, _, _ := svc.CreateAccessToken(ctx, userID, "ci", []string{ScopeTodosRead}, time.Time{})
+
+	if err := svc.RequestPasswordReset(ctx, "nobody@example.com"); err != nil {
+		t.Fatalf("Expected unknown email to succeed silently, got %v", err)
+	}
+	svc.RequestPasswordReset(ctx, "test@example.com")
+	stale := receiveToken(t, outbox, "Reset your password")
+	svc.RequestPasswordReset(ctx, "test@example.com")
+	token := receiveToken(t, outbox, "Reset your password")
+	if len(outbox) != 0 {
+		t.Fatal("Expected no mail for the unknown email")
+	}
+
+	if err := svc.ResetPassword(ctx, stale, "newpassword"); err != ErrInvalidResetToken {
+		t.Errorf("Expected superseded token to be rejected, got %v", err)
+	}
+	if err := svc.ResetPassword(ctx, token, "newpassword"); err != nil {
+		t.Fatalf("ResetPassword failed: %v", err)
+	}
+	if err := svc.ResetPassword(ctx, token, "another"); err != ErrInvalidResetToken {
+		t.Errorf("Expected token to be single-use, got %v", err)
+	}
+
+	if _, err := svc.ValidateToken(ctx, session); err != ErrInvalidToken {
+		t.Errorf("Expected existing session to be revoked, got %v", err)
+	}
+	if _, err := svc.ValidateToken(ctx, pat); err != ErrInvalidToken {
+		t.Errorf("Expected existing access token to be revoked, got %v", err)
+	}
+	if _, err := svc.Login(ctx, "test@example.com", "password123"); err != ErrInvalidCredentials {
+		t.Errorf("Expected old password to be rejected, got %v", err)
+	}
+	if _, err := svc.Login(ctx, "test@example.com", "newpassword"); err != nil {
+		t.Errorf("Expected login with new password, got %v", err)
+	}
+
+	svc.(*authService).resets.ttl = -time.Second
+	svc.RequestPasswordReset(ctx, "test@example.com")
+	if err := svc.ResetPassword(ctx, receiveToken(t, outbox, "Reset your password"), "expired"); err != ErrInvalidResetToken {
+		t.Errorf("Expected expired token to be rejected, got %v", err)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	mailer, err := NewFileMailer(dir, "noreply@example.com")
+	if err != nil {
+		t.Fatalf("NewFileMailer failed: %v", err)
+	}
+	if err := mailer.Send(context.Background(), Mail{To: "test@example.com", Subject: "Hello", Body: "Hi"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one .eml file, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(data), "To: test@example.com\r\n") || !strings.HasSuffix(string(data), "\r\n\r\nHi") {
+		t.Errorf("Unexpected message: %q", data)
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					received <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "DATA":
+				inData = true
+				reply("354 Go ahead")
+			case "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	mailer := NewSMTPMailer(ln.Addr().String(), "noreply@example.com", nil)
+	if err := mailer.Send(context.Background(), Mail{To: "test@example.com", Subject: "Hello", Body: "Hi"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if msg := <-received; !strings.Contains(msg, "Subject: Hello\r\n") || !strings.Contains(msg, "From: noreply@example.com\r\n") {
+		t.Errorf("Unexpected message: %q", msg)
+	}
+
+	if err := mailer.Send(context.Background(), Mail{To: "a@example.com\r\nBcc: b@example.com"}); err == nil {
+		t.Error("Expected header injection to be rejected")
+	}
+}
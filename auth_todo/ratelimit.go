@@ -1,24 +1,446 @@
 package auth_todo
 
 import (
+	"container/list"
 	"context"
 	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
 	"golang.org/x/time/rate"
 )
 
 var ErrRateLimitExceeded = errors.New("rate limit exceeded")
 
-func NewRateLimitMiddleware(limit rate.Limit, burst int) endpoint.Middleware {
-	limiter := rate.NewLimiter(limit, burst)
+// RateLimitKey selects what a policy counts requests against.
+type RateLimitKey int
 
+const (
+	// KeyByUser counts requests per authenticated user. Anonymous requests
+	// fall back to the client IP.
+	KeyByUser RateLimitKey = iota
+	// KeyByIP counts requests per client IP.
+	KeyByIP
+)
+
+// RateLimitPolicy allows Burst requests at once, refilled at Limit requests
+// per second.
+type RateLimitPolicy struct {
+	Limit rate.Limit
+	Burst int
+	Key   RateLimitKey
+}
+
+type RateLimitConfig struct {
+	// Default applies to endpoints without an entry in Policies.
+	Default RateLimitPolicy
+	// Policies are keyed by endpoint name, as passed to Middleware.
+	Policies map[string]RateLimitPolicy
+	// TrustedProxies lists the CIDRs whose X-Forwarded-For and X-Real-IP
+	// headers are believed. Requests from anywhere else are keyed by their
+	// remote address. MakeHTTPHandler resolves the client IP of every request
+	// with them before authentication runs, so the same address backs
+	// ClientIPFromContext whether or not the endpoint is limited.
+	TrustedProxies []string
+}
+
+// defaultRateLimitKeys bounds the buckets of a local limiter.
+const defaultRateLimitKeys = 10000
+
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Default: RateLimitPolicy{Limit: 20, Burst: 40, Key: KeyByUser},
+		Policies: map[string]RateLimitPolicy{
+			"signup":              {Limit: rate.Every(10 * time.Second), Burst: 5, Key: KeyByIP},
+			"login":               {Limit: 1, Burst: 10, Key: KeyByIP},
+			"login_mfa":           {Limit: 1, Burst: 10, Key: KeyByIP},
+			"confirm_mfa":         {Limit: rate.Every(10 * time.Second), Burst: 5, Key: KeyByUser},
+			"disable_mfa":         {Limit: rate.Every(10 * time.Second), Burst: 5, Key: KeyByUser},
+			"oauth_consent":       {Limit: 1, Burst: 10, Key: KeyByIP},
+			"oauth_token":         {Limit: 5, Burst: 20, Key: KeyByIP},
+			"oidc_login":          {Limit: 1, Burst: 10, Key: KeyByIP},
+			"oidc_callback":       {Limit: 1, Burst: 10, Key: KeyByIP},
+			"forgot_password":     {Limit: rate.Every(time.Minute), Burst: 3, Key: KeyByIP},
+			"reset_password":      {Limit: rate.Every(10 * time.Second), Burst: 5, Key: KeyByIP},
+			"verify_email":        {Limit: rate.Every(10 * time.Second), Burst: 5, Key: KeyByIP},
+			"resend_verification": {Limit: rate.Every(time.Minute), Burst: 3, Key: KeyByIP},
+			"create_todo":         {Limit: 10, Burst: 20, Key: KeyByUser},
+			"share_list":          {Limit: rate.Every(10 * time.Second), Burst: 10, Key: KeyByUser},
+			"add_attachment":      {Limit: 1, Burst: 10, Key: KeyByUser},
+			"graphql":             {Limit: 5, Burst: 20, Key: KeyByUser},
+		},
+	}
+}
+
+// RateLimitStatus is the state of the bucket a request was counted against,
+// reported to clients in the RateLimit-* headers.
+type RateLimitStatus struct {
+	Limit      int
+	Remaining  int
+	Window     time.Duration
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitError is returned by the middleware when a request is rejected. It
+// matches ErrRateLimitExceeded with errors.Is.
+type RateLimitError struct {
+	Status RateLimitStatus
+}
+
+func (e *RateLimitError) Error() string {
+	return ErrRateLimitExceeded.Error()
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimitExceeded
+}
+
+// RateLimiter is the backend that holds the buckets. Allow counts one request
+// against key and reports whether it is within policy. Buckets are tracked
+// with GCRA, which needs a single timestamp per key: the theoretical arrival
+// time (TAT) of the next request.
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, policy RateLimitPolicy) (RateLimitStatus, bool, error)
+}
+
+// gcra returns the emission interval of policy, the time between two requests
+// at the sustained rate, and its tolerance, how far ahead of time the TAT may
+// run before requests are rejected.
+func gcra(policy RateLimitPolicy) (burst int, interval, tolerance time.Duration) {
+	burst = policy.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	interval = time.Duration(float64(time.Second) / float64(policy.Limit))
+	return burst, interval, interval * time.Duration(burst)
+}
+
+// RateLimits applies per-endpoint policies on top of a RateLimiter backend.
+type RateLimits struct {
+	config    RateLimitConfig
+	clientIPs clientIPResolver
+	backend   RateLimiter
+	rejected  metrics.Counter
+}
+
+// NewRateLimits returns the rate limits of config, counted in backend.
+// rejected, if not nil, is incremented with "endpoint" and "key" labels for
+// every rejected request.
+func NewRateLimits(config RateLimitConfig, backend RateLimiter, rejected metrics.Counter) (*RateLimits, error) {
+	trusted, err := parseCIDRs(config.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	return &RateLimits{
+		config:    config,
+		clientIPs: clientIPResolver{trusted: trusted},
+		backend:   backend,
+		rejected:  rejected,
+	}, nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func (rl *RateLimits) policy(name string) RateLimitPolicy {
+	if policy, ok := rl.config.Policies[name]; ok {
+		return policy
+	}
+	return rl.config.Default
+}
+
+// Middleware limits the endpoint with the policy configured for name. Nil
+// RateLimits do not limit anything. Requests are keyed by ClientIPFromContext,
+// which the transport resolved when the request arrived. Endpoints that require authentication
+// should be wrapped by the authentication middleware first, so that KeyByUser
+// sees the user.
+func (rl *RateLimits) Middleware(name string) endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if rl == nil {
+			return next
+		}
+		policy := rl.policy(name)
+		unlimited := policy.Limit == rate.Inf || policy.Limit <= 0
+
 		return func(ctx context.Context, request interface{}) (interface{}, error) {
-			if !limiter.Allow() {
-				return nil, ErrRateLimitExceeded
+			if unlimited {
+				return next(ctx, request)
+			}
+
+			keyType, key := "ip", ClientIPFromContext(ctx)
+			if userID, ok := UserIDFromContext(ctx); ok && policy.Key == KeyByUser {
+				keyType, key = "user", userID
+			}
+
+			status, ok, err := rl.backend.Allow(ctx, name+"|"+keyType+":"+key, policy)
+			if err != nil {
+				return nil, err
+			}
+			if info, _ := ctx.Value(requestInfoContextKey).(*requestInfo); info != nil {
+				info.rateLimit = &status
+			}
+			if !ok {
+				if rl.rejected != nil {
+					rl.rejected.With("endpoint", name, "key", keyType).Add(1)
+				}
+				return nil, &RateLimitError{Status: status}
 			}
 			return next(ctx, request)
 		}
 	}
 }
+
+// clientIPResolver resolves the address of the client behind the trusted
+// proxies.
+type clientIPResolver struct {
+	trusted []*net.IPNet
+}
+
+// resolve returns the address of the client. Forwarding headers are only
+// honoured when the connection comes from a trusted proxy; X-Forwarded-For
+// is walked from the right, skipping further trusted proxies, so a client
+// cannot pick its own key by prepending addresses.
+func (c clientIPResolver) resolve(info *requestInfo) string {
+	if info == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(info.remoteAddr)
+	if err != nil {
+		host = info.remoteAddr
+	}
+	if !c.isTrusted(host) {
+		return host
+	}
+
+	if info.forwardedFor != "" {
+		hops := strings.Split(info.forwardedFor, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			host = hop
+			if !c.isTrusted(hop) {
+				return hop
+			}
+		}
+		return host
+	}
+	if realIP := strings.TrimSpace(info.realIP); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return host
+}
+
+func (c clientIPResolver) isTrusted(host string) bool {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range c.trusted {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// localRateLimiter keeps the buckets in memory. A bucket whose TAT has passed
+// is full and indistinguishable from a missing one, so idle buckets are
+// dropped as soon as they reach the back of the LRU list, and the least
+// recently used bucket is evicted once maxKeys is reached.
+type localRateLimiter struct {
+	maxKeys int
+	now     func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*list.Element
+	lru     *list.List
+}
+
+type rateLimitBucket struct {
+	key string
+	tat time.Time
+}
+
+// NewLocalRateLimiter returns a RateLimiter for a single replica that keeps
+// at most maxKeys buckets.
+func NewLocalRateLimiter(maxKeys int) RateLimiter {
+	return newLocalRateLimiter(maxKeys)
+}
+
+func newLocalRateLimiter(maxKeys int) *localRateLimiter {
+	if maxKeys <= 0 {
+		maxKeys = defaultRateLimitKeys
+	}
+	return &localRateLimiter{
+		maxKeys: maxKeys,
+		now:     time.Now,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func (l *localRateLimiter) Allow(_ context.Context, key string, policy RateLimitPolicy) (RateLimitStatus, bool, error) {
+	burst, interval, tolerance := gcra(policy)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.evict(now)
+
+	tat := now
+	elem, exists := l.buckets[key]
+	if exists {
+		if bucketTAT := elem.Value.(*rateLimitBucket).tat; bucketTAT.After(now) {
+			tat = bucketTAT
+		}
+	}
+
+	status := RateLimitStatus{Limit: burst, Window: tolerance}
+	next := tat.Add(interval)
+	allowAt := next.Add(-tolerance)
+	if now.Before(allowAt) {
+		status.Reset = tat.Sub(now)
+		status.RetryAfter = allowAt.Sub(now)
+		return status, false, nil
+	}
+
+	if exists {
+		elem.Value.(*rateLimitBucket).tat = next
+		l.lru.MoveToFront(elem)
+	} else {
+		l.buckets[key] = l.lru.PushFront(&rateLimitBucket{key: key, tat: next})
+		if l.lru.Len() > l.maxKeys {
+			l.remove(l.lru.Back())
+		}
+	}
+
+	status.Remaining = int(now.Sub(allowAt) / interval)
+	status.Reset = next.Sub(now)
+	return status, true, nil
+}
+
+// evict drops buckets from the back of the LRU list that have refilled. It
+// must be called with l.mu held.
+func (l *localRateLimiter) evict(now time.Time) {
+	for elem := l.lru.Back(); elem != nil; elem = l.lru.Back() {
+		if elem.Value.(*rateLimitBucket).tat.After(now) {
+			return
+		}
+		l.remove(elem)
+	}
+}
+
+func (l *localRateLimiter) remove(elem *list.Element) {
+	l.lru.Remove(elem)
+	delete(l.buckets, elem.Value.(*rateLimitBucket).key)
+}
+
+// requestInfo carries what the rate limiter needs from the HTTP request, and
+// the status it computed back to the transport for the response headers.
+type requestInfo struct {
+	remoteAddr   string
+	forwardedFor string
+	realIP       string
+	clientIP     string
+	rateLimit    *RateLimitStatus
+}
+
+// ClientIPFromContext returns the address of the client that made the
+// request. Behind a router without trusted proxies, it is the remote address
+// of the connection.
+func ClientIPFromContext(ctx context.Context) string {
+	info, _ := ctx.Value(requestInfoContextKey).(*requestInfo)
+	if info == nil {
+		return ""
+	}
+	if info.clientIP != "" {
+		return info.clientIP
+	}
+	host, _, err := net.SplitHostPort(info.remoteAddr)
+	if err != nil {
+		return info.remoteAddr
+	}
+	return host
+}
+
+func (c clientIPResolver) newRequestInfo(r *http.Request) *requestInfo {
+	info := &requestInfo{
+		remoteAddr:   r.RemoteAddr,
+		forwardedFor: r.Header.Get("X-Forwarded-For"),
+		realIP:       r.Header.Get("X-Real-IP"),
+	}
+	info.clientIP = c.resolve(info)
+	return info
+}
+
+// middleware resolves the client IP once per request, before any handler
+// runs, so that authentication, the rate limiter and the audit log all see
+// the same address.
+func (c clientIPResolver) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), requestInfoContextKey, c.newRequestInfo(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// populateRequestInfo keeps the request info resolved by the router's
+// middleware. Handlers served on their own resolve it without trusted
+// proxies.
+func populateRequestInfo(ctx context.Context, r *http.Request) context.Context {
+	if info, _ := ctx.Value(requestInfoContextKey).(*requestInfo); info != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, requestInfoContextKey, clientIPResolver{}.newRequestInfo(r))
+}
+
+// encodeRateLimitHeaders sets the RateLimit-* headers of the IETF
+// draft-ietf-httpapi-ratelimit-headers for the bucket the request was counted
+// against.
+func encodeRateLimitHeaders(ctx context.Context, w http.ResponseWriter) context.Context {
+	info, _ := ctx.Value(requestInfoContextKey).(*requestInfo)
+	if info == nil || info.rateLimit == nil {
+		return ctx
+	}
+	status := info.rateLimit
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(status.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(status.Reset)))
+	w.Header().Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", status.Limit, ceilSeconds(status.Window)))
+	return ctx
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,122 @@
+package auth_todo
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/redis/go-redis/v9"
+)
+
+// gcraScript implements GCRA atomically. The clock is Redis's own, so
+// replicas with skewed clocks still agree on every bucket. Times are in
+// microseconds; the bucket expires once it has refilled.
+//
+// KEYS[1] bucket, ARGV[1] emission interval, ARGV[2] tolerance.
+// Returns {allowed, remaining, reset, retry after}.
+var gcraScript = redis.NewScript(`
+local now = redis.call('TIME')
+now = tonumber(now[1]) * 1000000 + tonumber(now[2])
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+
+local tat = now
+local stored = redis.call('GET', KEYS[1])
+if stored then
+  tat = math.max(tonumber(stored), now)
+end
+
+local next = tat + interval
+local allow_at = next - tolerance
+if now < allow_at then
+  return {0, 0, tat - now, allow_at - now}
+end
+
+local ttl = math.max(1, math.ceil((next - now) / 1000))
+redis.call('SET', KEYS[1], string.format('%.0f', next), 'PX', ttl)
+return {1, math.floor((now - allow_at) / interval), next - now, 0}
+`)
+
+type redisRateLimiter struct {
+	client redis.Scripter
+	prefix string
+}
+
+// NewRedisRateLimiter returns a RateLimiter whose buckets live in Redis, so
+// that every replica counts against the same limits. Keys are namespaced with
+// prefix.
+func NewRedisRateLimiter(client redis.Scripter, prefix string) RateLimiter {
+	return &redisRateLimiter{client: client, prefix: prefix}
+}
+
+func (l *redisRateLimiter) Allow(ctx context.Context, key string, policy RateLimitPolicy) (RateLimitStatus, bool, error) {
+	burst, interval, tolerance := gcra(policy)
+
+	result, err := gcraScript.Run(ctx, l.client, []string{l.prefix + key}, interval.Microseconds(), tolerance.Microseconds()).Int64Slice()
+	if err != nil {
+		return RateLimitStatus{}, false, err
+	}
+	if len(result) != 4 {
+		return RateLimitStatus{}, false, fmt.Errorf("rate limit script returned %d values", len(result))
+	}
+
+	return RateLimitStatus{
+		Limit:      burst,
+		Remaining:  int(result[1]),
+		Window:     tolerance,
+		Reset:      time.Duration(result[2]) * time.Microsecond,
+		RetryAfter: time.Duration(result[3]) * time.Microsecond,
+	}, result[0] == 1, nil
+}
+
+type fallbackRateLimiter struct {
+	primary  RateLimiter
+	fallback RateLimiter
+	logger   log.Logger
+	retry    time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+// NewFallbackRateLimiter counts requests in primary and, when it fails, in
+// fallback. primary is not tried again for retry after a failure, so an
+// unreachable backend costs one timeout per interval rather than one per
+// request. While on the fallback, limits are enforced per replica.
+func NewFallbackRateLimiter(primary, fallback RateLimiter, retry time.Duration, logger log.Logger) RateLimiter {
+	return &fallbackRateLimiter{
+		primary:  primary,
+		fallback: fallback,
+		logger:   logger,
+		retry:    retry,
+		now:      time.Now,
+	}
+}
+
+func (l *fallbackRateLimiter) Allow(ctx context.Context, key string, policy RateLimitPolicy) (RateLimitStatus, bool, error) {
+	l.mu.Lock()
+	down := l.now().Before(l.downUntil)
+	l.mu.Unlock()
+
+	if !down {
+		status, ok, err := l.primary.Allow(ctx, key, policy)
+		if err == nil {
+			return status, ok, nil
+		}
+		if ctx.Err() != nil {
+			return RateLimitStatus{}, false, ctx.Err()
+		}
+
+		l.mu.Lock()
+		if !l.now().Before(l.downUntil) {
+			l.logger.Log("msg", "rate limit backend unavailable, limiting locally", "retry", l.retry, "err", err)
+		}
+		l.downUntil = l.now().Add(l.retry)
+		l.mu.Unlock()
+	}
+
+	return l.fallback.Allow(ctx, key, policy)
+}
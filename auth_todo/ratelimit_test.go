@@ -0,0 +1,235 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-kit/log"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/time/rate"
+)
+
+func newTestRateLimits(t *testing.T, config RateLimitConfig, backend RateLimiter) *RateLimits {
+	t.Helper()
+	limits, err := NewRateLimits(config, backend, nil)
+	if err != nil {
+		t.Fatalf("NewRateLimits failed: %v", err)
+	}
+	return limits
+}
+
+func newTestLocalRateLimiter(maxKeys int) (*localRateLimiter, *time.Time) {
+	limiter := newLocalRateLimiter(maxKeys)
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestRateLimiterKeys(t *testing.T) {
+	backend, now := newTestLocalRateLimiter(0)
+	limits := newTestRateLimits(t, RateLimitConfig{
+		Default: RateLimitPolicy{Limit: 1, Burst: 2, Key: KeyByUser},
+	}, backend)
+	ep := limits.Middleware("test")(func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	call := func(remoteAddr, userID string) error {
+		ctx := context.WithValue(context.Background(), requestInfoContextKey, &requestInfo{remoteAddr: remoteAddr})
+		if userID != "" {
+			ctx = context.WithValue(ctx, userIDContextKey, userID)
+		}
+		_, err := ep(ctx, nil)
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := call("10.0.0.1:1234", ""); err != nil {
+			t.Fatalf("Request %d within burst rejected: %v", i, err)
+		}
+	}
+	err := call("10.0.0.1:5678", "")
+	var rateLimitErr *RateLimitError
+	if !errors.As(err, &rateLimitErr) || !errors.Is(err, ErrRateLimitExceeded) {
+		t.Fatalf("Expected rate limit error, got %v", err)
+	}
+	if rateLimitErr.Status.RetryAfter != time.Second {
+		t.Errorf("Expected retry after 1s, got %v", rateLimitErr.Status.RetryAfter)
+	}
+
+	// Other clients and authenticated users have their own buckets.
+	if err := call("10.0.0.2:1234", ""); err != nil {
+		t.Errorf("Other IP rejected: %v", err)
+	}
+	if err := call("10.0.0.1:1234", "user_1"); err != nil {
+		t.Errorf("Authenticated user rejected: %v", err)
+	}
+
+	*now = now.Add(time.Second)
+	if err := call("10.0.0.1:1234", ""); err != nil {
+		t.Errorf("Request after refill rejected: %v", err)
+	}
+}
+
+func TestRateLimiterEvictsBuckets(t *testing.T) {
+	limiter, now := newTestLocalRateLimiter(2)
+	policy := RateLimitPolicy{Limit: 1, Burst: 5}
+
+	for _, key := range []string{"a", "b", "c"} {
+		limiter.Allow(context.Background(), key, policy)
+	}
+	if _, ok := limiter.buckets["a"]; ok || len(limiter.buckets) != 2 {
+		t.Fatalf("Expected least recently used bucket to be evicted, have %d buckets", len(limiter.buckets))
+	}
+
+	*now = now.Add(time.Second)
+	limiter.Allow(context.Background(), "d", policy)
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("Expected refilled buckets to be dropped, have %d buckets", len(limiter.buckets))
+	}
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	limits := newTestRateLimits(t, RateLimitConfig{TrustedProxies: []string{"10.0.0.0/8"}}, nil)
+
+	tests := []struct {
+		name string
+		info requestInfo
+		want string
+	}{
+		{"direct", requestInfo{remoteAddr: "203.0.113.7:1234", forwardedFor: "198.51.100.1"}, "203.0.113.7"},
+		{"proxied", requestInfo{remoteAddr: "10.0.0.1:1234", forwardedFor: "198.51.100.1"}, "198.51.100.1"},
+		{"spoofed", requestInfo{remoteAddr: "10.0.0.1:1234", forwardedFor: "1.2.3.4, 198.51.100.1, 10.0.0.2"}, "198.51.100.1"},
+		{"real ip", requestInfo{remoteAddr: "10.0.0.1:1234", realIP: "198.51.100.2"}, "198.51.100.2"},
+	}
+	for _, tt := range tests {
+		if got := limits.clientIPs.resolve(&tt.info); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestClientIPResolvedBeforeAuthentication(t *testing.T) {
+	audit, err := NewFileAuditLogger(filepath.Join(t.TempDir(), "audit.log"), 0, 0)
+	if err != nil {
+		t.Fatalf("NewFileAuditLogger failed: %v", err)
+	}
+	authSvc := NewAuditingAuthMiddleware(audit, log.NewNopLogger(), NewAuthService())
+	// Rate limits without policies limit nothing but still trust the proxy.
+	limits := newTestRateLimits(t, RateLimitConfig{TrustedProxies: []string{"10.0.0.0/8"}}, NewLocalRateLimiter(0))
+	handler := MakeHTTPHandler(MakeEndpoints(authSvc, NewTodoService(), NewEventBroker(1), limits))
+
+	req := httptest.NewRequest("GET", "/v1/todos", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	req.Header.Set("Authorization", "Bearer invalid")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401, got %d", rec.Code)
+	}
+	if rec.Header().Get("RateLimit-Limit") != "" {
+		t.Errorf("Expected no rate limit headers, got %q", rec.Header().Get("RateLimit-Limit"))
+	}
+	events, _, _ := audit.Query(context.Background(), SecurityEventQuery{Type: AuditTokenRejected}, 10, 0)
+	if len(events) != 1 || events[0].IP != "198.51.100.1" {
+		t.Errorf("Expected rejected token from the forwarded client, got %+v", events)
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	limits := newTestRateLimits(t, RateLimitConfig{
+		Default:  RateLimitPolicy{Limit: 100, Burst: 100},
+		Policies: map[string]RateLimitPolicy{"signup": {Limit: rate.Every(time.Minute), Burst: 1, Key: KeyByIP}},
+	}, NewLocalRateLimiter(0))
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(NewAuthService(), NewTodoService(), NewEventBroker(1), limits)))
+	defer server.Close()
+
+	signup := func() *http.Response {
+		resp, err := http.Post(server.URL+"/v1/signup", "application/json", strings.NewReader(`{"email":"a@example.com","password":"password123"}`))
+		if err != nil {
+			t.Fatalf("POST failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := signup()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("RateLimit-Remaining") != "0" || resp.Header.Get("RateLimit-Limit") != "1" {
+		t.Fatalf("Unexpected first response: %d %v", resp.StatusCode, resp.Header)
+	}
+
+	resp = signup()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") == "" || resp.Header.Get("RateLimit-Policy") != "1;w=60" {
+		t.Fatalf("Unexpected rate limit headers: %v", resp.Header)
+	}
+}
+
+func TestRedisRateLimiterSharedAcrossReplicas(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Unix(1700000000, 0))
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	ctx := context.Background()
+	policy := RateLimitPolicy{Limit: 1, Burst: 2}
+	replicas := []RateLimiter{
+		NewRedisRateLimiter(client, "test:"),
+		NewRedisRateLimiter(client, "test:"),
+	}
+
+	for i, replica := range replicas {
+		status, ok, err := replica.Allow(ctx, "user_1", policy)
+		if err != nil || !ok || status.Remaining != 1-i {
+			t.Fatalf("Request %d: expected allowed with %d remaining, got %+v %v %v", i, 1-i, status, ok, err)
+		}
+	}
+	status, ok, err := replicas[0].Allow(ctx, "user_1", policy)
+	if err != nil || ok || status.RetryAfter != time.Second {
+		t.Fatalf("Expected rejection with 1s retry, got %+v %v %v", status, ok, err)
+	}
+	if _, ok, _ := replicas[1].Allow(ctx, "user_2", policy); !ok {
+		t.Fatal("Expected other key to be allowed")
+	}
+
+	mr.SetTime(time.Unix(1700000001, 0))
+	if _, ok, _ := replicas[1].Allow(ctx, "user_1", policy); !ok {
+		t.Fatal("Expected request after refill to be allowed")
+	}
+}
+
+func TestFallbackRateLimiter(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr(), MaxRetries: -1})
+	defer client.Close()
+
+	local, _ := newTestLocalRateLimiter(0)
+	limiter := NewFallbackRateLimiter(NewRedisRateLimiter(client, "test:"), local, time.Minute, log.NewNopLogger())
+	ctx := context.Background()
+	policy := RateLimitPolicy{Limit: 1, Burst: 1}
+
+	if _, ok, err := limiter.Allow(ctx, "user_1", policy); !ok || err != nil {
+		t.Fatalf("Expected request to be allowed by Redis, got %v %v", ok, err)
+	}
+	if len(local.buckets) != 0 {
+		t.Fatal("Expected the local limiter to be unused while Redis is up")
+	}
+
+	mr.Close()
+	if _, ok, err := limiter.Allow(ctx, "user_1", policy); !ok || err != nil {
+		t.Fatalf("Expected fallback to allow the request, got %v %v", ok, err)
+	}
+	if _, ok, err := limiter.Allow(ctx, "user_1", policy); ok || err != nil {
+		t.Fatalf("Expected fallback to enforce the limit, got %v %v", ok, err)
+	}
+}
@@ -4,29 +4,167 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Todo struct {
+	ID         string
+	UserID     string
+	ListID     string
+	AssigneeID string
+	Text       string
+	Tags       []string
+	Completed  bool
+	Status     string
+	Rank       string
+	BlockedBy  []string `json:",omitempty"`
+	Blocking   []string `json:",omitempty"`
+	Blocked    bool     `json:",omitempty"`
+	CreatedAt  time.Time
+}
+
+// List is a named group of todos. UserID is its creator; Role is the role
+// of the user the list was returned to.
+type List struct {
 	ID        string
 	UserID    string
-	Text      string
-	Completed bool
+	Name      string
+	Role      string
 	CreatedAt time.Time
 }
 
+type Tag struct {
+	Name  string
+	Count int
+}
+
+type User struct {
+	ID            string
+	Email         string
+	EmailVerified bool
+	MFAEnabled    bool
+	Role          string
+	Disabled      bool
+	CreatedAt     time.Time
+}
+
+// TodoInput holds the fields a client may set when creating a todo.
+type TodoInput struct {
+	Text   string
+	ListID string
+	Tags   []string
+}
+
+// TodoPatch holds the fields changed by UpdateTodo; nil fields are left
+// untouched. An empty ListID moves the todo out of its list.
+type TodoPatch struct {
+	Text   *string
+	ListID *string
+	Tags   *[]string
+}
+
+// TodoFilter narrows ListTodos. Zero-valued fields match every todo; ListIDs
+// matches todos in any of the given lists, SharedWithMe only todos in lists
+// other users shared with the caller and AssignedToMe only todos assigned
+// to the caller. Sort orders the todos newest first, or by rank for
+// TodoSortManual.
+type TodoFilter struct {
+	Completed    *bool
+	ListIDs      []string
+	Tag          string
+	Search       string
+	SharedWithMe bool
+	AssignedToMe bool
+	Sort         string
+}
+
 type AuthService interface {
 	Signup(ctx context.Context, email, password string) (userID string, err error)
 	Login(ctx context.Context, email, password string) (token string, err error)
+	VerifyCredentials(ctx context.Context, email, password, code string) (userID string, err error)
 	ValidateToken(ctx context.Context, token string) (userID string, err error)
+	GetUser(ctx context.Context, userID string) (User, error)
+	UnlockAccount(ctx context.Context, email string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendVerification(ctx context.Context, email string) error
+	EnrollMFA(ctx context.Context, userID string) (MFAEnrollment, error)
+	ConfirmMFA(ctx context.Context, userID, code string) (recoveryCodes []string, err error)
+	CompleteMFALogin(ctx context.Context, challengeToken, code string) (token string, err error)
+	DisableMFA(ctx context.Context, userID, password string) error
+	Authenticate(ctx context.Context, token string) (Credentials, error)
+	CreateAccessToken(ctx context.Context, userID, name string, scopes []string, expiresAt time.Time) (token string, info AccessToken, err error)
+	ListAccessTokens(ctx context.Context, userID string) ([]AccessToken, error)
+	RevokeAccessToken(ctx context.Context, userID, tokenID string) error
+	RegisterOAuthClient(ctx context.Context, ownerID, name string, redirectURIs []string, confidential bool) (client OAuthClient, secret string, err error)
+	ValidateOAuthAuthorization(ctx context.Context, req OAuthAuthorizationRequest) (OAuthClient, error)
+	AuthorizeOAuth(ctx context.Context, userID string, req OAuthAuthorizationRequest) (code string, err error)
+	ExchangeOAuthToken(ctx context.Context, req OAuthTokenRequest) (OAuthToken, error)
+	IntrospectOAuthToken(ctx context.Context, clientID, clientSecret, token string) (OAuthIntrospection, error)
+	RevokeOAuthToken(ctx context.Context, clientID, clientSecret, token string) error
+	BeginOIDCLogin(ctx context.Context) (OIDCAuthorization, error)
+	CompleteOIDCLogin(ctx context.Context, state, code string) (token string, err error)
+	ListUsers(ctx context.Context, query UserQuery, limit, offset int) (users []User, total int, err error)
+	SetRole(ctx context.Context, userID, role string) error
+	SetUserDisabled(ctx context.Context, userID string, disabled bool) error
+	ResetMFA(ctx context.Context, userID string) error
+	RecordAdminAction(ctx context.Context, action AdminAction) error
+	ListAdminActions(ctx context.Context, targetID string, limit, offset int) (actions []AdminAction, total int, err error)
+	ListSecurityEvents(ctx context.Context, query SecurityEventQuery, limit, offset int) (events []SecurityEvent, total int, err error)
 }
 
 type TodoService interface {
-	CreateTodo(ctx context.Context, userID, text string) (todoID string, err error)
-	ListTodos(ctx context.Context, userID string, limit, offset int) (todos []Todo, total int, err error)
+	CreateTodo(ctx context.Context, userID string, input TodoInput) (todoID string, err error)
+	GetTodo(ctx context.Context, userID, todoID string) (Todo, error)
+	ListTodos(ctx context.Context, userID string, filter TodoFilter, limit, offset int) (todos []Todo, total int, err error)
 	CompleteTodo(ctx context.Context, userID, todoID string) error
+	UpdateTodo(ctx context.Context, userID, todoID string, patch TodoPatch) (Todo, error)
+	DeleteTodo(ctx context.Context, userID, todoID string) error
+	CreateList(ctx context.Context, userID, name string) (listID string, err error)
+	ListLists(ctx context.Context, userID string) ([]List, error)
+	ListTags(ctx context.Context, userID string) ([]Tag, error)
+	ShareList(ctx context.Context, userID, listID, email, role string) (Invitation, error)
+	ListInvitations(ctx context.Context, email string) ([]Invitation, error)
+	RespondToInvitation(ctx context.Context, userID, email, invitationID string, accept bool) error
+	ListMembers(ctx context.Context, userID, listID string) ([]ListMember, error)
+	SetMemberRole(ctx context.Context, userID, listID, memberID, role string) error
+	RemoveMember(ctx context.Context, userID, listID, memberID string) error
+	AssignTodo(ctx context.Context, userID, todoID, assigneeID string) (Todo, error)
+	AddComment(ctx context.Context, userID, todoID, text string) (Comment, error)
+	EditComment(ctx context.Context, userID, todoID, commentID, text string) (Comment, error)
+	DeleteComment(ctx context.Context, userID, todoID, commentID string) error
+	ListComments(ctx context.Context, userID, todoID string, limit, offset int) (comments []Comment, total int, err error)
+	TodoActivity(ctx context.Context, userID, todoID string, limit, offset int) (activity []Activity, total int, err error)
+	TodoHistory(ctx context.Context, userID, todoID string, limit, offset int) (history []TodoChange, total int, err error)
+	RevertTodo(ctx context.Context, userID, todoID string, version int) (Todo, error)
+	MoveTodo(ctx context.Context, userID, todoID string, move TodoMove) (Todo, error)
+	GetWorkflow(ctx context.Context, userID, listID string) (Workflow, error)
+	SetWorkflow(ctx context.Context, userID, listID string, workflow Workflow) (Workflow, error)
+	TransitionTodo(ctx context.Context, userID, todoID, status string) (Todo, error)
+	ListBoard(ctx context.Context, userID, listID string) (Board, error)
+	AddBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error)
+	RemoveBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error)
+	ListNextTodos(ctx context.Context, userID string, limit, offset int) (todos []Todo, total int, err error)
+	AddAttachment(ctx context.Context, userID, todoID, name string, r io.Reader) (Attachment, error)
+	ListAttachments(ctx context.Context, userID, todoID string) ([]Attachment, error)
+	OpenAttachment(ctx context.Context, userID, todoID, attachmentID string) (Attachment, io.ReadCloser, error)
+	DeleteAttachment(ctx context.Context, userID, todoID, attachmentID string) error
+	AttachmentUsage(ctx context.Context, userID string) (used, quota int64, err error)
+	StartTimer(ctx context.Context, userID, todoID, note string) (TimeEntry, error)
+	StopTimer(ctx context.Context, userID string) (TimeEntry, error)
+	AddTimeEntry(ctx context.Context, userID, todoID string, input TimeEntryInput) (TimeEntry, error)
+	ListTimeEntries(ctx context.Context, userID, todoID string, limit, offset int) (entries []TimeEntry, total int, err error)
+	DeleteTimeEntry(ctx context.Context, userID, todoID, entryID string) error
+	TimeReport(ctx context.Context, userID string, query TimeQuery) (TimeReport, error)
+	Timesheet(ctx context.Context, userID string, query TimeQuery) ([]TimesheetEntry, error)
 }
 
 var (
@@ -38,28 +176,152 @@ var (
 	ErrEmptyEmail         = errors.New("email cannot be empty")
 	ErrEmptyPassword      = errors.New("password cannot be empty")
 	ErrEmptyText          = errors.New("todo text cannot be empty")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrListNotFound       = errors.New("list not found")
+	ErrEmptyListName      = errors.New("list name cannot be empty")
+	ErrInvalidResetToken  = errors.New("invalid or expired reset token")
+	ErrInvalidEmail       = errors.New("invalid email address")
+	ErrInvalidVerifyToken = errors.New("invalid or expired verification token")
+	ErrEmailNotVerified   = errors.New("email address not verified")
 )
 
 type user struct {
-	ID       string
-	Email    string
-	Password string
+	ID           string
+	Email        string
+	PasswordHash []byte
+	Verified     bool
+	Role         string
+	Disabled     bool
+	CreatedAt    time.Time
 }
 
 type authService struct {
-	mu      sync.RWMutex
-	users   map[string]user
-	tokens  map[string]string
-	counter int
+	mu         sync.RWMutex
+	users      map[string]user
+	emailsByID map[string]string
+	tokens     map[string]string
+	counter    int
+
+	passwordCost int
+	dummyHash    []byte
+	throttle     *loginThrottle
+
+	mailer        Mailer
+	appURL        string
+	resets        *tokenStore
+	verifications *tokenStore
+	resendAfter   time.Duration
+
+	mfaIssuer  string
+	mfa        map[string]*mfaState
+	challenges map[string]*mfaChallenge
+
+	accessTokens       map[string]*accessToken
+	accessTokensByUser map[string][]*accessToken
+	accessTokenCounter int
+
+	oauthClients       map[string]*oauthClient
+	oauthCodes         map[string]*oauthCode
+	oauthTokens        map[string]*oauthToken
+	oauthClientCounter int
+	oauthSweptAt       time.Time
+
+	oidc           *oidcProvider
+	oidcLogins     map[string]*oidcLogin
+	oidcIdentities map[string]string
+
+	adminEmails        map[string]bool
+	adminActions       []AdminAction
+	adminActionCounter int
+}
+
+// AuthOption configures the AuthService returned by NewAuthService.
+type AuthOption func(*authService)
+
+// WithLoginThrottle replaces DefaultLoginThrottleConfig.
+func WithLoginThrottle(config LoginThrottleConfig) AuthOption {
+	return func(s *authService) {
+		s.throttle.config = config
+	}
+}
+
+// WithLoginEventHook calls hook for every failed login and lockout. It is
+// called synchronously and must not block.
+func WithLoginEventHook(hook func(LoginEvent)) AuthOption {
+	return func(s *authService) {
+		s.throttle.hook = hook
+	}
+}
+
+// WithPasswordCost sets the bcrypt cost of password hashes.
+func WithPasswordCost(cost int) AuthOption {
+	return func(s *authService) {
+		s.passwordCost = cost
+	}
+}
+
+// WithMailer sets the Mailer used for password reset and verification mail.
+// appURL is the address of the client; mailed links point to its
+// /reset-password and /verify-email pages with the token as the token query
+// parameter.
+func WithMailer(mailer Mailer, appURL string) AuthOption {
+	return func(s *authService) {
+		s.mailer = mailer
+		s.appURL = appURL
+	}
+}
+
+// WithMFAIssuer sets the issuer shown by authenticator apps next to the
+// account. It defaults to "auth_todo".
+func WithMFAIssuer(issuer string) AuthOption {
+	return func(s *authService) {
+		s.mfaIssuer = issuer
+	}
 }
 
-func NewAuthService() AuthService {
-	return &authService{
-		users:  make(map[string]user),
-		tokens: make(map[string]string),
+// WithOIDC enables login through an OpenID Connect identity provider.
+func WithOIDC(config OIDCConfig) AuthOption {
+	return func(s *authService) {
+		s.oidc = newOIDCProvider(config)
 	}
 }
 
+func NewAuthService(options ...AuthOption) AuthService {
+	s := &authService{
+		users:         make(map[string]user),
+		emailsByID:    make(map[string]string),
+		tokens:        make(map[string]string),
+		passwordCost:  bcrypt.DefaultCost,
+		throttle:      newLoginThrottle(DefaultLoginThrottleConfig()),
+		mailer:        discardMailer{},
+		resets:        newTokenStore(time.Hour),
+		verifications: newTokenStore(24 * time.Hour),
+		resendAfter:   time.Minute,
+		mfaIssuer:     "auth_todo",
+		mfa:           make(map[string]*mfaState),
+		challenges:    make(map[string]*mfaChallenge),
+
+		accessTokens:       make(map[string]*accessToken),
+		accessTokensByUser: make(map[string][]*accessToken),
+
+		oauthClients: make(map[string]*oauthClient),
+		oauthCodes:   make(map[string]*oauthCode),
+		oauthTokens:  make(map[string]*oauthToken),
+
+		oidcLogins:     make(map[string]*oidcLogin),
+		oidcIdentities: make(map[string]string),
+
+		adminEmails: make(map[string]bool),
+	}
+	for _, option := range options {
+		option(s)
+	}
+	// Logins for unknown emails are checked against this hash so that they
+	// take as long as logins for existing accounts.
+	s.dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), s.passwordCost)
+	return s
+}
+
 func (s *authService) Signup(ctx context.Context, email, password string) (string, error) {
 	if email == "" {
 		return "", ErrEmptyEmail
@@ -67,100 +329,287 @@ func (s *authService) Signup(ctx context.Context, email, password string) (strin
 	if password == "" {
 		return "", ErrEmptyPassword
 	}
+	if err := validateEmail(email); err != nil {
+		return "", err
+	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.passwordCost)
+	if err != nil {
+		return "", err
+	}
 
+	s.mu.Lock()
 	if _, exists := s.users[email]; exists {
+		s.mu.Unlock()
 		return "", ErrUserExists
 	}
 
 	s.counter++
-	userID := fmt.Sprintf("user_%d", s.counter)
-	s.users[email] = user{
-		ID:       userID,
-		Email:    email,
-		Password: password,
+	u := user{
+		ID:           fmt.Sprintf("user_%d", s.counter),
+		Email:        email,
+		PasswordHash: hash,
+		CreatedAt:    time.Now(),
 	}
+	s.users[email] = u
+	s.emailsByID[u.ID] = email
+	s.mu.Unlock()
 
-	return userID, nil
+	if err := s.sendVerification(u); err != nil {
+		return "", err
+	}
+	return u.ID, nil
 }
 
 func (s *authService) Login(ctx context.Context, email, password string) (string, error) {
+	u, err := s.checkPassword(ctx, email, password)
+	if err != nil {
+		return "", err
+	}
+
+	// With a second factor, failures are only cleared once the login is
+	// completed, so that wrong codes keep counting towards a lockout.
+	ip := ClientIPFromContext(ctx)
+	s.mu.Lock()
+	if s.mfaEnabled(u.ID) {
+		err = s.newMFAChallenge(u.ID)
+		s.mu.Unlock()
+		s.throttle.release(email, ip)
+		return "", err
+	}
+	token, err := s.newSession(u.ID)
+	s.mu.Unlock()
+	if err != nil {
+		s.throttle.release(email, ip)
+		return "", err
+	}
+
+	s.throttle.succeed(email, ip)
+	return token, nil
+}
+
+// checkPassword returns the account of email if password is right and the
+// account is enabled. Wrong passwords count as failed logins; a right one
+// leaves the attempt reserved for the caller to settle with the throttle.
+func (s *authService) checkPassword(ctx context.Context, email, password string) (user, error) {
 	if email == "" {
-		return "", ErrEmptyEmail
+		return user{}, ErrEmptyEmail
 	}
 	if password == "" {
-		return "", ErrEmptyPassword
+		return user{}, ErrEmptyPassword
+	}
+
+	ip := ClientIPFromContext(ctx)
+	if err := s.throttle.reserve(email, ip); err != nil {
+		return user{}, err
 	}
 
 	s.mu.RLock()
 	u, exists := s.users[email]
 	s.mu.RUnlock()
 
-	if !exists || u.Password != password {
-		return "", ErrInvalidCredentials
+	hash := s.dummyHash
+	if exists {
+		hash = u.PasswordHash
+		setAuditSubject(ctx, u.ID)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !exists {
+		s.throttle.fail(email, ip)
+		return user{}, ErrInvalidCredentials
 	}
 
-	token := fmt.Sprintf("token_%s_%d", u.ID, time.Now().Unix())
+	if u.Disabled {
+		s.throttle.release(email, ip)
+		return user{}, ErrAccountDisabled
+	}
+	return u, nil
+}
 
+// VerifyCredentials checks the password of an account and, if it has a
+// second factor, code, without starting a session. It returns
+// ErrMFARequired when the account needs a code and none was given. Failures
+// count as failed logins.
+func (s *authService) VerifyCredentials(ctx context.Context, email, password, code string) (string, error) {
+	u, err := s.checkPassword(ctx, email, password)
+	if err != nil {
+		return "", err
+	}
+
+	ip := ClientIPFromContext(ctx)
 	s.mu.Lock()
-	s.tokens[token] = u.ID
+	if s.mfaEnabled(u.ID) {
+		if code == "" {
+			s.mu.Unlock()
+			s.throttle.release(email, ip)
+			return "", ErrMFARequired
+		}
+		if !s.checkMFACode(u.ID, code) {
+			s.mu.Unlock()
+			s.throttle.fail(email, ip)
+			return "", ErrInvalidMFACode
+		}
+	}
 	s.mu.Unlock()
 
+	s.throttle.succeed(email, ip)
+	return u.ID, nil
+}
+
+// newSession issues a random session token, which is stored by its hash.
+// It must be called with s.mu held.
+func (s *authService) newSession(userID string) (string, error) {
+	token, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	s.tokens[hashToken(token)] = userID
 	return token, nil
 }
 
+// ValidateToken accepts session tokens and personal access tokens.
 func (s *authService) ValidateToken(ctx context.Context, token string) (string, error) {
+	credentials, err := s.Authenticate(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	return credentials.UserID, nil
+}
+
+func (s *authService) GetUser(ctx context.Context, userID string) (User, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	userID, exists := s.tokens[token]
+	email, exists := s.emailsByID[userID]
 	if !exists {
-		return "", ErrInvalidToken
+		return User{}, ErrUserNotFound
 	}
 
-	return userID, nil
+	return s.publicUser(s.users[email]), nil
+}
+
+// UnlockAccount clears the failed logins and any lockout of the account.
+// Lockouts of client IPs are left to expire.
+func (s *authService) UnlockAccount(ctx context.Context, email string) error {
+	s.mu.RLock()
+	_, exists := s.users[email]
+	s.mu.RUnlock()
+
+	if !exists {
+		return ErrUserNotFound
+	}
+	s.throttle.unlock(email)
+	return nil
 }
 
+// todoService keeps the todos of each user in todosByUser under their
+// creator, who keeps full access to them. Lists shared with other users
+// give their members access to the todos in the list by role.
 type todoService struct {
-	mu          sync.RWMutex
-	todosByUser map[string][]Todo
-	todosById   map[string]Todo
-	counter     int
+	mu                sync.RWMutex
+	todosByUser       map[string][]Todo
+	todosById         map[string]Todo
+	lists             map[string]List
+	members           map[string]map[string]ListMember
+	invitations       map[string]Invitation
+	comments          map[string][]Comment
+	activity          map[string][]Activity
+	history           map[string][]TodoChange
+	workflows         map[string]Workflow
+	attachments       map[string][]Attachment
+	attachmentUsage   map[string]int64
+	timeEntries       map[string][]TimeEntry
+	timers            map[string]TimeEntry
+	counter           int
+	listCounter       int
+	invitationCounter int
+	commentCounter    int
+	attachmentCounter int
+	timeEntryCounter  int
+	invitationHook    func(Invitation)
+	blobs             BlobStore
+	attachmentQuota   int64
+	rankSpaces        map[rankScope]*rankSpace
+	blockedCompletion bool
 }
 
-func NewTodoService() TodoService {
-	return &todoService{
-		todosByUser: make(map[string][]Todo),
-		todosById:   make(map[string]Todo),
+func NewTodoService(options ...TodoOption) TodoService {
+	s := &todoService{
+		todosByUser:     make(map[string][]Todo),
+		todosById:       make(map[string]Todo),
+		lists:           make(map[string]List),
+		members:         make(map[string]map[string]ListMember),
+		invitations:     make(map[string]Invitation),
+		comments:        make(map[string][]Comment),
+		activity:        make(map[string][]Activity),
+		history:         make(map[string][]TodoChange),
+		workflows:       make(map[string]Workflow),
+		attachments:     make(map[string][]Attachment),
+		attachmentUsage: make(map[string]int64),
+		timeEntries:     make(map[string][]TimeEntry),
+		timers:          make(map[string]TimeEntry),
+		rankSpaces:      make(map[rankScope]*rankSpace),
+	}
+	for _, option := range options {
+		option(s)
 	}
+	return s
 }
 
-func (s *todoService) CreateTodo(ctx context.Context, userID, text string) (string, error) {
-	if text == "" {
+func (s *todoService) CreateTodo(ctx context.Context, userID string, input TodoInput) (string, error) {
+	if input.Text == "" {
 		return "", ErrEmptyText
 	}
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if input.ListID != "" {
+		list, exists := s.lists[input.ListID]
+		if !exists {
+			return "", ErrListNotFound
+		}
+		if !canEdit(s.listRole(list, userID)) {
+			return "", ErrUnauthorized
+		}
+	}
+
 	s.counter++
 	todoID := fmt.Sprintf("todo_%d", s.counter)
 	todo := Todo{
 		ID:        todoID,
 		UserID:    userID,
-		Text:      text,
+		ListID:    input.ListID,
+		Text:      input.Text,
+		Tags:      normalizeTags(input.Tags),
 		Completed: false,
+		Rank:      s.nextRank(ctx, userID, rankScopeOf(Todo{UserID: userID, ListID: input.ListID})),
 		CreatedAt: time.Now(),
 	}
+	s.fitStatus(&todo)
 	s.todosById[todoID] = todo
 	s.todosByUser[userID] = append(s.todosByUser[userID], todo)
+	s.record(todo, userID, TodoCreated)
 
 	return todoID, nil
 }
 
-func (s *todoService) ListTodos(ctx context.Context, userID string, limit, offset int) ([]Todo, int, error) {
+func (s *todoService) GetTodo(ctx context.Context, userID, todoID string) (Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return Todo{}, ErrTodoNotFound
+	}
+
+	if s.todoRole(todo, userID) == "" {
+		return Todo{}, ErrUnauthorized
+	}
+
+	return todo, nil
+}
+
+func (s *todoService) ListTodos(ctx context.Context, userID string, filter TodoFilter, limit, offset int) ([]Todo, int, error) {
 	if limit <= 0 {
 		limit = 50
 	}
@@ -172,18 +621,33 @@ func (s *todoService) ListTodos(ctx context.Context, userID string, limit, offse
 	}
 
 	s.mu.RLock()
-	userTodos, exists := s.todosByUser[userID]
-	if !exists || len(userTodos) == 0 {
-		s.mu.RUnlock()
-		return []Todo{}, 0, nil
+	allTodos := []Todo{}
+	if !filter.SharedWithMe {
+		for _, t := range s.todosByUser[userID] {
+			if s.todoRole(t, userID) != "" && filter.matches(t, userID) {
+				allTodos = append(allTodos, t)
+			}
+		}
+	}
+	if shared := s.accessibleLists(userID, filter.SharedWithMe); len(shared) > 0 {
+		for _, t := range s.todosById {
+			if t.UserID != userID && shared[t.ListID] && filter.matches(t, userID) {
+				allTodos = append(allTodos, t)
+			}
+		}
 	}
-	allTodos := make([]Todo, len(userTodos))
-	copy(allTodos, userTodos)
 	s.mu.RUnlock()
 
-	sort.Slice(allTodos, func(i, j int) bool {
-		return allTodos[i].CreatedAt.After(allTodos[j].CreatedAt)
-	})
+	if filter.Sort == TodoSortManual {
+		sortByRank(allTodos)
+	} else {
+		sort.Slice(allTodos, func(i, j int) bool {
+			if !allTodos[i].CreatedAt.Equal(allTodos[j].CreatedAt) {
+				return allTodos[i].CreatedAt.After(allTodos[j].CreatedAt)
+			}
+			return allTodos[i].ID > allTodos[j].ID
+		})
+	}
 
 	total := len(allTodos)
 
@@ -209,21 +673,245 @@ func (s *todoService) CompleteTodo(ctx context.Context, userID, todoID string) e
 		return ErrTodoNotFound
 	}
 
-	if todo.UserID != userID {
+	if !canEdit(s.todoRole(todo, userID)) {
 		return ErrUnauthorized
 	}
+	if !s.canComplete(todo) {
+		return ErrTodoBlocked
+	}
 
+	todo.Status = s.workflow(todo.ListID).terminal()
 	todo.Completed = true
-	s.todosById[todoID] = todo
-	
-	userTodos := s.todosByUser[userID]
+	s.storeTodo(todo)
+	s.record(todo, userID, TodoCompleted)
+
+	return nil
+}
+
+func (s *todoService) UpdateTodo(ctx context.Context, userID, todoID string, patch TodoPatch) (Todo, error) {
+	if patch.Text != nil && *patch.Text == "" {
+		return Todo{}, ErrEmptyText
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return Todo{}, ErrTodoNotFound
+	}
+
+	if !canEdit(s.todoRole(todo, userID)) {
+		return Todo{}, ErrUnauthorized
+	}
+
+	if patch.ListID != nil && *patch.ListID != todo.ListID && !s.canMove(todo, userID) {
+		return Todo{}, ErrUnauthorized
+	}
+	if patch.ListID != nil && *patch.ListID != "" {
+		list, exists := s.lists[*patch.ListID]
+		if !exists {
+			return Todo{}, ErrListNotFound
+		}
+		if !canEdit(s.listRole(list, userID)) {
+			return Todo{}, ErrUnauthorized
+		}
+	}
+
+	if patch.Text != nil {
+		todo.Text = *patch.Text
+	}
+	if patch.ListID != nil && *patch.ListID != todo.ListID {
+		todo.ListID = *patch.ListID
+		todo.Rank = s.nextRank(ctx, userID, rankScopeOf(todo))
+		if todo.AssigneeID != "" && !canEdit(s.todoRole(todo, todo.AssigneeID)) {
+			todo.AssigneeID = ""
+		}
+		s.fitStatus(&todo)
+	}
+	if patch.Tags != nil {
+		todo.Tags = normalizeTags(*patch.Tags)
+	}
+	s.storeTodo(todo)
+	s.record(todo, userID, TodoUpdated)
+
+	return todo, nil
+}
+
+func (s *todoService) DeleteTodo(ctx context.Context, userID, todoID string) error {
+	// The blobs of the attachments are deleted once s.mu is released.
+	var blobKeys []string
+	defer func() { s.deleteBlobs(ctx, blobKeys) }()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return ErrTodoNotFound
+	}
+
+	if !canEdit(s.todoRole(todo, userID)) {
+		return ErrUnauthorized
+	}
+
+	delete(s.todosById, todoID)
+	delete(s.comments, todoID)
+	delete(s.activity, todoID)
+	s.appendHistory(todo, userID, TodoDeleted)
+	s.dropDependencies(todo)
+	blobKeys = s.dropAttachments(todoID)
+	s.dropTimeEntries(todoID)
+
+	userTodos := s.todosByUser[todo.UserID]
 	for i, t := range userTodos {
 		if t.ID == todoID {
-			userTodos[i].Completed = true
-			s.todosByUser[userID] = userTodos
+			s.todosByUser[todo.UserID] = append(userTodos[:i:i], userTodos[i+1:]...)
 			break
 		}
 	}
 
 	return nil
 }
+
+// storeTodo saves a changed todo, and updates whether the todos it blocks
+// are blocked when it is completed or reopened. It must be called with s.mu
+// held.
+func (s *todoService) storeTodo(todo Todo) {
+	previous := s.todosById[todo.ID]
+	s.todosById[todo.ID] = todo
+	if todo.Completed != previous.Completed {
+		for _, id := range todo.Blocking {
+			s.refreshBlocked(id)
+		}
+	}
+
+	userTodos := s.todosByUser[todo.UserID]
+	for i, t := range userTodos {
+		if t.ID == todo.ID {
+			userTodos[i] = todo
+			break
+		}
+	}
+}
+
+func (s *todoService) CreateList(ctx context.Context, userID, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrEmptyListName
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.listCounter++
+	listID := fmt.Sprintf("list_%d", s.listCounter)
+	s.lists[listID] = List{
+		ID:        listID,
+		UserID:    userID,
+		Name:      name,
+		CreatedAt: time.Now(),
+	}
+
+	return listID, nil
+}
+
+func (s *todoService) ListLists(ctx context.Context, userID string) ([]List, error) {
+	s.mu.RLock()
+	lists := []List{}
+	for _, l := range s.lists {
+		if l.Role = s.listRole(l, userID); l.Role != "" {
+			lists = append(lists, l)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(lists, func(i, j int) bool {
+		return lists[i].CreatedAt.Before(lists[j].CreatedAt)
+	})
+
+	return lists, nil
+}
+
+func (s *todoService) ListTags(ctx context.Context, userID string) ([]Tag, error) {
+	s.mu.RLock()
+	counts := make(map[string]int)
+	for _, t := range s.todosByUser[userID] {
+		if s.todoRole(t, userID) == "" {
+			continue
+		}
+		for _, tag := range t.Tags {
+			counts[tag]++
+		}
+	}
+	if shared := s.accessibleLists(userID, false); len(shared) > 0 {
+		for _, t := range s.todosById {
+			if t.UserID != userID && shared[t.ListID] {
+				for _, tag := range t.Tags {
+					counts[tag]++
+				}
+			}
+		}
+	}
+	s.mu.RUnlock()
+
+	tags := make([]Tag, 0, len(counts))
+	for name, count := range counts {
+		tags = append(tags, Tag{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags, nil
+}
+
+// matches reports whether t matches the filter when listed for userID.
+func (f TodoFilter) matches(t Todo, userID string) bool {
+	if f.Completed != nil && t.Completed != *f.Completed {
+		return false
+	}
+	if f.AssignedToMe && t.AssigneeID != userID {
+		return false
+	}
+	if len(f.ListIDs) > 0 && !containsString(f.ListIDs, t.ListID) {
+		return false
+	}
+	if f.Tag != "" && !containsString(t.Tags, strings.ToLower(f.Tag)) {
+		return false
+	}
+	if f.Search != "" && !strings.Contains(strings.ToLower(t.Text), strings.ToLower(f.Search)) {
+		return false
+	}
+	return true
+}
+
+// key returns a stable representation of the filter for use in cache keys.
+func (f TodoFilter) key() string {
+	completed := ""
+	if f.Completed != nil {
+		completed = strconv.FormatBool(*f.Completed)
+	}
+	return fmt.Sprintf("%s|%s|%s|%s|%t|%t|%s", completed, strings.Join(f.ListIDs, ","), f.Tag, f.Search, f.SharedWithMe, f.AssignedToMe, f.Sort)
+}
+
+// normalizeTags lower-cases, trims and de-duplicates tags.
+func normalizeTags(tags []string) []string {
+	out := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !containsString(out, tag) {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
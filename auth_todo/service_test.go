@@ -2,6 +2,7 @@ package auth_todo
 
 import (
 	"context"
+	"strings"
 	"testing"
 )
 
@@ -32,6 +33,12 @@ func TestAuthService(t *testing.T) {
 	if token == "" {
 		t.Fatal("Expected non-empty token")
 	}
+	if _, stored := svc.(*authService).tokens[hashToken(token)]; !stored || strings.Contains(token, userID) {
+		t.Errorf("Expected a random session token stored by its hash, got %q", token)
+	}
+	if again, _ := svc.Login(ctx, "test@example.com", "password123"); again == token {
+		t.Error("Expected every login to get its own session token")
+	}
 
 	// Test invalid login
 	_, err = svc.Login(ctx, "test@example.com", "wrongpassword")
@@ -61,7 +68,7 @@ func TestTodoService(t *testing.T) {
 	userID := "user_1"
 
 	// Test CreateTodo
-	todoID, err := svc.CreateTodo(ctx, userID, "Buy groceries")
+	todoID, err := svc.CreateTodo(ctx, userID, TodoInput{Text: "Buy groceries"})
 	if err != nil {
 		t.Fatalf("CreateTodo failed: %v", err)
 	}
@@ -70,7 +77,7 @@ func TestTodoService(t *testing.T) {
 	}
 
 	// Test ListTodos
-	todos, total, err := svc.ListTodos(ctx, userID, 50, 0)
+	todos, total, err := svc.ListTodos(ctx, userID, TodoFilter{}, 50, 0)
 	if err != nil {
 		t.Fatalf("ListTodos failed: %v", err)
 	}
@@ -91,7 +98,7 @@ func TestTodoService(t *testing.T) {
 	}
 
 	// Verify completion
-	todos, _, _ = svc.ListTodos(ctx, userID, 50, 0)
+	todos, _, _ = svc.ListTodos(ctx, userID, TodoFilter{}, 50, 0)
 	if !todos[0].Completed {
 		t.Fatal("Expected todo to be completed")
 	}
@@ -108,3 +115,53 @@ func TestTodoService(t *testing.T) {
 		t.Fatalf("Expected ErrTodoNotFound, got: %v", err)
 	}
 }
+
+func TestTodoServiceListsAndFilters(t *testing.T) {
+	svc := NewTodoService()
+	ctx := context.Background()
+	userID := "user_1"
+
+	listID, err := svc.CreateList(ctx, userID, "Groceries")
+	if err != nil {
+		t.Fatalf("CreateList failed: %v", err)
+	}
+
+	// Test CreateTodo in a list owned by someone else
+	_, err = svc.CreateTodo(ctx, "different_user", TodoInput{Text: "Sneaky", ListID: listID})
+	if err != ErrUnauthorized {
+		t.Fatalf("Expected ErrUnauthorized, got: %v", err)
+	}
+
+	milkID, _ := svc.CreateTodo(ctx, userID, TodoInput{Text: "Buy milk", ListID: listID, Tags: []string{"Dairy", "dairy ", "urgent"}})
+	svc.CreateTodo(ctx, userID, TodoInput{Text: "Call mom"})
+
+	todo, err := svc.GetTodo(ctx, userID, milkID)
+	if err != nil {
+		t.Fatalf("GetTodo failed: %v", err)
+	}
+	if len(todo.Tags) != 2 || todo.Tags[0] != "dairy" {
+		t.Fatalf("Expected normalized tags [dairy urgent], got %v", todo.Tags)
+	}
+
+	todos, total, _ := svc.ListTodos(ctx, userID, TodoFilter{ListIDs: []string{listID}}, 50, 0)
+	if total != 1 || todos[0].ID != milkID {
+		t.Fatalf("Expected only %s in list, got %v", milkID, todos)
+	}
+
+	_, total, _ = svc.ListTodos(ctx, userID, TodoFilter{Search: "MOM"}, 50, 0)
+	if total != 1 {
+		t.Fatalf("Expected 1 search match, got %d", total)
+	}
+
+	svc.CompleteTodo(ctx, userID, milkID)
+	open := false
+	_, total, _ = svc.ListTodos(ctx, userID, TodoFilter{Completed: &open}, 50, 0)
+	if total != 1 {
+		t.Fatalf("Expected 1 open todo, got %d", total)
+	}
+
+	tags, _ := svc.ListTags(ctx, userID)
+	if len(tags) != 2 || tags[0] != (Tag{Name: "dairy", Count: 1}) {
+		t.Fatalf("Unexpected tags: %v", tags)
+	}
+}
@@ -0,0 +1,350 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	ListRoleViewer = "viewer"
+	ListRoleEditor = "editor"
+	ListRoleOwner  = "owner"
+)
+
+// invitationTTL is how long an invitation can be accepted.
+const invitationTTL = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidListRole    = errors.New("role must be viewer, editor or owner")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrAlreadyMember      = errors.New("user is already a member of the list")
+	ErrMemberNotFound     = errors.New("member not found")
+	ErrListCreator        = errors.New("the creator of a list cannot be removed or demoted")
+)
+
+var listRoles = map[string]int{
+	ListRoleViewer: 1,
+	ListRoleEditor: 2,
+	ListRoleOwner:  3,
+}
+
+// Invitation invites the owner of Email to collaborate on a list with Role.
+type Invitation struct {
+	ID        string
+	ListID    string
+	ListName  string
+	InviterID string
+	Email     string
+	Role      string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// ListMember is a user a list is shared with. The creator of a list is
+// always one of its owners.
+type ListMember struct {
+	UserID  string
+	Email   string `json:",omitempty"`
+	Role    string
+	AddedAt time.Time
+}
+
+// TodoOption configures the TodoService returned by NewTodoService.
+type TodoOption func(*todoService)
+
+// WithInvitationHook calls hook for every new invitation, e.g. to mail it.
+// It is called synchronously and must not block.
+func WithInvitationHook(hook func(Invitation)) TodoOption {
+	return func(s *todoService) {
+		s.invitationHook = hook
+	}
+}
+
+// InvitationMailer returns a hook for WithInvitationHook that mails
+// invitations. The mail links to the /invitations page of appURL.
+func InvitationMailer(mailer Mailer, appURL string) func(Invitation) {
+	return func(inv Invitation) {
+		mail := Mail{
+			To:      inv.Email,
+			Subject: fmt.Sprintf("You are invited to the list %q", inv.ListName),
+			Body: fmt.Sprintf("You were invited to collaborate on the list %q as %s. Sign in with this "+
+				"email address to accept or decline within %s:\n\n%s\n",
+				inv.ListName, inv.Role, invitationTTL, link(appURL, "invitations", inv.ID)),
+		}
+		go mailer.Send(context.Background(), mail)
+	}
+}
+
+// listRole returns the role of userID in list, or "" if it is not shared
+// with them. It must be called with s.mu held.
+func (s *todoService) listRole(list List, userID string) string {
+	if list.UserID == userID {
+		return ListRoleOwner
+	}
+	return s.members[list.ID][userID].Role
+}
+
+// todoRole returns the role of userID for todo: their role in its list, or
+// owner for the creator of a todo outside any list. Creators of todos in a
+// list keep no rights once they leave it. It must be called with s.mu held.
+func (s *todoService) todoRole(todo Todo, userID string) string {
+	if todo.ListID == "" {
+		if todo.UserID == userID {
+			return ListRoleOwner
+		}
+		return ""
+	}
+	return s.listRole(s.lists[todo.ListID], userID)
+}
+
+// canMove reports whether userID may move todo to another list. Only its
+// creator and the owners of its list may, so that editors cannot take todos
+// away from them. It must be called with s.mu held.
+func (s *todoService) canMove(todo Todo, userID string) bool {
+	return todo.UserID == userID || s.todoRole(todo, userID) == ListRoleOwner
+}
+
+func canEdit(role string) bool {
+	return listRoles[role] >= listRoles[ListRoleEditor]
+}
+
+// accessibleLists returns the IDs of the lists userID may read. It must be
+// called with s.mu held.
+func (s *todoService) accessibleLists(userID string, sharedOnly bool) map[string]bool {
+	ids := make(map[string]bool)
+	for id, list := range s.lists {
+		if list.UserID == userID {
+			if !sharedOnly {
+				ids[id] = true
+			}
+		} else if _, member := s.members[id][userID]; member {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// ShareList invites the user with email to the list. Only owners may
+// share a list; inviting an address again replaces its pending invitation.
+func (s *todoService) ShareList(ctx context.Context, userID, listID, email, role string) (Invitation, error) {
+	if _, valid := listRoles[role]; !valid {
+		return Invitation{}, ErrInvalidListRole
+	}
+	email = strings.TrimSpace(email)
+	if err := validateEmail(email); err != nil {
+		return Invitation{}, err
+	}
+
+	s.mu.Lock()
+	list, exists := s.lists[listID]
+	if !exists {
+		s.mu.Unlock()
+		return Invitation{}, ErrListNotFound
+	}
+	if s.listRole(list, userID) != ListRoleOwner {
+		s.mu.Unlock()
+		return Invitation{}, ErrUnauthorized
+	}
+
+	for id, inv := range s.invitations {
+		if inv.ListID == listID && strings.EqualFold(inv.Email, email) {
+			delete(s.invitations, id)
+		}
+	}
+	s.invitationCounter++
+	now := time.Now()
+	inv := Invitation{
+		ID:        fmt.Sprintf("invitation_%d", s.invitationCounter),
+		ListID:    listID,
+		ListName:  list.Name,
+		InviterID: userID,
+		Email:     email,
+		Role:      role,
+		CreatedAt: now,
+		ExpiresAt: now.Add(invitationTTL),
+	}
+	s.invitations[inv.ID] = inv
+	s.mu.Unlock()
+
+	if s.invitationHook != nil {
+		s.invitationHook(inv)
+	}
+	return inv, nil
+}
+
+// ListInvitations returns the pending invitations for email, oldest first.
+func (s *todoService) ListInvitations(ctx context.Context, email string) ([]Invitation, error) {
+	now := time.Now()
+
+	s.mu.RLock()
+	invitations := []Invitation{}
+	for _, inv := range s.invitations {
+		if strings.EqualFold(inv.Email, email) && now.Before(inv.ExpiresAt) {
+			invitations = append(invitations, inv)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(invitations, func(i, j int) bool {
+		return invitations[i].CreatedAt.Before(invitations[j].CreatedAt)
+	})
+	return invitations, nil
+}
+
+// RespondToInvitation accepts or declines an invitation for email on behalf
+// of userID, whose verified address it must be. Either way the invitation
+// is used up.
+func (s *todoService) RespondToInvitation(ctx context.Context, userID, email, invitationID string, accept bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	inv, exists := s.invitations[invitationID]
+	if !exists || !strings.EqualFold(inv.Email, email) || !time.Now().Before(inv.ExpiresAt) {
+		return ErrInvitationNotFound
+	}
+	list, exists := s.lists[inv.ListID]
+	if !exists {
+		delete(s.invitations, invitationID)
+		return ErrListNotFound
+	}
+	if accept && s.listRole(list, userID) != "" {
+		return ErrAlreadyMember
+	}
+
+	delete(s.invitations, invitationID)
+	if !accept {
+		return nil
+	}
+	if s.members[list.ID] == nil {
+		s.members[list.ID] = make(map[string]ListMember)
+	}
+	s.members[list.ID][userID] = ListMember{UserID: userID, Role: inv.Role, AddedAt: time.Now()}
+	return nil
+}
+
+// ListMembers returns the creator and the members of a list, to anyone it
+// is shared with.
+func (s *todoService) ListMembers(ctx context.Context, userID, listID string) ([]ListMember, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, exists := s.lists[listID]
+	if !exists {
+		return nil, ErrListNotFound
+	}
+	if s.listRole(list, userID) == "" {
+		return nil, ErrUnauthorized
+	}
+
+	members := []ListMember{{UserID: list.UserID, Role: ListRoleOwner, AddedAt: list.CreatedAt}}
+	for _, m := range s.members[listID] {
+		members = append(members, m)
+	}
+	sort.SliceStable(members[1:], func(i, j int) bool {
+		return members[i+1].AddedAt.Before(members[j+1].AddedAt)
+	})
+	return members, nil
+}
+
+// SetMemberRole changes the role of a member. Only owners may change roles;
+// demoting a member to viewer unassigns their todos in the list.
+func (s *todoService) SetMemberRole(ctx context.Context, userID, listID, memberID, role string) error {
+	if _, valid := listRoles[role]; !valid {
+		return ErrInvalidListRole
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, exists := s.lists[listID]
+	if !exists {
+		return ErrListNotFound
+	}
+	if s.listRole(list, userID) != ListRoleOwner {
+		return ErrUnauthorized
+	}
+	if memberID == list.UserID {
+		return ErrListCreator
+	}
+	member, exists := s.members[listID][memberID]
+	if !exists {
+		return ErrMemberNotFound
+	}
+	member.Role = role
+	s.members[listID][memberID] = member
+	s.unassignLostAccess(userID, listID)
+	return nil
+}
+
+// RemoveMember stops sharing a list with a member. Owners may remove
+// anyone but the creator, and members may remove themselves to leave.
+// Todos assigned to the member in the list are unassigned.
+func (s *todoService) RemoveMember(ctx context.Context, userID, listID, memberID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, exists := s.lists[listID]
+	if !exists {
+		return ErrListNotFound
+	}
+	if memberID != userID && s.listRole(list, userID) != ListRoleOwner {
+		return ErrUnauthorized
+	}
+	if memberID == list.UserID {
+		return ErrListCreator
+	}
+	if _, exists := s.members[listID][memberID]; !exists {
+		return ErrMemberNotFound
+	}
+	delete(s.members[listID], memberID)
+	s.unassignLostAccess(userID, listID)
+	return nil
+}
+
+// todoAudience returns who sees changes to todos made by userID: the actor,
+// the creators of todos outside any list and the members of the lists of the
+// others.
+func todoAudience(ctx context.Context, svc TodoService, userID string, todos ...Todo) []string {
+	seen := map[string]bool{userID: true}
+	audience := []string{userID}
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			audience = append(audience, id)
+		}
+	}
+	for _, todo := range todos {
+		if todo.ListID == "" {
+			add(todo.UserID)
+			continue
+		}
+		members, err := svc.ListMembers(ctx, userID, todo.ListID)
+		if err != nil {
+			continue
+		}
+		for _, m := range members {
+			add(m.UserID)
+		}
+	}
+	return audience
+}
+
+// listAudience returns who sees changes to the members of a list made by
+// userID: the actor and every member of the list.
+func listAudience(ctx context.Context, svc TodoService, userID, listID string) []string {
+	audience := []string{userID}
+	members, err := svc.ListMembers(ctx, userID, listID)
+	if err != nil {
+		return audience
+	}
+	for _, m := range members {
+		if m.UserID != userID {
+			audience = append(audience, m.UserID)
+		}
+	}
+	return audience
+}
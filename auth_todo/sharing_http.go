@@ -0,0 +1,255 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+type shareListRequest struct {
+	ListID string `json:"-"`
+	Email  string `json:"email"`
+	Role   string `json:"role"`
+}
+
+type shareListResponse struct {
+	Invitation *Invitation `json:"invitation,omitempty"`
+	Err        string      `json:"error,omitempty"`
+}
+
+func makeShareListEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(shareListRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		inv, err := svc.ShareList(ctx, userID, req.ListID, req.Email, req.Role)
+		if err != nil {
+			return shareListResponse{Err: err.Error()}, nil
+		}
+		return shareListResponse{Invitation: &inv}, nil
+	}
+}
+
+type listMembersRequest struct {
+	ListID string `json:"-"`
+}
+
+type listMembersResponse struct {
+	Members []ListMember `json:"members,omitempty"`
+	Err     string       `json:"error,omitempty"`
+}
+
+// makeListMembersEndpoint lists the members of a list with their email
+// addresses, which the todo service does not know.
+func makeListMembersEndpoint(authSvc AuthService, todoSvc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listMembersRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		members, err := todoSvc.ListMembers(ctx, userID, req.ListID)
+		if err != nil {
+			return listMembersResponse{Err: err.Error()}, nil
+		}
+		for i, m := range members {
+			if u, err := authSvc.GetUser(ctx, m.UserID); err == nil {
+				members[i].Email = u.Email
+			}
+		}
+		return listMembersResponse{Members: members}, nil
+	}
+}
+
+type setMemberRoleRequest struct {
+	ListID   string `json:"-"`
+	MemberID string `json:"-"`
+	Role     string `json:"role"`
+}
+
+type memberResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeSetMemberRoleEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(setMemberRoleRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		if err := svc.SetMemberRole(ctx, userID, req.ListID, req.MemberID, req.Role); err != nil {
+			return memberResponse{Err: err.Error()}, nil
+		}
+		return memberResponse{}, nil
+	}
+}
+
+type removeMemberRequest struct {
+	ListID   string `json:"-"`
+	MemberID string `json:"-"`
+}
+
+func makeRemoveMemberEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(removeMemberRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		if err := svc.RemoveMember(ctx, userID, req.ListID, req.MemberID); err != nil {
+			return memberResponse{Err: err.Error()}, nil
+		}
+		return memberResponse{}, nil
+	}
+}
+
+// verifiedEmail returns the email address of the authenticated user. Only
+// verified addresses can see and accept invitations, so that nobody can
+// join a list by signing up with someone else's address.
+func verifiedEmail(ctx context.Context, svc AuthService) (userID, email string, err error) {
+	userID, ok := UserIDFromContext(ctx)
+	if !ok {
+		return "", "", ErrUnauthorized
+	}
+	u, err := svc.GetUser(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	if !u.EmailVerified {
+		return "", "", ErrEmailNotVerified
+	}
+	return userID, u.Email, nil
+}
+
+type listInvitationsRequest struct{}
+
+type listInvitationsResponse struct {
+	Invitations []Invitation `json:"invitations,omitempty"`
+	Err         string       `json:"error,omitempty"`
+}
+
+func makeListInvitationsEndpoint(authSvc AuthService, todoSvc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		_, email, err := verifiedEmail(ctx, authSvc)
+		if err == ErrUnauthorized {
+			return nil, err
+		}
+		if err != nil {
+			return listInvitationsResponse{Err: err.Error()}, nil
+		}
+		invitations, err := todoSvc.ListInvitations(ctx, email)
+		if err != nil {
+			return listInvitationsResponse{Err: err.Error()}, nil
+		}
+		return listInvitationsResponse{Invitations: invitations}, nil
+	}
+}
+
+type respondToInvitationRequest struct {
+	InvitationID string `json:"-"`
+}
+
+type respondToInvitationResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeRespondToInvitationEndpoint(authSvc AuthService, todoSvc TodoService, accept bool) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(respondToInvitationRequest)
+		userID, email, err := verifiedEmail(ctx, authSvc)
+		if err == ErrUnauthorized {
+			return nil, err
+		}
+		if err == nil {
+			err = todoSvc.RespondToInvitation(ctx, userID, email, req.InvitationID, accept)
+		}
+		if err != nil {
+			return respondToInvitationResponse{Err: err.Error()}, nil
+		}
+		return respondToInvitationResponse{}, nil
+	}
+}
+
+func decodeShareListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req shareListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.ListID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func decodeListMembersRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return listMembersRequest{ListID: mux.Vars(r)["id"]}, nil
+}
+
+func decodeSetMemberRoleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req setMemberRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	vars := mux.Vars(r)
+	req.ListID, req.MemberID = vars["id"], vars["user_id"]
+	return req, nil
+}
+
+func decodeRemoveMemberRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	return removeMemberRequest{ListID: vars["id"], MemberID: vars["user_id"]}, nil
+}
+
+func decodeListInvitationsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return listInvitationsRequest{}, nil
+}
+
+func decodeRespondToInvitationRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return respondToInvitationRequest{InvitationID: mux.Vars(r)["id"]}, nil
+}
+
+// makeSharingHandler serves a sharing endpoint, which all take the token
+// from the Authorization header.
+func makeSharingHandler(e endpoint.Endpoint, dec httptransport.DecodeRequestFunc) http.Handler {
+	return httptransport.NewServer(
+		e,
+		dec,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeShareListHandler(endpoints Endpoints) http.Handler {
+	return makeSharingHandler(endpoints.ShareListEndpoint, decodeShareListRequest)
+}
+
+func MakeListMembersHandler(endpoints Endpoints) http.Handler {
+	return makeSharingHandler(endpoints.ListMembersEndpoint, decodeListMembersRequest)
+}
+
+func MakeSetMemberRoleHandler(endpoints Endpoints) http.Handler {
+	return makeSharingHandler(endpoints.SetMemberRoleEndpoint, decodeSetMemberRoleRequest)
+}
+
+func MakeRemoveMemberHandler(endpoints Endpoints) http.Handler {
+	return makeSharingHandler(endpoints.RemoveMemberEndpoint, decodeRemoveMemberRequest)
+}
+
+func MakeListInvitationsHandler(endpoints Endpoints) http.Handler {
+	return makeSharingHandler(endpoints.ListInvitationsEndpoint, decodeListInvitationsRequest)
+}
+
+func MakeAcceptInvitationHandler(endpoints Endpoints) http.Handler {
+	return makeSharingHandler(endpoints.AcceptInvitationEndpoint, decodeRespondToInvitationRequest)
+}
+
+func MakeDeclineInvitationHandler(endpoints Endpoints) http.Handler {
+	return makeSharingHandler(endpoints.DeclineInvitationEndpoint, decodeRespondToInvitationRequest)
+}
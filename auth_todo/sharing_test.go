@@ -0,0 +1,216 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestListSharing(t *testing.T) {
+	ctx := context.Background()
+	var invited []Invitation
+	svc := NewTodoService(WithInvitationHook(func(inv Invitation) { invited = append(invited, inv) }))
+	listID, _ := svc.CreateList(ctx, "owner", "Groceries")
+	todoID, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "Milk", ListID: listID, Tags: []string{"dairy"}})
+	svc.CreateTodo(ctx, "owner", TodoInput{Text: "Private"})
+
+	if _, err := svc.ShareList(ctx, "owner", listID, "viewer@example.com", "admin"); err != ErrInvalidListRole {
+		t.Errorf("Expected ErrInvalidListRole, got %v", err)
+	}
+	if _, err := svc.ShareList(ctx, "stranger", listID, "viewer@example.com", ListRoleViewer); err != ErrUnauthorized {
+		t.Errorf("Expected only owners to share, got %v", err)
+	}
+	viewerInv, _ := svc.ShareList(ctx, "owner", listID, "viewer@example.com", ListRoleViewer)
+	editorInv, _ := svc.ShareList(ctx, "owner", listID, "editor@example.com", ListRoleEditor)
+	if len(invited) != 2 || invited[0].ListName != "Groceries" {
+		t.Errorf("Expected the hook to see both invitations, got %+v", invited)
+	}
+
+	if _, err := svc.GetTodo(ctx, "viewer", todoID); err != ErrUnauthorized {
+		t.Errorf("Expected no access before accepting, got %v", err)
+	}
+	if err := svc.RespondToInvitation(ctx, "viewer", "other@example.com", viewerInv.ID, true); err != ErrInvitationNotFound {
+		t.Errorf("Expected invitations to be bound to their email, got %v", err)
+	}
+	if invitations, _ := svc.ListInvitations(ctx, "VIEWER@example.com"); len(invitations) != 1 || invitations[0].ID != viewerInv.ID {
+		t.Errorf("Expected the viewer's invitation, got %+v", invitations)
+	}
+	svc.RespondToInvitation(ctx, "viewer", "viewer@example.com", viewerInv.ID, true)
+	svc.RespondToInvitation(ctx, "editor", "editor@example.com", editorInv.ID, true)
+	if err := svc.RespondToInvitation(ctx, "viewer", "viewer@example.com", viewerInv.ID, true); err != ErrInvitationNotFound {
+		t.Errorf("Expected invitations to be single-use, got %v", err)
+	}
+
+	if _, err := svc.GetTodo(ctx, "viewer", todoID); err != nil {
+		t.Errorf("Expected viewers to read todos, got %v", err)
+	}
+	if err := svc.CompleteTodo(ctx, "viewer", todoID); err != ErrUnauthorized {
+		t.Errorf("Expected viewers not to complete todos, got %v", err)
+	}
+	if _, err := svc.CreateTodo(ctx, "viewer", TodoInput{Text: "Eggs", ListID: listID}); err != ErrUnauthorized {
+		t.Errorf("Expected viewers not to add todos, got %v", err)
+	}
+	if err := svc.CompleteTodo(ctx, "editor", todoID); err != nil {
+		t.Errorf("Expected editors to complete todos, got %v", err)
+	}
+	editorTodo, _ := svc.CreateTodo(ctx, "editor", TodoInput{Text: "Eggs", ListID: listID})
+	if todo, _ := svc.GetTodo(ctx, "owner", todoID); !todo.Completed {
+		t.Error("Expected the owner to see the editor's change")
+	}
+	if _, total, _ := svc.ListTodos(ctx, "owner", TodoFilter{}, 10, 0); total != 3 {
+		t.Errorf("Expected the owner to see the editor's todo, got %d todos", total)
+	}
+	todos, total, _ := svc.ListTodos(ctx, "viewer", TodoFilter{SharedWithMe: true}, 10, 0)
+	if total != 2 || todos[0].ID != editorTodo {
+		t.Errorf("Expected the viewer to see the list's todos, got %+v", todos)
+	}
+	if _, total, _ := svc.ListTodos(ctx, "owner", TodoFilter{SharedWithMe: true}, 10, 0); total != 0 {
+		t.Errorf("Expected nothing shared with the owner, got %d", total)
+	}
+	if tags, _ := svc.ListTags(ctx, "viewer"); len(tags) != 1 || tags[0].Name != "dairy" {
+		t.Errorf("Expected the viewer to see shared tags, got %+v", tags)
+	}
+	if lists, _ := svc.ListLists(ctx, "editor"); len(lists) != 1 || lists[0].Role != ListRoleEditor {
+		t.Errorf("Expected the shared list with the editor role, got %+v", lists)
+	}
+	editorList, _ := svc.CreateList(ctx, "editor", "Mine")
+	if _, err := svc.UpdateTodo(ctx, "editor", todoID, TodoPatch{ListID: &editorList}); err != ErrUnauthorized {
+		t.Errorf("Expected editors not to move others' todos out of the list, got %v", err)
+	}
+	if todo, _ := svc.GetTodo(ctx, "owner", todoID); todo.ListID != listID {
+		t.Errorf("Expected the todo to stay in the list, got %+v", todo)
+	}
+
+	if err := svc.SetMemberRole(ctx, "editor", listID, "viewer", ListRoleEditor); err != ErrUnauthorized {
+		t.Errorf("Expected only owners to change roles, got %v", err)
+	}
+	if err := svc.SetMemberRole(ctx, "owner", listID, "owner", ListRoleViewer); err != ErrListCreator {
+		t.Errorf("Expected ErrListCreator, got %v", err)
+	}
+	svc.SetMemberRole(ctx, "owner", listID, "editor", ListRoleViewer)
+	if err := svc.DeleteTodo(ctx, "editor", editorTodo); err != ErrUnauthorized {
+		t.Errorf("Expected demoted creators to lose edit rights, got %v", err)
+	}
+	svc.SetMemberRole(ctx, "owner", listID, "viewer", ListRoleOwner)
+	if err := svc.RemoveMember(ctx, "viewer", listID, "editor"); err != nil {
+		t.Errorf("Expected a new owner to remove members, got %v", err)
+	}
+	if _, err := svc.GetTodo(ctx, "editor", todoID); err != ErrUnauthorized {
+		t.Errorf("Expected removed members to lose access, got %v", err)
+	}
+	if _, err := svc.GetTodo(ctx, "editor", editorTodo); err != ErrUnauthorized {
+		t.Errorf("Expected removed creators to lose access to their todos, got %v", err)
+	}
+	if _, total, _ := svc.ListTodos(ctx, "editor", TodoFilter{}, 10, 0); total != 0 {
+		t.Errorf("Expected removed creators not to list their todos, got %d", total)
+	}
+	if err := svc.RemoveMember(ctx, "viewer", listID, "viewer"); err != nil {
+		t.Errorf("Expected members to leave, got %v", err)
+	}
+	if members, _ := svc.ListMembers(ctx, "owner", listID); len(members) != 1 || members[0].UserID != "owner" {
+		t.Errorf("Expected only the creator to remain, got %+v", members)
+	}
+}
+
+func TestSharingEndpoints(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost))
+	ownerID, _ := authSvc.Signup(ctx, "owner@example.com", "password123")
+	friendID, _ := authSvc.Signup(ctx, "friend@example.com", "password123")
+	ownerSession, _ := authSvc.Login(ctx, "owner@example.com", "password123")
+	friendSession, _ := authSvc.Login(ctx, "friend@example.com", "password123")
+
+	broker := NewEventBroker(16)
+	todoSvc := NewEventingTodoMiddleware(broker, NewCachedTodoService(time.Minute, NewTodoService()))
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(authSvc, todoSvc, broker, nil)))
+	defer server.Close()
+
+	do := func(method, path, token, body string) map[string]interface{} {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		result := make(map[string]interface{})
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result
+	}
+
+	listID := do("POST", "/v1/lists", ownerSession, `{"name":"Trip"}`)["list_id"].(string)
+	hotelID := do("POST", "/v1/todos", ownerSession, `{"text":"Book hotel","list_id":"`+listID+`"}`)["todo_id"].(string)
+	body := do("POST", "/v1/lists/"+listID+"/members", ownerSession, `{"email":"friend@example.com","role":"editor"}`)
+	inv, _ := body["invitation"].(map[string]interface{})
+	if inv == nil {
+		t.Fatalf("Expected an invitation, got %v", body)
+	}
+	invitationID := inv["ID"].(string)
+
+	if body := do("POST", "/v1/invitations/"+invitationID+"/accept", friendSession, ""); body["error"] != ErrEmailNotVerified.Error() {
+		t.Errorf("Expected unverified addresses to be refused, got %v", body)
+	}
+	svc := authSvc.(*authService)
+	friend := svc.users["friend@example.com"]
+	friend.Verified = true
+	svc.users["friend@example.com"] = friend
+
+	// Prime the friend's cached listing before joining.
+	if body := do("GET", "/v1/todos", friendSession, ""); body["total"] != float64(0) {
+		t.Errorf("Expected no todos before joining, got %v", body)
+	}
+	if body := do("GET", "/v1/invitations", friendSession, ""); len(body["invitations"].([]interface{})) != 1 {
+		t.Errorf("Expected one invitation, got %v", body)
+	}
+	if body := do("POST", "/v1/invitations/"+invitationID+"/accept", friendSession, ""); body["error"] != nil {
+		t.Fatalf("Accepting failed: %v", body)
+	}
+	if body := do("GET", "/v1/todos?shared=true", friendSession, ""); body["total"] != float64(1) {
+		t.Errorf("Expected the shared todo after joining, got %v", body)
+	}
+	members := do("GET", "/v1/lists/"+listID+"/members", friendSession, "")["members"].([]interface{})
+	if len(members) != 2 || members[1].(map[string]interface{})["Email"] != "friend@example.com" {
+		t.Errorf("Expected both members with emails, got %v", members)
+	}
+
+	ownerSub, _, _ := broker.Subscribe(ownerID, 0)
+	defer ownerSub.Close()
+	friendTodo := do("POST", "/v1/todos", friendSession, `{"text":"Buy tickets","list_id":"`+listID+`"}`)["todo_id"]
+	select {
+	case event := <-ownerSub.C:
+		if event.TodoID != friendTodo || event.Todo == nil || event.Todo.UserID != friendID {
+			t.Errorf("Unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the owner to receive the member's event")
+	}
+	if body := do("GET", "/v1/todos", ownerSession, ""); body["total"] != float64(2) {
+		t.Errorf("Expected the owner's listing to include the member's todo, got %v", body)
+	}
+
+	// Leaving unassigns the friend, which the owner's cached listing must
+	// show.
+	do("PUT", "/v1/todos/"+hotelID+"/assignee", ownerSession, `{"assignee_id":"`+friendID+`"}`)
+	do("GET", "/v1/todos", ownerSession, "")
+	if body := do("DELETE", "/v1/lists/"+listID+"/members/"+friendID, friendSession, ""); body["error"] != nil {
+		t.Errorf("Leaving failed: %v", body)
+	}
+	for _, todo := range do("GET", "/v1/todos", ownerSession, "")["todos"].([]interface{}) {
+		if todo := todo.(map[string]interface{}); todo["ID"] == hotelID && todo["AssigneeID"] != "" {
+			t.Errorf("Expected the owner's listing to drop the assignee, got %v", todo)
+		}
+	}
+	if body := do("GET", "/v1/todos", friendSession, ""); body["total"] != float64(0) {
+		t.Errorf("Expected no todos after leaving, including the friend's own, got %v", body)
+	}
+	if body := do("GET", "/v1/lists?shared=true", friendSession, ""); len(body["lists"].([]interface{})) != 0 {
+		t.Errorf("Expected no shared lists after leaving, got %v", body)
+	}
+}
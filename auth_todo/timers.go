@@ -0,0 +1,377 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxTimeEntryNoteLength bounds the notes of time entries, in bytes.
+const maxTimeEntryNoteLength = 500
+
+var (
+	ErrTimerRunning      = errors.New("a timer is already running; stop it first")
+	ErrNoTimerRunning    = errors.New("no timer is running")
+	ErrInvalidTimeEntry  = errors.New("a time entry must end after it starts and not in the future")
+	ErrTimeEntryNotFound = errors.New("time entry not found")
+	ErrTimeNoteTooLong   = fmt.Errorf("note cannot be longer than %d bytes", maxTimeEntryNoteLength)
+)
+
+// TimeEntry is time a user spent on a todo, tracked with a timer or entered
+// by hand. End is unset while the timer of the entry is running, and
+// Seconds then counts until now.
+type TimeEntry struct {
+	ID      string
+	TodoID  string
+	UserID  string
+	Start   time.Time
+	End     *time.Time `json:",omitempty"`
+	Seconds int64
+	Note    string `json:",omitempty"`
+	Manual  bool   `json:",omitempty"`
+}
+
+// TimeEntryInput is a time entry added by hand.
+type TimeEntryInput struct {
+	Start time.Time
+	End   time.Time
+	Note  string
+}
+
+// TimeQuery selects the time entries of a report or timesheet. Empty fields
+// match everything; a zero Until means now. Entries overlapping the range
+// count only with the time inside it.
+type TimeQuery struct {
+	TodoID string
+	ListID string
+	Tag    string
+	UserID string
+	Since  time.Time
+	Until  time.Time
+}
+
+// TimeTotal is the tracked time of a todo, list, tag or day.
+type TimeTotal struct {
+	Key     string
+	Seconds int64
+}
+
+// TimeReport totals the time entries matching a query. Todos, Lists and Tags
+// are sorted by time spent, most first; a todo counts towards each of its
+// tags. Days are UTC dates in order, with entries split at midnight.
+type TimeReport struct {
+	Seconds int64
+	Todos   []TimeTotal
+	Lists   []TimeTotal
+	Tags    []TimeTotal
+	Days    []TimeTotal
+}
+
+// TimesheetEntry is a line of a timesheet: a time entry, clipped to the
+// range of the query, with the todo it was spent on. End is set to now for
+// running timers.
+type TimesheetEntry struct {
+	TimeEntry
+	Running  bool
+	TodoText string
+	ListID   string
+	Tags     []string
+}
+
+func entrySeconds(start, end time.Time) int64 {
+	return int64(end.Sub(start) / time.Second)
+}
+
+// elapsed returns e with Seconds counted until now if its timer is running.
+func (e TimeEntry) elapsed(now time.Time) TimeEntry {
+	if e.End == nil {
+		e.Seconds = entrySeconds(e.Start, now)
+	}
+	return e
+}
+
+func (s *todoService) nextTimeEntryID() string {
+	s.timeEntryCounter++
+	return fmt.Sprintf("time_%d", s.timeEntryCounter)
+}
+
+// StartTimer starts tracking time on a todo. Editors of a todo may track
+// time on it; each user has at most one running timer.
+func (s *todoService) StartTimer(ctx context.Context, userID, todoID, note string) (TimeEntry, error) {
+	note = strings.TrimSpace(note)
+	if len(note) > maxTimeEntryNoteLength {
+		return TimeEntry{}, ErrTimeNoteTooLong
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return TimeEntry{}, ErrTodoNotFound
+	}
+	if !canEdit(s.todoRole(todo, userID)) {
+		return TimeEntry{}, ErrUnauthorized
+	}
+	if _, running := s.timers[userID]; running {
+		return TimeEntry{}, ErrTimerRunning
+	}
+
+	entry := TimeEntry{
+		ID:     s.nextTimeEntryID(),
+		TodoID: todoID,
+		UserID: userID,
+		Start:  time.Now(),
+		Note:   note,
+	}
+	s.timeEntries[todoID] = append(s.timeEntries[todoID], entry)
+	s.timers[userID] = entry
+	return entry, nil
+}
+
+// StopTimer stops the running timer of a user and returns its entry.
+func (s *todoService) StopTimer(ctx context.Context, userID string) (TimeEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	timer, running := s.timers[userID]
+	if !running {
+		return TimeEntry{}, ErrNoTimerRunning
+	}
+	delete(s.timers, userID)
+
+	entries := s.timeEntries[timer.TodoID]
+	for i, e := range entries {
+		if e.ID == timer.ID {
+			end := time.Now()
+			e.End = &end
+			e.Seconds = entrySeconds(e.Start, end)
+			entries[i] = e
+			return e, nil
+		}
+	}
+	return TimeEntry{}, ErrNoTimerRunning
+}
+
+// AddTimeEntry records time spent on a todo by hand, for editors of the
+// todo.
+func (s *todoService) AddTimeEntry(ctx context.Context, userID, todoID string, input TimeEntryInput) (TimeEntry, error) {
+	input.Note = strings.TrimSpace(input.Note)
+	if len(input.Note) > maxTimeEntryNoteLength {
+		return TimeEntry{}, ErrTimeNoteTooLong
+	}
+	if input.Start.IsZero() || !input.End.After(input.Start) || input.End.After(time.Now()) {
+		return TimeEntry{}, ErrInvalidTimeEntry
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return TimeEntry{}, ErrTodoNotFound
+	}
+	if !canEdit(s.todoRole(todo, userID)) {
+		return TimeEntry{}, ErrUnauthorized
+	}
+
+	end := input.End
+	entry := TimeEntry{
+		ID:      s.nextTimeEntryID(),
+		TodoID:  todoID,
+		UserID:  userID,
+		Start:   input.Start,
+		End:     &end,
+		Seconds: entrySeconds(input.Start, end),
+		Note:    input.Note,
+		Manual:  true,
+	}
+	s.timeEntries[todoID] = append(s.timeEntries[todoID], entry)
+	return entry, nil
+}
+
+// ListTimeEntries returns the time entries of a todo in the order they were
+// added, with their total number.
+func (s *todoService) ListTimeEntries(ctx context.Context, userID, todoID string, limit, offset int) ([]TimeEntry, int, error) {
+	s.mu.RLock()
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		s.mu.RUnlock()
+		return nil, 0, ErrTodoNotFound
+	}
+	if s.todoRole(todo, userID) == "" {
+		s.mu.RUnlock()
+		return nil, 0, ErrUnauthorized
+	}
+	entries := append([]TimeEntry{}, s.timeEntries[todoID]...)
+	s.mu.RUnlock()
+
+	now := time.Now()
+	start, end := page(len(entries), limit, offset)
+	for i := start; i < end; i++ {
+		entries[i] = entries[i].elapsed(now)
+	}
+	return entries[start:end], len(entries), nil
+}
+
+// DeleteTimeEntry deletes a time entry, stopping its timer if it is
+// running. Users may delete their own entries and owners any entry.
+func (s *todoService) DeleteTimeEntry(ctx context.Context, userID, todoID, entryID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return ErrTodoNotFound
+	}
+	role := s.todoRole(todo, userID)
+	if role == "" {
+		return ErrUnauthorized
+	}
+	entries := s.timeEntries[todoID]
+	for i, e := range entries {
+		if e.ID != entryID {
+			continue
+		}
+		if e.UserID != userID && role != ListRoleOwner {
+			return ErrUnauthorized
+		}
+		if e.End == nil {
+			delete(s.timers, e.UserID)
+		}
+		s.timeEntries[todoID] = append(entries[:i:i], entries[i+1:]...)
+		return nil
+	}
+	return ErrTimeEntryNotFound
+}
+
+// dropTimeEntries deletes the time entries of a deleted todo and stops the
+// timers running on it. It must be called with s.mu held.
+func (s *todoService) dropTimeEntries(todoID string) {
+	for _, e := range s.timeEntries[todoID] {
+		if e.End == nil {
+			delete(s.timers, e.UserID)
+		}
+	}
+	delete(s.timeEntries, todoID)
+}
+
+// queryTime returns the time entries on todos userID can read that match
+// query, clipped to its range and oldest first.
+func (s *todoService) queryTime(userID string, query TimeQuery) ([]TimesheetEntry, error) {
+	now := time.Now()
+	until := query.Until
+	if until.IsZero() || until.After(now) {
+		until = now
+	}
+	if !query.Since.IsZero() && !until.After(query.Since) {
+		return nil, ErrInvalidTimeRange
+	}
+	tag := strings.ToLower(strings.TrimSpace(query.Tag))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sheet []TimesheetEntry
+	for todoID, entries := range s.timeEntries {
+		todo := s.todosById[todoID]
+		if query.TodoID != "" && todoID != query.TodoID ||
+			query.ListID != "" && todo.ListID != query.ListID ||
+			tag != "" && !containsString(todo.Tags, tag) ||
+			s.todoRole(todo, userID) == "" {
+			continue
+		}
+		for _, e := range entries {
+			if query.UserID != "" && e.UserID != query.UserID {
+				continue
+			}
+			end := until
+			if e.End != nil && e.End.Before(until) {
+				end = *e.End
+			}
+			start := e.Start
+			if start.Before(query.Since) {
+				start = query.Since
+			}
+			if !end.After(start) {
+				continue
+			}
+			running := e.End == nil
+			e.Start, e.End, e.Seconds = start, &end, entrySeconds(start, end)
+			sheet = append(sheet, TimesheetEntry{
+				TimeEntry: e,
+				Running:   running,
+				TodoText:  todo.Text,
+				ListID:    todo.ListID,
+				Tags:      todo.Tags,
+			})
+		}
+	}
+	sort.Slice(sheet, func(i, j int) bool {
+		if !sheet[i].Start.Equal(sheet[j].Start) {
+			return sheet[i].Start.Before(sheet[j].Start)
+		}
+		return sheet[i].ID < sheet[j].ID
+	})
+	return sheet, nil
+}
+
+// Timesheet returns the time entries matching query on the todos userID
+// can read, oldest first.
+func (s *todoService) Timesheet(ctx context.Context, userID string, query TimeQuery) ([]TimesheetEntry, error) {
+	return s.queryTime(userID, query)
+}
+
+// TimeReport totals the time entries matching query on the todos userID
+// can read.
+func (s *todoService) TimeReport(ctx context.Context, userID string, query TimeQuery) (TimeReport, error) {
+	sheet, err := s.queryTime(userID, query)
+	if err != nil {
+		return TimeReport{}, err
+	}
+	todos, lists, tags, days := map[string]int64{}, map[string]int64{}, map[string]int64{}, map[string]int64{}
+	var report TimeReport
+	for _, e := range sheet {
+		report.Seconds += e.Seconds
+		todos[e.TodoID] += e.Seconds
+		if e.ListID != "" {
+			lists[e.ListID] += e.Seconds
+		}
+		for _, tag := range e.Tags {
+			tags[tag] += e.Seconds
+		}
+		for start := e.Start.UTC(); start.Before(*e.End); {
+			midnight := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, time.UTC)
+			end := *e.End
+			if midnight.Before(end) {
+				end = midnight
+			}
+			days[start.Format("2006-01-02")] += entrySeconds(start, end)
+			start = midnight
+		}
+	}
+	report.Todos = sortTotals(todos, true)
+	report.Lists = sortTotals(lists, true)
+	report.Tags = sortTotals(tags, true)
+	report.Days = sortTotals(days, false)
+	return report, nil
+}
+
+// sortTotals sorts totals by key, or by time spent, most first, if bySeconds
+// is set.
+func sortTotals(totals map[string]int64, bySeconds bool) []TimeTotal {
+	sorted := make([]TimeTotal, 0, len(totals))
+	for key, seconds := range totals {
+		sorted = append(sorted, TimeTotal{Key: key, Seconds: seconds})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if bySeconds && sorted[i].Seconds != sorted[j].Seconds {
+			return sorted[i].Seconds > sorted[j].Seconds
+		}
+		return sorted[i].Key < sorted[j].Key
+	})
+	return sorted
+}
@@ -0,0 +1,297 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+type startTimerRequest struct {
+	TodoID string `json:"-"`
+	Note   string `json:"note"`
+}
+
+type timeEntryResponse struct {
+	Entry *TimeEntry `json:"entry,omitempty"`
+	Err   string     `json:"error,omitempty"`
+}
+
+func makeStartTimerEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(startTimerRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		entry, err := svc.StartTimer(ctx, userID, req.TodoID, req.Note)
+		if err != nil {
+			return timeEntryResponse{Err: err.Error()}, nil
+		}
+		return timeEntryResponse{Entry: &entry}, nil
+	}
+}
+
+func makeStopTimerEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		entry, err := svc.StopTimer(ctx, userID)
+		if err != nil {
+			return timeEntryResponse{Err: err.Error()}, nil
+		}
+		return timeEntryResponse{Entry: &entry}, nil
+	}
+}
+
+type addTimeEntryRequest struct {
+	TodoID string    `json:"-"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Note   string    `json:"note"`
+}
+
+func makeAddTimeEntryEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(addTimeEntryRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		entry, err := svc.AddTimeEntry(ctx, userID, req.TodoID, TimeEntryInput{Start: req.Start, End: req.End, Note: req.Note})
+		if err != nil {
+			return timeEntryResponse{Err: err.Error()}, nil
+		}
+		return timeEntryResponse{Entry: &entry}, nil
+	}
+}
+
+type listTimeEntriesResponse struct {
+	Entries []TimeEntry `json:"entries,omitempty"`
+	Total   int         `json:"total"`
+	Limit   int         `json:"limit"`
+	Offset  int         `json:"offset"`
+	Err     string      `json:"error,omitempty"`
+}
+
+func makeListTimeEntriesEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(todoPageRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		entries, total, err := svc.ListTimeEntries(ctx, userID, req.TodoID, req.Limit, req.Offset)
+		if err != nil {
+			return listTimeEntriesResponse{Err: err.Error()}, nil
+		}
+		return listTimeEntriesResponse{Entries: entries, Total: total, Limit: req.Limit, Offset: req.Offset}, nil
+	}
+}
+
+type deleteTimeEntryRequest struct {
+	TodoID  string
+	EntryID string
+}
+
+type deleteTimeEntryResponse struct {
+	Err string `json:"error,omitempty"`
+}
+
+func makeDeleteTimeEntryEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteTimeEntryRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		if err := svc.DeleteTimeEntry(ctx, userID, req.TodoID, req.EntryID); err != nil {
+			return deleteTimeEntryResponse{Err: err.Error()}, nil
+		}
+		return deleteTimeEntryResponse{}, nil
+	}
+}
+
+type timeReportResponse struct {
+	Report *TimeReport `json:"report,omitempty"`
+	Err    string      `json:"error,omitempty"`
+}
+
+func makeTimeReportEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		query := request.(TimeQuery)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		report, err := svc.TimeReport(ctx, userID, query)
+		if err != nil {
+			return timeReportResponse{Err: err.Error()}, nil
+		}
+		return timeReportResponse{Report: &report}, nil
+	}
+}
+
+// timesheetResponse carries the lines of a timesheet, which
+// encodeTimesheetResponse writes as CSV.
+type timesheetResponse struct {
+	Entries []TimesheetEntry `json:"-"`
+	Err     string           `json:"error,omitempty"`
+}
+
+func makeTimesheetEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		query := request.(TimeQuery)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		entries, err := svc.Timesheet(ctx, userID, query)
+		if err != nil {
+			return timesheetResponse{Err: err.Error()}, nil
+		}
+		return timesheetResponse{Entries: entries}, nil
+	}
+}
+
+// decodeStartTimerRequest accepts an empty body for timers without a note.
+func decodeStartTimerRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req startTimerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		return nil, err
+	}
+	req.TodoID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func decodeStopTimerRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return struct{}{}, nil
+}
+
+func decodeAddTimeEntryRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req addTimeEntryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.TodoID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func decodeDeleteTimeEntryRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	return deleteTimeEntryRequest{TodoID: vars["id"], EntryID: vars["entry_id"]}, nil
+}
+
+func decodeTimeQuery(_ context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	query := TimeQuery{
+		TodoID: q.Get("todo_id"),
+		ListID: q.Get("list_id"),
+		Tag:    q.Get("tag"),
+		UserID: q.Get("user_id"),
+	}
+	if err := parseTimeRange(q, &query.Since, &query.Until); err != nil {
+		return nil, err
+	}
+	return query, nil
+}
+
+// timesheetColumns is the header row of timesheet exports.
+var timesheetColumns = []string{"entry_id", "user_id", "todo_id", "todo", "list_id", "tags", "start", "end", "seconds", "hours", "note"}
+
+// encodeTimesheetResponse writes a timesheet as a CSV download. Running
+// timers have an empty end. Failures are reported as JSON like every other
+// endpoint.
+func encodeTimesheetResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(timesheetResponse)
+	if resp.Err != "" {
+		return encodeResponse(ctx, w, resp)
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="timesheet.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write(timesheetColumns)
+	for _, e := range resp.Entries {
+		end := e.End.UTC().Format(time.RFC3339)
+		if e.Running {
+			end = ""
+		}
+		cw.Write([]string{
+			e.ID,
+			e.UserID,
+			e.TodoID,
+			csvText(e.TodoText),
+			e.ListID,
+			csvText(strings.Join(e.Tags, ";")),
+			e.Start.UTC().Format(time.RFC3339),
+			end,
+			strconv.FormatInt(e.Seconds, 10),
+			fmt.Sprintf("%.2f", float64(e.Seconds)/3600),
+			csvText(e.Note),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvText escapes user text that spreadsheets would otherwise run as a
+// formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// makeTimeHandler serves a time tracking endpoint, which all take the token
+// from the Authorization header.
+func makeTimeHandler(e endpoint.Endpoint, dec httptransport.DecodeRequestFunc, enc httptransport.EncodeResponseFunc) http.Handler {
+	return httptransport.NewServer(
+		e,
+		dec,
+		enc,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeStartTimerHandler(endpoints Endpoints) http.Handler {
+	return makeTimeHandler(endpoints.StartTimerEndpoint, decodeStartTimerRequest, encodeResponse)
+}
+
+func MakeStopTimerHandler(endpoints Endpoints) http.Handler {
+	return makeTimeHandler(endpoints.StopTimerEndpoint, decodeStopTimerRequest, encodeResponse)
+}
+
+func MakeAddTimeEntryHandler(endpoints Endpoints) http.Handler {
+	return makeTimeHandler(endpoints.AddTimeEntryEndpoint, decodeAddTimeEntryRequest, encodeResponse)
+}
+
+func MakeListTimeEntriesHandler(endpoints Endpoints) http.Handler {
+	return makeTimeHandler(endpoints.ListTimeEntriesEndpoint, decodeTodoPageRequest, encodeResponse)
+}
+
+func MakeDeleteTimeEntryHandler(endpoints Endpoints) http.Handler {
+	return makeTimeHandler(endpoints.DeleteTimeEntryEndpoint, decodeDeleteTimeEntryRequest, encodeResponse)
+}
+
+func MakeTimeReportHandler(endpoints Endpoints) http.Handler {
+	return makeTimeHandler(endpoints.TimeReportEndpoint, decodeTimeQuery, encodeResponse)
+}
+
+func MakeTimesheetHandler(endpoints Endpoints) http.Handler {
+	return makeTimeHandler(endpoints.TimesheetEndpoint, decodeTimeQuery, encodeTimesheetResponse)
+}
@@ -0,0 +1,157 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestTimeTracking(t *testing.T) {
+	ctx := context.Background()
+	svc := NewCachedTodoService(time.Minute, NewTodoService())
+	listID, _ := svc.CreateList(ctx, "owner", "Client A")
+	design, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "Design", ListID: listID, Tags: []string{"billable"}})
+	build, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "Build", ListID: listID})
+	inv, _ := svc.ShareList(ctx, "owner", listID, "editor@example.com", ListRoleEditor)
+	svc.RespondToInvitation(ctx, "editor", "editor@example.com", inv.ID, true)
+
+	if _, err := svc.StartTimer(ctx, "stranger", design, ""); err != ErrUnauthorized {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	timer, err := svc.StartTimer(ctx, "editor", design, "kickoff")
+	if err != nil || timer.End != nil {
+		t.Fatalf("StartTimer failed: %+v %v", timer, err)
+	}
+	if _, err := svc.StartTimer(ctx, "editor", build, ""); err != ErrTimerRunning {
+		t.Errorf("Expected one running timer per user, got %v", err)
+	}
+	if _, err := svc.StartTimer(ctx, "owner", build, ""); err != nil {
+		t.Errorf("Expected other users to run their own timers, got %v", err)
+	}
+	stopped, err := svc.StopTimer(ctx, "editor")
+	if err != nil || stopped.ID != timer.ID || stopped.End == nil {
+		t.Fatalf("StopTimer failed: %+v %v", stopped, err)
+	}
+	if _, err := svc.StopTimer(ctx, "editor"); err != ErrNoTimerRunning {
+		t.Errorf("Expected ErrNoTimerRunning, got %v", err)
+	}
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, input := range []TimeEntryInput{
+		{Start: day.Add(time.Hour), End: day.Add(time.Hour)},
+		{Start: time.Now(), End: time.Now().Add(time.Hour)},
+	} {
+		if _, err := svc.AddTimeEntry(ctx, "editor", design, input); err != ErrInvalidTimeEntry {
+			t.Errorf("Expected ErrInvalidTimeEntry for %+v, got %v", input, err)
+		}
+	}
+	// Two hours on the design across midnight and one hour on the build.
+	svc.AddTimeEntry(ctx, "editor", design, TimeEntryInput{Start: day.Add(23 * time.Hour), End: day.Add(25 * time.Hour)})
+	manual, err := svc.AddTimeEntry(ctx, "owner", build, TimeEntryInput{Start: day.Add(26 * time.Hour), End: day.Add(27 * time.Hour), Note: "review"})
+	if err != nil || !manual.Manual || manual.Seconds != 3600 {
+		t.Fatalf("AddTimeEntry failed: %+v %v", manual, err)
+	}
+
+	range2024 := TimeQuery{Since: day, Until: day.AddDate(0, 0, 7)}
+	report, err := svc.TimeReport(ctx, "editor", range2024)
+	if err != nil {
+		t.Fatalf("TimeReport failed: %v", err)
+	}
+	if report.Seconds != 3*3600 || report.Todos[0].Key != design || report.Todos[0].Seconds != 2*3600 {
+		t.Errorf("Unexpected totals %+v", report)
+	}
+	if len(report.Days) != 2 || report.Days[0] != (TimeTotal{"2024-03-01", 3600}) || report.Days[1] != (TimeTotal{"2024-03-02", 2 * 3600}) {
+		t.Errorf("Expected the time split by day, got %+v", report.Days)
+	}
+	if len(report.Lists) != 1 || report.Lists[0].Seconds != 3*3600 || len(report.Tags) != 1 || report.Tags[0] != (TimeTotal{"billable", 2 * 3600}) {
+		t.Errorf("Unexpected list and tag totals %+v %+v", report.Lists, report.Tags)
+	}
+	clipped := TimeQuery{UserID: "editor", Since: day.Add(24 * time.Hour), Until: day.AddDate(0, 0, 7)}
+	if report, _ := svc.TimeReport(ctx, "owner", clipped); report.Seconds != 3600 {
+		t.Errorf("Expected entries clipped to the range, got %+v", report)
+	}
+	if report, _ := svc.TimeReport(ctx, "stranger", range2024); report.Seconds != 0 {
+		t.Errorf("Expected no time on unreadable todos, got %+v", report)
+	}
+	if _, err := svc.TimeReport(ctx, "owner", TimeQuery{Since: day, Until: day}); err != ErrInvalidTimeRange {
+		t.Errorf("Expected ErrInvalidTimeRange, got %v", err)
+	}
+
+	if err := svc.DeleteTimeEntry(ctx, "editor", build, manual.ID); err != ErrUnauthorized {
+		t.Errorf("Expected editors not to delete the entries of others, got %v", err)
+	}
+	if err := svc.DeleteTimeEntry(ctx, "owner", design, timer.ID); err != nil {
+		t.Errorf("Expected owners to delete any entry, got %v", err)
+	}
+	if entries, total, _ := svc.ListTimeEntries(ctx, "editor", design, 10, 0); total != 1 || entries[0].Seconds != 2*3600 {
+		t.Errorf("Unexpected entries %+v", entries)
+	}
+
+	svc.DeleteTodo(ctx, "owner", build)
+	if _, err := svc.StartTimer(ctx, "owner", design, ""); err != nil {
+		t.Errorf("Expected deleting the todo to stop its timer, got %v", err)
+	}
+}
+
+func TestTimesheetExport(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost))
+	authSvc.Signup(ctx, "owner@example.com", "password123")
+	session, _ := authSvc.Login(ctx, "owner@example.com", "password123")
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(authSvc, NewTodoService(), NewEventBroker(16), nil)))
+	defer server.Close()
+
+	do := func(method, path, body string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+session)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		return resp
+	}
+
+	resp := do("POST", "/v1/todos", `{"text":"=HYPERLINK(\"x\")","tags":["client"]}`)
+	var created struct {
+		TodoID string `json:"todo_id"`
+	}
+	json.NewDecoder(resp.Body).Decode(&created)
+	resp.Body.Close()
+	do("POST", "/v1/todos/"+created.TodoID+"/time-entries",
+		`{"start":"2024-03-01T09:00:00Z","end":"2024-03-01T10:30:00Z","note":"call"}`).Body.Close()
+	do("POST", "/v1/todos/"+created.TodoID+"/timer", "").Body.Close()
+
+	resp = do("GET", "/v1/time/timesheet?since=2024-01-01T00:00:00Z", "")
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("Expected a CSV timesheet, got %q", ct)
+	}
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil || len(rows) != 3 {
+		t.Fatalf("Unexpected timesheet %v %v", rows, err)
+	}
+	if row := rows[1]; row[3] != `'=HYPERLINK("x")` || row[5] != "client" || row[8] != "5400" || row[9] != "1.50" || row[10] != "call" {
+		t.Errorf("Unexpected timesheet row %v", row)
+	}
+	if rows[2][7] != "" {
+		t.Errorf("Expected the running timer without an end, got %v", rows[2])
+	}
+
+	resp = do("GET", "/v1/time/timesheet?since=yesterday", "")
+	var failed struct {
+		Err string `json:"error"`
+	}
+	json.NewDecoder(resp.Body).Decode(&failed)
+	resp.Body.Close()
+	if failed.Err != ErrInvalidTimeRange.Error() {
+		t.Errorf("Expected the error as JSON, got %+v", failed)
+	}
+}
@@ -0,0 +1,99 @@
+package auth_todo
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"time"
+)
+
+// newSecret returns a random token with 256 bits of entropy.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the digest under which a secret token is stored. The
+// tokens are random, so a fast unsalted hash is enough to keep a leaked
+// store from being usable.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type issuedToken struct {
+	userID    string
+	issuedAt  time.Time
+	expiresAt time.Time
+}
+
+// tokenStore holds at most one outstanding single-use token per user, such
+// as a password reset or email verification token, by hash. It is not safe
+// for concurrent use; authService guards it with its mutex.
+type tokenStore struct {
+	ttl    time.Duration
+	byHash map[string]issuedToken
+	byUser map[string]string
+}
+
+func newTokenStore(ttl time.Duration) *tokenStore {
+	return &tokenStore{
+		ttl:    ttl,
+		byHash: make(map[string]issuedToken),
+		byUser: make(map[string]string),
+	}
+}
+
+// issue stores token for userID, replacing the previous one.
+func (ts *tokenStore) issue(userID, token string, now time.Time) {
+	if previous, ok := ts.byUser[userID]; ok {
+		delete(ts.byHash, previous)
+	}
+	hash := hashToken(token)
+	ts.byHash[hash] = issuedToken{userID: userID, issuedAt: now, expiresAt: now.Add(ts.ttl)}
+	ts.byUser[userID] = hash
+}
+
+// consume returns the user of token and forgets it, whether or not it has
+// expired.
+func (ts *tokenStore) consume(token string, now time.Time) (string, bool) {
+	hash := hashToken(token)
+	issued, ok := ts.byHash[hash]
+	if !ok {
+		return "", false
+	}
+	delete(ts.byHash, hash)
+	delete(ts.byUser, issued.userID)
+	return issued.userID, now.Before(issued.expiresAt)
+}
+
+// issuedAt returns when the outstanding token of userID was issued.
+func (ts *tokenStore) issuedAt(userID string) (time.Time, bool) {
+	hash, ok := ts.byUser[userID]
+	if !ok {
+		return time.Time{}, false
+	}
+	return ts.byHash[hash].issuedAt, true
+}
+
+// link returns the page of the client at path with token as its token query
+// parameter, or the bare token if no client URL is configured.
+func link(appURL, path, token string) string {
+	if appURL == "" {
+		return token
+	}
+	u, err := url.Parse(appURL)
+	if err != nil {
+		return token
+	}
+	u = u.JoinPath(path)
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
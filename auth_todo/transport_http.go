@@ -3,11 +3,17 @@ package auth_todo
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
 func decodeSignupRequest(_ context.Context, r *http.Request) (interface{}, error) {
@@ -38,6 +44,82 @@ func decodeValidateTokenRequest(_ context.Context, r *http.Request) (interface{}
 	return validateTokenRequest{Token: token}, nil
 }
 
+func decodeForgotPasswordRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func decodeResetPasswordRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func decodeVerifyEmailRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req verifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func decodeResendVerificationRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req resendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func decodeLoginMFARequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req loginMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func decodeEnrollMFARequest(_ context.Context, _ *http.Request) (interface{}, error) {
+	return nil, nil
+}
+
+func decodeConfirmMFARequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req confirmMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func decodeDisableMFARequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req disableMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func decodeCreateAccessTokenRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req createAccessTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func decodeListAccessTokensRequest(_ context.Context, _ *http.Request) (interface{}, error) {
+	return nil, nil
+}
+
+func decodeRevokeAccessTokenRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return revokeAccessTokenRequest{TokenID: mux.Vars(r)["id"]}, nil
+}
+
 func decodeCreateTodoRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var req createTodoRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -62,8 +144,22 @@ func decodeListTodosRequest(_ context.Context, r *http.Request) (interface{}, er
 		}
 	}
 
+	var filter TodoFilter
+	if c := r.URL.Query().Get("completed"); c != "" {
+		if parsed, err := strconv.ParseBool(c); err == nil {
+			filter.Completed = &parsed
+		}
+	}
+	filter.ListIDs = r.URL.Query()["list_id"]
+	filter.Tag = r.URL.Query().Get("tag")
+	filter.Search = r.URL.Query().Get("q")
+	filter.SharedWithMe, _ = strconv.ParseBool(r.URL.Query().Get("shared"))
+	filter.AssignedToMe, _ = strconv.ParseBool(r.URL.Query().Get("assigned_to_me"))
+	filter.Sort = r.URL.Query().Get("sort")
+
 	return listTodosRequest{
 		UserID: userID,
+		Filter: filter,
 		Limit:  limit,
 		Offset: offset,
 	}, nil
@@ -86,6 +182,193 @@ func decodeCompleteTodoRequest(_ context.Context, r *http.Request) (interface{},
 	}, nil
 }
 
+func decodeUpdateTodoRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req updateTodoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.TodoID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func decodeDeleteTodoRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return deleteTodoRequest{
+		UserID: r.URL.Query().Get("user_id"),
+		TodoID: mux.Vars(r)["id"],
+	}, nil
+}
+
+func decodeTodoEventsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	var req todoEventsRequest
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		req.LastEventID = id
+	}
+	return req, nil
+}
+
+// populateAuthTokenFromQuery accepts the token as an access_token query
+// parameter, since browsers cannot set headers on an EventSource.
+func populateAuthTokenFromQuery(ctx context.Context, r *http.Request) context.Context {
+	if _, ok := ctx.Value(tokenContextKey).(string); ok {
+		return ctx
+	}
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return context.WithValue(ctx, tokenContextKey, token)
+	}
+	return ctx
+}
+
+const (
+	eventStreamHeartbeat = 15 * time.Second
+	eventStreamRetry     = 3 * time.Second
+)
+
+// encodeEventStream writes the replayed events and then every new event as
+// Server-Sent Events until the client disconnects or falls behind. A "reset"
+// event tells a resuming client that events were lost and it should refetch.
+func encodeEventStream(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	stream := response.(todoEventsResponse)
+	defer stream.sub.Close()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("streaming unsupported")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", eventStreamRetry.Milliseconds())
+	if !stream.complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, event := range stream.replay {
+		if err := writeEvent(w, event); err != nil {
+			return err
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-stream.sub.C:
+			if !ok {
+				return nil
+			}
+			if err := writeEvent(w, event); err != nil {
+				return err
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return err
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeEvent(w io.Writer, event TodoEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+func decodeCreateListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req createListRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func decodeListListsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	shared, _ := strconv.ParseBool(r.URL.Query().Get("shared"))
+	return listListsRequest{UserID: r.URL.Query().Get("user_id"), Shared: shared}, nil
+}
+
+func decodeGraphQLRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req graphqlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// encodeGraphQLError reports errors raised before the query runs, such as a
+// missing or invalid token, in the GraphQL response format.
+func encodeGraphQLError(ctx context.Context, err error, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(errorStatus(ctx, err, w))
+	json.NewEncoder(w).Encode(graphqlResponse{Errors: gqlerror.List{gqlerror.Wrap(err)}})
+}
+
+// encodeError reports errors returned by endpoint middleware, such as a
+// missing or invalid token, and requests that could not be decoded.
+func encodeError(ctx context.Context, err error, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(errorStatus(ctx, err, w))
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// errorStatus maps err to a status code, setting any headers that go with it.
+func errorStatus(ctx context.Context, err error, w http.ResponseWriter) int {
+	var rateLimitErr *RateLimitError
+	var throttledErr *LoginThrottledError
+	switch {
+	case errors.As(err, &rateLimitErr):
+		encodeRateLimitHeaders(ctx, w)
+		setRetryAfter(w, rateLimitErr.Status.RetryAfter)
+		return http.StatusTooManyRequests
+	case errors.As(err, &throttledErr):
+		setRetryAfter(w, time.Until(throttledErr.Until))
+		return http.StatusTooManyRequests
+	case err == ErrUnauthorized || err == ErrInvalidToken:
+		return http.StatusUnauthorized
+	case err == ErrInsufficientScope || err == ErrForbidden:
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
+
+func setRetryAfter(w http.ResponseWriter, d time.Duration) {
+	retryAfter := ceilSeconds(d)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+}
+
+// serverOptions are shared by every handler: they expose the request to the
+// rate limiter and report its decision in the response headers.
+func serverOptions(options ...httptransport.ServerOption) []httptransport.ServerOption {
+	return append([]httptransport.ServerOption{
+		httptransport.ServerBefore(populateRequestInfo),
+		httptransport.ServerAfter(encodeRateLimitHeaders),
+		httptransport.ServerErrorEncoder(encodeError),
+	}, options...)
+}
+
 func encodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	return json.NewEncoder(w).Encode(response)
@@ -96,6 +379,7 @@ func MakeSignupHandler(endpoints Endpoints) http.Handler {
 		endpoints.SignupEndpoint,
 		decodeSignupRequest,
 		encodeResponse,
+		serverOptions()...,
 	)
 }
 
@@ -104,6 +388,7 @@ func MakeLoginHandler(endpoints Endpoints) http.Handler {
 		endpoints.LoginEndpoint,
 		decodeLoginRequest,
 		encodeResponse,
+		serverOptions()...,
 	)
 }
 
@@ -112,6 +397,118 @@ func MakeValidateTokenHandler(endpoints Endpoints) http.Handler {
 		endpoints.ValidateTokenEndpoint,
 		decodeValidateTokenRequest,
 		encodeResponse,
+		serverOptions()...,
+	)
+}
+
+func MakeForgotPasswordHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.ForgotPasswordEndpoint,
+		decodeForgotPasswordRequest,
+		encodeResponse,
+		serverOptions()...,
+	)
+}
+
+func MakeResetPasswordHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.ResetPasswordEndpoint,
+		decodeResetPasswordRequest,
+		encodeResponse,
+		serverOptions()...,
+	)
+}
+
+func MakeVerifyEmailHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.VerifyEmailEndpoint,
+		decodeVerifyEmailRequest,
+		encodeResponse,
+		serverOptions()...,
+	)
+}
+
+func MakeResendVerificationHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.ResendVerificationEndpoint,
+		decodeResendVerificationRequest,
+		encodeResponse,
+		serverOptions()...,
+	)
+}
+
+func MakeLoginMFAHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.LoginMFAEndpoint,
+		decodeLoginMFARequest,
+		encodeResponse,
+		serverOptions()...,
+	)
+}
+
+func MakeEnrollMFAHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.EnrollMFAEndpoint,
+		decodeEnrollMFARequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeConfirmMFAHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.ConfirmMFAEndpoint,
+		decodeConfirmMFARequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeDisableMFAHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.DisableMFAEndpoint,
+		decodeDisableMFARequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeCreateAccessTokenHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.CreateAccessTokenEndpoint,
+		decodeCreateAccessTokenRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeListAccessTokensHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.ListAccessTokensEndpoint,
+		decodeListAccessTokensRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeRevokeAccessTokenHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.RevokeAccessTokenEndpoint,
+		decodeRevokeAccessTokenRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
 	)
 }
 
@@ -120,6 +517,9 @@ func MakeCreateTodoHandler(endpoints Endpoints) http.Handler {
 		endpoints.CreateTodoEndpoint,
 		decodeCreateTodoRequest,
 		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
 	)
 }
 
@@ -128,6 +528,76 @@ func MakeListTodosHandler(endpoints Endpoints) http.Handler {
 		endpoints.ListTodosEndpoint,
 		decodeListTodosRequest,
 		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeUpdateTodoHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.UpdateTodoEndpoint,
+		decodeUpdateTodoRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeDeleteTodoHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.DeleteTodoEndpoint,
+		decodeDeleteTodoRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeTodoEventsHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.TodoEventsEndpoint,
+		decodeTodoEventsRequest,
+		encodeEventStream,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken, populateAuthTokenFromQuery),
+		)...,
+	)
+}
+
+func MakeCreateListHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.CreateListEndpoint,
+		decodeCreateListRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeListListsHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.ListListsEndpoint,
+		decodeListListsRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeGraphQLHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.GraphQLEndpoint,
+		decodeGraphQLRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+			httptransport.ServerErrorEncoder(encodeGraphQLError),
+		)...,
 	)
 }
 
@@ -136,5 +606,149 @@ func MakeCompleteTodoHandler(endpoints Endpoints) http.Handler {
 		endpoints.CompleteTodoEndpoint,
 		decodeCompleteTodoRequest,
 		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
 	)
 }
+
+// Legacy unversioned routes alias v1 until legacySunset; see RFC 9745 and
+// RFC 8594 for the Deprecation and Sunset headers.
+var (
+	legacyDeprecatedAt = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	legacySunset       = time.Date(2027, time.April, 18, 0, 0, 0, 0, time.UTC)
+)
+
+// apiVersion registers the transports of one API version on its subrouter.
+// All versions share the same Endpoints, and so the same services; a version
+// only decides how requests are decoded and responses encoded, which lets a
+// /v2 with different response shapes coexist with /v1.
+type apiVersion struct {
+	prefix   string
+	register func(r *mux.Router, endpoints Endpoints)
+}
+
+var apiVersions = []apiVersion{
+	{prefix: "/v1", register: registerV1Routes},
+}
+
+// legacyVersion is the version served at the unversioned root paths.
+const legacyVersion = "/v1"
+
+func MakeHTTPHandler(endpoints Endpoints) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(endpoints.clientIPs.middleware)
+
+	r.Handle("/openapi.json", MakeOpenAPIHandler()).Methods("GET")
+	r.Handle("/docs", MakeDocsHandler()).Methods("GET")
+	r.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	r.Handle("/graphql", MakeGraphQLHandler(endpoints)).Methods("POST")
+	r.Handle("/oauth/authorize", MakeOAuthAuthorizeHandler(endpoints)).Methods("GET")
+	r.Handle("/oauth/authorize", MakeOAuthConsentHandler(endpoints)).Methods("POST")
+	r.Handle("/oauth/token", MakeOAuthTokenHandler(endpoints)).Methods("POST")
+	r.Handle("/oauth/introspect", MakeOAuthIntrospectHandler(endpoints)).Methods("POST")
+	r.Handle("/oauth/revoke", MakeOAuthRevokeHandler(endpoints)).Methods("POST")
+	r.Handle("/oidc/login", MakeOIDCLoginHandler(endpoints)).Methods("GET")
+	r.Handle("/oidc/callback", MakeOIDCCallbackHandler(endpoints)).Methods("GET")
+
+	for _, v := range apiVersions {
+		v.register(r.PathPrefix(v.prefix).Subrouter(), endpoints)
+
+		if v.prefix == legacyVersion {
+			legacy := r.NewRoute().Subrouter()
+			legacy.Use(deprecationMiddleware(v.prefix, legacyDeprecatedAt, legacySunset))
+			v.register(legacy, endpoints)
+		}
+	}
+
+	return r
+}
+
+func registerV1Routes(r *mux.Router, endpoints Endpoints) {
+	r.Handle("/signup", MakeSignupHandler(endpoints)).Methods("POST")
+	r.Handle("/login", MakeLoginHandler(endpoints)).Methods("POST")
+	r.Handle("/login/mfa", MakeLoginMFAHandler(endpoints)).Methods("POST")
+	r.Handle("/mfa/enroll", MakeEnrollMFAHandler(endpoints)).Methods("POST")
+	r.Handle("/mfa/confirm", MakeConfirmMFAHandler(endpoints)).Methods("POST")
+	r.Handle("/mfa/disable", MakeDisableMFAHandler(endpoints)).Methods("POST")
+	r.Handle("/tokens", MakeCreateAccessTokenHandler(endpoints)).Methods("POST")
+	r.Handle("/tokens", MakeListAccessTokensHandler(endpoints)).Methods("GET")
+	r.Handle("/tokens/{id}", MakeRevokeAccessTokenHandler(endpoints)).Methods("DELETE")
+	r.Handle("/oauth/clients", MakeCreateOAuthClientHandler(endpoints)).Methods("POST")
+	r.Handle("/validate", MakeValidateTokenHandler(endpoints)).Methods("POST", "GET")
+	r.Handle("/password/forgot", MakeForgotPasswordHandler(endpoints)).Methods("POST")
+	r.Handle("/password/reset", MakeResetPasswordHandler(endpoints)).Methods("POST")
+	r.Handle("/verify-email", MakeVerifyEmailHandler(endpoints)).Methods("POST")
+	r.Handle("/verify-email/resend", MakeResendVerificationHandler(endpoints)).Methods("POST")
+	r.Handle("/todos", MakeCreateTodoHandler(endpoints)).Methods("POST")
+	r.Handle("/todos", MakeListTodosHandler(endpoints)).Methods("GET")
+	r.Handle("/todos/events", MakeTodoEventsHandler(endpoints)).Methods("GET")
+	r.Handle("/todos/next", MakeListNextTodosHandler(endpoints)).Methods("GET")
+	r.Handle("/sync", MakeSyncHandler(endpoints)).Methods("GET")
+	r.Handle("/todos/{id}", MakeUpdateTodoHandler(endpoints)).Methods("PATCH")
+	r.Handle("/todos/{id}", MakeDeleteTodoHandler(endpoints)).Methods("DELETE")
+	r.Handle("/todos/{id}/complete", MakeCompleteTodoHandler(endpoints)).Methods("POST")
+	r.Handle("/todos/{id}/assignee", MakeAssignTodoHandler(endpoints)).Methods("PUT")
+	r.Handle("/todos/{id}/assignee", MakeUnassignTodoHandler(endpoints)).Methods("DELETE")
+	r.Handle("/todos/{id}/comments", MakeAddCommentHandler(endpoints)).Methods("POST")
+	r.Handle("/todos/{id}/comments", MakeListCommentsHandler(endpoints)).Methods("GET")
+	r.Handle("/todos/{id}/comments/{comment_id}", MakeEditCommentHandler(endpoints)).Methods("PATCH")
+	r.Handle("/todos/{id}/comments/{comment_id}", MakeDeleteCommentHandler(endpoints)).Methods("DELETE")
+	r.Handle("/todos/{id}/activity", MakeTodoActivityHandler(endpoints)).Methods("GET")
+	r.Handle("/todos/{id}/history", MakeTodoHistoryHandler(endpoints)).Methods("GET")
+	r.Handle("/todos/{id}/revert", MakeRevertTodoHandler(endpoints)).Methods("POST")
+	r.Handle("/todos/{id}/move", MakeMoveTodoHandler(endpoints)).Methods("POST")
+	r.Handle("/todos/{id}/transition", MakeTransitionTodoHandler(endpoints)).Methods("POST")
+	r.Handle("/todos/{id}/blockers", MakeAddBlockerHandler(endpoints)).Methods("POST")
+	r.Handle("/todos/{id}/blockers/{blocker_id}", MakeRemoveBlockerHandler(endpoints)).Methods("DELETE")
+	r.Handle("/todos/{id}/attachments", MakeAddAttachmentHandler(endpoints)).Methods("POST")
+	r.Handle("/todos/{id}/attachments", MakeListAttachmentsHandler(endpoints)).Methods("GET")
+	r.Handle("/todos/{id}/attachments/{attachment_id}", MakeDownloadAttachmentHandler(endpoints)).Methods("GET")
+	r.Handle("/todos/{id}/attachments/{attachment_id}", MakeDeleteAttachmentHandler(endpoints)).Methods("DELETE")
+	r.Handle("/attachments/usage", MakeAttachmentUsageHandler(endpoints)).Methods("GET")
+	r.Handle("/todos/{id}/timer", MakeStartTimerHandler(endpoints)).Methods("POST")
+	r.Handle("/timer/stop", MakeStopTimerHandler(endpoints)).Methods("POST")
+	r.Handle("/todos/{id}/time-entries", MakeAddTimeEntryHandler(endpoints)).Methods("POST")
+	r.Handle("/todos/{id}/time-entries", MakeListTimeEntriesHandler(endpoints)).Methods("GET")
+	r.Handle("/todos/{id}/time-entries/{entry_id}", MakeDeleteTimeEntryHandler(endpoints)).Methods("DELETE")
+	r.Handle("/time/report", MakeTimeReportHandler(endpoints)).Methods("GET")
+	r.Handle("/time/timesheet", MakeTimesheetHandler(endpoints)).Methods("GET")
+	r.Handle("/lists", MakeCreateListHandler(endpoints)).Methods("POST")
+	r.Handle("/lists", MakeListListsHandler(endpoints)).Methods("GET")
+	r.Handle("/lists/{id}/members", MakeShareListHandler(endpoints)).Methods("POST")
+	r.Handle("/lists/{id}/members", MakeListMembersHandler(endpoints)).Methods("GET")
+	r.Handle("/lists/{id}/workflow", MakeGetWorkflowHandler(endpoints)).Methods("GET")
+	r.Handle("/lists/{id}/workflow", MakeSetWorkflowHandler(endpoints)).Methods("PUT")
+	r.Handle("/lists/{id}/board", MakeListBoardHandler(endpoints)).Methods("GET")
+	r.Handle("/lists/{id}/members/{user_id}", MakeSetMemberRoleHandler(endpoints)).Methods("PUT")
+	r.Handle("/lists/{id}/members/{user_id}", MakeRemoveMemberHandler(endpoints)).Methods("DELETE")
+	r.Handle("/invitations", MakeListInvitationsHandler(endpoints)).Methods("GET")
+	r.Handle("/invitations/{id}/accept", MakeAcceptInvitationHandler(endpoints)).Methods("POST")
+	r.Handle("/invitations/{id}/decline", MakeDeclineInvitationHandler(endpoints)).Methods("POST")
+	r.Handle("/admin/users", MakeAdminListUsersHandler(endpoints)).Methods("GET")
+	r.Handle("/admin/users/{id}", MakeAdminGetUserHandler(endpoints)).Methods("GET")
+	r.Handle("/admin/users/{id}/role", MakeAdminSetRoleHandler(endpoints)).Methods("PUT")
+	r.Handle("/admin/users/{id}/disable", MakeAdminDisableUserHandler(endpoints)).Methods("POST")
+	r.Handle("/admin/users/{id}/enable", MakeAdminEnableUserHandler(endpoints)).Methods("POST")
+	r.Handle("/admin/users/{id}/mfa/reset", MakeAdminResetMFAHandler(endpoints)).Methods("POST")
+	r.Handle("/admin/users/{id}/unlock", MakeAdminUnlockUserHandler(endpoints)).Methods("POST")
+	r.Handle("/admin/users/{id}/todos", MakeAdminListTodosHandler(endpoints)).Methods("GET")
+	r.Handle("/admin/audit", MakeAdminAuditHandler(endpoints)).Methods("GET")
+	r.Handle("/admin/security-events", MakeAdminSecurityLogHandler(endpoints)).Methods("GET")
+}
+
+// deprecationMiddleware marks responses as deprecated and points clients at
+// the same path under successorPrefix.
+func deprecationMiddleware(successorPrefix string, deprecatedAt, sunset time.Time) mux.MiddlewareFunc {
+	deprecation := fmt.Sprintf("@%d", deprecatedAt.Unix())
+	sunsetHeader := sunset.UTC().Format(http.TimeFormat)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunsetHeader)
+			w.Header().Add("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successorPrefix, r.URL.Path))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
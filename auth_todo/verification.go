@@ -0,0 +1,272 @@
+package auth_todo
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/mail"
+	"time"
+)
+
+// validateEmail accepts a bare RFC 5322 address such as user@example.com.
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return ErrInvalidEmail
+	}
+	return nil
+}
+
+// sendVerification mails a new verification token to u, replacing any token
+// sent before.
+func (s *authService) sendVerification(u user) error {
+	token, err := newSecret()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.verifications.issue(u.ID, token, time.Now())
+	s.mu.Unlock()
+
+	mail := Mail{
+		To:      u.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Confirm that this is your email address by opening this link within %s:\n\n%s\n\n"+
+			"If you did not sign up, ignore this mail.\n",
+			s.verifications.ttl, link(s.appURL, "verify-email", token)),
+	}
+	go s.mailer.Send(context.Background(), mail)
+	return nil
+}
+
+// VerifyEmail marks the account of a token mailed at signup or by
+// ResendVerification as verified.
+func (s *authService) VerifyEmail(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID, valid := s.verifications.consume(token, time.Now())
+	email, exists := s.emailsByID[userID]
+	if !valid || !exists {
+		return ErrInvalidVerifyToken
+	}
+
+	u := s.users[email]
+	u.Verified = true
+	s.users[email] = u
+	return nil
+}
+
+// ResendVerification mails a new verification token to email if it belongs
+// to an unverified account and the last token is older than resendAfter.
+// Like RequestPasswordReset, it succeeds either way.
+func (s *authService) ResendVerification(ctx context.Context, email string) error {
+	if email == "" {
+		return ErrEmptyEmail
+	}
+
+	s.mu.RLock()
+	u, exists := s.users[email]
+	issuedAt, issued := s.verifications.issuedAt(u.ID)
+	s.mu.RUnlock()
+
+	if !exists || u.Verified || (issued && time.Since(issuedAt) < s.resendAfter) {
+		return nil
+	}
+	return s.sendVerification(u)
+}
+
+type verifiedEmailTodoMiddleware struct {
+	authSvc AuthService
+	next    TodoService
+}
+
+// NewVerifiedEmailTodoMiddleware refuses to create todos for users who have
+// not verified their email address yet. Everything else, including reading
+// and completing existing todos, is allowed.
+func NewVerifiedEmailTodoMiddleware(authSvc AuthService, svc TodoService) TodoService {
+	return &verifiedEmailTodoMiddleware{
+		authSvc: authSvc,
+		next:    svc,
+	}
+}
+
+func (mw *verifiedEmailTodoMiddleware) CreateTodo(ctx context.Context, userID string, input TodoInput) (string, error) {
+	u, err := mw.authSvc.GetUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if !u.EmailVerified {
+		return "", ErrEmailNotVerified
+	}
+	return mw.next.CreateTodo(ctx, userID, input)
+}
+
+func (mw *verifiedEmailTodoMiddleware) GetTodo(ctx context.Context, userID, todoID string) (Todo, error) {
+	return mw.next.GetTodo(ctx, userID, todoID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) ListTodos(ctx context.Context, userID string, filter TodoFilter, limit, offset int) ([]Todo, int, error) {
+	return mw.next.ListTodos(ctx, userID, filter, limit, offset)
+}
+
+func (mw *verifiedEmailTodoMiddleware) CompleteTodo(ctx context.Context, userID, todoID string) error {
+	return mw.next.CompleteTodo(ctx, userID, todoID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) UpdateTodo(ctx context.Context, userID, todoID string, patch TodoPatch) (Todo, error) {
+	return mw.next.UpdateTodo(ctx, userID, todoID, patch)
+}
+
+func (mw *verifiedEmailTodoMiddleware) DeleteTodo(ctx context.Context, userID, todoID string) error {
+	return mw.next.DeleteTodo(ctx, userID, todoID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) CreateList(ctx context.Context, userID, name string) (string, error) {
+	return mw.next.CreateList(ctx, userID, name)
+}
+
+func (mw *verifiedEmailTodoMiddleware) ListLists(ctx context.Context, userID string) ([]List, error) {
+	return mw.next.ListLists(ctx, userID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) ListTags(ctx context.Context, userID string) ([]Tag, error) {
+	return mw.next.ListTags(ctx, userID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) ShareList(ctx context.Context, userID, listID, email, role string) (Invitation, error) {
+	return mw.next.ShareList(ctx, userID, listID, email, role)
+}
+
+func (mw *verifiedEmailTodoMiddleware) ListInvitations(ctx context.Context, email string) ([]Invitation, error) {
+	return mw.next.ListInvitations(ctx, email)
+}
+
+func (mw *verifiedEmailTodoMiddleware) RespondToInvitation(ctx context.Context, userID, email, invitationID string, accept bool) error {
+	return mw.next.RespondToInvitation(ctx, userID, email, invitationID, accept)
+}
+
+func (mw *verifiedEmailTodoMiddleware) ListMembers(ctx context.Context, userID, listID string) ([]ListMember, error) {
+	return mw.next.ListMembers(ctx, userID, listID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) SetMemberRole(ctx context.Context, userID, listID, memberID, role string) error {
+	return mw.next.SetMemberRole(ctx, userID, listID, memberID, role)
+}
+
+func (mw *verifiedEmailTodoMiddleware) RemoveMember(ctx context.Context, userID, listID, memberID string) error {
+	return mw.next.RemoveMember(ctx, userID, listID, memberID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) AssignTodo(ctx context.Context, userID, todoID, assigneeID string) (Todo, error) {
+	return mw.next.AssignTodo(ctx, userID, todoID, assigneeID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) AddComment(ctx context.Context, userID, todoID, text string) (Comment, error) {
+	return mw.next.AddComment(ctx, userID, todoID, text)
+}
+
+func (mw *verifiedEmailTodoMiddleware) EditComment(ctx context.Context, userID, todoID, commentID, text string) (Comment, error) {
+	return mw.next.EditComment(ctx, userID, todoID, commentID, text)
+}
+
+func (mw *verifiedEmailTodoMiddleware) DeleteComment(ctx context.Context, userID, todoID, commentID string) error {
+	return mw.next.DeleteComment(ctx, userID, todoID, commentID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) ListComments(ctx context.Context, userID, todoID string, limit, offset int) ([]Comment, int, error) {
+	return mw.next.ListComments(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *verifiedEmailTodoMiddleware) TodoActivity(ctx context.Context, userID, todoID string, limit, offset int) ([]Activity, int, error) {
+	return mw.next.TodoActivity(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *verifiedEmailTodoMiddleware) TodoHistory(ctx context.Context, userID, todoID string, limit, offset int) ([]TodoChange, int, error) {
+	return mw.next.TodoHistory(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *verifiedEmailTodoMiddleware) RevertTodo(ctx context.Context, userID, todoID string, version int) (Todo, error) {
+	return mw.next.RevertTodo(ctx, userID, todoID, version)
+}
+
+func (mw *verifiedEmailTodoMiddleware) MoveTodo(ctx context.Context, userID, todoID string, move TodoMove) (Todo, error) {
+	return mw.next.MoveTodo(ctx, userID, todoID, move)
+}
+
+func (mw *verifiedEmailTodoMiddleware) GetWorkflow(ctx context.Context, userID, listID string) (Workflow, error) {
+	return mw.next.GetWorkflow(ctx, userID, listID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) SetWorkflow(ctx context.Context, userID, listID string, workflow Workflow) (Workflow, error) {
+	return mw.next.SetWorkflow(ctx, userID, listID, workflow)
+}
+
+func (mw *verifiedEmailTodoMiddleware) TransitionTodo(ctx context.Context, userID, todoID, status string) (Todo, error) {
+	return mw.next.TransitionTodo(ctx, userID, todoID, status)
+}
+
+func (mw *verifiedEmailTodoMiddleware) ListBoard(ctx context.Context, userID, listID string) (Board, error) {
+	return mw.next.ListBoard(ctx, userID, listID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) AddBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error) {
+	return mw.next.AddBlocker(ctx, userID, todoID, blockerID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) RemoveBlocker(ctx context.Context, userID, todoID, blockerID string) (Todo, error) {
+	return mw.next.RemoveBlocker(ctx, userID, todoID, blockerID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) ListNextTodos(ctx context.Context, userID string, limit, offset int) ([]Todo, int, error) {
+	return mw.next.ListNextTodos(ctx, userID, limit, offset)
+}
+
+func (mw *verifiedEmailTodoMiddleware) AddAttachment(ctx context.Context, userID, todoID, name string, r io.Reader) (Attachment, error) {
+	return mw.next.AddAttachment(ctx, userID, todoID, name, r)
+}
+
+func (mw *verifiedEmailTodoMiddleware) ListAttachments(ctx context.Context, userID, todoID string) ([]Attachment, error) {
+	return mw.next.ListAttachments(ctx, userID, todoID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) OpenAttachment(ctx context.Context, userID, todoID, attachmentID string) (Attachment, io.ReadCloser, error) {
+	return mw.next.OpenAttachment(ctx, userID, todoID, attachmentID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) DeleteAttachment(ctx context.Context, userID, todoID, attachmentID string) error {
+	return mw.next.DeleteAttachment(ctx, userID, todoID, attachmentID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) AttachmentUsage(ctx context.Context, userID string) (int64, int64, error) {
+	return mw.next.AttachmentUsage(ctx, userID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) StartTimer(ctx context.Context, userID, todoID, note string) (TimeEntry, error) {
+	return mw.next.StartTimer(ctx, userID, todoID, note)
+}
+
+func (mw *verifiedEmailTodoMiddleware) StopTimer(ctx context.Context, userID string) (TimeEntry, error) {
+	return mw.next.StopTimer(ctx, userID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) AddTimeEntry(ctx context.Context, userID, todoID string, input TimeEntryInput) (TimeEntry, error) {
+	return mw.next.AddTimeEntry(ctx, userID, todoID, input)
+}
+
+func (mw *verifiedEmailTodoMiddleware) ListTimeEntries(ctx context.Context, userID, todoID string, limit, offset int) ([]TimeEntry, int, error) {
+	return mw.next.ListTimeEntries(ctx, userID, todoID, limit, offset)
+}
+
+func (mw *verifiedEmailTodoMiddleware) DeleteTimeEntry(ctx context.Context, userID, todoID, entryID string) error {
+	return mw.next.DeleteTimeEntry(ctx, userID, todoID, entryID)
+}
+
+func (mw *verifiedEmailTodoMiddleware) TimeReport(ctx context.Context, userID string, query TimeQuery) (TimeReport, error) {
+	return mw.next.TimeReport(ctx, userID, query)
+}
+
+func (mw *verifiedEmailTodoMiddleware) Timesheet(ctx context.Context, userID string, query TimeQuery) ([]TimesheetEntry, error) {
+	return mw.next.Timesheet(ctx, userID, query)
+}
@@ -0,0 +1,60 @@
+package auth_todo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestEmailVerification(t *testing.T) {
+	ctx := context.Background()
+	outbox := make(channelMailer, 4)
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost), WithMailer(outbox, "https://todo.example.com"))
+	todoSvc := NewVerifiedEmailTodoMiddleware(authSvc, NewTodoService())
+
+	for _, email := range []string{"not an email", "Name <test@example.com>", "test@"} {
+		if _, err := authSvc.Signup(ctx, email, "password123"); err != ErrInvalidEmail {
+			t.Errorf("Signup(%q): expected ErrInvalidEmail, got %v", email, err)
+		}
+	}
+
+	userID, _ := authSvc.Signup(ctx, "test@example.com", "password123")
+	first := receiveToken(t, outbox, "Verify your email address")
+
+	if _, err := todoSvc.CreateTodo(ctx, userID, TodoInput{Text: "Too early"}); err != ErrEmailNotVerified {
+		t.Fatalf("Expected ErrEmailNotVerified, got %v", err)
+	}
+
+	// A resend within a minute of the last mail is silently dropped.
+	authSvc.ResendVerification(ctx, "test@example.com")
+	authSvc.ResendVerification(ctx, "nobody@example.com")
+	if len(outbox) != 0 {
+		t.Fatal("Expected no mail to be sent")
+	}
+
+	authSvc.(*authService).resendAfter = 0
+	authSvc.ResendVerification(ctx, "test@example.com")
+	second := receiveToken(t, outbox, "Verify your email address")
+
+	if err := authSvc.VerifyEmail(ctx, first); err != ErrInvalidVerifyToken {
+		t.Errorf("Expected the superseded token to be rejected, got %v", err)
+	}
+	if err := authSvc.VerifyEmail(ctx, second); err != nil {
+		t.Fatalf("VerifyEmail failed: %v", err)
+	}
+	if u, _ := authSvc.GetUser(ctx, userID); !u.EmailVerified {
+		t.Error("Expected the user to be verified")
+	}
+	if _, err := todoSvc.CreateTodo(ctx, userID, TodoInput{Text: "Verified"}); err != nil {
+		t.Errorf("Expected todo creation after verification, got %v", err)
+	}
+
+	authSvc.ResendVerification(ctx, "test@example.com")
+	select {
+	case mail := <-outbox:
+		t.Errorf("Expected no mail for a verified account, got %q", mail.Subject)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,359 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	syncWriteTimeout = 10 * time.Second
+	syncPongTimeout  = 60 * time.Second
+	syncPingInterval = syncPongTimeout * 9 / 10
+	syncMaxMessage   = 64 << 10
+	// syncSendBuffer is how many outgoing messages may queue for a connection
+	// before it is considered a slow consumer and closed.
+	syncSendBuffer = 64
+	// syncAllLists subscribes a connection to every todo of its user.
+	syncAllLists = "*"
+)
+
+var (
+	ErrUnknownMessageType = errors.New("unknown message type")
+	errSlowConsumer       = errors.New("slow consumer")
+)
+
+// syncMessage is sent by clients. Mutations carry the same JSON bodies as
+// their REST counterparts in Payload.
+type syncMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	ListID  string          `json:"list_id,omitempty"`
+	TodoID  string          `json:"todo_id,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// syncReply is sent to clients: the result of a message with the same ID, an
+// error, or an event for a subscribed list.
+type syncReply struct {
+	ID     string      `json:"id,omitempty"`
+	Type   string      `json:"type"`
+	ListID string      `json:"list_id,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+	Event  *TodoEvent  `json:"event,omitempty"`
+	Err    string      `json:"error,omitempty"`
+}
+
+type syncHandler struct {
+	endpoints Endpoints
+	upgrader  websocket.Upgrader
+}
+
+// MakeSyncHandler serves the bidirectional sync channel. The token is checked
+// with ValidateToken before the upgrade and again before every mutation, so a
+// revoked session cannot keep writing over an open connection. Mutations are
+// dispatched to the same endpoints as the REST API and events are delivered
+// to every connection of the user subscribed to the todo's list.
+func MakeSyncHandler(endpoints Endpoints) http.Handler {
+	return &syncHandler{
+		endpoints: endpoints,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  4096,
+			WriteBufferSize: 4096,
+		},
+	}
+}
+
+func (h *syncHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := populateAuthTokenFromQuery(populateAuthToken(populateRequestInfo(r.Context(), r), r), r)
+	token, _ := ctx.Value(tokenContextKey).(string)
+
+	userID, err := h.validate(ctx, token)
+	if err != nil {
+		encodeError(ctx, err, w)
+		return
+	}
+
+	events, err := h.endpoints.TodoEventsEndpoint(ctx, todoEventsRequest{})
+	if err != nil {
+		encodeError(ctx, err, w)
+		return
+	}
+	sub := events.(todoEventsResponse).sub
+
+	ws, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		sub.Close()
+		return
+	}
+
+	// The connection outlives the request context, which the server cancels
+	// once ServeHTTP returns after hijacking. Mutations are rate limited as the
+	// connection's user.
+	connCtx := context.WithValue(context.Background(), tokenContextKey, token)
+	connCtx = context.WithValue(connCtx, userIDContextKey, userID)
+	info := *ctx.Value(requestInfoContextKey).(*requestInfo)
+	info.rateLimit = nil
+	connCtx = context.WithValue(connCtx, requestInfoContextKey, &info)
+	connCtx, cancel := context.WithCancel(connCtx)
+	c := &syncConn{
+		handler: h,
+		ws:      ws,
+		ctx:     connCtx,
+		cancel:  cancel,
+		token:   token,
+		userID:  userID,
+		sub:     sub,
+		send:    make(chan syncReply, syncSendBuffer),
+		lists:   make(map[string]bool),
+	}
+
+	go c.writePump()
+	go c.eventPump()
+	c.readPump()
+}
+
+func (h *syncHandler) validate(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", ErrUnauthorized
+	}
+	resp, err := h.endpoints.ValidateTokenEndpoint(ctx, validateTokenRequest{Token: token})
+	if err != nil {
+		return "", err
+	}
+	validated := resp.(validateTokenResponse)
+	if validated.Err != "" {
+		return "", ErrInvalidToken
+	}
+	return validated.UserID, nil
+}
+
+type syncConn struct {
+	handler *syncHandler
+	ws      *websocket.Conn
+	ctx     context.Context
+	cancel  context.CancelFunc
+	token   string
+	userID  string
+	sub     *EventSubscription
+	send    chan syncReply
+
+	mu        sync.Mutex
+	lists     map[string]bool
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// enqueue queues a reply without blocking. A full queue means the client is
+// not reading fast enough; rather than buffer without bound or stall the
+// other connections of the user, the connection is closed and the client is
+// expected to reconnect and refetch.
+func (c *syncConn) enqueue(reply syncReply) bool {
+	select {
+	case <-c.ctx.Done():
+		return false
+	default:
+	}
+	select {
+	case c.send <- reply:
+		return true
+	default:
+		c.close(errSlowConsumer)
+		return false
+	}
+}
+
+func (c *syncConn) close(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closeErr = err
+		c.mu.Unlock()
+		c.cancel()
+		c.sub.Close()
+	})
+}
+
+func (c *syncConn) readPump() {
+	defer c.close(nil)
+
+	c.ws.SetReadLimit(syncMaxMessage)
+	c.ws.SetReadDeadline(time.Now().Add(syncPongTimeout))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(syncPongTimeout))
+	})
+
+	for {
+		var msg syncMessage
+		if err := c.ws.ReadJSON(&msg); err != nil {
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+				c.enqueue(syncReply{Type: "error", Err: err.Error()})
+				continue
+			}
+			return
+		}
+		if !c.handle(msg) {
+			return
+		}
+	}
+}
+
+func (c *syncConn) handle(msg syncMessage) bool {
+	switch msg.Type {
+	case "ping":
+		return c.enqueue(syncReply{ID: msg.ID, Type: "pong"})
+	case "subscribe", "unsubscribe":
+		listID := msg.ListID
+		if listID == "" {
+			listID = syncAllLists
+		}
+		c.mu.Lock()
+		if msg.Type == "subscribe" {
+			c.lists[listID] = true
+		} else {
+			delete(c.lists, listID)
+		}
+		c.mu.Unlock()
+		return c.enqueue(syncReply{ID: msg.ID, Type: msg.Type + "d", ListID: listID})
+	}
+
+	result, err := c.mutate(msg)
+	if err != nil {
+		ok := c.enqueue(syncReply{ID: msg.ID, Type: "error", Err: err.Error()})
+		return ok && err != ErrInvalidToken && err != ErrUnauthorized
+	}
+	return c.enqueue(syncReply{ID: msg.ID, Type: "result", Result: result})
+}
+
+// mutate dispatches a mutation to its endpoint on behalf of the connection's
+// user, after re-validating the token.
+func (c *syncConn) mutate(msg syncMessage) (interface{}, error) {
+	if _, err := c.handler.validate(c.ctx, c.token); err != nil {
+		return nil, err
+	}
+
+	endpoints := c.handler.endpoints
+	switch msg.Type {
+	case "create_todo":
+		var req createTodoRequest
+		if err := decodePayload(msg.Payload, &req); err != nil {
+			return nil, err
+		}
+		req.UserID = c.userID
+		return endpoints.CreateTodoEndpoint(c.ctx, req)
+	case "update_todo":
+		var req updateTodoRequest
+		if err := decodePayload(msg.Payload, &req); err != nil {
+			return nil, err
+		}
+		req.UserID = c.userID
+		req.TodoID = msg.TodoID
+		return endpoints.UpdateTodoEndpoint(c.ctx, req)
+	case "complete_todo":
+		return endpoints.CompleteTodoEndpoint(c.ctx, completeTodoRequest{UserID: c.userID, TodoID: msg.TodoID})
+	case "delete_todo":
+		return endpoints.DeleteTodoEndpoint(c.ctx, deleteTodoRequest{UserID: c.userID, TodoID: msg.TodoID})
+	}
+	return nil, ErrUnknownMessageType
+}
+
+func decodePayload(payload json.RawMessage, v interface{}) error {
+	if len(payload) == 0 {
+		return nil
+	}
+	return json.Unmarshal(payload, v)
+}
+
+// eventPump forwards the user's events for subscribed lists.
+func (c *syncConn) eventPump() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case event, ok := <-c.sub.C:
+			if !ok {
+				if c.sub.Dropped() {
+					c.close(errSlowConsumer)
+				}
+				return
+			}
+			if !c.subscribed(event) {
+				continue
+			}
+			if !c.enqueue(syncReply{Type: "event", ListID: eventListID(event), Event: &event}) {
+				return
+			}
+		}
+	}
+}
+
+func (c *syncConn) subscribed(event TodoEvent) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lists[syncAllLists] || c.lists[eventListID(event)]
+}
+
+func eventListID(event TodoEvent) string {
+	if event.Todo == nil {
+		return ""
+	}
+	return event.Todo.ListID
+}
+
+func (c *syncConn) writePump() {
+	ping := time.NewTicker(syncPingInterval)
+	defer func() {
+		ping.Stop()
+		c.ws.Close()
+	}()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			c.mu.Lock()
+			err := c.closeErr
+			c.mu.Unlock()
+			code, text := websocket.CloseNormalClosure, ""
+			if err == errSlowConsumer {
+				code, text = websocket.CloseTryAgainLater, err.Error()
+			} else {
+				c.flush()
+			}
+			c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(syncWriteTimeout))
+			return
+		case reply := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(syncWriteTimeout))
+			if err := c.ws.WriteJSON(reply); err != nil {
+				c.close(err)
+				return
+			}
+		case <-ping.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(syncWriteTimeout)); err != nil {
+				c.close(err)
+				return
+			}
+		}
+	}
+}
+
+// flush writes whatever is still queued, such as the error explaining why
+// the connection is being closed.
+func (c *syncConn) flush() {
+	for {
+		select {
+		case reply := <-c.send:
+			c.ws.SetWriteDeadline(time.Now().Add(syncWriteTimeout))
+			if err := c.ws.WriteJSON(reply); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package auth_todo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialSync(t *testing.T, url, token string) *websocket.Conn {
+	t.Helper()
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("Dial failed: %v (%v)", err, resp)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func readReply(t *testing.T, conn *websocket.Conn, replyType string) syncReply {
+	t.Helper()
+	for {
+		var reply syncReply
+		if err := conn.ReadJSON(&reply); err != nil {
+			t.Fatalf("ReadJSON failed waiting for %s: %v", replyType, err)
+		}
+		if reply.Type == replyType {
+			return reply
+		}
+	}
+}
+
+func TestSyncChannel(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService()
+	authSvc.Signup(ctx, "test@example.com", "password123")
+	token, _ := authSvc.Login(ctx, "test@example.com", "password123")
+	userID, _ := authSvc.ValidateToken(ctx, token)
+
+	broker := NewEventBroker(16)
+	todoSvc := NewEventingTodoMiddleware(broker, NewTodoService())
+	listID, _ := todoSvc.CreateList(ctx, userID, "Board")
+
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(authSvc, todoSvc, broker, nil)))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/v1/sync"
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 without a token, got %v", err)
+	}
+
+	writer := dialSync(t, url, token)
+	defer writer.Close()
+	reader := dialSync(t, url+"?access_token="+token, "")
+	defer reader.Close()
+
+	reader.WriteJSON(syncMessage{ID: "1", Type: "subscribe", ListID: listID})
+	if reply := readReply(t, reader, "subscribed"); reply.ID != "1" || reply.ListID != listID {
+		t.Fatalf("Unexpected subscribe reply: %+v", reply)
+	}
+	writer.WriteJSON(syncMessage{ID: "2", Type: "subscribe"})
+	readReply(t, writer, "subscribed")
+
+	// A todo outside the subscribed list only reaches the "*" subscriber.
+	writer.WriteJSON(syncMessage{ID: "3", Type: "create_todo", Payload: []byte(`{"text":"Elsewhere"}`)})
+	readReply(t, writer, "result")
+	if reply := readReply(t, writer, "event"); reply.Event.Type != TodoCreated {
+		t.Fatalf("Expected created event, got %+v", reply)
+	}
+
+	writer.WriteJSON(syncMessage{ID: "4", Type: "create_todo", Payload: []byte(`{"text":"On the board","list_id":"` + listID + `"}`)})
+	result := readReply(t, writer, "result")
+	todoID := result.Result.(map[string]interface{})["todo_id"].(string)
+
+	event := readReply(t, reader, "event")
+	if event.ListID != listID || event.Event.TodoID != todoID {
+		t.Fatalf("Expected event for %s in %s, got %+v", todoID, listID, event)
+	}
+
+	writer.WriteJSON(syncMessage{ID: "5", Type: "complete_todo", TodoID: todoID})
+	if event := readReply(t, reader, "event"); event.Event.Type != TodoCompleted {
+		t.Fatalf("Expected completed event, got %+v", event.Event)
+	}
+
+	writer.WriteJSON(syncMessage{ID: "6", Type: "bogus"})
+	if reply := readReply(t, writer, "error"); reply.ID != "6" || reply.Err != ErrUnknownMessageType.Error() {
+		t.Fatalf("Unexpected error reply: %+v", reply)
+	}
+}
@@ -0,0 +1,284 @@
+package auth_todo
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// TodoTransitioned is the type of the history and activity entries of
+// status changes made with TransitionTodo.
+const TodoTransitioned = "transitioned"
+
+const (
+	maxWorkflowStatuses     = 20
+	maxWorkflowStatusLength = 50
+)
+
+var (
+	ErrInvalidWorkflow      = errors.New("a workflow needs 2 to 20 statuses with unique names of up to 50 characters")
+	ErrUnknownStatus        = errors.New("status is not part of the workflow")
+	ErrTransitionNotAllowed = errors.New("the workflow does not allow this transition")
+	ErrWIPLimitReached      = errors.New("status has reached its WIP limit")
+)
+
+// WorkflowStatus is a status of a workflow and a column of its board.
+// WIPLimit caps how many todos may be moved into the status; zero means no
+// limit.
+type WorkflowStatus struct {
+	Name     string
+	WIPLimit int `json:",omitempty"`
+}
+
+// Workflow is the sequence of statuses the todos of a list move through.
+// New todos start in the first status; the last one is terminal, and todos
+// in it are completed. Transitions maps a status to the statuses todos may
+// move to from it; todos may move anywhere from statuses it leaves out.
+type Workflow struct {
+	Statuses    []WorkflowStatus
+	Transitions map[string][]string `json:",omitempty"`
+}
+
+// defaultWorkflow applies to todos outside lists and to lists without a
+// workflow of their own.
+var defaultWorkflow = Workflow{Statuses: []WorkflowStatus{{Name: "todo"}, {Name: "done"}}}
+
+// BoardColumn holds the todos of a list in one status, in manual order.
+// OverLimit reports more todos than the WIP limit, which happens when the
+// limit is lowered or todos are completed or moved into the list.
+type BoardColumn struct {
+	Status    string
+	WIPLimit  int `json:",omitempty"`
+	Count     int
+	OverLimit bool `json:",omitempty"`
+	Todos     []Todo
+}
+
+// Board groups the todos of a list by status, in workflow order.
+type Board struct {
+	ListID  string
+	Columns []BoardColumn
+}
+
+func (w Workflow) initial() string {
+	return w.Statuses[0].Name
+}
+
+func (w Workflow) terminal() string {
+	return w.Statuses[len(w.Statuses)-1].Name
+}
+
+func (w Workflow) status(name string) (WorkflowStatus, bool) {
+	for _, status := range w.Statuses {
+		if status.Name == name {
+			return status, true
+		}
+	}
+	return WorkflowStatus{}, false
+}
+
+func (w Workflow) allows(from, to string) bool {
+	targets, restricted := w.Transitions[from]
+	return !restricted || containsString(targets, to)
+}
+
+// validateWorkflow trims the status names of w and checks that the
+// statuses are unique and that the transitions only name statuses of w.
+func validateWorkflow(w Workflow) (Workflow, error) {
+	if len(w.Statuses) < 2 || len(w.Statuses) > maxWorkflowStatuses {
+		return Workflow{}, ErrInvalidWorkflow
+	}
+	valid := Workflow{Transitions: make(map[string][]string)}
+	for _, status := range w.Statuses {
+		status.Name = strings.TrimSpace(status.Name)
+		if status.Name == "" || len(status.Name) > maxWorkflowStatusLength || status.WIPLimit < 0 {
+			return Workflow{}, ErrInvalidWorkflow
+		}
+		if _, duplicate := valid.status(status.Name); duplicate {
+			return Workflow{}, ErrInvalidWorkflow
+		}
+		valid.Statuses = append(valid.Statuses, status)
+	}
+	for from, targets := range w.Transitions {
+		from = strings.TrimSpace(from)
+		if _, exists := valid.status(from); !exists {
+			return Workflow{}, ErrUnknownStatus
+		}
+		allowed := []string{}
+		for _, to := range targets {
+			to = strings.TrimSpace(to)
+			if _, exists := valid.status(to); !exists {
+				return Workflow{}, ErrUnknownStatus
+			}
+			if !containsString(allowed, to) {
+				allowed = append(allowed, to)
+			}
+		}
+		valid.Transitions[from] = allowed
+	}
+	if len(valid.Transitions) == 0 {
+		valid.Transitions = nil
+	}
+	return valid, nil
+}
+
+// workflow returns the workflow of a list. It must be called with s.mu
+// held.
+func (s *todoService) workflow(listID string) Workflow {
+	if w, exists := s.workflows[listID]; exists {
+		return w
+	}
+	return defaultWorkflow
+}
+
+// fitStatus keeps the status of todo if its workflow has it and otherwise
+// moves it to the terminal status if it is completed and to the initial
+// one if not, then completes the todo if the status is terminal. It must be
+// called with s.mu held.
+func (s *todoService) fitStatus(todo *Todo) {
+	w := s.workflow(todo.ListID)
+	if _, exists := w.status(todo.Status); !exists {
+		todo.Status = w.initial()
+		if todo.Completed {
+			todo.Status = w.terminal()
+		}
+	}
+	todo.Completed = todo.Status == w.terminal()
+}
+
+// countStatus counts the todos of a list in status other than todoID. It
+// must be called with s.mu held.
+func (s *todoService) countStatus(listID, status, todoID string) int {
+	count := 0
+	for _, t := range s.todosById {
+		if t.ListID == listID && t.Status == status && t.ID != todoID {
+			count++
+		}
+	}
+	return count
+}
+
+// GetWorkflow returns the workflow of a list to anyone who can read it.
+func (s *todoService) GetWorkflow(ctx context.Context, userID, listID string) (Workflow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, exists := s.lists[listID]
+	if !exists {
+		return Workflow{}, ErrListNotFound
+	}
+	if s.listRole(list, userID) == "" {
+		return Workflow{}, ErrUnauthorized
+	}
+	return s.workflow(listID), nil
+}
+
+// SetWorkflow replaces the workflow of a list. Only owners may change it.
+// Todos in statuses the new workflow lacks move to its terminal status if
+// they are completed and to its initial one otherwise.
+func (s *todoService) SetWorkflow(ctx context.Context, userID, listID string, workflow Workflow) (Workflow, error) {
+	workflow, err := validateWorkflow(workflow)
+	if err != nil {
+		return Workflow{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, exists := s.lists[listID]
+	if !exists {
+		return Workflow{}, ErrListNotFound
+	}
+	if s.listRole(list, userID) != ListRoleOwner {
+		return Workflow{}, ErrUnauthorized
+	}
+	s.workflows[listID] = workflow
+
+	for _, todo := range s.todosById {
+		if todo.ListID != listID {
+			continue
+		}
+		before := todo
+		s.fitStatus(&todo)
+		if todo.Status != before.Status || todo.Completed != before.Completed {
+			s.storeTodo(todo)
+			s.record(todo, userID, TodoTransitioned)
+		}
+	}
+	return workflow, nil
+}
+
+// TransitionTodo moves a todo to another status of its workflow. Editors
+// may make the transitions the workflow allows, into statuses below their
+// WIP limit. Moving a todo to the terminal status completes it, unless it
+// is blocked, and moving it out reopens it.
+func (s *todoService) TransitionTodo(ctx context.Context, userID, todoID, status string) (Todo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	todo, exists := s.todosById[todoID]
+	if !exists {
+		return Todo{}, ErrTodoNotFound
+	}
+	if !canEdit(s.todoRole(todo, userID)) {
+		return Todo{}, ErrUnauthorized
+	}
+	w := s.workflow(todo.ListID)
+	target, exists := w.status(strings.TrimSpace(status))
+	if !exists {
+		return Todo{}, ErrUnknownStatus
+	}
+	if target.Name == todo.Status {
+		return todo, nil
+	}
+	if !w.allows(todo.Status, target.Name) {
+		return Todo{}, ErrTransitionNotAllowed
+	}
+	if target.WIPLimit > 0 && s.countStatus(todo.ListID, target.Name, todo.ID) >= target.WIPLimit {
+		return Todo{}, ErrWIPLimitReached
+	}
+	if target.Name == w.terminal() && !s.canComplete(todo) {
+		return Todo{}, ErrTodoBlocked
+	}
+
+	todo.Status = target.Name
+	todo.Completed = target.Name == w.terminal()
+	s.storeTodo(todo)
+	s.record(todo, userID, TodoTransitioned)
+
+	return todo, nil
+}
+
+// ListBoard returns the board of a list to anyone who can read it.
+func (s *todoService) ListBoard(ctx context.Context, userID, listID string) (Board, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list, exists := s.lists[listID]
+	if !exists {
+		return Board{}, ErrListNotFound
+	}
+	if s.listRole(list, userID) == "" {
+		return Board{}, ErrUnauthorized
+	}
+
+	w := s.workflow(listID)
+	board := Board{ListID: listID, Columns: make([]BoardColumn, len(w.Statuses))}
+	columns := make(map[string]*BoardColumn, len(w.Statuses))
+	for i, status := range w.Statuses {
+		board.Columns[i] = BoardColumn{Status: status.Name, WIPLimit: status.WIPLimit, Todos: []Todo{}}
+		columns[status.Name] = &board.Columns[i]
+	}
+	for _, todo := range s.todosById {
+		if column, exists := columns[todo.Status]; exists && todo.ListID == listID {
+			column.Todos = append(column.Todos, todo)
+		}
+	}
+	for i := range board.Columns {
+		column := &board.Columns[i]
+		sortByRank(column.Todos)
+		column.Count = len(column.Todos)
+		column.OverLimit = column.WIPLimit > 0 && column.Count > column.WIPLimit
+	}
+	return board, nil
+}
@@ -0,0 +1,179 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+)
+
+type getWorkflowRequest struct {
+	ListID string `json:"-"`
+}
+
+type workflowStatusRequest struct {
+	Name     string `json:"name"`
+	WIPLimit int    `json:"wip_limit,omitempty"`
+}
+
+type setWorkflowRequest struct {
+	ListID      string                  `json:"-"`
+	Statuses    []workflowStatusRequest `json:"statuses"`
+	Transitions map[string][]string     `json:"transitions,omitempty"`
+}
+
+type workflowResponse struct {
+	Workflow *Workflow `json:"workflow,omitempty"`
+	Err      string    `json:"error,omitempty"`
+}
+
+func makeGetWorkflowEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getWorkflowRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		workflow, err := svc.GetWorkflow(ctx, userID, req.ListID)
+		if err != nil {
+			return workflowResponse{Err: err.Error()}, nil
+		}
+		return workflowResponse{Workflow: &workflow}, nil
+	}
+}
+
+func makeSetWorkflowEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(setWorkflowRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		workflow := Workflow{Transitions: req.Transitions}
+		for _, status := range req.Statuses {
+			workflow.Statuses = append(workflow.Statuses, WorkflowStatus{Name: status.Name, WIPLimit: status.WIPLimit})
+		}
+		workflow, err := svc.SetWorkflow(ctx, userID, req.ListID, workflow)
+		if err != nil {
+			return workflowResponse{Err: err.Error()}, nil
+		}
+		return workflowResponse{Workflow: &workflow}, nil
+	}
+}
+
+type transitionTodoRequest struct {
+	TodoID string `json:"-"`
+	Status string `json:"status"`
+}
+
+func makeTransitionTodoEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(transitionTodoRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		todo, err := svc.TransitionTodo(ctx, userID, req.TodoID, req.Status)
+		if err != nil {
+			return updateTodoResponse{Err: err.Error()}, nil
+		}
+		return updateTodoResponse{Todo: &todo}, nil
+	}
+}
+
+type listBoardRequest struct {
+	ListID string `json:"-"`
+}
+
+type listBoardResponse struct {
+	Board *Board `json:"board,omitempty"`
+	Err   string `json:"error,omitempty"`
+}
+
+func makeListBoardEndpoint(svc TodoService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listBoardRequest)
+		userID, ok := UserIDFromContext(ctx)
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		board, err := svc.ListBoard(ctx, userID, req.ListID)
+		if err != nil {
+			return listBoardResponse{Err: err.Error()}, nil
+		}
+		return listBoardResponse{Board: &board}, nil
+	}
+}
+
+func decodeGetWorkflowRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return getWorkflowRequest{ListID: mux.Vars(r)["id"]}, nil
+}
+
+func decodeSetWorkflowRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req setWorkflowRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.ListID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func decodeTransitionTodoRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req transitionTodoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	req.TodoID = mux.Vars(r)["id"]
+	return req, nil
+}
+
+func decodeListBoardRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return listBoardRequest{ListID: mux.Vars(r)["id"]}, nil
+}
+
+func MakeGetWorkflowHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.GetWorkflowEndpoint,
+		decodeGetWorkflowRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeSetWorkflowHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.SetWorkflowEndpoint,
+		decodeSetWorkflowRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeTransitionTodoHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.TransitionTodoEndpoint,
+		decodeTransitionTodoRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
+
+func MakeListBoardHandler(endpoints Endpoints) http.Handler {
+	return httptransport.NewServer(
+		endpoints.ListBoardEndpoint,
+		decodeListBoardRequest,
+		encodeResponse,
+		serverOptions(
+			httptransport.ServerBefore(populateAuthToken),
+		)...,
+	)
+}
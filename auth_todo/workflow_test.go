@@ -0,0 +1,188 @@
+package auth_todo
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestWorkflow(t *testing.T) {
+	ctx := context.Background()
+	broker := NewEventBroker(16)
+	svc := NewEventingTodoMiddleware(broker, NewCachedTodoService(time.Minute, NewTodoService()))
+	listID, _ := svc.CreateList(ctx, "owner", "Sprint")
+	first, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "Design", ListID: listID})
+	second, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "Build", ListID: listID})
+	svc.CompleteTodo(ctx, "owner", second)
+	inv, _ := svc.ShareList(ctx, "owner", listID, "editor@example.com", ListRoleEditor)
+	svc.RespondToInvitation(ctx, "editor", "editor@example.com", inv.ID, true)
+
+	if todo, _ := svc.GetTodo(ctx, "owner", first); todo.Status != "todo" {
+		t.Errorf("Expected the default workflow, got %q", todo.Status)
+	}
+	if _, err := svc.SetWorkflow(ctx, "owner", listID, Workflow{Statuses: []WorkflowStatus{{Name: "a"}, {Name: "a"}}}); err != ErrInvalidWorkflow {
+		t.Errorf("Expected duplicate statuses to be rejected, got %v", err)
+	}
+	kanban := Workflow{
+		Statuses: []WorkflowStatus{{Name: "Backlog"}, {Name: "In Progress", WIPLimit: 1}, {Name: "Review"}, {Name: " Done "}},
+		Transitions: map[string][]string{
+			"Backlog":     {"In Progress"},
+			"In Progress": {"Backlog", "Review"},
+			"Review":      {"In Progress", "Done"},
+		},
+	}
+	if _, err := svc.SetWorkflow(ctx, "editor", listID, kanban); err != ErrUnauthorized {
+		t.Errorf("Expected only owners to change the workflow, got %v", err)
+	}
+	workflow, err := svc.SetWorkflow(ctx, "owner", listID, kanban)
+	if err != nil || workflow.Statuses[3].Name != "Done" {
+		t.Fatalf("SetWorkflow failed: %+v %v", workflow, err)
+	}
+	if todo, _ := svc.GetTodo(ctx, "owner", second); todo.Status != "Done" || !todo.Completed {
+		t.Errorf("Expected the completed todo to move to the terminal status, got %+v", todo)
+	}
+
+	if _, err := svc.TransitionTodo(ctx, "editor", first, "Review"); err != ErrTransitionNotAllowed {
+		t.Errorf("Expected Backlog to Review to be rejected, got %v", err)
+	}
+	if _, err := svc.TransitionTodo(ctx, "editor", first, "Shipped"); err != ErrUnknownStatus {
+		t.Errorf("Expected ErrUnknownStatus, got %v", err)
+	}
+	if _, err := svc.TransitionTodo(ctx, "editor", first, "In Progress"); err != nil {
+		t.Fatalf("TransitionTodo failed: %v", err)
+	}
+	if _, err := svc.TransitionTodo(ctx, "editor", second, "In Progress"); err != ErrWIPLimitReached {
+		t.Errorf("Expected the WIP limit to be enforced, got %v", err)
+	}
+	todo, _ := svc.TransitionTodo(ctx, "editor", second, "Backlog")
+	if todo.Completed {
+		t.Errorf("Expected leaving the terminal status to reopen the todo, got %+v", todo)
+	}
+
+	sub, _, _ := broker.Subscribe("owner", 0)
+	defer sub.Close()
+	svc.TransitionTodo(ctx, "editor", first, "Review")
+	todo, _ = svc.TransitionTodo(ctx, "editor", first, "Done")
+	if !todo.Completed {
+		t.Errorf("Expected the terminal status to complete the todo, got %+v", todo)
+	}
+	if event := <-sub.C; event.Type != TodoUpdated {
+		t.Errorf("Expected an update, got %+v", event)
+	}
+	if event := <-sub.C; event.Type != TodoCompleted {
+		t.Errorf("Expected a completion, got %+v", event)
+	}
+	if todos, _, _ := svc.ListTodos(ctx, "editor", TodoFilter{Completed: &todo.Completed}, 10, 0); len(todos) != 1 {
+		t.Errorf("Expected the completed filter to follow the status, got %+v", todos)
+	}
+
+	svc.TransitionTodo(ctx, "editor", second, "In Progress")
+	svc.CompleteTodo(ctx, "owner", second)
+	svc.MoveTodo(ctx, "owner", second, TodoMove{Before: first})
+	board, err := svc.ListBoard(ctx, "editor", listID)
+	if err != nil {
+		t.Fatalf("ListBoard failed: %v", err)
+	}
+	var counts []int
+	for _, column := range board.Columns {
+		counts = append(counts, column.Count)
+	}
+	if len(counts) != 4 || counts[3] != 2 || board.Columns[3].Todos[0].ID != second || board.Columns[1].WIPLimit != 1 {
+		t.Errorf("Unexpected board %+v", board)
+	}
+	if _, err := svc.ListBoard(ctx, "stranger", listID); err != ErrUnauthorized {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+
+	history, _, _ := svc.TodoHistory(ctx, "owner", first, 10, 0)
+	if last := history[len(history)-1]; last.Action != TodoTransitioned || last.Before.Status != "Review" {
+		t.Errorf("Expected the transition in the history, got %+v", last)
+	}
+}
+
+func TestRevertFollowsWorkflow(t *testing.T) {
+	ctx := context.Background()
+	svc := NewTodoService()
+	listID, _ := svc.CreateList(ctx, "owner", "Sprint")
+	svc.SetWorkflow(ctx, "owner", listID, Workflow{
+		Statuses: []WorkflowStatus{{Name: "Backlog"}, {Name: "In Progress", WIPLimit: 1}, {Name: "Review"}, {Name: "Done"}},
+		Transitions: map[string][]string{
+			"Backlog":     {"In Progress"},
+			"In Progress": {"Backlog", "Review"},
+			"Review":      {"In Progress", "Done"},
+		},
+	})
+	first, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "Design", ListID: listID})
+	second, _ := svc.CreateTodo(ctx, "owner", TodoInput{Text: "Build", ListID: listID})
+	svc.TransitionTodo(ctx, "owner", first, "In Progress")
+	svc.TransitionTodo(ctx, "owner", first, "Review")
+	svc.TransitionTodo(ctx, "owner", second, "In Progress")
+
+	if _, err := svc.RevertTodo(ctx, "owner", first, 1); err != ErrTransitionNotAllowed {
+		t.Errorf("Expected Review to Backlog to be rejected, got %v", err)
+	}
+	if _, err := svc.RevertTodo(ctx, "owner", first, 2); err != ErrWIPLimitReached {
+		t.Errorf("Expected the WIP limit to be enforced, got %v", err)
+	}
+	svc.TransitionTodo(ctx, "owner", second, "Backlog")
+	if todo, err := svc.RevertTodo(ctx, "owner", first, 2); err != nil || todo.Status != "In Progress" {
+		t.Errorf("Expected the revert to be allowed, got %+v %v", todo, err)
+	}
+}
+
+func TestBoardEndpoints(t *testing.T) {
+	ctx := context.Background()
+	authSvc := NewAuthService(WithPasswordCost(bcrypt.MinCost))
+	authSvc.Signup(ctx, "owner@example.com", "password123")
+	session, _ := authSvc.Login(ctx, "owner@example.com", "password123")
+	server := httptest.NewServer(MakeHTTPHandler(MakeEndpoints(authSvc, NewTodoService(), NewEventBroker(16), nil)))
+	defer server.Close()
+
+	do := func(method, path, body string) map[string]interface{} {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+session)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		result := make(map[string]interface{})
+		json.NewDecoder(resp.Body).Decode(&result)
+		return result
+	}
+
+	listID := do("POST", "/v1/lists", `{"name":"Sprint"}`)["list_id"].(string)
+	body := do("PUT", "/v1/lists/"+listID+"/workflow",
+		`{"statuses":[{"name":"Backlog"},{"name":"Doing","wip_limit":2},{"name":"Done"}],"transitions":{"Backlog":["Doing"]}}`)
+	if body["error"] != nil {
+		t.Fatalf("Setting the workflow failed: %v", body)
+	}
+	todoID := do("POST", "/v1/todos", `{"text":"Ship","list_id":"`+listID+`"}`)["todo_id"].(string)
+
+	body = do("POST", "/v1/todos/"+todoID+"/transition", `{"status":"Done"}`)
+	if body["error"] != ErrTransitionNotAllowed.Error() {
+		t.Errorf("Expected the transition to be rejected, got %v", body)
+	}
+	body = do("POST", "/v1/todos/"+todoID+"/transition", `{"status":"Doing"}`)
+	if todo, _ := body["todo"].(map[string]interface{}); todo["Status"] != "Doing" {
+		t.Errorf("Expected the todo to be in progress, got %v", body)
+	}
+
+	board := do("GET", "/v1/lists/"+listID+"/board", "")["board"].(map[string]interface{})
+	columns := board["Columns"].([]interface{})
+	doing := columns[1].(map[string]interface{})
+	if len(columns) != 3 || doing["Count"] != 1.0 || doing["WIPLimit"] != 2.0 {
+		t.Errorf("Unexpected board %v", board)
+	}
+	workflow := do("GET", "/v1/lists/"+listID+"/workflow", "")["workflow"].(map[string]interface{})
+	if len(workflow["Statuses"].([]interface{})) != 3 {
+		t.Errorf("Unexpected workflow %v", workflow)
+	}
+}
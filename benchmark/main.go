@@ -38,17 +38,51 @@ func main() {
 	loginResult := benchmarkLogin(baseURL, concurrency, totalRequests)
 	printResults(loginResult)
 
+	// The todo endpoints require a token; log in once and reuse it.
+	token, err := login(baseURL)
+	if err != nil {
+		fmt.Printf("\nCannot log in for the todo benchmarks: %v\n", err)
+		return
+	}
+
 	fmt.Println("\n=== Create Todo Benchmark ===")
-	createTodoResult := benchmarkCreateTodo(baseURL, concurrency, totalRequests)
+	createTodoResult := benchmarkCreateTodo(baseURL, token, concurrency, totalRequests)
 	printResults(createTodoResult)
 
 	fmt.Println("\n=== List Todos Benchmark ===")
-	listTodosResult := benchmarkListTodos(baseURL, concurrency, totalRequests)
+	listTodosResult := benchmarkListTodos(baseURL, token, concurrency, totalRequests)
 	printResults(listTodosResult)
 }
 
+// login returns a session token of the benchmark user, signing it up if
+// needed.
+func login(baseURL string) (string, error) {
+	credentials := []byte(`{"email":"bench@example.com","password":"pass123"}`)
+	if resp, err := http.Post(baseURL+"/v1/signup", "application/json", bytes.NewBuffer(credentials)); err == nil {
+		resp.Body.Close()
+	}
+
+	resp, err := http.Post(baseURL+"/v1/login", "application/json", bytes.NewBuffer(credentials))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Token string `json:"token"`
+		Err   string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if result.Token == "" {
+		return "", fmt.Errorf("login failed: %s (%s)", result.Err, resp.Status)
+	}
+	return result.Token, nil
+}
+
 func benchmarkSignup(baseURL string, concurrency, totalRequests int) BenchmarkResult {
-	return runBenchmark(baseURL+"/signup", "POST", func(i int) []byte {
+	return runBenchmark(baseURL+"/v1/signup", "POST", "", func(i int) []byte {
 		data := map[string]string{
 			"email":    fmt.Sprintf("user%d@example.com", i),
 			"password": "password123",
@@ -59,9 +93,9 @@ func benchmarkSignup(baseURL string, concurrency, totalRequests int) BenchmarkRe
 }
 
 func benchmarkLogin(baseURL string, concurrency, totalRequests int) BenchmarkResult {
-	http.Post(baseURL+"/signup", "application/json", bytes.NewBuffer([]byte(`{"email":"bench@example.com","password":"pass123"}`)))
+	http.Post(baseURL+"/v1/signup", "application/json", bytes.NewBuffer([]byte(`{"email":"bench@example.com","password":"pass123"}`)))
 
-	return runBenchmark(baseURL+"/login", "POST", func(i int) []byte {
+	return runBenchmark(baseURL+"/v1/login", "POST", "", func(i int) []byte {
 		data := map[string]string{
 			"email":    "bench@example.com",
 			"password": "pass123",
@@ -71,24 +105,25 @@ func benchmarkLogin(baseURL string, concurrency, totalRequests int) BenchmarkRes
 	}, concurrency, totalRequests)
 }
 
-func benchmarkCreateTodo(baseURL string, concurrency, totalRequests int) BenchmarkResult {
-	return runBenchmark(baseURL+"/todos", "POST", func(i int) []byte {
+func benchmarkCreateTodo(baseURL, token string, concurrency, totalRequests int) BenchmarkResult {
+	return runBenchmark(baseURL+"/v1/todos", "POST", token, func(i int) []byte {
 		data := map[string]string{
-			"user_id": "user_1",
-			"text":    fmt.Sprintf("Todo item %d", i),
+			"text": fmt.Sprintf("Todo item %d", i),
 		}
 		body, _ := json.Marshal(data)
 		return body
 	}, concurrency, totalRequests)
 }
 
-func benchmarkListTodos(baseURL string, concurrency, totalRequests int) BenchmarkResult {
-	return runBenchmark(baseURL+"/todos?user_id=user_1&limit=50&offset=0", "GET", func(i int) []byte {
+func benchmarkListTodos(baseURL, token string, concurrency, totalRequests int) BenchmarkResult {
+	return runBenchmark(baseURL+"/v1/todos?limit=50&offset=0", "GET", token, func(i int) []byte {
 		return nil
 	}, concurrency, totalRequests)
 }
 
-func runBenchmark(url, method string, bodyGenerator func(int) []byte, concurrency, totalRequests int) BenchmarkResult {
+// runBenchmark sends totalRequests requests from concurrency workers. A
+// non-empty token is sent as a bearer token.
+func runBenchmark(url, method, token string, bodyGenerator func(int) []byte, concurrency, totalRequests int) BenchmarkResult {
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 
@@ -127,6 +162,9 @@ func runBenchmark(url, method string, bodyGenerator func(int) []byte, concurrenc
 					mu.Unlock()
 					continue
 				}
+				if token != "" {
+					req.Header.Set("Authorization", "Bearer "+token)
+				}
 
 				resp, err := client.Do(req)
 				latency := time.Since(requestStart)
@@ -3,6 +3,12 @@ docker tag todo-microservice:latest YOUR_DOCKER_USERNAME/todo-microservice:lates
 docker push YOUR_DOCKER_USERNAME/todo-microservice:latest
 
 kubectl apply -f k8s/namespace.yaml
+kubectl create secret generic todo-microservice-smtp -n todo-microservice \
+  --from-literal=addr=YOUR_SMTP_HOST:587 \
+  --from-literal=username=YOUR_SMTP_USERNAME \
+  --from-literal=password=YOUR_SMTP_PASSWORD \
+  --from-literal=from=noreply@YOUR_DOMAIN \
+  --dry-run=client -o yaml | kubectl apply -f -
 kubectl apply -f k8s/deployment.yaml
 kubectl apply -f k8s/service.yaml
 
@@ -1,17 +1,21 @@
 package main
 
 import (
+	"context"
+	"net"
 	"net/http"
+	"net/smtp"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"todo-microservice/auth_todo"
 
 	kitprometheus "github.com/go-kit/kit/metrics/prometheus"
 	kitlog "github.com/go-kit/log"
-	"github.com/gorilla/mux"
 	stdprometheus "github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
@@ -49,29 +53,159 @@ func main() {
 		Help:      "Total duration of requests in microseconds.",
 	}, fieldKeys)
 
+	rateLimitRejected := kitprometheus.NewCounterFrom(stdprometheus.CounterOpts{
+		Namespace: "auth_todo",
+		Subsystem: "rate_limit",
+		Name:      "rejected_count",
+		Help:      "Number of requests rejected by the rate limiter.",
+	}, []string{"endpoint", "key"})
+
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "noreply@localhost"
+	}
+	var (
+		mailer auth_todo.Mailer
+		err    error
+	)
+	switch {
+	case os.Getenv("SMTP_ADDR") != "":
+		addr := os.Getenv("SMTP_ADDR")
+		var auth smtp.Auth
+		if username := os.Getenv("SMTP_USERNAME"); username != "" {
+			host, _, _ := net.SplitHostPort(addr)
+			auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+		}
+		mailer = auth_todo.NewSMTPMailer(addr, mailFrom, auth)
+	case os.Getenv("MAIL_OUTBOX") != "":
+		mailer, err = auth_todo.NewFileMailer(os.Getenv("MAIL_OUTBOX"), mailFrom)
+		if err != nil {
+			logger.Log("msg", "cannot create mail outbox", "err", err)
+			os.Exit(1)
+		}
+	case os.Getenv("MAIL_LOG") == "true":
+		mailer = auth_todo.NewLogMailer(logger)
+	default:
+		logger.Log("msg", "no mailer configured; set SMTP_ADDR or MAIL_OUTBOX, or MAIL_LOG=true for development")
+		os.Exit(1)
+	}
+	mailer = auth_todo.NewLoggingMailer(logger, mailer)
+
+	authOptions := []auth_todo.AuthOption{
+		auth_todo.WithMailer(mailer, os.Getenv("APP_URL")),
+		auth_todo.WithLoginEventHook(func(event auth_todo.LoginEvent) {
+			logger.Log("msg", "login security event", "event", event.Type, "email", event.Email, "ip", event.IP, "failures", event.Failures, "until", event.Until)
+		}),
+	}
+	if issuer := os.Getenv("MFA_ISSUER"); issuer != "" {
+		authOptions = append(authOptions, auth_todo.WithMFAIssuer(issuer))
+	}
+	if emails := os.Getenv("ADMIN_EMAILS"); emails != "" {
+		authOptions = append(authOptions, auth_todo.WithAdminEmails(strings.Split(emails, ",")...))
+	}
+	if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+		authOptions = append(authOptions, auth_todo.WithOIDC(auth_todo.OIDCConfig{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+		}))
+	}
+
 	var authSvc auth_todo.AuthService
-	authSvc = auth_todo.NewAuthService()
+	authSvc = auth_todo.NewAuthService(authOptions...)
+	if path := os.Getenv("AUDIT_LOG"); path != "" {
+		maxSize, _ := strconv.ParseInt(os.Getenv("AUDIT_LOG_MAX_SIZE"), 10, 64)
+		backups, err := strconv.Atoi(os.Getenv("AUDIT_LOG_BACKUPS"))
+		if err != nil {
+			backups = -1
+		}
+		audit, err := auth_todo.NewFileAuditLogger(path, maxSize, backups)
+		if err != nil {
+			logger.Log("msg", "cannot open security audit log", "err", err)
+			os.Exit(1)
+		}
+		if err := audit.Verify(context.Background()); err != nil {
+			logger.Log("msg", "security audit log failed verification", "err", err)
+		}
+		authSvc = auth_todo.NewAuditingAuthMiddleware(audit, logger, authSvc)
+	}
 	authSvc = auth_todo.NewLoggingAuthMiddleware(logger, authSvc)
 	authSvc = auth_todo.NewInstrumentingAuthMiddleware(authRequestCount, authRequestLatency, authSvc)
 
+	broker := auth_todo.NewEventBroker(256)
+
+	todoOptions := []auth_todo.TodoOption{
+		auth_todo.WithInvitationHook(auth_todo.InvitationMailer(mailer, os.Getenv("APP_URL"))),
+	}
+	var blobs auth_todo.BlobStore
+	switch {
+	case os.Getenv("S3_ENDPOINT") != "":
+		blobs, err = auth_todo.NewS3BlobStore(auth_todo.S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	case os.Getenv("ATTACHMENT_DIR") != "":
+		blobs, err = auth_todo.NewLocalBlobStore(os.Getenv("ATTACHMENT_DIR"))
+	}
+	if err != nil {
+		logger.Log("msg", "cannot create attachment store", "err", err)
+		os.Exit(1)
+	}
+	if blobs != nil {
+		quota, _ := strconv.ParseInt(os.Getenv("ATTACHMENT_QUOTA"), 10, 64)
+		todoOptions = append(todoOptions, auth_todo.WithAttachments(blobs, quota))
+	}
+	if os.Getenv("ALLOW_BLOCKED_COMPLETION") == "true" {
+		todoOptions = append(todoOptions, auth_todo.WithBlockedCompletion())
+	}
+
 	var todoSvc auth_todo.TodoService
-	todoSvc = auth_todo.NewTodoService()
+	todoSvc = auth_todo.NewTodoService(todoOptions...)
+	if os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true" {
+		todoSvc = auth_todo.NewVerifiedEmailTodoMiddleware(authSvc, todoSvc)
+	}
 	todoSvc = auth_todo.NewCachedTodoService(30*time.Second, todoSvc)
+	todoSvc = auth_todo.NewEventingTodoMiddleware(broker, todoSvc)
 	todoSvc = auth_todo.NewLoggingTodoMiddleware(logger, todoSvc)
 	todoSvc = auth_todo.NewInstrumentingTodoMiddleware(todoRequestCount, todoRequestLatency, todoSvc)
 
-	endpoints := auth_todo.MakeEndpoints(authSvc, todoSvc)
-
-	r := mux.NewRouter()
-
-	r.Handle("/signup", auth_todo.MakeSignupHandler(endpoints)).Methods("POST")
-	r.Handle("/login", auth_todo.MakeLoginHandler(endpoints)).Methods("POST")
-	r.Handle("/validate", auth_todo.MakeValidateTokenHandler(endpoints)).Methods("POST", "GET")
-	r.Handle("/todos", auth_todo.MakeCreateTodoHandler(endpoints)).Methods("POST")
-	r.Handle("/todos", auth_todo.MakeListTodosHandler(endpoints)).Methods("GET")
-	r.Handle("/todos/{id}/complete", auth_todo.MakeCompleteTodoHandler(endpoints)).Methods("POST")
-
-	r.Handle("/metrics", promhttp.Handler())
+	rateLimitConfig := auth_todo.DefaultRateLimitConfig()
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		rateLimitConfig.TrustedProxies = strings.Split(proxies, ",")
+	}
+	rateLimiter := auth_todo.NewLocalRateLimiter(10000)
+	if addr := os.Getenv("REDIS_ADDR"); addr != "" {
+		client := redis.NewClient(&redis.Options{
+			Addr:         addr,
+			DialTimeout:  200 * time.Millisecond,
+			ReadTimeout:  100 * time.Millisecond,
+			WriteTimeout: 100 * time.Millisecond,
+		})
+		rateLimiter = auth_todo.NewFallbackRateLimiter(
+			auth_todo.NewRedisRateLimiter(client, "auth_todo:ratelimit:"),
+			rateLimiter,
+			10*time.Second,
+			logger,
+		)
+	}
+	rateLimits, err := auth_todo.NewRateLimits(rateLimitConfig, rateLimiter, rateLimitRejected)
+	if err != nil {
+		logger.Log("msg", "invalid rate limit configuration", "err", err)
+		os.Exit(1)
+	}
+	if os.Getenv("RATE_LIMIT_DISABLED") == "true" {
+		// Without policies nothing is limited, but the trusted proxies still
+		// resolve the client IP for authentication and the audit log.
+		rateLimits, _ = auth_todo.NewRateLimits(auth_todo.RateLimitConfig{TrustedProxies: rateLimitConfig.TrustedProxies}, rateLimiter, rateLimitRejected)
+	}
+
+	endpoints := auth_todo.MakeEndpoints(authSvc, todoSvc, broker, rateLimits)
+
+	r := auth_todo.MakeHTTPHandler(endpoints)
 
 	logger.Log("msg", "HTTP server started", "addr", ":8080")
 	http.ListenAndServe(":8080", r)